@@ -0,0 +1,400 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/bot/notification"
+	"Crawlzilla/services/crawl_runs"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/queue"
+	"Crawlzilla/services/crawler/source"
+	"Crawlzilla/services/dedup"
+	"Crawlzilla/services/fill_rates"
+	"Crawlzilla/services/images"
+	"Crawlzilla/services/pages"
+	"Crawlzilla/utils"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type CrawlerState struct {
+	SuccessAdCount  int
+	FailAdCount     int
+	DiscoveredCount int
+	// Counters of this process, a resumed run does not restore them
+	PagesScrolled  int
+	InsertedCount  int
+	UpdatedCount   int
+	DuplicateCount int
+	FailureCounts  map[models.FailureKind]int
+	Resumed        bool
+	Mode           string
+	KnownCount     int // Known listings an incremental run skipped
+	RecoveryCount  int // Browser restarts during discovery
+	// Results reported by the workers of the shared queue, by worker
+	Workers map[string]queue.WorkerStats
+
+	runID             string           // Crawl run the archived pages belong to
+	fill              fill_rates.Tally // Fields left empty in the saved ads
+	resumedDiscovered int
+	checkpoint        models.Checkpoint
+	mu                sync.Mutex // To avoid race conditions
+}
+
+// fillRun copies the counters of this process to run, the caller must hold state.mu
+func (state *CrawlerState) fillRun(run *models.CrawlRun) {
+	run.Status = state.checkpoint.Status
+	run.Resumed = state.Resumed
+	run.Mode = state.Mode
+	run.KnownCount = state.KnownCount
+	run.RecoveryCount = state.RecoveryCount
+	run.PagesScrolled = state.PagesScrolled
+	run.DiscoveredCount = state.DiscoveredCount - state.resumedDiscovered
+	run.InsertedCount = state.InsertedCount
+	run.UpdatedCount = state.UpdatedCount
+	run.DuplicateCount = state.DuplicateCount
+	run.SetFailures(state.FailureCounts)
+}
+
+func worker(ctx context.Context, src source.Source, jobs <-chan source.Job, maxAdCount int, retry retryPolicy, state *CrawlerState, wg *sync.WaitGroup, cancel context.CancelFunc) {
+	defer wg.Done()
+
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	for {
+		select {
+		case job, ok := <-jobs:
+			if !ok {
+				// Jobs channel closed, exit worker
+				return
+			}
+
+			crawlerLogger.Info("Scraping Ad Number", zap.String("source", src.Name()), zap.Int("successAdCounter", state.SuccessAdCount+1))
+			data, saved, err := scrapeJob(ctx, src, job, retry, state.runID)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				state.mu.Lock()
+				state.FailAdCount++
+				if state.FailureCounts == nil {
+					state.FailureCounts = make(map[models.FailureKind]int)
+				}
+				state.FailureCounts[source.Classify(err)]++
+				state.saveCheckpoint(ctx)
+				state.mu.Unlock()
+				continue
+			}
+
+			// Increment the counter and check if we reached maxAdCount
+			state.mu.Lock()
+			state.SuccessAdCount++
+			state.fill.Add(job.URL, fill_rates.EmptyFields(data))
+			switch saved {
+			case repositories.AdInserted:
+				state.InsertedCount++
+			case repositories.AdUpdated:
+				state.UpdatedCount++
+			case repositories.AdUnchanged:
+				state.DuplicateCount++
+			}
+			state.saveCheckpoint(ctx)
+			if state.SuccessAdCount >= maxAdCount {
+				state.mu.Unlock()
+				cancel() // Trigger context cancellation
+				return
+			}
+			state.mu.Unlock()
+
+		case <-ctx.Done():
+			// Context canceled, exit worker
+			crawlerLogger.Info("worker received shutdown signal, stopping...")
+			return
+		}
+	}
+}
+
+// scrapeJob scrapes a listing and saves its ad, retrying transient failures of either step.
+// A job that fails for good goes to the dead letters, a job cut off by ctx is left pending
+// in the frontier for the next run. It returns the ad as it was parsed from the page.
+func scrapeJob(ctx context.Context, src source.Source, job source.Job, retry retryPolicy, runID string) (models.Ads, repositories.AdSaveResult, error) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+	databaseLogger, _ := configLogger("database")
+	archive := pages.FromContext(ctx)
+
+	markFrontier(ctx, src, job, models.FrontierInProgress, nil)
+
+	var data, parsed models.Ads
+	var id string
+	var saved repositories.AdSaveResult
+	scrapCtx, recorder := withRecorder(ctx, archive)
+	onRetry := func(attempt int, err error) {
+		crawlerLogger.Warn("retrying failed ad", zap.String("source", src.Name()), zap.String("url", job.URL), zap.String("kind", string(source.Classify(err))), zap.Int("attempt", attempt), zap.Error(err))
+	}
+	attempts, err := retry.run(ctx, func() (err error) {
+		data, err = src.Scrap(scrapCtx, job)
+		return err
+	}, onRetry)
+	// Saving fills in the stored fields, the fill rates are about what the page had
+	parsed = data
+	if ctx.Err() == nil {
+		// Keep the raw page, a wrong field can then be traced to the page or to the parser
+		archivePage(ctx, archive, src, runID, job, recorder, err)
+	}
+	if err == nil {
+		var saveAttempts int
+		saveAttempts, err = retry.run(ctx, func() (err error) {
+			id, saved, err = repositories.UpsertAd(database.DB, &data)
+			return source.Fail(models.FailureDatabase, err)
+		}, onRetry)
+		attempts += saveAttempts - 1
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			// Scrape was cut off by shutdown, leave the URL for the next run
+			markFrontier(ctx, src, job, models.FrontierPending, nil)
+			return data, "", err
+		}
+		crawlerLogger.Warn("ad failed, moved to dead letters", zap.String("source", src.Name()), zap.String("url", job.URL), zap.String("kind", string(source.Classify(err))), zap.Int("attempts", attempts), zap.Error(err))
+		markFrontier(ctx, src, job, models.FrontierFailed, err)
+		deadLetter(ctx, src, job, attempts, err)
+		return data, "", err
+	}
+
+	databaseLogger.Info("saved to db successfully", zap.String("Ad ID", id), zap.String("result", string(saved)))
+	markFrontier(ctx, src, job, models.FrontierDone, nil)
+	// The URL may have failed in an earlier run
+	if err := repositories.RemoveDeadLetter(database.DB, src.Name(), job.URL); err != nil {
+		databaseLogger.Error("Error removing dead letter:", zap.String("url", job.URL), zap.Error(err))
+	}
+	// Keep local copies of the photos, they vanish from the CDN with the listing
+	if archived, err := images.ArchiveAdImages(ctx, database.DB, images.FromContext(ctx), id); err != nil {
+		crawlerLogger.Warn("Error archiving ad images", zap.String("Ad ID", id), zap.Int("archived", archived), zap.Error(err))
+	}
+	// Group the ad with the copies of the same property on this and other sites
+	if _, err := dedup.AssignCluster(database.DB, id); err != nil {
+		databaseLogger.Error("Error assigning duplicate cluster:", zap.String("Ad ID", id), zap.Error(err))
+	}
+	return parsed, saved, nil
+}
+
+// StartCrawler feeds the listings discovered by src to a pool of workers until
+// MAX_AD_COUNT ads are scraped, discovery finishes or ctx is canceled.
+// Pending URLs of the frontier are scraped first. If the previous run was cut off
+// they are all that is scraped, discovery only runs when nothing is left to resume.
+func StartCrawler(ctx context.Context, src source.Source, state *CrawlerState) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	crawlerLogger.Info("crawler started successfully", zap.String("source", src.Name()))
+
+	jobs := make(chan source.Job)
+	var wg sync.WaitGroup
+
+	// Get maxAdCount from the target or environment
+	maxAdCount, err := source.MaxAds(ctx)
+	if err != nil {
+		log.Printf("Error reading MAX_AD_COUNT from .env: %v", err)
+		crawlerLogger.Error("Error reading MAX_AD_COUNT from .env:", zap.Error(err))
+	}
+
+	// Get worker count and tab recycling from environment
+	numWorkers, maxTabPages := workersFromEnv(crawlerLogger)
+
+	// Transient failures are retried, the rest go to the dead letters
+	retry := retryPolicyFromEnv()
+
+	pending, resume := loadCheckpoint(ctx, src, state)
+
+	state.mu.Lock()
+	state.Mode = crawlModeFromEnv()
+	state.mu.Unlock()
+
+	// Create a cancellable context for controlled shutdown
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Count the listing pages discovery loads
+	ctx = context.WithValue(ctx, "page_reporter", source.PageReporter(func() {
+		state.mu.Lock()
+		state.PagesScrolled++
+		state.mu.Unlock()
+	}))
+
+	// Count the browser restarts of discovery
+	ctx = context.WithValue(ctx, "recovery_reporter", source.RecoveryReporter(func() {
+		state.mu.Lock()
+		state.RecoveryCount++
+		state.mu.Unlock()
+	}))
+
+	// An incremental run skips the listings it already has and stops at a run of them
+	if state.Mode == CrawlModeIncremental {
+		ctx = context.WithValue(ctx, "incremental", newIncremental(ctx, src, state))
+	}
+
+	// Workers lease Chrome tabs from a pool with a tab per worker
+	pool := browser.NewPool(ctx, numWorkers, maxTabPages)
+	defer pool.Close()
+	ctx = context.WithValue(ctx, "browser_pool", pool)
+
+	// Launch workers, or hand the jobs to the workers of the shared queue
+	if q, ok := queue.FromContext(ctx); ok {
+		wg.Add(1)
+		go distribute(ctx, q, src, jobs, maxAdCount, state, &wg, cancel)
+	} else {
+		for i := 0; i < numWorkers; i++ {
+			wg.Add(1)
+			go worker(ctx, src, jobs, maxAdCount, retry, state, &wg, cancel)
+		}
+	}
+
+	// Start a goroutine to fetch URLs and send them to the jobs channel
+	discovered := make(chan struct{})
+	go func() {
+		defer close(discovered)
+		defer close(jobs)
+		if !resumePending(ctx, pending, jobs) {
+			return
+		}
+		if resume && len(pending) > 0 {
+			crawlerLogger.Info("resumed pending frontier, skipping discovery", zap.String("source", src.Name()), zap.Int("pending", len(pending)))
+			return
+		}
+		discover(ctx, src, state, jobs)
+	}()
+
+	// Wait until workers drain the jobs or the context is canceled
+	wg.Wait()
+	// Discovery may still be adding a URL to the frontier, the next run must see it
+	cancel()
+	<-discovered
+
+	// A run stopped by its parent context was interrupted and is resumed next time
+	state.mu.Lock()
+	if parent.Err() != nil {
+		state.checkpoint.Status = models.CheckpointInterrupted
+	} else {
+		state.checkpoint.Status = models.CheckpointFinished
+	}
+	state.saveCheckpoint(context.WithoutCancel(parent))
+	state.mu.Unlock()
+	crawlerLogger.Info("crawler stopped, closing down...", zap.String("source", src.Name()))
+}
+
+// workersFromEnv reads MAX_WORKERS and MAX_TAB_PAGES, the pages a tab loads before it is recycled
+func workersFromEnv(crawlerLogger *zap.Logger) (numWorkers int, maxTabPages int) {
+	numWorkers, err := strconv.Atoi(os.Getenv("MAX_WORKERS"))
+	if err != nil || numWorkers < 1 {
+		crawlerLogger.Warn("Invalid MAX_WORKERS in .env, using a single worker", zap.Error(err))
+		numWorkers = 1
+	}
+	maxTabPages, err = strconv.Atoi(os.Getenv("MAX_TAB_PAGES"))
+	if err != nil {
+		crawlerLogger.Warn("Invalid MAX_TAB_PAGES in .env, tabs are not recycled by page count", zap.Error(err))
+	}
+	return numWorkers, maxTabPages
+}
+
+// RunCrawler runs a crawl of src, or of the target in ctx, records it as a crawl run,
+// reports its stats to the super admin and returns the run
+func RunCrawler(ctx context.Context, src source.Source) models.CrawlRun {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	databaseLogger, _ := configLogger("database")
+
+	// Create shared state for success and fail counts
+	state := &CrawlerState{}
+
+	// Store the run up front, so a process killed midway still leaves a record
+	run := models.CrawlRun{Reference: src.Name(), Status: models.CheckpointRunning, StartedAt: time.Now()}
+	if target, ok := source.TargetFromContext(ctx); ok {
+		run.Target = target.Name
+	}
+	if err := repositories.CreateCrawlRun(database.DB, &run); err != nil {
+		databaseLogger.Error("Error creating crawl run:", zap.Error(err))
+	}
+	state.runID = run.ID
+
+	stats := utils.MeasureExecution(func() { StartCrawler(ctx, src, state) })
+
+	// Access shared state after crawler finishes
+	state.mu.Lock()
+	state.fillRun(&run)
+	successAdCount := state.SuccessAdCount
+	failAdCount := state.FailAdCount
+	workers := state.Workers
+	fill := state.fill
+	state.mu.Unlock()
+
+	run.FinishedAt = stats.EndTime
+	run.CPUPercent = stats.CPUPercent
+	run.AllocatedMB = int64(stats.AllocatedMB)
+	run.InUseMB = int64(stats.InUseMB)
+	if err := repositories.SaveCrawlRun(database.DB, &run); err != nil {
+		databaseLogger.Error("Error saving crawl run:", zap.Error(err))
+	}
+
+	metrics := fmt.Sprintf("Source: %v\n", src.Name())
+	if run.Target != "" {
+		metrics += fmt.Sprintf("Target: %v\n", run.Target)
+	}
+	metrics += fmt.Sprintf("Run Status: %v\nMode: %v\n", run.Status, run.Mode) + stats.String() +
+		fmt.Sprintf("Pages Scrolled: %v\nDiscovered Ad Count: %v\nSuccess Crawled Ad Count: %v\nFailed Crawled Ad Count: %v\n", run.PagesScrolled, run.DiscoveredCount, successAdCount, failAdCount) +
+		fmt.Sprintf("Inserted: %v\nUpdated: %v\nDuplicated: %v\nKnown Skipped: %v\nBrowser Recoveries: %v\n", run.InsertedCount, run.UpdatedCount, run.DuplicateCount, run.KnownCount, run.RecoveryCount) +
+		formatFailures(run) + formatWorkers(workers)
+
+	// Compare with the previous run of the source
+	report, err := crawl_runs.GetRunReport(database.DB, run)
+	if err != nil {
+		databaseLogger.Error("Error comparing crawl run:", zap.Error(err))
+	} else if report.Comparison != nil {
+		metrics += formatComparison(*report.Comparison)
+	}
+	notification.NotifySuperAdmin(ctx, metrics)
+
+	// A field that is suddenly missing from most ads usually means the markup of the site changed
+	drops, err := fill_rates.Check(database.DB, fill_rates.ConfigFromEnv(), run, fill)
+	if err != nil {
+		databaseLogger.Error("Error checking field fill rates:", zap.Error(err))
+	} else if len(drops) > 0 {
+		notification.NotifySuperAdmin(ctx, fill_rates.FormatAlert(run, drops))
+	}
+	return run
+}
+
+// formatFailures lists the failures of a run by kind
+func formatFailures(run models.CrawlRun) string {
+	if run.FailedCount == 0 {
+		return ""
+	}
+	text := "Failures:"
+	for _, kind := range []models.FailureKind{models.FailureTimeout, models.FailureNavigation, models.FailureUnsupported, models.FailureParse, models.FailureDatabase, models.FailureDisallowed} {
+		if count := run.Failures()[kind]; count > 0 {
+			text += fmt.Sprintf(" %v=%v", kind, count)
+		}
+	}
+	return text + "\n"
+}
+
+// formatComparison describes the changes against the previous run
+func formatComparison(comparison crawl_runs.RunComparison) string {
+	duration := comparison.Duration.Round(time.Second).String()
+	if comparison.Duration >= 0 {
+		duration = "+" + duration
+	}
+	return fmt.Sprintf("Compared to the run of %v:\nDuration: %v\nScraped: %+d\nInserted: %+d\nUpdated: %+d\nFailed: %+d\nAds per minute: %+.1f\n",
+		comparison.Previous.StartedAt.Format("2006-01-02 15:04"), duration, comparison.Scraped, comparison.Inserted, comparison.Updated, comparison.Failed, comparison.AdsPerMinute)
+}
@@ -0,0 +1,27 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/services/dedup"
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// dedupBatch is how many ads without a cluster a deduplication run compares
+const dedupBatch = 1000
+
+// RunDeduplication clusters the stored ads that were never compared with the others,
+// like ads stored before deduplication existed or ads whose crawl failed to cluster them
+func RunDeduplication(ctx context.Context) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	clustered, err := dedup.ClusterUnassigned(database.DB, dedupBatch)
+	if err != nil {
+		crawlerLogger.Error("Error clustering duplicate ads", zap.Int("clustered", clustered), zap.Error(err))
+		return
+	}
+	crawlerLogger.Info("clustered duplicate ads", zap.Int("clustered", clustered))
+}
@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// loadCheckpoint prepares the checkpoint of this run and returns the pending URLs to scrape first.
+// resume is true when the previous run of the source, or of the target in ctx, did not finish.
+func loadCheckpoint(ctx context.Context, src source.Source, state *CrawlerState) (pending []models.Frontier, resume bool) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+	databaseLogger, _ := configLogger("database")
+
+	target, _ := source.TargetFromContext(ctx)
+	checkpoint, err := repositories.GetCheckpoint(database.DB, src.Name(), target.Name)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		databaseLogger.Error("Error reading crawl checkpoint:", zap.Error(err))
+	}
+	resume = err == nil && checkpoint.Status != models.CheckpointFinished
+
+	// URLs left in-progress were being scraped when the process stopped
+	if err := repositories.ResetInProgressFrontier(database.DB, src.Name(), target.Name); err != nil {
+		databaseLogger.Error("Error resetting in-progress frontier:", zap.Error(err))
+	}
+	pending, err = repositories.GetPendingFrontier(database.DB, src.Name(), target.Name)
+	if err != nil {
+		databaseLogger.Error("Error reading pending frontier:", zap.Error(err))
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if resume {
+		crawlerLogger.Info("resuming interrupted run", zap.String("source", src.Name()), zap.Time("startedAt", checkpoint.StartedAt), zap.Int("pending", len(pending)))
+		state.SuccessAdCount = checkpoint.SuccessCount
+		state.FailAdCount = checkpoint.FailCount
+		state.DiscoveredCount = checkpoint.DiscoveredCount
+		state.Resumed = true
+		state.resumedDiscovered = checkpoint.DiscoveredCount
+	} else {
+		checkpoint = models.Checkpoint{Reference: src.Name(), Target: target.Name, StartedAt: time.Now()}
+	}
+	checkpoint.Status = models.CheckpointRunning
+	state.checkpoint = checkpoint
+	state.saveCheckpoint(ctx)
+
+	return pending, resume
+}
+
+// resumePending sends the pending URLs to the workers, it returns false if ctx was canceled
+func resumePending(ctx context.Context, pending []models.Frontier, jobs chan<- source.Job) bool {
+	for _, frontier := range pending {
+		select {
+		case jobs <- source.Job{URL: frontier.URL, Category: frontier.Category}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// discover runs the discovery of src and passes every URL that is new to this run
+// to the workers, after storing it in the frontier
+func discover(ctx context.Context, src source.Source, state *CrawlerState, jobs chan<- source.Job) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	databaseLogger, _ := configLogger("database")
+
+	state.mu.Lock()
+	runStart := state.checkpoint.StartedAt
+	target := state.checkpoint.Target
+	state.mu.Unlock()
+
+	discovered := make(chan source.Job)
+	go func() {
+		defer close(discovered)
+		src.Discover(ctx, discovered)
+	}()
+	// Let discovery finish if we stop reading early
+	defer func() {
+		for range discovered {
+		}
+	}()
+
+	for job := range discovered {
+		frontier := models.Frontier{Reference: src.Name(), URL: job.URL, Category: job.Category, Target: target}
+		added, err := repositories.AddToFrontier(database.DB, &frontier, runStart)
+		if err != nil {
+			// Without the frontier the URL is still scraped, it just can't be resumed
+			databaseLogger.Error("Error adding URL to frontier:", zap.String("url", job.URL), zap.Error(err))
+		} else if !added {
+			continue
+		}
+
+		state.mu.Lock()
+		state.DiscoveredCount++
+		state.saveCheckpoint(ctx)
+		state.mu.Unlock()
+
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// markFrontier records the state of a scraped URL
+func markFrontier(ctx context.Context, src source.Source, job source.Job, status models.FrontierStatus, scrapErr error) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	databaseLogger, _ := configLogger("database")
+
+	lastError := ""
+	if scrapErr != nil {
+		lastError = scrapErr.Error()
+	}
+	if err := repositories.UpdateFrontierStatus(database.DB, src.Name(), job.URL, status, lastError); err != nil {
+		databaseLogger.Error("Error updating frontier status:", zap.String("url", job.URL), zap.Error(err))
+	}
+}
+
+// saveCheckpoint stores the counters of the run, the caller must hold state.mu
+func (state *CrawlerState) saveCheckpoint(ctx context.Context) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	databaseLogger, _ := configLogger("database")
+
+	state.checkpoint.SuccessCount = state.SuccessAdCount
+	state.checkpoint.FailCount = state.FailAdCount
+	state.checkpoint.DiscoveredCount = state.DiscoveredCount
+	if err := repositories.SaveCheckpoint(database.DB, &state.checkpoint); err != nil {
+		databaseLogger.Error("Error saving crawl checkpoint:", zap.Error(err))
+	}
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/services/crawler/source"
+	"Crawlzilla/utils"
+	"context"
+	"os"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// Constants for the crawl modes set by CRAWL_MODE
+const (
+	CrawlModeFull        = "full"
+	CrawlModeIncremental = "incremental"
+)
+
+// defaultStopAfter is how many known listings in a row end an incremental run
+const defaultStopAfter = 50
+
+// crawlModeFromEnv reads CRAWL_MODE, anything but incremental is a full run
+func crawlModeFromEnv() string {
+	if os.Getenv("CRAWL_MODE") == CrawlModeIncremental {
+		return CrawlModeIncremental
+	}
+	return CrawlModeFull
+}
+
+// newIncremental builds the incremental run of src. A listing is known when its ad
+// is stored, knowing it also bumps the last seen time of the ad since it is still listed.
+func newIncremental(ctx context.Context, src source.Source, state *CrawlerState) source.Incremental {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	databaseLogger, _ := configLogger("database")
+
+	stopAfter, err := strconv.Atoi(os.Getenv("INCREMENTAL_STOP_AFTER"))
+	if err != nil || stopAfter < 1 {
+		stopAfter = defaultStopAfter
+	}
+
+	return source.Incremental{
+		StopAfter: stopAfter,
+		Known: func(url string) bool {
+			listingID := source.ListingID(src, url, utils.ExtractSourceListingID)
+			if listingID == "" {
+				return false
+			}
+			known, err := repositories.TouchListing(database.DB, src.Name(), listingID)
+			if err != nil {
+				// Scraping a known listing again is only wasted work
+				databaseLogger.Error("Error checking known listing:", zap.String("url", url), zap.Error(err))
+				return false
+			}
+			if known {
+				state.mu.Lock()
+				state.KnownCount++
+				state.mu.Unlock()
+			}
+			return known
+		},
+	}
+}
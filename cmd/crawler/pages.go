@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"Crawlzilla/services/pages"
+	"Crawlzilla/utils"
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// withRecorder returns a context recording the page a worker scrapes, when pages are archived
+func withRecorder(ctx context.Context, archive *pages.Archive) (context.Context, *source.PageRecorder) {
+	if !archive.Enabled() {
+		return ctx, nil
+	}
+	recorder := &source.PageRecorder{Screenshots: archive.Screenshots()}
+	return context.WithValue(ctx, "page_recorder", recorder), recorder
+}
+
+// archivePage stores the page recorded while scraping job, with the error the scrape ended with
+func archivePage(ctx context.Context, archive *pages.Archive, src source.Source, runID string, job source.Job, recorder *source.PageRecorder, scrapErr error) {
+	html, screenshot, ok := recorder.Page()
+	if !ok || runID == "" {
+		return
+	}
+
+	page := models.RawPage{
+		CrawlRunID:      runID,
+		Reference:       src.Name(),
+		SourceListingID: source.ListingID(src, job.URL, utils.ExtractSourceListingID),
+		URL:             job.URL,
+		Category:        job.Category,
+	}
+	if scrapErr != nil {
+		page.ScrapeError = scrapErr.Error()
+	}
+	if err := archive.Store(database.DB, &page, html, screenshot); err != nil {
+		configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+		crawlerLogger, _ := configLogger("crawler")
+		crawlerLogger.Warn("Error archiving page", zap.String("url", job.URL), zap.Error(err))
+	}
+}
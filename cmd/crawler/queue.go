@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/divar"
+	"Crawlzilla/services/crawler/generic"
+	"Crawlzilla/services/crawler/queue"
+	"Crawlzilla/services/crawler/sheypoor"
+	"Crawlzilla/services/crawler/source"
+	"Crawlzilla/services/fill_rates"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxDeliveries is how often a task is pulled before it is given up on. A task is
+// only pulled again when its worker died, so it may be what kills the workers.
+const maxDeliveries = 3
+
+// queuePollInterval is how often a distributed run checks the results of its workers
+var queuePollInterval = time.Second
+
+// Sources returns the crawled sources by reference, with the sites defined in SITES_DIR
+func Sources() map[string]source.Source {
+	sources := map[string]source.Source{
+		"divar":    divar.NewSource(),
+		"sheypoor": sheypoor.NewSource(),
+	}
+	catalog := generic.Default()
+	for _, name := range catalog.Names() {
+		site, _ := catalog.Site(name)
+		sources[name] = generic.NewSource(site)
+	}
+	return sources
+}
+
+// distribute pushes the jobs of a run to the shared queue instead of scraping them, then
+// waits until the workers went through them. The counters of the run come from the results
+// the workers report, the run stops once MAX_AD_COUNT ads were scraped. Tasks of the run
+// still queued when it stops are dropped by the workers.
+func distribute(ctx context.Context, q queue.Queue, src source.Source, jobs <-chan source.Job, maxAdCount int, state *CrawlerState, wg *sync.WaitGroup, cancel context.CancelFunc) {
+	defer wg.Done()
+
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	state.mu.Lock()
+	if state.runID == "" {
+		state.runID = uuid.NewString()
+	}
+	runID := state.runID
+	// A resumed run starts from the counts of the interrupted one
+	resumedSuccess, resumedFail := state.SuccessAdCount, state.FailAdCount
+	state.mu.Unlock()
+
+	defer func() {
+		if err := q.Finish(context.WithoutCancel(ctx), runID); err != nil {
+			crawlerLogger.Error("Error finishing run in queue", zap.String("run", runID), zap.Error(err))
+		}
+	}()
+
+	// syncStats copies the results of the workers to the run, it returns false once the run has enough ads
+	syncStats := func() bool {
+		stats, err := q.Stats(context.WithoutCancel(ctx), runID)
+		if err != nil {
+			crawlerLogger.Error("Error reading worker stats", zap.String("run", runID), zap.Error(err))
+			return true
+		}
+
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		state.Workers = stats
+		state.SuccessAdCount, state.FailAdCount = resumedSuccess, resumedFail
+		state.InsertedCount, state.UpdatedCount, state.DuplicateCount = 0, 0, 0
+		state.FailureCounts = make(map[models.FailureKind]int)
+		state.fill = fill_rates.Tally{}
+		for _, worker := range stats {
+			state.fill.Merge(worker.Fill)
+			state.SuccessAdCount += worker.Success
+			state.FailAdCount += worker.Failed
+			state.InsertedCount += worker.Inserted
+			state.UpdatedCount += worker.Updated
+			state.DuplicateCount += worker.Duplicate
+			for kind, count := range worker.Failures {
+				state.FailureCounts[kind] += count
+			}
+		}
+		state.saveCheckpoint(ctx)
+		return state.SuccessAdCount < maxAdCount
+	}
+
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+
+	// Hand out the jobs until discovery finishes
+	for jobs != nil {
+		select {
+		case job, ok := <-jobs:
+			if !ok {
+				jobs = nil
+				continue
+			}
+			task := queue.Task{RunID: runID, Reference: src.Name(), URL: job.URL, Category: job.Category}
+			if err := q.Push(ctx, task); err != nil {
+				// The URL stays pending in the frontier and is resumed by the next run
+				crawlerLogger.Error("Error pushing job to queue", zap.String("url", job.URL), zap.Error(err))
+			}
+		case <-ticker.C:
+			if !syncStats() {
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			syncStats()
+			return
+		}
+	}
+
+	// Wait for the workers to go through what is left
+	for {
+		outstanding, err := q.Outstanding(ctx, runID)
+		if err != nil {
+			crawlerLogger.Error("Error reading outstanding jobs", zap.String("run", runID), zap.Error(err))
+		}
+		if !syncStats() || (err == nil && outstanding <= 0) {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			syncStats()
+			return
+		}
+	}
+}
+
+// RunWorker scrapes the tasks of the shared queue with MAX_WORKERS workers until ctx is
+// canceled, and reports the result of every task to the run it belongs to
+func RunWorker(ctx context.Context, q queue.Queue, name string, sources map[string]source.Source) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	numWorkers, maxTabPages := workersFromEnv(crawlerLogger)
+	retry := retryPolicyFromEnv()
+
+	pool := browser.NewPool(ctx, numWorkers, maxTabPages)
+	defer pool.Close()
+	ctx = context.WithValue(ctx, "browser_pool", pool)
+
+	crawlerLogger.Info("queue worker started", zap.String("worker", name), zap.Int("workers", numWorkers))
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				delivery, ok, err := q.Pull(ctx, name)
+				if err != nil {
+					if ctx.Err() == nil {
+						crawlerLogger.Error("Error pulling job from queue", zap.String("worker", name), zap.Error(err))
+						sleepCtx(ctx, queuePollInterval)
+					}
+					continue
+				}
+				if ok {
+					handleDelivery(ctx, q, name, sources, retry, delivery)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	crawlerLogger.Info("queue worker stopped", zap.String("worker", name))
+}
+
+// handleDelivery scrapes a task of the queue, reports its result and acks it.
+// A task cut off by shutdown is not acked, another worker takes it over.
+func handleDelivery(ctx context.Context, q queue.Queue, name string, sources map[string]source.Source, retry retryPolicy, delivery queue.Delivery) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	task := delivery.Task
+
+	// The run stopped, at MAX_AD_COUNT or on shutdown, without waiting for this task.
+	// Its URL stays pending in the frontier and is resumed by the next run.
+	finished, err := q.Finished(ctx, task.RunID)
+	if err != nil && ctx.Err() == nil {
+		crawlerLogger.Error("Error reading run state", zap.String("run", task.RunID), zap.Error(err))
+	}
+	if finished {
+		crawlerLogger.Debug("dropping job of finished run", zap.String("run", task.RunID), zap.String("url", task.URL))
+		if _, err := q.Ack(context.WithoutCancel(ctx), delivery); err != nil {
+			crawlerLogger.Error("Error acking job", zap.String("url", task.URL), zap.Error(err))
+		}
+		return
+	}
+
+	result := queue.Result{RunID: task.RunID, Worker: name}
+	src, known := sources[task.Reference]
+	switch {
+	case !known:
+		crawlerLogger.Error("job of unknown source", zap.String("source", task.Reference), zap.String("url", task.URL))
+		result.Failure = models.FailureUnsupported
+	case delivery.Attempts > maxDeliveries:
+		err := fmt.Errorf("gave up after %d workers stopped while scraping it", delivery.Attempts-1)
+		crawlerLogger.Warn("job kept failing its workers, moved to dead letters", zap.String("source", task.Reference), zap.String("url", task.URL), zap.Int64("deliveries", delivery.Attempts))
+		markFrontier(ctx, src, task.Job(), models.FrontierFailed, err)
+		deadLetter(ctx, src, task.Job(), int(delivery.Attempts-1), err)
+		result.Failure = source.Classify(err)
+	default:
+		data, saved, err := scrapeJob(ctx, src, task.Job(), retry, task.RunID)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		result.Saved = saved
+		if err != nil {
+			result.Failure = source.Classify(err)
+		} else {
+			result.URL = task.URL
+			result.Empty = fill_rates.EmptyFields(data)
+		}
+	}
+
+	// The result is counted and the task acked together, a task another worker took
+	// over while this one was slow is counted once, by the worker that holds it
+	completed, err := q.Complete(context.WithoutCancel(ctx), delivery, result)
+	if err != nil {
+		crawlerLogger.Error("Error completing job", zap.String("url", task.URL), zap.Error(err))
+	} else if !completed {
+		crawlerLogger.Warn("job was taken over by another worker, its result is dropped", zap.String("worker", name), zap.String("url", task.URL))
+	}
+}
+
+// sleepCtx waits for d or until ctx is canceled
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// formatWorkers lists the results of the workers of a distributed run
+func formatWorkers(workers map[string]queue.WorkerStats) string {
+	if len(workers) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(workers))
+	for name := range workers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	text := "Workers:\n"
+	for _, name := range names {
+		stats := workers[name]
+		text += fmt.Sprintf("%v: scraped=%v failed=%v inserted=%v updated=%v\n", name, stats.Success, stats.Failed, stats.Inserted, stats.Updated)
+	}
+	return text
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"Crawlzilla/services/dedup"
+	"Crawlzilla/services/pages"
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// ReprocessStats counts the results of parsing archived pages again
+type ReprocessStats struct {
+	Pages     int
+	Inserted  int
+	Updated   int
+	Unchanged int
+	Failed    int
+}
+
+func (stats ReprocessStats) String() string {
+	return fmt.Sprintf("Pages: %v\nInserted: %v\nUpdated: %v\nUnchanged: %v\nFailed: %v\n", stats.Pages, stats.Inserted, stats.Updated, stats.Unchanged, stats.Failed)
+}
+
+// Parsers returns the sources that can parse archived pages, by reference
+func Parsers() map[string]source.Parser {
+	parsers := make(map[string]source.Parser)
+	for reference, src := range Sources() {
+		if parser, ok := src.(source.Parser); ok {
+			parsers[reference] = parser
+		}
+	}
+	return parsers
+}
+
+// Reprocess parses archived pages again with the current parsers and stores the ads, without
+// loading anything. It takes the pages of a crawl run when runID is set, otherwise the newest page
+// of every listing of reference, or of a single listing. Ads keep the time their page was scraped,
+// so reprocessing an old page doesn't bring back a removed listing.
+func Reprocess(ctx context.Context, archive *pages.Archive, parsers map[string]source.Parser, reference string, runID string, sourceListingID string) (ReprocessStats, error) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	var stats ReprocessStats
+	if !archive.Enabled() {
+		return stats, errors.New("page archive is disabled, set PAGE_ARCHIVE_DIR")
+	}
+
+	var rawPages []models.RawPage
+	var err error
+	if runID != "" {
+		rawPages, err = repositories.GetRawPagesOfRun(database.DB, runID)
+	} else {
+		rawPages, err = repositories.GetLatestRawPages(database.DB, reference, sourceListingID)
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	for _, page := range rawPages {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		if (reference != "" && page.Reference != reference) || (sourceListingID != "" && page.SourceListingID != sourceListingID) {
+			continue
+		}
+		stats.Pages++
+
+		id, saved, err := reprocessPage(archive, parsers, page)
+		if err != nil {
+			stats.Failed++
+			crawlerLogger.Warn("reprocessing page failed", zap.String("source", page.Reference), zap.String("url", page.URL), zap.Error(err))
+			continue
+		}
+		switch saved {
+		case repositories.AdInserted:
+			stats.Inserted++
+		case repositories.AdUpdated:
+			stats.Updated++
+		case repositories.AdUnchanged:
+			stats.Unchanged++
+		}
+		if _, err := dedup.AssignCluster(database.DB, id); err != nil {
+			crawlerLogger.Error("Error assigning duplicate cluster:", zap.String("Ad ID", id), zap.Error(err))
+		}
+	}
+	return stats, nil
+}
+
+// reprocessPage parses an archived page and stores its ad as seen when the page was scraped
+func reprocessPage(archive *pages.Archive, parsers map[string]source.Parser, page models.RawPage) (string, repositories.AdSaveResult, error) {
+	parser, ok := parsers[page.Reference]
+	if !ok {
+		return "", "", fmt.Errorf("no parser for source %s", page.Reference)
+	}
+	html, err := archive.Read(page)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := parser.Parse(source.Job{URL: page.URL, Category: page.Category, SeenAt: page.CreatedAt}, html)
+	if err != nil {
+		return "", "", err
+	}
+	return repositories.UpsertAdSeenAt(database.DB, &data, page.CreatedAt)
+}
@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// retryPolicy sets how often and how patiently transient failures are retried
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// retryPolicyFromEnv reads MAX_RETRIES and RETRY_BACKOFF (seconds) from the environment
+func retryPolicyFromEnv() retryPolicy {
+	policy := retryPolicy{retries: 2, backoff: 2 * time.Second}
+	if retries, err := strconv.Atoi(os.Getenv("MAX_RETRIES")); err == nil && retries >= 0 {
+		policy.retries = retries
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("RETRY_BACKOFF")); err == nil && seconds >= 0 {
+		policy.backoff = time.Duration(seconds) * time.Second
+	}
+	return policy
+}
+
+// run calls fn until it succeeds, fails permanently or runs out of retries. The wait
+// between attempts doubles every time. It returns the attempts made and the last error.
+func (policy retryPolicy) run(ctx context.Context, fn func() error, onRetry func(attempt int, err error)) (int, error) {
+	wait := policy.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt > policy.retries || !source.Classify(err).Transient() {
+			return attempt, err
+		}
+		onRetry(attempt, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		}
+		wait *= 2
+	}
+}
+
+// deadLetter stores a URL the worker gave up on
+func deadLetter(ctx context.Context, src source.Source, job source.Job, attempts int, scrapErr error) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	databaseLogger, _ := configLogger("database")
+
+	letter := models.DeadLetter{
+		Reference: src.Name(),
+		URL:       job.URL,
+		Category:  job.Category,
+		Kind:      source.Classify(scrapErr),
+		Error:     scrapErr.Error(),
+		Attempts:  attempts,
+	}
+	if err := repositories.AddDeadLetter(database.DB, &letter); err != nil {
+		databaseLogger.Error("Error adding dead letter:", zap.String("url", job.URL), zap.Error(err))
+	}
+}
@@ -0,0 +1,163 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/bot/notification"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/divar"
+	"Crawlzilla/services/crawler/sheypoor"
+	"Crawlzilla/services/crawler/source"
+	"Crawlzilla/utils"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Defaults used when REVALIDATE_COUNT or REVALIDATE_AFTER are not set
+const (
+	defaultRevalidateCount = 100
+	defaultRevalidateAfter = 24 // hours
+)
+
+// RevalidationStats counts the results of a revalidation run
+type RevalidationStats struct {
+	Checked int
+	Active  int
+	Expired int
+	Sold    int
+	Failed  int
+	mu      sync.Mutex
+}
+
+func (stats *RevalidationStats) add(status models.AdStatus, err error) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	stats.Checked++
+	if err != nil {
+		stats.Failed++
+		return
+	}
+	switch status {
+	case models.AdActive:
+		stats.Active++
+	case models.AdExpired:
+		stats.Expired++
+	case models.AdSold:
+		stats.Sold++
+	}
+}
+
+// StartRevalidation visits the least recently checked active ads of src and stores their status.
+// REVALIDATE_COUNT ads are checked per run, an ad is checked again after REVALIDATE_AFTER hours.
+func StartRevalidation(ctx context.Context, src source.Source, stats *RevalidationStats) error {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+	databaseLogger, _ := configLogger("database")
+
+	validator, ok := src.(source.Validator)
+	if !ok {
+		return fmt.Errorf("source %s can not check listing status", src.Name())
+	}
+
+	count, err := strconv.Atoi(os.Getenv("REVALIDATE_COUNT"))
+	if err != nil || count < 1 {
+		count = defaultRevalidateCount
+	}
+	after, err := strconv.Atoi(os.Getenv("REVALIDATE_AFTER"))
+	if err != nil || after < 0 {
+		after = defaultRevalidateAfter
+	}
+	numWorkers, err := strconv.Atoi(os.Getenv("MAX_WORKERS"))
+	if err != nil || numWorkers < 1 {
+		numWorkers = 1
+	}
+	maxTabPages, _ := strconv.Atoi(os.Getenv("MAX_TAB_PAGES"))
+
+	ads, err := repositories.GetAdsToRevalidate(database.DB, src.Name(), time.Now().Add(-time.Duration(after)*time.Hour), count)
+	if err != nil {
+		return err
+	}
+	crawlerLogger.Info("revalidation started", zap.String("source", src.Name()), zap.Int("ads", len(ads)))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pool := browser.NewPool(ctx, numWorkers, maxTabPages)
+	defer pool.Close()
+	ctx = context.WithValue(ctx, "browser_pool", pool)
+
+	jobs := make(chan models.Ads)
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ad := range jobs {
+				status, err := validator.Check(ctx, ad)
+				if ctx.Err() != nil {
+					// Check was cut off by shutdown, the ad stays due for the next run
+					return
+				}
+				if err != nil {
+					crawlerLogger.Warn("cant check listing status", zap.String("URL", ad.URL), zap.Error(err))
+					// Keep the status but count the visit, so a broken page does not block the queue
+					status = ad.Status
+				}
+				if err := repositories.UpdateAdStatus(database.DB, ad.ID, status, time.Now()); err != nil {
+					databaseLogger.Warn("cant update ad status", zap.String("Ad ID", ad.ID), zap.Error(err))
+				}
+				stats.add(status, err)
+			}
+		}()
+	}
+
+	for _, ad := range ads {
+		select {
+		case jobs <- ad:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	crawlerLogger.Info("revalidation stopped", zap.String("source", src.Name()))
+	return nil
+}
+
+// RunRevalidation checks the stored ads of every source and reports the results to the super admin
+func RunRevalidation(ctx context.Context, sources ...source.Source) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	for _, src := range sources {
+		stats := &RevalidationStats{}
+		var runErr error
+		metrics := utils.MeasureExecutionStats(func() { runErr = StartRevalidation(ctx, src, stats) })
+		if runErr != nil {
+			crawlerLogger.Error("revalidation failed", zap.String("source", src.Name()), zap.Error(runErr))
+			continue
+		}
+
+		stats.mu.Lock()
+		metrics = fmt.Sprintf("Revalidation Source: %v\n", src.Name()) + metrics + fmt.Sprintf("Checked Ad Count: %v\nActive Ad Count: %v\nExpired Ad Count: %v\nSold Ad Count: %v\nFailed Check Count: %v\n", stats.Checked, stats.Active, stats.Expired, stats.Sold, stats.Failed)
+		stats.mu.Unlock()
+		notification.NotifySuperAdmin(ctx, metrics)
+	}
+}
+
+// RunAdRevalidation revalidates the ads of the divar and sheypoor sources
+func RunAdRevalidation(ctx context.Context) {
+	RunRevalidation(ctx, divar.NewSource(), sheypoor.NewSource())
+}
@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/generic"
+	"Crawlzilla/services/crawler/source"
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// site runs the crawl of a whole site and builds the sources of its targets
+type site struct {
+	run       func(ctx context.Context)
+	newTarget func(city, category string) source.Source
+}
+
+// sites are the crawled sites by reference
+var sites = map[string]site{
+	"divar":    {run: RunDivarCrawler, newTarget: newDivarTarget},
+	"sheypoor": {run: RunSheypoorCrawler, newTarget: newSheypoorTarget},
+}
+
+// siteOf returns a built-in site or one defined in SITES_DIR
+func siteOf(reference string) (site, bool) {
+	if builtIn, ok := sites[reference]; ok {
+		return builtIn, true
+	}
+	definition, ok := generic.Default().Site(reference)
+	if !ok {
+		return site{}, false
+	}
+	newTarget := func(city, category string) source.Source {
+		return generic.NewTargetSource(definition, city, category)
+	}
+	return site{
+		run:       func(ctx context.Context) { RunTargets(ctx, reference, generic.NewSource(definition), newTarget) },
+		newTarget: newTarget,
+	}, true
+}
+
+// RunSchedule runs the crawl of a schedule, every target of its source or only its own target
+func RunSchedule(ctx context.Context, schedule models.CrawlSchedule) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+	databaseLogger, _ := configLogger("database")
+
+	site, ok := siteOf(schedule.Reference)
+	if !ok {
+		crawlerLogger.Error("schedule of an unknown source", zap.String("source", schedule.Reference), zap.String("schedule", schedule.ID))
+		return
+	}
+	if schedule.TargetID == "" {
+		site.run(ctx)
+		return
+	}
+
+	target, err := repositories.GetCrawlTargetByID(database.DB, schedule.TargetID)
+	if err != nil {
+		databaseLogger.Error("Error reading scheduled crawl target:", zap.String("schedule", schedule.ID), zap.Error(err))
+		return
+	}
+	if !target.Enabled {
+		crawlerLogger.Info("scheduled crawl target is disabled, skipping", zap.String("target", target.Name()))
+		return
+	}
+	RunTarget(ctx, target, site.newTarget)
+}
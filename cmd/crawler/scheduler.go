@@ -0,0 +1,227 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// OverlapPolicy decides what happens to a run of a source that is already crawling
+type OverlapPolicy string
+
+// Constants for the overlap policies set by SCHEDULE_OVERLAP
+const (
+	OverlapSkip  OverlapPolicy = "skip"
+	OverlapQueue OverlapPolicy = "queue"
+)
+
+// TriggerResult tells what became of a triggered run
+type TriggerResult string
+
+// Constants for the results of a triggered run
+const (
+	RunStarted TriggerResult = "started"
+	RunQueued  TriggerResult = "queued"
+	RunSkipped TriggerResult = "skipped"
+)
+
+// reloadSpec is how often the scheduler picks up schedules changed outside the bot
+const reloadSpec = "@every 1m"
+
+// OverlapFromEnv reads SCHEDULE_OVERLAP, runs are skipped unless it is queue
+func OverlapFromEnv() OverlapPolicy {
+	if OverlapPolicy(os.Getenv("SCHEDULE_OVERLAP")) == OverlapQueue {
+		return OverlapQueue
+	}
+	return OverlapSkip
+}
+
+// Scheduler runs the crawl schedules stored in the database. A source crawls one run at
+// a time, a run triggered while the source is busy is skipped or queued behind it.
+type Scheduler struct {
+	ctx     context.Context
+	run     func(ctx context.Context, schedule models.CrawlSchedule)
+	overlap OverlapPolicy
+	cron    *cron.Cron
+
+	mu      sync.Mutex
+	entries map[string]scheduledEntry // By schedule ID
+	active  map[string]bool           // Sources with a running crawl
+	queued  map[string][]models.CrawlSchedule
+	runs    sync.WaitGroup
+}
+
+type scheduledEntry struct {
+	id       cron.EntryID
+	schedule models.CrawlSchedule
+}
+
+// NewScheduler creates a scheduler running the schedules with run, RunSchedule in production
+func NewScheduler(ctx context.Context, run func(ctx context.Context, schedule models.CrawlSchedule), overlap OverlapPolicy) *Scheduler {
+	return &Scheduler{
+		ctx:     ctx,
+		run:     run,
+		overlap: overlap,
+		cron:    cron.New(),
+		entries: make(map[string]scheduledEntry),
+		active:  make(map[string]bool),
+		queued:  make(map[string][]models.CrawlSchedule),
+	}
+}
+
+// SchedulerFromContext returns the scheduler stored in ctx under "scheduler", or nil
+func SchedulerFromContext(ctx context.Context) *Scheduler {
+	scheduler, _ := ctx.Value("scheduler").(*Scheduler)
+	return scheduler
+}
+
+// Start loads the schedules and starts running them
+func (s *Scheduler) Start() error {
+	configLogger := s.ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	err := s.Reload()
+	_, reloadErr := s.cron.AddFunc(reloadSpec, func() {
+		if err := s.Reload(); err != nil {
+			crawlerLogger.Error("Error reloading crawl schedules", zap.Error(err))
+		}
+	})
+	if reloadErr != nil {
+		return reloadErr
+	}
+	s.cron.Start()
+	return err
+}
+
+// Stop stops scheduling runs and waits for the running ones to return
+func (s *Scheduler) Stop() {
+	<-s.cron.Stop().Done()
+	s.runs.Wait()
+}
+
+// Reload brings the cron entries in line with the enabled schedules of the database
+func (s *Scheduler) Reload() error {
+	configLogger := s.ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	schedules, err := repositories.GetEnabledCrawlSchedules(database.DB)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := make(map[string]bool)
+	for _, schedule := range schedules {
+		current[schedule.ID] = true
+		if entry, ok := s.entries[schedule.ID]; ok {
+			if entry.schedule.Spec == schedule.Spec && entry.schedule.TargetID == schedule.TargetID && entry.schedule.Reference == schedule.Reference {
+				continue
+			}
+			s.cron.Remove(entry.id)
+			delete(s.entries, schedule.ID)
+		}
+
+		schedule := schedule
+		id, err := s.cron.AddFunc(schedule.Spec, func() { s.Trigger(schedule) })
+		if err != nil {
+			crawlerLogger.Error("Invalid crawl schedule", zap.String("id", schedule.ID), zap.String("spec", schedule.Spec), zap.Error(err))
+			continue
+		}
+		s.entries[schedule.ID] = scheduledEntry{id: id, schedule: schedule}
+		crawlerLogger.Info("scheduled crawl", zap.String("source", schedule.Reference), zap.String("target", schedule.TargetID), zap.String("spec", schedule.Spec))
+	}
+
+	// Schedules that were removed or disabled
+	for scheduleID, entry := range s.entries {
+		if !current[scheduleID] {
+			s.cron.Remove(entry.id)
+			delete(s.entries, scheduleID)
+		}
+	}
+	return nil
+}
+
+// Trigger starts a run of the schedule, unless its source is already crawling.
+// A busy source skips the run, or queues it when the overlap policy is queue.
+func (s *Scheduler) Trigger(schedule models.CrawlSchedule) TriggerResult {
+	configLogger := s.ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active[schedule.Reference] {
+		if s.overlap != OverlapQueue {
+			crawlerLogger.Warn("source is still crawling, skipping run", zap.String("source", schedule.Reference), zap.String("schedule", schedule.ID))
+			return RunSkipped
+		}
+		// A schedule waits at most once, running it twice in a row would find nothing new
+		for _, queued := range s.queued[schedule.Reference] {
+			if queued.ID == schedule.ID && queued.TargetID == schedule.TargetID {
+				return RunQueued
+			}
+		}
+		crawlerLogger.Info("source is still crawling, queueing run", zap.String("source", schedule.Reference), zap.String("schedule", schedule.ID))
+		s.queued[schedule.Reference] = append(s.queued[schedule.Reference], schedule)
+		return RunQueued
+	}
+
+	s.active[schedule.Reference] = true
+	s.runs.Add(1)
+	go s.runQueue(schedule)
+	return RunStarted
+}
+
+// runQueue runs a schedule and then the runs queued behind it
+func (s *Scheduler) runQueue(schedule models.CrawlSchedule) {
+	defer s.runs.Done()
+	for {
+		s.run(s.ctx, schedule)
+
+		s.mu.Lock()
+		queue := s.queued[schedule.Reference]
+		if len(queue) == 0 || s.ctx.Err() != nil {
+			delete(s.active, schedule.Reference)
+			delete(s.queued, schedule.Reference)
+			s.mu.Unlock()
+			return
+		}
+		schedule, s.queued[schedule.Reference] = queue[0], queue[1:]
+		s.mu.Unlock()
+	}
+}
+
+// Next returns the next run time of a schedule, false when it is not scheduled
+func (s *Scheduler) Next(scheduleID string) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+	s.mu.Lock()
+	entry, ok := s.entries[scheduleID]
+	s.mu.Unlock()
+	if !ok {
+		return time.Time{}, false
+	}
+	next := s.cron.Entry(entry.id).Next
+	return next, !next.IsZero()
+}
+
+// Running reports whether a source is crawling
+func (s *Scheduler) Running(reference string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active[reference]
+}
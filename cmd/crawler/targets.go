@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunTargets crawls the enabled targets of a source one after the other, the one crawled
+// longest ago first. A target is only marked as crawled when its run finished, so targets
+// cut off by a shutdown get the first turn next time. A source without any targets is
+// crawled as a whole with whole.
+func RunTargets(ctx context.Context, reference string, whole source.Source, newSource func(city, category string) source.Source) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+	databaseLogger, _ := configLogger("database")
+
+	count, err := repositories.CountCrawlTargets(database.DB, reference)
+	if err != nil {
+		databaseLogger.Error("Error counting crawl targets:", zap.String("source", reference), zap.Error(err))
+	}
+	if count == 0 {
+		RunCrawler(ctx, whole)
+		return
+	}
+
+	targets, err := repositories.GetDueCrawlTargets(database.DB, reference)
+	if err != nil {
+		databaseLogger.Error("Error reading crawl targets:", zap.String("source", reference), zap.Error(err))
+		return
+	}
+	if len(targets) == 0 {
+		crawlerLogger.Info("every crawl target of the source is disabled", zap.String("source", reference))
+		return
+	}
+
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			return
+		}
+		RunTarget(ctx, target, newSource)
+	}
+}
+
+// RunTarget crawls a single target and marks it as crawled when the run finished
+func RunTarget(ctx context.Context, target models.CrawlTarget, newSource func(city, category string) source.Source) models.CrawlRun {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	crawlerLogger, _ := configLogger("crawler")
+	databaseLogger, _ := configLogger("database")
+
+	crawlerLogger.Info("crawling target", zap.String("source", target.Reference), zap.String("target", target.Name()))
+	run := RunCrawler(withTarget(ctx, target), newSource(target.City, target.Category))
+	if run.Status == models.CheckpointFinished {
+		if err := repositories.MarkCrawlTargetRun(database.DB, target.ID, time.Now()); err != nil {
+			databaseLogger.Error("Error marking crawl target run:", zap.String("target", target.Name()), zap.Error(err))
+		}
+	}
+	return run
+}
+
+// withTarget stores the budgets of target in ctx for the scrollers and workers
+func withTarget(ctx context.Context, target models.CrawlTarget) context.Context {
+	return context.WithValue(ctx, "crawl_target", source.Target{
+		Name:     target.Name(),
+		MaxPages: target.MaxPages,
+		MaxAds:   target.MaxAds,
+	})
+}
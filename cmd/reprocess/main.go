@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/config"
+	"Crawlzilla/database"
+	"Crawlzilla/logger"
+	"Crawlzilla/services/pages"
+)
+
+// Parses archived listing pages again with the current parsers and updates the stored ads:
+// go run ./cmd/reprocess -source divar
+// go run ./cmd/reprocess -run <crawl run ID>
+// go run ./cmd/reprocess -source divar -listing <listing ID>
+func main() {
+	reference := flag.String("source", "", "only reprocess the pages of this source (divar, sheypoor)")
+	runID := flag.String("run", "", "reprocess the pages archived by this crawl run")
+	listingID := flag.String("listing", "", "reprocess the newest page of this listing")
+	flag.Parse()
+
+	if *listingID != "" && *reference == "" {
+		log.Fatal("-listing needs -source")
+	}
+
+	// Load configuration
+	if err := config.LoadConfig(); err != nil {
+		log.Printf("Error loading .env file: %v", err)
+	}
+
+	configLogger := logger.ConfigLogger()
+	dbLogger, _ := configLogger("database")
+
+	if _, err := database.SetupDB(); err != nil {
+		dbLogger.Error("Database setup error", zap.Error(err))
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = context.WithValue(ctx, "configLogger", configLogger)
+
+	stats, err := crawler.Reprocess(ctx, pages.Default(), crawler.Parsers(), *reference, *runID, *listingID)
+	fmt.Print(stats)
+	if err != nil {
+		log.Fatalf("Reprocessing stopped: %v", err)
+	}
+}
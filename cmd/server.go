@@ -10,7 +10,11 @@ import (
 	"syscall"
 
 	tgBot "Crawlzilla/services/bot"
+	"Crawlzilla/services/cache"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/queue"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 
@@ -45,6 +49,21 @@ func main() {
 
 	defer stop()
 
+	// "crawler worker" mode only scrapes the jobs other processes push to the shared queue
+	if args := os.Args[1:]; len(args) == 2 && args[0] == "crawler" && args[1] == "worker" {
+		redisClient := cache.InitRedis(ctx)
+		jobQueue := queue.NewRedisQueue(redisClient, queue.ConfigFromEnv())
+		crawler.RunWorker(sharedPoliteness(ctx, redisClient), jobQueue, queue.WorkerName(), crawler.Sources())
+		return
+	}
+
+	// With CRAWL_QUEUE=redis crawls only discover listings, worker processes scrape them
+	if os.Getenv("CRAWL_QUEUE") == "redis" {
+		redisClient := cache.InitRedis(ctx)
+		var jobQueue queue.Queue = queue.NewRedisQueue(redisClient, queue.ConfigFromEnv())
+		ctx = context.WithValue(sharedPoliteness(ctx, redisClient), "crawl_queue", jobQueue)
+	}
+
 	// Initialize bot and attach it to context
 	botInstance := tgBot.Init()
 	ctx = context.WithValue(ctx, "bot", botInstance)
@@ -52,20 +71,28 @@ func main() {
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
+	// Crawl schedules are stored in the database and can be changed from the bot
+	scheduler := crawler.NewScheduler(ctx, crawler.RunSchedule, crawler.OverlapFromEnv())
+	if err := scheduler.Start(); err != nil {
+		log.Printf("Error loading crawl schedules: %v", err)
+	}
+	defer scheduler.Stop()
+	ctx = context.WithValue(ctx, "scheduler", scheduler)
+
 	c := cron.New()
-	// Divar Crawler
-	c.AddFunc("@daily", func() {
-		log.Println("Starting Crawler...")
-		crawler.RunCrawler(ctx)
-		log.Println("Crawler stopped.")
+	// Revalidate stored ads and mark removed listings
+	c.AddFunc("@every 6h", func() {
+		log.Println("Starting Revalidation...")
+		crawler.RunAdRevalidation(ctx)
+		log.Println("Revalidation stopped.")
 	})
 
-	// Sheypoor Crawler
-	// c.AddFunc("@daily", func() {
-	// 	log.Println("Starting Crawler...")
-	// 	crawler.StartSheypoorWorker(&wg)
-	// 	log.Println("Crawler stopped.")
-	// })
+	// Cluster ads that were never compared with the others
+	c.AddFunc("@daily", func() {
+		log.Println("Starting Deduplication...")
+		crawler.RunDeduplication(ctx)
+		log.Println("Deduplication stopped.")
+	})
 
 	c.Start()
 	defer c.Stop()
@@ -86,3 +113,11 @@ func main() {
 	fmt.Println("Server received shutdown signal, waiting for components to stop...")
 	return
 }
+
+// sharedPoliteness keeps the per-host rate limits in Redis, so the processes of a
+// distributed crawl share them instead of each one allowing the full rate
+func sharedPoliteness(ctx context.Context, client *redis.Client) context.Context {
+	settings := politeness.ConfigFromEnv()
+	settings.Limiter = queue.NewRedisLimiter(client)
+	return context.WithValue(ctx, "politeness", politeness.New(settings))
+}
@@ -5,7 +5,9 @@ import (
 	"os"
 	"strconv"
 
+	"Crawlzilla/database/repositories"
 	"Crawlzilla/models"
+	"Crawlzilla/utils"
 
 	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
@@ -29,12 +31,51 @@ func SetupDB() (*gorm.DB, error) {
 		log.Fatalf("failed to connect to the database: %v", err)
 	}
 
-	// Run migrations for the Ads, Filters, and Users models
-	err = db.AutoMigrate(&models.Ads{}, &models.Filters{}, &models.Users{})
+	// Ads used to be deduplicated by a unique content hash, listings are now keyed by their listing ID
+	if db.Migrator().HasIndex(&models.Ads{}, "idx_ads_hash") {
+		if err := db.Migrator().DropIndex(&models.Ads{}, "idx_ads_hash"); err != nil {
+			log.Fatalf("Failed to drop ads hash index: %v", err)
+		}
+	}
+
+	// Crawl schedules replaced the hardcoded daily crawls, a new schedules table starts with them
+	seedSchedules := !db.Migrator().HasTable(&models.CrawlSchedule{})
+
+	// Rent ads used to keep their deposit in the price, ads without a deposit column are moved once
+	backfillDeposits := db.Migrator().HasTable(&models.Ads{}) && !db.Migrator().HasColumn(&models.Ads{}, "deposit")
+
+	// Run migrations for the Ads, Filters, Users, ad history, crawl frontier, dead letter, crawl run, ad image, crawl target and crawl schedule models
+	err = db.AutoMigrate(&models.Ads{}, &models.Filters{}, &models.Users{}, &models.AdRevision{}, &models.Frontier{}, &models.Checkpoint{}, &models.DeadLetter{}, &models.CrawlRun{}, &models.AdImage{}, &models.CrawlTarget{}, &models.CrawlSchedule{}, &models.RawPage{}, &models.FieldFillRate{})
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	if seedSchedules {
+		for _, reference := range []string{"divar", "sheypoor"} {
+			schedule := models.CrawlSchedule{Reference: reference, Spec: "@daily", Enabled: true}
+			if err := repositories.CreateCrawlSchedule(db, &schedule); err != nil {
+				log.Printf("Failed to create the default %s crawl schedule: %v", reference, err)
+			}
+		}
+	}
+
+	if backfillDeposits {
+		moved, err := repositories.BackfillDeposits(db)
+		if err != nil {
+			log.Printf("Failed to backfill ad deposits: %v", err)
+		} else {
+			log.Printf("Moved the deposit of %d rent ads out of their price", moved)
+		}
+	}
+
+	// Give ads stored before listing IDs existed their listing ID
+	filled, err := repositories.BackfillSourceListingIDs(db, utils.ExtractSourceListingID)
+	if err != nil {
+		log.Printf("Failed to backfill ad listing IDs: %v", err)
+	} else if filled > 0 {
+		log.Printf("Backfilled listing IDs of %d ads", filled)
+	}
+
 	// Check if Super Admin exists, and create one if not
 	var count int64
 	err = db.Model(&models.Users{}).Where("role = ?", "super-admin").Count(&count).Error
@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+
+	"gorm.io/gorm"
+)
+
+// replaceAdImages stores the scraped gallery of an ad in place of the stored one.
+// Images that stay in the gallery keep their archived copy.
+func replaceAdImages(database *gorm.DB, adID string, images []models.AdImage) error {
+	var stored []models.AdImage
+	if err := database.Where("ad_id = ?", adID).Find(&stored).Error; err != nil {
+		return err
+	}
+	archived := make(map[string]models.AdImage)
+	for _, image := range stored {
+		if image.Archived() {
+			archived[image.URL] = image
+		}
+	}
+
+	if err := database.Where("ad_id = ?", adID).Delete(&models.AdImage{}).Error; err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return nil
+	}
+	for i := range images {
+		images[i].AdID = adID
+		if old, ok := archived[images[i].URL]; ok {
+			images[i].SHA256 = old.SHA256
+			images[i].PerceptualHash = old.PerceptualHash
+		}
+	}
+	return database.Create(&images).Error
+}
+
+// GetUnarchivedAdImages retrieves the images of an ad without a local copy, in gallery order
+func GetUnarchivedAdImages(database *gorm.DB, adID string) ([]models.AdImage, error) {
+	var images []models.AdImage
+	err := database.Where("ad_id = ? AND (sha256 = '' OR sha256 IS NULL)", adID).Order("position ASC").Find(&images).Error
+	return images, err
+}
+
+// SetAdImageArchive records the archived copy of an image
+func SetAdImageArchive(database *gorm.DB, id string, sha string, perceptualHash string) error {
+	return database.Model(&models.AdImage{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"sha256":          sha,
+		"perceptual_hash": perceptualHash,
+	}).Error
+}
@@ -2,39 +2,263 @@ package repositories
 
 import (
 	"Crawlzilla/models"
-	"errors"
+	"Crawlzilla/utils"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// CreateAd adds a new scrap result to the database if it doesn't already exist
+type AdSaveResult string
+
+// Constants for the outcome of saving a scraped ad
+const (
+	AdInserted  AdSaveResult = "inserted"
+	AdUpdated   AdSaveResult = "updated"
+	AdUnchanged AdSaveResult = "unchanged"
+)
+
+// CreateAd adds a new scrap result to the database, or updates the stored ad of the same listing
 func CreateAd(database *gorm.DB, result *models.Ads) (string, error) {
-	// Manually call BeforeCreate to generate the hash before querying the database
-	if err := result.BeforeCreate(database); err != nil {
-		return "", fmt.Errorf("failed to generate hash: %v", err)
+	id, _, err := UpsertAd(database, result)
+	return id, err
+}
+
+// UpsertAd stores an ad keyed by its (Reference, SourceListingID). A listing that is
+// already stored gets its changed fields updated and its LastSeenAt bumped.
+func UpsertAd(database *gorm.DB, result *models.Ads) (string, AdSaveResult, error) {
+	return UpsertAdSeenAt(database, result, time.Now())
+}
+
+// UpsertAdSeenAt is UpsertAd for a listing seen at seenAt, e.g. an archived page parsed again.
+// It never moves LastSeenAt back, and only reactivates an ad marked inactive before seenAt.
+func UpsertAdSeenAt(database *gorm.DB, result *models.Ads, seenAt time.Time) (string, AdSaveResult, error) {
+	result.LastSeenAt = seenAt
+
+	// Ads without a listing ID can't be matched, they are always new
+	if result.SourceListingID == "" {
+		return insertAd(database, result)
+	}
+
+	// The unique index settles which of two workers saving the same listing inserts it,
+	// the other one finds the stored ad and updates it
+	inserted, err := insertListing(database, result)
+	if err != nil {
+		return "", "", err
+	}
+	if inserted {
+		return result.ID, AdInserted, nil
 	}
 
-	// Check if a record with the same hash already exists
 	var existing models.Ads
-	err := database.Where("hash = ?", result.Hash).First(&existing).Error
+	err = database.Where("reference = ? AND source_listing_id = ?", result.Reference, result.SourceListingID).First(&existing).Error
+	if err != nil {
+		return "", "", err
+	}
+
+	// Keep what belongs to the stored ad rather than to this scrape
+	result.ID = existing.ID
+	result.CreatedAt = existing.CreatedAt
+	result.VisitCount = existing.VisitCount
+	result.LastCheckedAt = existing.LastCheckedAt
+	// A year worked out from the building age is anchored to when the ad was first stored,
+	// so a listing whose age is unchanged keeps its year instead of moving every Nowruz
+	if result.AgeBasedYear && result.YearBuilt != 0 {
+		result.YearBuilt += utils.SolarYear(existing.CreatedAt) - utils.SolarYear(seenAt)
+	}
+	result.Hash = result.ContentHash()
+
+	if existing.LastSeenAt.After(seenAt) {
+		result.LastSeenAt = existing.LastSeenAt
+	}
+
+	// A listing found by a crawl is online again, even if revalidation marked it inactive
+	result.Status = models.AdActive
+	result.StatusChangedAt = existing.StatusChangedAt
+	if existing.Status != models.AdActive {
+		if seenAt.After(existing.StatusChangedAt) {
+			result.StatusChangedAt = seenAt
+		} else {
+			result.Status = existing.Status
+		}
+	}
+
+	if result.Hash == existing.Hash {
+		err := database.Model(&existing).UpdateColumns(map[string]interface{}{
+			"last_seen_at":      result.LastSeenAt,
+			"status":            result.Status,
+			"status_changed_at": result.StatusChangedAt,
+		}).Error
+		if err != nil {
+			return "", "", err
+		}
+		return existing.ID, AdUnchanged, nil
+	}
+
+	// Update the ad and record what changed in one transaction
+	revisions := models.DiffAds(&existing, result)
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&existing).Select("*").Omit("ID", "CreatedAt", "VisitCount", "ClusterID", clause.Associations).Updates(result).Error; err != nil {
+			return err
+		}
+		if err := replaceAdImages(tx, existing.ID, result.Images); err != nil {
+			return err
+		}
+		if len(revisions) > 0 {
+			return tx.Create(&revisions).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("can't update ad %s: %w", existing.ID, err)
+	}
+	return existing.ID, AdUpdated, nil
+}
+
+// TouchListing bumps LastSeenAt of the stored ad of a listing and reports whether there is one
+func TouchListing(database *gorm.DB, reference string, sourceListingID string) (bool, error) {
+	result := database.Model(&models.Ads{}).
+		Where("reference = ? AND source_listing_id = ?", reference, sourceListingID).
+		UpdateColumn("last_seen_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
 
-	if err == nil {
-		// Hash exists, log that it already exists and skip insertion
-		fmt.Println("Record with hash already exists, skipping insert.")
-		return "", errors.New("hash of data existed")
+func insertAd(database *gorm.DB, result *models.Ads) (string, AdSaveResult, error) {
+	if err := database.Create(result).Error; err != nil {
+		return "", "", fmt.Errorf("can't add ad: %w", err)
 	}
+	return result.ID, AdInserted, nil
+}
 
-	// If no record with the hash was found, proceed with the creation
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		if err2 := database.Create(&result).Error; err2 != nil {
-			// Handle error if insert fails
-			return "", errors.New("cant't add to database")
+// insertListing inserts the ad of a listing unless the listing is stored already, in one statement
+func insertListing(database *gorm.DB, result *models.Ads) (bool, error) {
+	inserted := false
+	err := database.Transaction(func(tx *gorm.DB) error {
+		created := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "reference"}, {Name: "source_listing_id"}},
+			DoNothing: true,
+		}).Create(result)
+		if created.Error != nil || created.RowsAffected == 0 {
+			return created.Error
+		}
+		inserted = true
+		return replaceAdImages(tx, result.ID, result.Images)
+	})
+	if err != nil {
+		return false, fmt.Errorf("can't add ad: %w", err)
+	}
+	return inserted, nil
+}
+
+// GetAdsToRevalidate retrieves active crawled ads of a source that were not checked since the given time, least recently checked first
+func GetAdsToRevalidate(database *gorm.DB, reference string, checkedBefore time.Time, limit int) ([]models.Ads, error) {
+	var ads []models.Ads
+	err := database.Where("reference = ? AND status = ? AND (last_checked_at IS NULL OR last_checked_at < ?)", reference, models.AdActive, checkedBefore).
+		Order("last_checked_at ASC NULLS FIRST").
+		Limit(limit).
+		Find(&ads).Error
+	return ads, err
+}
+
+// UpdateAdStatus records the result of a revalidation visit
+func UpdateAdStatus(database *gorm.DB, id string, status models.AdStatus, checkedAt time.Time) error {
+	var ad models.Ads
+	if err := database.Select("id", "status").Where("id = ?", id).First(&ad).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"status":          status,
+		"last_checked_at": checkedAt,
+	}
+	if ad.Status != status {
+		updates["status_changed_at"] = checkedAt
+	}
+	return database.Model(&models.Ads{}).Where("id = ?", id).UpdateColumns(updates).Error
+}
+
+// GetAdRevisions retrieves the recorded changes of an ad, oldest first
+func GetAdRevisions(database *gorm.DB, adID string) ([]models.AdRevision, error) {
+	var revisions []models.AdRevision
+	err := database.Where("ad_id = ?", adID).Order("created_at ASC").Find(&revisions).Error
+	return revisions, err
+}
+
+// GetFieldRevisions retrieves the changes of one field for several ads, oldest first
+func GetFieldRevisions(database *gorm.DB, adIDs []string, field string) ([]models.AdRevision, error) {
+	var revisions []models.AdRevision
+	err := database.Where("ad_id IN ? AND field = ?", adIDs, field).Order("created_at ASC").Find(&revisions).Error
+	return revisions, err
+}
+
+// BackfillDeposits moves the deposit of rent ads and filters, stored in the price before ads had
+// a deposit, to the deposit, and renames the old "house" property type of sheypoor ads to apartment
+func BackfillDeposits(database *gorm.DB) (int64, error) {
+	var moved int64
+	err := database.Transaction(func(tx *gorm.DB) error {
+		rentAds := tx.Model(&models.Ads{}).Select("id").Where("category_type = ? AND price > 0 AND deposit = 0", "rent")
+		if err := tx.Model(&models.AdRevision{}).Where("field = ? AND ad_id IN (?)", "Price", rentAds).Update("field", "Deposit").Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Ads{}).Where("category_type = ? AND price > 0 AND deposit = 0", "rent").
+			UpdateColumns(map[string]interface{}{"deposit": gorm.Expr("price"), "price": 0})
+		if result.Error != nil {
+			return result.Error
+		}
+		moved = result.RowsAffected
+
+		err := tx.Model(&models.Filters{}).Where("category_type = ? AND min_deposit = 0 AND max_deposit = 0", "rent").
+			UpdateColumns(map[string]interface{}{
+				"min_deposit": gorm.Expr("min_price"),
+				"max_deposit": gorm.Expr("max_price"),
+				"min_price":   0,
+				"max_price":   0,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Ads{}).Where("property_type = ?", "house").UpdateColumn("property_type", models.PropertyApartment).Error
+	})
+	return moved, err
+}
+
+// BackfillSourceListingIDs sets the listing ID of ads stored before ads had one.
+// When a listing was stored several times only the newest copy gets the ID,
+// the older copies are left without one.
+func BackfillSourceListingIDs(database *gorm.DB, extract func(reference string, adURL string) string) (int, error) {
+	var ads []models.Ads
+	err := database.Select("id", "reference", "url").
+		Where("source_listing_id IS NULL OR source_listing_id = ''").
+		Order("created_at DESC").
+		Find(&ads).Error
+	if err != nil {
+		return 0, err
+	}
+
+	filled := 0
+	for _, ad := range ads {
+		listingID := extract(ad.Reference, ad.URL)
+		if listingID == "" {
+			// Not a crawled listing, it is its own listing
+			listingID = ad.ID
+		}
+
+		var count int64
+		if err := database.Model(&models.Ads{}).Where("reference = ? AND source_listing_id = ?", ad.Reference, listingID).Count(&count).Error; err != nil {
+			return filled, err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := database.Model(&models.Ads{}).Where("id = ?", ad.ID).UpdateColumn("source_listing_id", listingID).Error; err != nil {
+			return filled, err
 		}
-		fmt.Println("Record added to DB successfully!")
-		return result.ID, nil
+		filled++
 	}
-	return "", err
+	return filled, nil
 }
 
 // GetAllAds retrieves ads with pagination and selects specific fields
@@ -70,8 +294,10 @@ func GetAdByID(database *gorm.DB, id string) (models.Ads, error) {
 		return result, err
 	}
 
-	// Fetch the updated record to include the incremented visit_count
-	err = database.Where("id = ?", id).First(&result).Error
+	// Fetch the updated record to include the incremented visit_count, with its gallery in order
+	err = database.Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("id = ?", id).First(&result).Error
 	return result, err
 }
 
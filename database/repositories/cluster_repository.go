@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// FindAd retrieves an ad by ID without counting a visit
+func FindAd(db *gorm.DB, id string) (models.Ads, error) {
+	var ad models.Ads
+	err := db.Where("id = ?", id).First(&ad).Error
+	return ad, err
+}
+
+// GetClusterCandidates retrieves the ads that could be the same property as ad: in its city,
+// within maxDistance meters of it when both have coordinates, with a close area and the same
+// room count, or no room count. The newest ads come first, so the limit keeps the likely copies.
+func GetClusterCandidates(db *gorm.DB, ad models.Ads, maxAreaDifference float64, maxDistance float64, limit int) ([]models.Ads, error) {
+	var candidates []models.Ads
+	query := db.Where("id <> ?", ad.ID).
+		Where("area BETWEEN ? AND ?", float64(ad.Area)*(1-maxAreaDifference), float64(ad.Area)/(1-maxAreaDifference))
+	if ad.City != "" {
+		query = query.Where("city = ? OR city = ''", ad.City)
+	}
+	if ad.Latitude != 0 || ad.Longitude != 0 {
+		// A degree of latitude is about 111 km, a degree of longitude shrinks towards the poles
+		latitude := maxDistance / 111320
+		longitude := latitude / math.Cos(ad.Latitude*math.Pi/180)
+		query = query.Where("(latitude = 0 AND longitude = 0) OR (latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?)",
+			ad.Latitude-latitude, ad.Latitude+latitude, ad.Longitude-longitude, ad.Longitude+longitude)
+	}
+	if ad.Room > 0 {
+		query = query.Where("room = ? OR room = 0", ad.Room)
+	}
+	if ad.CategoryType != "" {
+		query = query.Where("category_type = ? OR category_type = ''", ad.CategoryType)
+	}
+	err := query.Order("created_at DESC").Limit(limit).Find(&candidates).Error
+	return candidates, err
+}
+
+// SetClusterID puts ads in a duplicate cluster
+func SetClusterID(db *gorm.DB, ids []string, clusterID string) error {
+	return db.Model(&models.Ads{}).Where("id IN ?", ids).UpdateColumn("cluster_id", clusterID).Error
+}
+
+// GetUnclusteredAdIDs retrieves ads that were never compared with the others, oldest first
+func GetUnclusteredAdIDs(db *gorm.DB, limit int) ([]string, error) {
+	var ids []string
+	err := db.Model(&models.Ads{}).
+		Where("cluster_id = '' OR cluster_id IS NULL").
+		Order("created_at ASC").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
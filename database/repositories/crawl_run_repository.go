@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+
+	"gorm.io/gorm"
+)
+
+// CreateCrawlRun stores a new crawl run
+func CreateCrawlRun(db *gorm.DB, run *models.CrawlRun) error {
+	return db.Create(run).Error
+}
+
+// SaveCrawlRun stores the latest statistics of a crawl run
+func SaveCrawlRun(db *gorm.DB, run *models.CrawlRun) error {
+	return db.Save(run).Error
+}
+
+// GetLastCrawlRuns retrieves the latest runs, newest first. An empty reference returns the runs of every source.
+func GetLastCrawlRuns(db *gorm.DB, reference string, limit int) ([]models.CrawlRun, error) {
+	var runs []models.CrawlRun
+	query := db.Order("started_at DESC").Limit(limit)
+	if reference != "" {
+		query = query.Where("reference = ?", reference)
+	}
+	err := query.Find(&runs).Error
+	return runs, err
+}
+
+// GetPreviousCrawlRun retrieves the run of the same source and target that started before the given run
+func GetPreviousCrawlRun(db *gorm.DB, run models.CrawlRun) (models.CrawlRun, error) {
+	var previous models.CrawlRun
+	err := db.Where("reference = ? AND COALESCE(target, '') = ? AND started_at < ?", run.Reference, run.Target, run.StartedAt).
+		Order("started_at DESC").
+		First(&previous).Error
+	return previous, err
+}
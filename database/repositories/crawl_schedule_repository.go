@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+
+	"gorm.io/gorm"
+)
+
+// CreateCrawlSchedule stores a new crawl schedule
+func CreateCrawlSchedule(db *gorm.DB, schedule *models.CrawlSchedule) error {
+	return db.Create(schedule).Error
+}
+
+// GetCrawlSchedules retrieves every crawl schedule ordered by source
+func GetCrawlSchedules(db *gorm.DB) ([]models.CrawlSchedule, error) {
+	var schedules []models.CrawlSchedule
+	err := db.Order("reference ASC, created_at ASC").Find(&schedules).Error
+	return schedules, err
+}
+
+// GetEnabledCrawlSchedules retrieves the schedules the scheduler runs
+func GetEnabledCrawlSchedules(db *gorm.DB) ([]models.CrawlSchedule, error) {
+	var schedules []models.CrawlSchedule
+	err := db.Where("enabled = ?", true).Order("reference ASC, created_at ASC").Find(&schedules).Error
+	return schedules, err
+}
+
+// GetCrawlScheduleByID retrieves a crawl schedule
+func GetCrawlScheduleByID(db *gorm.DB, id string) (models.CrawlSchedule, error) {
+	var schedule models.CrawlSchedule
+	err := db.First(&schedule, "id = ?", id).Error
+	return schedule, err
+}
+
+// UpdateCrawlSchedule sets the cron expression and state of a schedule
+func UpdateCrawlSchedule(db *gorm.DB, id string, spec string, enabled bool) error {
+	result := db.Model(&models.CrawlSchedule{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"spec":    spec,
+		"enabled": enabled,
+	})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// DeleteCrawlSchedule removes a crawl schedule
+func DeleteCrawlSchedule(db *gorm.DB, id string) error {
+	result := db.Where("id = ?", id).Delete(&models.CrawlSchedule{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// DeleteCrawlSchedulesOfTarget removes the schedules of a removed target
+func DeleteCrawlSchedulesOfTarget(db *gorm.DB, targetID string) error {
+	return db.Where("target_id = ?", targetID).Delete(&models.CrawlSchedule{}).Error
+}
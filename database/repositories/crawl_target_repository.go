@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateCrawlTarget stores a new crawl target
+func CreateCrawlTarget(db *gorm.DB, target *models.CrawlTarget) error {
+	return db.Create(target).Error
+}
+
+// GetCrawlTargets retrieves every crawl target ordered by source, city and category
+func GetCrawlTargets(db *gorm.DB) ([]models.CrawlTarget, error) {
+	var targets []models.CrawlTarget
+	err := db.Order("reference ASC, city ASC, category ASC").Find(&targets).Error
+	return targets, err
+}
+
+// GetCrawlTargetByID retrieves a crawl target
+func GetCrawlTargetByID(db *gorm.DB, id string) (models.CrawlTarget, error) {
+	var target models.CrawlTarget
+	err := db.First(&target, "id = ?", id).Error
+	return target, err
+}
+
+// GetDueCrawlTargets retrieves the enabled targets of a source, the one crawled longest ago first
+func GetDueCrawlTargets(db *gorm.DB, reference string) ([]models.CrawlTarget, error) {
+	var targets []models.CrawlTarget
+	err := db.Where("reference = ? AND enabled = ?", reference, true).
+		Order("last_run_at ASC, created_at ASC").
+		Find(&targets).Error
+	return targets, err
+}
+
+// CountCrawlTargets counts the targets of a source, enabled or not
+func CountCrawlTargets(db *gorm.DB, reference string) (int64, error) {
+	var count int64
+	err := db.Model(&models.CrawlTarget{}).Where("reference = ?", reference).Count(&count).Error
+	return count, err
+}
+
+// SetCrawlTargetEnabled turns a crawl target on or off
+func SetCrawlTargetEnabled(db *gorm.DB, id string, enabled bool) error {
+	result := db.Model(&models.CrawlTarget{}).Where("id = ?", id).Update("enabled", enabled)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// MarkCrawlTargetRun records that a run of the target finished
+func MarkCrawlTargetRun(db *gorm.DB, id string, at time.Time) error {
+	return db.Model(&models.CrawlTarget{}).Where("id = ?", id).Update("last_run_at", at).Error
+}
+
+// DeleteCrawlTarget removes a crawl target
+func DeleteCrawlTarget(db *gorm.DB, id string) error {
+	result := db.Where("id = ?", id).Delete(&models.CrawlTarget{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// GetCrawlTarget retrieves the target of a source covering a city and category
+func GetCrawlTarget(db *gorm.DB, reference, city, category string) (models.CrawlTarget, error) {
+	var target models.CrawlTarget
+	err := db.Where("reference = ? AND city = ? AND category = ?", reference, city, category).First(&target).Error
+	return target, err
+}
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// AddDeadLetter stores a URL the crawler gave up on. A URL that is already in the
+// dead-letter store gets the new failure and its attempts are added up.
+func AddDeadLetter(db *gorm.DB, letter *models.DeadLetter) error {
+	var existing models.DeadLetter
+	err := db.Where("reference = ? AND url = ?", letter.Reference, letter.URL).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Create(letter).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	letter.ID = existing.ID
+	letter.CreatedAt = existing.CreatedAt
+	letter.Attempts += existing.Attempts
+	return db.Model(&existing).Updates(map[string]interface{}{
+		"category": letter.Category,
+		"kind":     letter.Kind,
+		"error":    letter.Error,
+		"attempts": letter.Attempts,
+	}).Error
+}
+
+// RemoveDeadLetter deletes the dead letter of a URL, if there is one
+func RemoveDeadLetter(db *gorm.DB, reference string, url string) error {
+	return db.Where("reference = ? AND url = ?", reference, url).Delete(&models.DeadLetter{}).Error
+}
+
+// GetDeadLetters retrieves a page of dead letters, most recent failure first
+func GetDeadLetters(db *gorm.DB, offset, limit int) ([]models.DeadLetter, int64, error) {
+	var letters []models.DeadLetter
+	var totalRecords int64
+
+	if err := db.Model(&models.DeadLetter{}).Count(&totalRecords).Error; err != nil {
+		return nil, 0, err
+	}
+	err := db.Order("updated_at DESC").Offset(offset).Limit(limit).Find(&letters).Error
+	return letters, totalRecords, err
+}
+
+// CountDeadLettersByKind counts the dead letters of every failure kind
+func CountDeadLettersByKind(db *gorm.DB) (map[models.FailureKind]int64, error) {
+	var rows []struct {
+		Kind  models.FailureKind
+		Count int64
+	}
+	err := db.Model(&models.DeadLetter{}).Select("kind, COUNT(*) AS count").Group("kind").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[models.FailureKind]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Kind] = row.Count
+	}
+	return counts, nil
+}
+
+// RequeueDeadLetter moves a dead letter back to the pending frontier of its source,
+// so the next crawl run scrapes it again
+func RequeueDeadLetter(db *gorm.DB, id string) (models.DeadLetter, error) {
+	var letter models.DeadLetter
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).First(&letter).Error; err != nil {
+			return err
+		}
+		if err := requeueFrontier(tx, letter); err != nil {
+			return err
+		}
+		return tx.Delete(&letter).Error
+	})
+	return letter, err
+}
+
+// RequeueAllDeadLetters moves every dead letter back to the pending frontier and returns how many were moved
+func RequeueAllDeadLetters(db *gorm.DB) (int, error) {
+	var letters []models.DeadLetter
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Find(&letters).Error; err != nil {
+			return err
+		}
+		for _, letter := range letters {
+			if err := requeueFrontier(tx, letter); err != nil {
+				return err
+			}
+		}
+		if len(letters) == 0 {
+			return nil
+		}
+		return tx.Delete(&letters).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(letters), nil
+}
+
+func requeueFrontier(tx *gorm.DB, letter models.DeadLetter) error {
+	var frontier models.Frontier
+	err := tx.Where("reference = ? AND url = ?", letter.Reference, letter.URL).First(&frontier).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		frontier = models.Frontier{Reference: letter.Reference, URL: letter.URL, Category: letter.Category, Status: models.FrontierPending}
+		return tx.Create(&frontier).Error
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Model(&frontier).Updates(map[string]interface{}{
+		"status":     models.FrontierPending,
+		"attempts":   0,
+		"last_error": "",
+	}).Error
+}
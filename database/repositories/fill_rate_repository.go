@@ -0,0 +1,29 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+
+	"gorm.io/gorm"
+)
+
+// SaveFieldFillRates stores the field fill rates of a crawl run
+func SaveFieldFillRates(db *gorm.DB, rates []models.FieldFillRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return db.Create(&rates).Error
+}
+
+// GetPreviousFillRates retrieves the field fill rates of the last runs of the same source and target
+// that started before run, at most runs of them
+func GetPreviousFillRates(db *gorm.DB, run models.CrawlRun, runs int) ([]models.FieldFillRate, error) {
+	previous := db.Model(&models.CrawlRun{}).
+		Select("id").
+		Where("reference = ? AND COALESCE(target, '') = ? AND started_at < ?", run.Reference, run.Target, run.StartedAt).
+		Order("started_at DESC").
+		Limit(runs)
+
+	var rates []models.FieldFillRate
+	err := db.Where("crawl_run_id IN (?)", previous).Find(&rates).Error
+	return rates, err
+}
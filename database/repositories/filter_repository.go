@@ -25,12 +25,17 @@ func CreateOrUpdateFilter(db *gorm.DB, filter *models.Filters) error {
 			existingFilter.MaxArea = filter.MaxArea
 			existingFilter.MinPrice = filter.MinPrice
 			existingFilter.MaxPrice = filter.MaxPrice
+			existingFilter.MinDeposit = filter.MinDeposit
+			existingFilter.MaxDeposit = filter.MaxDeposit
 			existingFilter.MinRent = filter.MinRent
 			existingFilter.MaxRent = filter.MaxRent
 			existingFilter.MinRoom = filter.MinRoom
 			existingFilter.MaxRoom = filter.MaxRoom
 			existingFilter.MinFloorNumber = filter.MinFloorNumber
 			existingFilter.MaxFloorNumber = filter.MaxFloorNumber
+			existingFilter.MinYearBuilt = filter.MinYearBuilt
+			existingFilter.MaxYearBuilt = filter.MaxYearBuilt
+			existingFilter.MinParking = filter.MinParking
 			existingFilter.HasElevator = filter.HasElevator
 			existingFilter.HasStorage = filter.HasStorage
 			existingFilter.HasParking = filter.HasParking
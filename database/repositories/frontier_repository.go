@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddToFrontier stores a discovered URL as pending. A URL that is already queued,
+// or was already scraped since the given run start, is not added again and false is returned.
+func AddToFrontier(db *gorm.DB, frontier *models.Frontier, since time.Time) (bool, error) {
+	var existing models.Frontier
+	err := db.Where("reference = ? AND url = ?", frontier.Reference, frontier.URL).First(&existing).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		frontier.Status = models.FrontierPending
+		if err := db.Create(frontier).Error; err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Pending and in-progress URLs are already on their way to a worker
+	if existing.Status == models.FrontierPending || existing.Status == models.FrontierInProgress {
+		return false, nil
+	}
+	// Scraped earlier in this run, for example seen again on a later page
+	if !existing.UpdatedAt.Before(since) {
+		return false, nil
+	}
+
+	// Scraped by an earlier run, queue it again
+	err = db.Model(&existing).Updates(map[string]interface{}{
+		"status":     models.FrontierPending,
+		"category":   frontier.Category,
+		"target":     frontier.Target,
+		"attempts":   0,
+		"last_error": "",
+	}).Error
+	if err != nil {
+		return false, err
+	}
+	*frontier = existing
+	return true, nil
+}
+
+// GetFrontierByStatus retrieves the URLs of a source in the given state, oldest first
+func GetFrontierByStatus(db *gorm.DB, reference string, status models.FrontierStatus) ([]models.Frontier, error) {
+	var frontier []models.Frontier
+	err := db.Where("reference = ? AND status = ?", reference, status).Order("created_at ASC").Find(&frontier).Error
+	return frontier, err
+}
+
+// GetPendingFrontier retrieves the pending URLs a run of a target resumes, oldest first.
+// These are the URLs the target found and the ones re-queued without a target.
+func GetPendingFrontier(db *gorm.DB, reference string, target string) ([]models.Frontier, error) {
+	var frontier []models.Frontier
+	err := db.Where("reference = ? AND status = ? AND (target = ? OR target = '')", reference, models.FrontierPending, target).
+		Order("created_at ASC").Find(&frontier).Error
+	return frontier, err
+}
+
+// ResetInProgressFrontier moves URLs a target left in-progress when its process stopped back to pending
+func ResetInProgressFrontier(db *gorm.DB, reference string, target string) error {
+	return db.Model(&models.Frontier{}).
+		Where("reference = ? AND target = ? AND status = ?", reference, target, models.FrontierInProgress).
+		Update("status", models.FrontierPending).Error
+}
+
+// UpdateFrontierStatus sets the state of a URL, entering in-progress counts as a new attempt
+func UpdateFrontierStatus(db *gorm.DB, reference string, url string, status models.FrontierStatus, lastError string) error {
+	updates := map[string]interface{}{
+		"status":     status,
+		"last_error": lastError,
+	}
+	if status == models.FrontierInProgress {
+		updates["attempts"] = gorm.Expr("attempts + ?", 1)
+	}
+	return db.Model(&models.Frontier{}).
+		Where("reference = ? AND url = ?", reference, url).
+		Updates(updates).Error
+}
+
+// GetCheckpoint retrieves the checkpoint of the latest run of a target, an empty target is the whole site
+func GetCheckpoint(db *gorm.DB, reference string, target string) (models.Checkpoint, error) {
+	var checkpoint models.Checkpoint
+	err := db.Where("reference = ? AND target = ?", reference, target).First(&checkpoint).Error
+	return checkpoint, err
+}
+
+// SaveCheckpoint creates or replaces the checkpoint of a target
+func SaveCheckpoint(db *gorm.DB, checkpoint *models.Checkpoint) error {
+	// Save can't tell an update from an insert when the target is empty, so upsert on the key
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "reference"}, {Name: "target"}},
+		UpdateAll: true,
+	}).Create(checkpoint).Error
+}
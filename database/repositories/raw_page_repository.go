@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"Crawlzilla/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// SaveRawPage stores the archived page of a listing, a listing scraped again by the same run replaces its page
+func SaveRawPage(db *gorm.DB, page *models.RawPage) error {
+	var existing models.RawPage
+	err := db.Where("crawl_run_id = ? AND reference = ? AND source_listing_id = ?", page.CrawlRunID, page.Reference, page.SourceListingID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Create(page).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	page.ID = existing.ID
+	page.CreatedAt = existing.CreatedAt
+	return db.Model(&existing).Select("URL", "Category", "Path", "ScreenshotPath", "Size", "ScrapeError").Updates(page).Error
+}
+
+// GetRawPagesOfRun retrieves the pages archived by a crawl run
+func GetRawPagesOfRun(db *gorm.DB, crawlRunID string) ([]models.RawPage, error) {
+	var pages []models.RawPage
+	err := db.Where("crawl_run_id = ?", crawlRunID).Order("created_at ASC").Find(&pages).Error
+	return pages, err
+}
+
+// GetLatestRawPages retrieves the newest archived page of every listing, of one source or of all
+// of them when reference is empty, or of a single listing when sourceListingID is set
+func GetLatestRawPages(db *gorm.DB, reference string, sourceListingID string) ([]models.RawPage, error) {
+	latest := db.Model(&models.RawPage{}).
+		Select("reference, source_listing_id, MAX(created_at) AS created_at").
+		Group("reference, source_listing_id")
+	if reference != "" {
+		latest = latest.Where("reference = ?", reference)
+	}
+	if sourceListingID != "" {
+		latest = latest.Where("source_listing_id = ?", sourceListingID)
+	}
+
+	var pages []models.RawPage
+	err := db.Model(&models.RawPage{}).
+		Joins("JOIN (?) AS latest ON latest.reference = raw_pages.reference AND latest.source_listing_id = raw_pages.source_listing_id AND latest.created_at = raw_pages.created_at", latest).
+		Order("raw_pages.created_at ASC").
+		Find(&pages).Error
+	return pages, err
+}
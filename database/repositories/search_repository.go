@@ -27,3 +27,25 @@ func GetFilteredAds(db *gorm.DB, query *gorm.DB, page, pageSize int) ([]models.A
 	}
 	return ads, nil
 }
+
+// CollapseClusters narrows a filtered ads query to one ad of every duplicate cluster,
+// ads without a cluster are their own cluster
+func CollapseClusters(query *gorm.DB) *gorm.DB {
+	representatives := query.Session(&gorm.Session{}).
+		Select("MIN(CAST(id AS TEXT))").
+		Group("COALESCE(NULLIF(cluster_id, ''), CAST(id AS TEXT))")
+	return query.Where("CAST(id AS TEXT) IN (?)", representatives)
+}
+
+// GetClusterMembers retrieves every ad of the given duplicate clusters
+func GetClusterMembers(db *gorm.DB, clusterIDs []string) ([]models.Ads, error) {
+	var ads []models.Ads
+	if len(clusterIDs) == 0 {
+		return ads, nil
+	}
+	err := db.Select("id", "cluster_id", "reference", "url", "price", "rent", "status").
+		Where("cluster_id IN ?", clusterIDs).
+		Order("created_at ASC").
+		Find(&ads).Error
+	return ads, err
+}
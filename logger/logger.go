@@ -2,6 +2,7 @@ package logger
 
 import (
 	"Crawlzilla/config"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -117,3 +118,13 @@ func ConfigLogger() ConfigLoggerType {
 	logConfig := CreateLogger("crawler", "bot", "database")
 	return logConfig
 }
+
+// FromContext returns the scope logger stored in ctx, or a no-op logger when ctx has none
+func FromContext(ctx context.Context, scope string) *zap.Logger {
+	if configLogger, ok := ctx.Value("configLogger").(ConfigLoggerType); ok {
+		if logger, err := configLogger(scope); err == nil {
+			return logger
+		}
+	}
+	return zap.NewNop()
+}
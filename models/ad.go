@@ -3,7 +3,9 @@ package models
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,68 +19,134 @@ type AdSummary struct {
 	ImageURL string `json:"image_url"`
 }
 
+type AdStatus string
+
+// Constants for the listing states found by revalidation
+const (
+	AdActive  AdStatus = "active"
+	AdExpired AdStatus = "expired"
+	AdSold    AdStatus = "sold"
+)
+
+// Constants for the property types of an ad
+const (
+	PropertyApartment = "apartment"
+	PropertyVila      = "vila"
+	PropertyOffice    = "office"
+	PropertyShop      = "shop"
+	PropertyLand      = "land"
+	PropertyPresale   = "presale"
+)
+
+// PropertyTypes lists every property type the scrapers and filters know
+var PropertyTypes = []string{PropertyApartment, PropertyVila, PropertyOffice, PropertyShop, PropertyLand, PropertyPresale}
+
 // Ads struct definition as before
 type Ads struct {
-	ID            string    `gorm:"type:uuid;primary_key;"`
-	Hash          string    `gorm:"type:char(64);uniqueIndex"` // Unique hash to prevent duplicates
-	CreatedAt     time.Time `gorm:"autoCreateTime"`
-	Title         string    `gorm:"type:varchar(50);not null"`
-	Description   string    `gorm:"type:text"`
-	LocationURL   string    `gorm:"type:varchar(255)"`
-	ImageURL      string    `gorm:"type:varchar(255)"`
-	URL           string    `gorm:"type:varchar(255)"`
-	City          string    `gorm:"type:varchar(32)"`
-	Neighborhood  string    `gorm:"type:varchar(32)"`
-	ContactNumber string    `gorm:"type:varchar(32)"`
-	Reference     string    `gorm:"type:varchar(10)"`
-	CategoryType  string    `gorm:"type:varchar(10)"`
-	PropertyType  string    `gorm:"type:varchar(10)"`
-	Latitude      float64   `gorm:"type:decimal(9,6)"`
-	Longitude     float64   `gorm:"type:decimal(9,6)"`
-	Area          int       `gorm:"type:int"`
-	Price         int       `gorm:"type:int"`
-	Rent          int       `gorm:"type:int"`
-	Room          int       `gorm:"type:int"`
-	FloorNumber   int       `gorm:"type:int"`
-	TotalFloors   int       `gorm:"type:int"`
-	VisitCount    int       `gorm:"type:int"`
-	HasElevator   bool      `gorm:"type:boolean"`
-	HasStorage    bool      `gorm:"type:boolean"`
-	HasParking    bool      `gorm:"type:boolean"`
-	HasBalcony    bool      `gorm:"type:boolean"`
+	ID              string    `gorm:"type:uuid;primary_key;"`
+	Hash            string    `gorm:"type:char(64)"`                                                     // Hash of the listing content to detect changes
+	SourceListingID string    `gorm:"type:varchar(64);uniqueIndex:idx_ads_reference_listing,priority:2"` // ID of the listing on its site, unique per Reference
+	ClusterID       string    `gorm:"type:varchar(36);index"`                                            // Ads of the same property share a cluster, empty until deduplication ran
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	LastSeenAt      time.Time // Last time a crawl found the listing
+	Status          AdStatus  `gorm:"type:varchar(10);default:active;index"`
+	StatusChangedAt time.Time
+	LastCheckedAt   time.Time // Last time revalidation visited the listing
+	Title           string    `gorm:"type:varchar(50);not null"`
+	Description     string    `gorm:"type:text"`
+	LocationURL     string    `gorm:"type:varchar(255)"`
+	ImageURL        string    `gorm:"type:varchar(255)"` // Cover image, the first image of the gallery
+	Images          []AdImage `gorm:"foreignKey:AdID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	URL             string    `gorm:"type:varchar(255)"`
+	City            string    `gorm:"type:varchar(32)"`
+	Neighborhood    string    `gorm:"type:varchar(32)"`
+	ContactNumber   string    `gorm:"type:varchar(32)"`
+	Reference       string    `gorm:"type:varchar(10);uniqueIndex:idx_ads_reference_listing,priority:1"`
+	CategoryType    string    `gorm:"type:varchar(10)"`
+	PropertyType    string    `gorm:"type:varchar(10)"`
+	Latitude        float64   `gorm:"type:decimal(9,6)"`
+	Longitude       float64   `gorm:"type:decimal(9,6)"`
+	Area            int       `gorm:"type:int"`
+	Price           int       `gorm:"type:int"` // Sale price, rent ads keep their rahn in Deposit
+	Deposit         int       `gorm:"type:int"` // Deposit (rahn) of a rent ad
+	Rent            int       `gorm:"type:int"`
+	Room            int       `gorm:"type:int"`
+	FloorNumber     int       `gorm:"type:int"`
+	TotalFloors     int       `gorm:"type:int"`
+	YearBuilt       int       `gorm:"type:int"` // Solar Hijri year the building was built, 0 when unknown
+	ParkingCount    int       `gorm:"type:int"`
+	VisitCount      int       `gorm:"type:int"`
+	HasElevator     bool      `gorm:"type:boolean"`
+	HasStorage      bool      `gorm:"type:boolean"`
+	HasParking      bool      `gorm:"type:boolean"`
+	HasBalcony      bool      `gorm:"type:boolean"`
+
+	// AgeBasedYear is set by scrapers that work YearBuilt out from the building age the listing gives
+	AgeBasedYear bool `gorm:"-" json:"-"`
+}
+
+// hashIgnoredFields are not part of the listing content
+var hashIgnoredFields = map[string]bool{
+	"ID":              true,
+	"Hash":            true,
+	"CreatedAt":       true,
+	"LastSeenAt":      true,
+	"Status":          true,
+	"StatusChangedAt": true,
+	"LastCheckedAt":   true,
+	"VisitCount":      true,
+	"Images":          true, // Hashed by URL, the rows carry database fields
+	"ClusterID":       true,
+	"AgeBasedYear":    true, // Not stored, the year itself is hashed
 }
 
 func (c *Ads) BeforeCreate(tx *gorm.DB) (err error) {
 	// Set the ID to a new UUID
 	c.ID = uuid.NewString()
 
+	// Ads that are not from a crawled site, like admin ads, are their own listing
+	if c.SourceListingID == "" {
+		c.SourceListingID = c.ID
+	}
+	if c.LastSeenAt.IsZero() {
+		c.LastSeenAt = time.Now()
+	}
+	if c.Status == "" {
+		c.Status = AdActive
+		c.StatusChangedAt = c.LastSeenAt
+	}
+
+	// Set the hash field with the generated hash
+	c.Hash = c.ContentHash()
+
+	return nil
+}
+
+// ContentHash hashes the listing content, two scrapes of an unchanged listing get the same hash
+func (c *Ads) ContentHash() string {
 	// Create a variable to store the concatenated string
-	var hashInput string
+	var hashInput strings.Builder
 
 	// Use reflection to iterate over the fields of the struct
 	val := reflect.ValueOf(c).Elem()
 
-	// Iterate over all fields of the struct (excluding the ID field)
+	// Iterate over all fields of the struct
 	for i := 0; i < val.NumField(); i++ {
-		// Get the field name (ID is excluded)
+		// Skip the fields set by the database
 		fieldName := val.Type().Field(i).Name
-
-		// Skip the "ID" field
-		if fieldName == "ID" {
+		if hashIgnoredFields[fieldName] {
 			continue
 		}
 
 		// Get the field value and append it to the hash input string
-		fieldValue := val.Field(i).String()
-		hashInput += fieldValue
+		fmt.Fprintf(&hashInput, "%s=%v;", fieldName, val.Field(i).Interface())
+	}
+	// A changed gallery is a changed listing
+	if len(c.Images) > 0 {
+		fmt.Fprintf(&hashInput, "Images=%v;", c.ImageURLs())
 	}
 
 	// Create a new SHA-256 hash
-	hash := sha256.New()
-	hash.Write([]byte(hashInput))
-
-	// Set the hash field with the generated hash
-	c.Hash = hex.EncodeToString(hash.Sum(nil))
-
-	return nil
+	hash := sha256.Sum256([]byte(hashInput.String()))
+	return hex.EncodeToString(hash[:])
 }
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdImage is one photo of the gallery of an ad, Position keeps the order of the site
+type AdImage struct {
+	ID        string    `gorm:"type:uuid;primary_key;"`
+	AdID      string    `gorm:"type:uuid;uniqueIndex:idx_ad_images_ad_position,priority:1"`
+	Position  int       `gorm:"type:int;uniqueIndex:idx_ad_images_ad_position,priority:2"`
+	URL       string    `gorm:"type:varchar(512)"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	// Set once the image is downloaded to the local archive
+	SHA256         string `gorm:"type:char(64);index"`
+	PerceptualHash string `gorm:"type:varchar(16)"`
+}
+
+func (c *AdImage) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
+
+// NewAdImages returns the gallery of the given image URLs in their order, skipping empty and repeated URLs
+func NewAdImages(urls []string) []AdImage {
+	var images []AdImage
+	seen := make(map[string]bool)
+	for _, url := range urls {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		images = append(images, AdImage{URL: url, Position: len(images)})
+	}
+	return images
+}
+
+// SetImages stores the gallery of an ad, its first image becomes the cover image
+func (c *Ads) SetImages(urls []string) {
+	c.Images = NewAdImages(urls)
+	if len(c.Images) > 0 {
+		c.ImageURL = c.Images[0].URL
+	}
+}
+
+// Archived reports whether the image has a local copy
+func (c AdImage) Archived() bool {
+	return c.SHA256 != ""
+}
+
+// ImageURLs returns the gallery URLs of an ad in order
+func (c *Ads) ImageURLs() []string {
+	urls := make([]string, 0, len(c.Images))
+	for _, image := range c.Images {
+		urls = append(urls, image.URL)
+	}
+	return urls
+}
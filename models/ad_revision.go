@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdRevision records a change of one field of an ad seen by a later crawl
+type AdRevision struct {
+	ID        string    `gorm:"type:uuid;primary_key;"`
+	AdID      string    `gorm:"type:uuid;index"`
+	Ad        Ads       `gorm:"foreignKey:AdID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	Field     string    `gorm:"type:varchar(32)"`
+	OldValue  string    `gorm:"type:text"`
+	NewValue  string    `gorm:"type:text"`
+}
+
+func (c *AdRevision) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
+
+// revisionIgnoredFields identify the listing and don't change between scrapes
+var revisionIgnoredFields = map[string]bool{
+	"Reference":       true,
+	"SourceListingID": true,
+}
+
+// DiffAds returns a revision for every content field that differs between the stored and the scraped ad
+func DiffAds(stored *Ads, scraped *Ads) []AdRevision {
+	var revisions []AdRevision
+
+	storedValue := reflect.ValueOf(stored).Elem()
+	scrapedValue := reflect.ValueOf(scraped).Elem()
+	for i := 0; i < storedValue.NumField(); i++ {
+		fieldName := storedValue.Type().Field(i).Name
+		if hashIgnoredFields[fieldName] || revisionIgnoredFields[fieldName] {
+			continue
+		}
+
+		oldValue := fmt.Sprint(storedValue.Field(i).Interface())
+		newValue := fmt.Sprint(scrapedValue.Field(i).Interface())
+		if oldValue != newValue {
+			revisions = append(revisions, AdRevision{
+				AdID:     stored.ID,
+				Field:    fieldName,
+				OldValue: oldValue,
+				NewValue: newValue,
+			})
+		}
+	}
+	return revisions
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CrawlRun records the statistics of a single crawl run of a source. A run that
+// resumed an interrupted one only counts what it did itself.
+type CrawlRun struct {
+	ID              string           `gorm:"type:uuid;primary_key;"`
+	Reference       string           `gorm:"type:varchar(10);index:idx_crawl_runs_reference_started,priority:1"`
+	Target          string           `gorm:"type:varchar(130)"` // city/category of a crawl target, empty for the whole site
+	Status          CheckpointStatus `gorm:"type:varchar(15)"`
+	Resumed         bool             `gorm:"type:boolean"`
+	Mode            string           `gorm:"type:varchar(12)"` // full or incremental
+	StartedAt       time.Time        `gorm:"index:idx_crawl_runs_reference_started,priority:2"`
+	FinishedAt      time.Time
+	PagesScrolled   int `gorm:"type:int"`
+	DiscoveredCount int `gorm:"type:int"`
+	InsertedCount   int `gorm:"type:int"`
+	UpdatedCount    int `gorm:"type:int"`
+	DuplicateCount  int `gorm:"type:int"` // Ads found again without any change
+	KnownCount      int `gorm:"type:int"` // Known listings an incremental run did not scrape
+	RecoveryCount   int `gorm:"type:int"` // Times a crashed or stalled browser was restarted
+	FailedCount     int `gorm:"type:int"`
+	// Failures by kind, they add up to FailedCount
+	TimeoutCount     int     `gorm:"type:int"`
+	NavigationCount  int     `gorm:"type:int"`
+	UnsupportedCount int     `gorm:"type:int"`
+	ParseCount       int     `gorm:"type:int"`
+	DatabaseCount    int     `gorm:"type:int"`
+	DisallowedCount  int     `gorm:"type:int"`
+	CPUPercent       float64 `gorm:"type:float"`
+	AllocatedMB      int64   `gorm:"type:bigint"`
+	InUseMB          int64   `gorm:"type:bigint"`
+}
+
+func (c *CrawlRun) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
+
+// Duration returns how long the run took, or has been running
+func (c CrawlRun) Duration() time.Duration {
+	if c.FinishedAt.IsZero() {
+		return time.Since(c.StartedAt)
+	}
+	return c.FinishedAt.Sub(c.StartedAt)
+}
+
+// ScrapedCount returns the ads scraped and saved by the run
+func (c CrawlRun) ScrapedCount() int {
+	return c.InsertedCount + c.UpdatedCount + c.DuplicateCount
+}
+
+// AdsPerMinute returns the scraping throughput of the run
+func (c CrawlRun) AdsPerMinute() float64 {
+	minutes := c.Duration().Minutes()
+	if minutes <= 0 {
+		return 0
+	}
+	return float64(c.ScrapedCount()) / minutes
+}
+
+// SetFailures stores the failure breakdown of the run
+func (c *CrawlRun) SetFailures(failures map[FailureKind]int) {
+	c.TimeoutCount = failures[FailureTimeout]
+	c.NavigationCount = failures[FailureNavigation]
+	c.UnsupportedCount = failures[FailureUnsupported]
+	c.ParseCount = failures[FailureParse]
+	c.DatabaseCount = failures[FailureDatabase]
+	c.DisallowedCount = failures[FailureDisallowed]
+	c.FailedCount = 0
+	for _, count := range failures {
+		c.FailedCount += count
+	}
+}
+
+// Failures returns the failure breakdown of the run
+func (c CrawlRun) Failures() map[FailureKind]int {
+	return map[FailureKind]int{
+		FailureTimeout:     c.TimeoutCount,
+		FailureNavigation:  c.NavigationCount,
+		FailureUnsupported: c.UnsupportedCount,
+		FailureParse:       c.ParseCount,
+		FailureDatabase:    c.DatabaseCount,
+		FailureDisallowed:  c.DisallowedCount,
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CrawlSchedule runs the crawler of a source, or of one of its targets, on a cron expression
+type CrawlSchedule struct {
+	ID        string    `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	Reference string    `gorm:"type:varchar(10);index"`
+	TargetID  string    `gorm:"type:varchar(36);index"` // Empty runs every target of the source
+	Spec      string    `gorm:"type:varchar(64)"`       // Cron expression, e.g. "0 3 * * *" or "@every 6h"
+	Enabled   bool      `gorm:"type:boolean"`
+}
+
+func (c *CrawlSchedule) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
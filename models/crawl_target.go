@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CrawlTarget is a city and category of a site the crawler visits, with its own budgets.
+// Sources without targets are crawled as a whole.
+type CrawlTarget struct {
+	ID        string    `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	Reference string    `gorm:"type:varchar(10);uniqueIndex:idx_crawl_targets_target"`
+	City      string    `gorm:"type:varchar(64);uniqueIndex:idx_crawl_targets_target"` // City slug of the site, e.g. tehran
+	Category  string    `gorm:"type:varchar(64);uniqueIndex:idx_crawl_targets_target"` // Category slug of the site, e.g. buy-apartment
+	MaxPages  int       `gorm:"type:int"`                                              // 0 uses MAX_PAGE
+	MaxAds    int       `gorm:"type:int"`                                              // 0 uses MAX_AD_COUNT
+	Enabled   bool      `gorm:"type:boolean"`
+	LastRunAt time.Time // Last finished run, the targets crawled longest ago go first
+}
+
+func (c *CrawlTarget) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
+
+// Name returns the part of the site the target covers
+func (c CrawlTarget) Name() string {
+	return c.City + "/" + c.Category
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type FailureKind string
+
+// Constants for the kinds of scrape failures
+const (
+	FailureTimeout     FailureKind = "timeout"
+	FailureNavigation  FailureKind = "navigation"
+	FailureUnsupported FailureKind = "unsupported-category"
+	FailureParse       FailureKind = "parse"
+	FailureDatabase    FailureKind = "database"
+	FailureDisallowed  FailureKind = "disallowed" // Excluded by robots.txt, trying again is refused the same way
+)
+
+// Transient reports whether a failure of this kind may go away when the page is tried again
+func (k FailureKind) Transient() bool {
+	return k == FailureTimeout || k == FailureNavigation || k == FailureDatabase
+}
+
+// DeadLetter is a listing URL the crawler gave up on. It stays until it is
+// re-queued, so failures can be inspected instead of being lost.
+type DeadLetter struct {
+	ID        string      `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time   `gorm:"autoCreateTime"`
+	UpdatedAt time.Time   `gorm:"autoUpdateTime"`
+	Reference string      `gorm:"type:varchar(10);uniqueIndex:idx_dead_letter_reference_url"`
+	URL       string      `gorm:"type:varchar(255);uniqueIndex:idx_dead_letter_reference_url"`
+	Category  string      `gorm:"type:varchar(64)"`
+	Kind      FailureKind `gorm:"type:varchar(24);index"`
+	Error     string      `gorm:"type:text"`
+	Attempts  int         `gorm:"type:int"`
+}
+
+func (c *DeadLetter) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
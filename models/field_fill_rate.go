@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FieldFillRate records how many of the ads a crawl run saved had a field filled in
+type FieldFillRate struct {
+	ID         string    `gorm:"type:uuid;primary_key;"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	CrawlRunID string    `gorm:"type:varchar(36);index"`
+	Field      string    `gorm:"type:varchar(32)"`
+	Filled     int       `gorm:"type:int"`
+	Total      int       `gorm:"type:int"`
+}
+
+func (c *FieldFillRate) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
+
+// Rate returns the share of the ads that had the field filled in
+func (c FieldFillRate) Rate() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Filled) / float64(c.Total)
+}
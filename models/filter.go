@@ -25,17 +25,26 @@ type Filters struct {
 	MaxArea        int       `gorm:"type:int"`
 	MinPrice       int       `gorm:"type:int"`
 	MaxPrice       int       `gorm:"type:int"`
+	MinDeposit     int       `gorm:"type:int"`
+	MaxDeposit     int       `gorm:"type:int"`
 	MinRent        int       `gorm:"type:int"`
 	MaxRent        int       `gorm:"type:int"`
 	MinRoom        int       `gorm:"type:int"`
 	MaxRoom        int       `gorm:"type:int"`
 	MinFloorNumber int       `gorm:"type:int"`
 	MaxFloorNumber int       `gorm:"type:int"`
+	MinYearBuilt   int       `gorm:"type:int"`
+	MaxYearBuilt   int       `gorm:"type:int"`
+	MinParking     int       `gorm:"type:int"`
 	UsageCount     int       `gorm:"type:int"`
 	HasElevator    bool      `gorm:"type:boolean"`
 	HasStorage     bool      `gorm:"type:boolean"`
 	HasParking     bool      `gorm:"type:boolean"`
 	HasBalcony     bool      `gorm:"type:boolean"`
+	// IncludeInactive also returns expired and sold ads
+	IncludeInactive bool `gorm:"type:boolean"`
+	// CollapseDuplicates shows the ads of the same property as one result
+	CollapseDuplicates bool `gorm:"type:boolean"`
 }
 
 func (c *Filters) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type FrontierStatus string
+
+// Constants for the states of a discovered URL
+const (
+	FrontierPending    FrontierStatus = "pending"
+	FrontierInProgress FrontierStatus = "in-progress"
+	FrontierDone       FrontierStatus = "done"
+	FrontierFailed     FrontierStatus = "failed"
+)
+
+// Frontier is a listing URL discovered by a crawler source. It outlives the
+// process, so a restarted crawler can pick up the URLs it did not scrape yet.
+type Frontier struct {
+	ID        string         `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime"`
+	Reference string         `gorm:"type:varchar(10);uniqueIndex:idx_frontier_reference_url"`
+	URL       string         `gorm:"type:varchar(255);uniqueIndex:idx_frontier_reference_url"`
+	Category  string         `gorm:"type:varchar(64)"`
+	Target    string         `gorm:"type:varchar(130);index"` // city/category of the target that found it, empty for the whole site
+	Status    FrontierStatus `gorm:"type:varchar(15);index"`
+	Attempts  int            `gorm:"type:int"`
+	LastError string         `gorm:"type:text"`
+}
+
+func (c *Frontier) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
+
+type CheckpointStatus string
+
+// Constants for the states of a crawl run
+const (
+	CheckpointRunning     CheckpointStatus = "running"
+	CheckpointInterrupted CheckpointStatus = "interrupted"
+	CheckpointFinished    CheckpointStatus = "finished"
+)
+
+// Checkpoint records the progress of the latest crawl run of a source, or of one of its targets.
+// A run that never reached finished was cut off and is resumed by the next run of the same target.
+type Checkpoint struct {
+	Reference       string           `gorm:"type:varchar(10);primary_key;"`
+	Target          string           `gorm:"type:varchar(130);primary_key;"` // city/category, empty for the whole site
+	Status          CheckpointStatus `gorm:"type:varchar(15)"`
+	StartedAt       time.Time
+	UpdatedAt       time.Time `gorm:"autoUpdateTime"`
+	DiscoveredCount int       `gorm:"type:int"`
+	SuccessCount    int       `gorm:"type:int"`
+	FailCount       int       `gorm:"type:int"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RawPage is the archived HTML of a listing as a crawl run scraped it. The page
+// itself is a gzip file in the page archive, Path is relative to the archive.
+type RawPage struct {
+	ID              string    `gorm:"type:uuid;primary_key;"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	CrawlRunID      string    `gorm:"type:varchar(36);uniqueIndex:idx_raw_pages_run_listing,priority:1"`
+	Reference       string    `gorm:"type:varchar(10);uniqueIndex:idx_raw_pages_run_listing,priority:2;index:idx_raw_pages_listing,priority:1"`
+	SourceListingID string    `gorm:"type:varchar(64);uniqueIndex:idx_raw_pages_run_listing,priority:3;index:idx_raw_pages_listing,priority:2"`
+	URL             string    `gorm:"type:varchar(255)"`
+	Category        string    `gorm:"type:varchar(64)"`
+	Path            string    `gorm:"type:varchar(255)"`
+	ScreenshotPath  string    `gorm:"type:varchar(255)"` // Empty when no screenshot was taken
+	Size            int       `gorm:"type:int"`          // Size of the uncompressed HTML
+	ScrapeError     string    `gorm:"type:text"`         // Why the scrape failed, empty when the ad was saved
+}
+
+func (c *RawPage) BeforeCreate(tx *gorm.DB) (err error) {
+	// Set the ID to a new UUID
+	c.ID = uuid.NewString()
+	return nil
+}
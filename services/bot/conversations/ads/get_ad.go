@@ -3,9 +3,13 @@ package ads
 import (
 	"Crawlzilla/database"
 	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
 	"Crawlzilla/services/ads"
+	"Crawlzilla/services/images"
+	"Crawlzilla/services/search"
 	"context"
 	"fmt"
+	"strconv"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"go.uber.org/zap"
@@ -53,6 +57,7 @@ func GetAdDetailsConversation(ctx context.Context, update tgbotapi.Update) {
 			"🏘️ *محله:* %s\n"+
 			"📐 *مساحت:* %d متر مربع\n"+
 			"💰 *قیمت:* %d تومان\n"+
+			"🔐 *ودیعه:* %d تومان\n"+
 			"💰 *اجاره:* %d تومان\n"+
 			"📞 *شماره تماس:* %s\n"+
 			"💰 *تاریخ:* %v \n"+
@@ -60,26 +65,225 @@ func GetAdDetailsConversation(ctx context.Context, update tgbotapi.Update) {
 			"*طبقه:* %v \n"+
 			"*کل طبقه:* %v \n"+
 			"*تغداد اتاق:* %v \n"+
+			"*سال ساخت:* %v \n"+
+			"*تعداد پارکینگ:* %v \n"+
 			"*نوع آگهی:* %v \n"+
-			"*نوع ملک:* %v \n",
-		ad.Title, ad.Description, ad.City, ad.Neighborhood, ad.Area, ad.Price, ad.Rent, ad.ContactNumber, ad.CreatedAt, ad.Reference, ad.FloorNumber, ad.TotalFloors, ad.Room, ad.CategoryType, ad.PropertyType,
+			"*نوع ملک:* %v \n"+
+			"*وضعیت:* %v \n",
+		ad.Title, ad.Description, ad.City, ad.Neighborhood, ad.Area, ad.Price, ad.Deposit, ad.Rent, ad.ContactNumber, ad.CreatedAt, ad.Reference, ad.FloorNumber, ad.TotalFloors, ad.Room, formatYearBuilt(ad.YearBuilt), ad.ParkingCount, ad.CategoryType, ad.PropertyType, formatAdStatus(ad),
 	)
 
-	// Decide the message type based on the presence of an image URL
+	// Decide the message type based on the number of images. Telegram fetches the
+	// photos from the site, when a URL is dead the archived copies are sent instead.
 	chatID := update.CallbackQuery.Message.Chat.ID
-	if ad.ImageURL != "" {
+	archive := images.Default()
+	sent := false
+	if len(ad.Images) > 1 {
+		// Send the gallery as an album with details in the caption of the first photo
+		_, err := bot.SendMediaGroup(newGalleryMediaGroup(chatID, ad, response, nil))
+		if err != nil && hasArchivedImage(ad) {
+			_, err = bot.SendMediaGroup(newGalleryMediaGroup(chatID, ad, response, archive))
+		}
+		if err != nil {
+			botLogger.Error("Error sending ad gallery", zap.String("ad_id", adID), zap.Error(err))
+		}
+		sent = err == nil
+	} else if ad.ImageURL != "" {
 		// Send a photo message with details in the caption
 		photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(ad.ImageURL))
 		photoMsg.Caption = response
 		photoMsg.ParseMode = "Markdown" // Enable Markdown for formatting
-		bot.Send(photoMsg)
-	} else {
+		_, err := bot.Send(photoMsg)
+		if err != nil {
+			if cover, ok := archivedCover(ad, archive); ok {
+				photoMsg.File = cover
+				_, err = bot.Send(photoMsg)
+			}
+		}
+		if err != nil {
+			botLogger.Error("Error sending ad photo", zap.String("ad_id", adID), zap.Error(err))
+		}
+		sent = err == nil
+	}
+	if !sent {
 		// Send a regular text message
 		msg := tgbotapi.NewMessage(chatID, response)
 		msg.ParseMode = "Markdown" // Enable Markdown for formatting
 		bot.Send(msg)
 	}
 
+	// Send the price movement and changes recorded since the ad was first seen
+	history, err := search.GetAdHistory(database.DB, ad)
+	if err != nil {
+		botLogger.Error("Error fetching ad history", zap.String("ad_id", adID), zap.Error(err))
+	} else if len(history.Revisions) > 0 {
+		msg := tgbotapi.NewMessage(chatID, formatAdHistory(history))
+		msg.ParseMode = "Markdown"
+		bot.Send(msg)
+	}
+
 	// Acknowledge the callback to prevent loading spinner in the UI
 	bot.Send(tgbotapi.NewCallback(update.CallbackQuery.ID, "جزئیات آگهی ارسال شد."))
 }
+
+// maxGalleryImages is the largest media group Telegram accepts
+const maxGalleryImages = 10
+
+// newGalleryMediaGroup returns the first images of the ad gallery as an album, the caption goes on the first photo.
+// With an archive, archived images are uploaded from it instead of being fetched from their URL.
+func newGalleryMediaGroup(chatID int64, ad models.Ads, caption string, archive *images.Archive) tgbotapi.MediaGroupConfig {
+	var media []interface{}
+	for i, image := range ad.Images {
+		if i == maxGalleryImages {
+			break
+		}
+		photo := tgbotapi.NewInputMediaPhoto(imageFile(image, archive))
+		if i == 0 {
+			photo.Caption = caption
+			photo.ParseMode = "Markdown"
+		}
+		media = append(media, photo)
+	}
+	return tgbotapi.NewMediaGroup(chatID, media)
+}
+
+// imageFile returns the archived copy of an image when there is one, otherwise its URL
+func imageFile(image models.AdImage, archive *images.Archive) tgbotapi.RequestFileData {
+	if archive != nil && image.Archived() {
+		if data, err := archive.Read(image.SHA256); err == nil {
+			return tgbotapi.FileBytes{Name: image.SHA256 + ".jpg", Bytes: data}
+		}
+	}
+	return tgbotapi.FileURL(image.URL)
+}
+
+func hasArchivedImage(ad models.Ads) bool {
+	for i, image := range ad.Images {
+		if i == maxGalleryImages {
+			break
+		}
+		if image.Archived() {
+			return true
+		}
+	}
+	return false
+}
+
+// archivedCover returns the archived copy of the cover image of an ad
+func archivedCover(ad models.Ads, archive *images.Archive) (tgbotapi.RequestFileData, bool) {
+	for _, image := range ad.Images {
+		if image.URL != ad.ImageURL || !image.Archived() {
+			continue
+		}
+		if data, err := archive.Read(image.SHA256); err == nil {
+			return tgbotapi.FileBytes{Name: image.SHA256 + ".jpg", Bytes: data}, true
+		}
+	}
+	return nil, false
+}
+
+// adStatusNames are the Persian names of the listing states
+var adStatusNames = map[models.AdStatus]string{
+	models.AdActive:  "فعال",
+	models.AdExpired: "منقضی شده",
+	models.AdSold:    "فروخته شده",
+}
+
+func formatAdStatus(ad models.Ads) string {
+	name, ok := adStatusNames[ad.Status]
+	if !ok {
+		name = string(ad.Status)
+	}
+	if ad.Status != models.AdActive && !ad.StatusChangedAt.IsZero() {
+		name += " از " + ad.StatusChangedAt.Format("2006-01-02")
+	}
+	return name
+}
+
+func formatYearBuilt(year int) string {
+	if year == 0 {
+		return "نامشخص"
+	}
+	return strconv.Itoa(year)
+}
+
+// revisionFieldNames are the Persian names of the fields shown in the ad history
+var revisionFieldNames = map[string]string{
+	"Title":         "عنوان",
+	"Description":   "توضیحات",
+	"Price":         "قیمت",
+	"Deposit":       "ودیعه",
+	"Rent":          "اجاره",
+	"Area":          "مساحت",
+	"Room":          "تعداد اتاق",
+	"FloorNumber":   "طبقه",
+	"TotalFloors":   "کل طبقه",
+	"YearBuilt":     "سال ساخت",
+	"ParkingCount":  "تعداد پارکینگ",
+	"ContactNumber": "شماره تماس",
+	"ImageURL":      "تصویر",
+	"City":          "شهر",
+	"Neighborhood":  "محله",
+	"HasElevator":   "آسانسور",
+	"HasStorage":    "انباری",
+	"HasParking":    "پارکینگ",
+	"HasBalcony":    "بالکن",
+}
+
+// maxHistoryLines limits the listed changes so the message stays short
+const maxHistoryLines = 10
+
+func formatAdHistory(history search.AdHistory) string {
+	response := "🕓 *تاریخچه تغییرات آگهی:*\n\n"
+
+	change := history.PriceChange
+	if change.PriceChanges > 0 {
+		response += formatPercentChange("💰 قیمت", change.FirstPrice, change.Price, change.PricePercent)
+	}
+	if change.DepositChanges > 0 {
+		response += formatPercentChange("💰 ودیعه", change.FirstDeposit, change.Deposit, change.DepositPercent)
+	}
+	if change.RentChanges > 0 {
+		response += formatPercentChange("💰 اجاره", change.FirstRent, change.Rent, change.RentPercent)
+	}
+	if change.Changed() {
+		response += "\n"
+	}
+
+	// Newest changes first
+	revisions := history.Revisions
+	for i := len(revisions) - 1; i >= 0 && len(revisions)-i <= maxHistoryLines; i-- {
+		revision := revisions[i]
+		name, ok := revisionFieldNames[revision.Field]
+		if !ok {
+			name = revision.Field
+		}
+		name = tgbotapi.EscapeText(tgbotapi.ModeMarkdown, name)
+		date := revision.CreatedAt.Format("2006-01-02")
+		switch revision.Field {
+		case "Description", "ImageURL", "Title":
+			response += fmt.Sprintf("• %s: *%s* تغییر کرد\n", date, name)
+		default:
+			// Values are scraped text, an underscore or asterisk in them would break the Markdown
+			oldValue := tgbotapi.EscapeText(tgbotapi.ModeMarkdown, revision.OldValue)
+			newValue := tgbotapi.EscapeText(tgbotapi.ModeMarkdown, revision.NewValue)
+			response += fmt.Sprintf("• %s: *%s* از %s به %s\n", date, name, oldValue, newValue)
+		}
+	}
+	if len(revisions) > maxHistoryLines {
+		response += fmt.Sprintf("\n... و %d تغییر دیگر", len(revisions)-maxHistoryLines)
+	}
+	return response
+}
+
+func formatPercentChange(label string, first int, current int, percent float64) string {
+	switch {
+	case first == current:
+		return fmt.Sprintf("%s تغییر کرده و به مقدار اولیه برگشته (%d تومان)\n", label, current)
+	case first == 0:
+		return fmt.Sprintf("%s از %d به %d تومان تغییر کرده\n", label, first, current)
+	case percent < 0:
+		return fmt.Sprintf("%s از زمان اولین مشاهده %.1f٪ کاهش یافته (از %d به %d تومان)\n", label, -percent, first, current)
+	}
+	return fmt.Sprintf("%s از زمان اولین مشاهده %.1f٪ افزایش یافته (از %d به %d تومان)\n", label, percent, first, current)
+}
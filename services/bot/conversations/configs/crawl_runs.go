@@ -0,0 +1,142 @@
+package configs
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawl_runs"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// crawlRunCounts are the sizes offered for the last runs view
+var crawlRunCounts = []int{5, 10, 20}
+
+// maxMessageLength keeps messages under the Telegram limit of 4096 characters
+const maxMessageLength = 3500
+
+// runStatusNames are the Persian names of the crawl run states
+var runStatusNames = map[models.CheckpointStatus]string{
+	models.CheckpointRunning:     "در حال اجرا",
+	models.CheckpointInterrupted: "متوقف شده",
+	models.CheckpointFinished:    "پایان یافته",
+}
+
+// GetCrawlRunsConversation shows the last N crawl runs, each compared with the run before it
+func GetCrawlRunsConversation(ctx context.Context, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	// Extract the run count from callback data (if provided)
+	count := crawlRunCounts[0]
+	action := update.CallbackQuery.Data
+	if len(action) > len("/crawl_runs:") && action[:len("/crawl_runs:")] == "/crawl_runs:" {
+		if n, err := strconv.Atoi(action[len("/crawl_runs:"):]); err == nil && n > 0 && n <= crawlRunCounts[len(crawlRunCounts)-1] {
+			count = n
+		}
+	}
+
+	reports, err := crawl_runs.GetLastRuns(database.DB, "", count)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "خطا در دریافت تاریخچه اجرای کرالر!"))
+		botLogger.Error("Error fetching crawl runs", zap.Error(err))
+		return
+	}
+	if len(reports) == 0 {
+		bot.Send(tgbotapi.NewMessage(chatID, "هنوز کرالر اجرا نشده است."))
+		return
+	}
+
+	// Long histories are split over several messages
+	var messages []string
+	response := fmt.Sprintf("📊 *آخرین %d اجرای کرالر:*\n\n", len(reports))
+	for _, report := range reports {
+		text := formatCrawlRun(report)
+		if len(response)+len(text) > maxMessageLength {
+			messages = append(messages, response)
+			response = ""
+		}
+		response += text
+	}
+	messages = append(messages, response)
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	for _, n := range crawlRunCounts {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d اجرای آخر", n), fmt.Sprintf("/crawl_runs:%d", n)))
+	}
+
+	for i, text := range messages {
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ParseMode = "Markdown"
+		if i == len(messages)-1 {
+			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons)
+		}
+		bot.Send(msg)
+	}
+}
+
+func formatCrawlRun(report crawl_runs.RunReport) string {
+	run := report.Run
+	status := runStatusNames[run.Status]
+	if run.Resumed {
+		status += " (ادامه اجرای قبلی)"
+	}
+	if run.Mode == crawler.CrawlModeIncremental {
+		status += " - افزایشی"
+	}
+
+	reference := run.Reference
+	if run.Target != "" {
+		reference += " " + run.Target
+	}
+	text := fmt.Sprintf(
+		"🕷️ *%s* - %s\n"+
+			"🕓 شروع: %s | مدت: %s\n"+
+			"📄 صفحات: %d | 🔎 کشف شده: %d\n"+
+			"🆕 جدید: %d | ✏️ بروزرسانی: %d | ♻️ تکراری: %d\n"+
+			"❌ ناموفق: %d",
+		reference, status,
+		run.StartedAt.Format("2006-01-02 15:04"), run.Duration().Round(time.Second),
+		run.PagesScrolled, run.DiscoveredCount,
+		run.InsertedCount, run.UpdatedCount, run.DuplicateCount,
+		run.FailedCount,
+	)
+
+	// Failure breakdown
+	if run.FailedCount > 0 {
+		text += " ("
+		failures := run.Failures()
+		first := true
+		for _, kind := range []models.FailureKind{models.FailureTimeout, models.FailureNavigation, models.FailureUnsupported, models.FailureParse, models.FailureDatabase, models.FailureDisallowed} {
+			if n := failures[kind]; n > 0 {
+				if !first {
+					text += "، "
+				}
+				text += fmt.Sprintf("%s: %d", failureKindNames[kind], n)
+				first = false
+			}
+		}
+		text += ")"
+	}
+	if run.KnownCount > 0 {
+		text += fmt.Sprintf("\n⏭️ آگهی‌های از قبل موجود: %d", run.KnownCount)
+	}
+	if run.RecoveryCount > 0 {
+		text += fmt.Sprintf("\n🔁 راه‌اندازی مجدد مرورگر: %d", run.RecoveryCount)
+	}
+	text += fmt.Sprintf("\n💻 پردازنده: %.1f%% | 🧠 حافظه: %d MB\n", run.CPUPercent, run.InUseMB)
+
+	// Changes against the previous run of the source
+	if comparison := report.Comparison; comparison != nil {
+		text += fmt.Sprintf("📈 نسبت به اجرای قبل: جدید %+d، ناموفق %+d، سرعت %+.1f آگهی در دقیقه\n", comparison.Inserted, comparison.Failed, comparison.AdsPerMinute)
+	}
+	return text + "\n"
+}
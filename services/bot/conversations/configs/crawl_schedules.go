@@ -0,0 +1,333 @@
+package configs
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/cache"
+	crawlScheduleService "Crawlzilla/services/crawl_schedules"
+	crawlTargetService "Crawlzilla/services/crawl_targets"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// crawlScheduleErrors are the Persian messages of the schedule validation errors
+var crawlScheduleErrors = map[error]string{
+	crawlScheduleService.ErrUnknownSource: "منبع نامعتبر است. لطفاً divar یا sheypoor را وارد کنید.",
+	crawlScheduleService.ErrUnknownTarget: "این منبع چنین هدفی ندارد. هدف را از منوی اهداف کرال اضافه کنید.",
+	crawlScheduleService.ErrInvalidSpec:   "عبارت زمان‌بندی نامعتبر است. مثلاً `0 3 * * *` یا `@every 6h` یا `@daily` را وارد کنید.",
+}
+
+// allTargets are the answers that schedule every target of a source
+var allTargets = []string{"همه", "all"}
+
+// specHelp explains the cron expressions the scheduler accepts
+const specHelp = "زمان‌بندی را به صورت عبارت cron وارد کنید:\n" +
+	"- `0 3 * * *` هر روز ساعت ۳ بامداد\n" +
+	"- `30 */6 * * *` هر ۶ ساعت در دقیقه ۳۰\n" +
+	"- `@every 12h` هر ۱۲ ساعت\n" +
+	"- `@daily` هر روز نیمه‌شب"
+
+// GetCrawlSchedulesConversation lists the crawl schedules with their next run times and buttons to change them
+func GetCrawlSchedulesConversation(ctx context.Context, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	chatID := update.CallbackQuery.Message.Chat.ID
+	scheduler := crawler.SchedulerFromContext(ctx)
+
+	schedules, err := crawlScheduleService.GetSchedules(database.DB)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "خطا در دریافت زمان‌بندی‌های کرال!"))
+		botLogger.Error("Error fetching crawl schedules", zap.Error(err))
+		return
+	}
+	targets, err := crawlTargetService.GetTargets(database.DB)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "خطا در دریافت اهداف کرال!"))
+		botLogger.Error("Error fetching crawl targets", zap.Error(err))
+		return
+	}
+	targetNames := make(map[string]string)
+	for _, target := range targets {
+		targetNames[target.ID] = target.Name()
+	}
+
+	response := "⏰ زمان‌بندی‌های کرال:\n\n"
+	for _, reference := range crawlTargetService.References() {
+		if scheduler.Running(reference) {
+			response += fmt.Sprintf("🔄 کرالر %s در حال اجراست.\n", reference)
+		}
+	}
+	if len(schedules) == 0 {
+		response += "زمان‌بندی‌ای تعریف نشده است، کرالر فقط به صورت دستی اجرا می‌شود.\n"
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for i, schedule := range schedules {
+		target := "همه اهداف"
+		if schedule.TargetID != "" {
+			target = targetNames[schedule.TargetID]
+		}
+		status := "✅ فعال"
+		if !schedule.Enabled {
+			status = "⏸️ غیرفعال"
+		}
+		next := "-"
+		if at, ok := scheduler.Next(schedule.ID); ok {
+			next = at.Format("2006-01-02 15:04")
+		}
+		response += fmt.Sprintf(
+			"%d. %s: %s - %s\n"+
+				"🕒 زمان‌بندی: %s\n"+
+				"⏭️ اجرای بعدی: %s\n\n",
+			i+1, schedule.Reference, target, status, schedule.Spec, next,
+		)
+
+		toggle := fmt.Sprintf("⏸️ غیرفعال %d", i+1)
+		if !schedule.Enabled {
+			toggle = fmt.Sprintf("▶️ فعال %d", i+1)
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(toggle, fmt.Sprintf("/toggle_crawl_schedule:%s", schedule.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("✏️ ویرایش %d", i+1), fmt.Sprintf("/edit_crawl_schedule:%s", schedule.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑️ حذف %d", i+1), fmt.Sprintf("/delete_crawl_schedule:%s", schedule.ID)),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ افزودن زمان‌بندی", "/add_crawl_schedule"),
+	))
+
+	// Sent as plain text, cron expressions would break the Markdown
+	msg := tgbotapi.NewMessage(chatID, response)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	bot.Send(msg)
+}
+
+// ChangeCrawlScheduleConversation turns a schedule on or off, or removes it
+func ChangeCrawlScheduleConversation(ctx context.Context, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	action := update.CallbackQuery.Data
+	var err error
+	var response string
+	switch {
+	case strings.HasPrefix(action, "/toggle_crawl_schedule:"):
+		var schedule models.CrawlSchedule
+		schedule, err = crawlScheduleService.ToggleSchedule(database.DB, action[len("/toggle_crawl_schedule:"):])
+		response = fmt.Sprintf("زمان‌بندی %s (%s) فعال شد.", schedule.Reference, schedule.Spec)
+		if !schedule.Enabled {
+			response = fmt.Sprintf("زمان‌بندی %s (%s) غیرفعال شد.", schedule.Reference, schedule.Spec)
+		}
+	case strings.HasPrefix(action, "/delete_crawl_schedule:"):
+		err = crawlScheduleService.RemoveSchedule(database.DB, action[len("/delete_crawl_schedule:"):])
+		response = "زمان‌بندی حذف شد."
+	default:
+		bot.Send(tgbotapi.NewMessage(chatID, "خطای غیرمنتظره‌ای رخ داد!"))
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bot.Send(tgbotapi.NewMessage(chatID, "این زمان‌بندی وجود ندارد."))
+		return
+	}
+	if err != nil {
+		botLogger.Error("Error changing crawl schedule", zap.String("action", action), zap.Error(err))
+		bot.Send(tgbotapi.NewMessage(chatID, "خطایی هنگام تغییر زمان‌بندی رخ داد!"))
+		return
+	}
+	reloadScheduler(ctx)
+	bot.Send(tgbotapi.NewMessage(chatID, response))
+}
+
+// AddCrawlScheduleConversation asks for the source, target and cron expression of a new schedule
+func AddCrawlScheduleConversation(ctx context.Context, state cache.UserState, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	userStates := ctx.Value("user_state").(*cache.UserCache)
+	actionStates := ctx.Value("action_state").(*cache.ActionCache)
+
+	// saveAnswer keeps an answer of the conversation and moves it to the next stage
+	saveAnswer := func(key string, value interface{}, nextStage string, question string) {
+		currentAction, _ := actionStates.GetActionState(ctx, state.ChatId)
+		actionData := currentAction.ActionData
+		if actionData == nil {
+			actionData = make(map[string]interface{})
+		}
+		actionData[key] = value
+
+		actionStates.SetUserState(ctx, state.ChatId, cache.ActionState{
+			ChatId:       state.ChatId,
+			UserId:       state.UserId,
+			Conversation: "add_crawl_schedule",
+			Action:       "add_crawl_schedule",
+			ActionData:   actionData,
+		})
+		msg := tgbotapi.NewMessage(state.ChatId, question)
+		msg.ParseMode = "Markdown"
+		bot.Send(msg)
+		userStates.UpdateUserCache(ctx, state.ChatId, map[string]interface{}{
+			"Stage": nextStage,
+		})
+	}
+
+	switch state.Stage {
+	case "init":
+		bot.Send(tgbotapi.NewMessage(state.ChatId, fmt.Sprintf("منبع زمان‌بندی را وارد کنید (%s):", strings.Join(crawlTargetService.References(), " یا "))))
+		userStates.SetUserCache(ctx, state.ChatId, cache.UserState{
+			ChatId:       state.ChatId,
+			UserId:       state.UserId,
+			Conversation: "add_crawl_schedule",
+			Stage:        "get_source",
+		})
+
+	case "get_source":
+		reference := strings.ToLower(strings.TrimSpace(update.Message.Text))
+		if !slices.Contains(crawlTargetService.References(), reference) {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, crawlScheduleErrors[crawlScheduleService.ErrUnknownSource]))
+			return
+		}
+
+		// Offer the targets of the source
+		question := "هدف را به صورت `شهر/دسته‌بندی` وارد کنید، یا «همه» برای همه اهداف منبع:"
+		targets, err := crawlTargetService.GetTargets(database.DB)
+		if err != nil {
+			botLogger.Error("Error fetching crawl targets", zap.Error(err))
+		}
+		for _, target := range targets {
+			if target.Reference == reference {
+				question += fmt.Sprintf("\n- `%s`", target.Name())
+			}
+		}
+		saveAnswer("reference", reference, "get_target", question)
+
+	case "get_target":
+		target := strings.TrimSpace(update.Message.Text)
+		if slices.Contains(allTargets, strings.ToLower(target)) {
+			target = ""
+		}
+		saveAnswer("target", target, "get_spec", specHelp)
+
+	case "get_spec":
+		currentAction, _ := actionStates.GetActionState(ctx, state.ChatId)
+		reference, _ := currentAction.ActionData["reference"].(string)
+		target, _ := currentAction.ActionData["target"].(string)
+
+		schedule, err := crawlScheduleService.AddSchedule(database.DB, reference, target, update.Message.Text)
+		if errors.Is(err, crawlScheduleService.ErrInvalidSpec) {
+			// Let the admin try another expression
+			msg := tgbotapi.NewMessage(state.ChatId, crawlScheduleErrors[err])
+			msg.ParseMode = "Markdown"
+			bot.Send(msg)
+			return
+		}
+
+		userStates.ClearUserCache(ctx, state.ChatId)
+		actionStates.ClearActionState(ctx, state.ChatId)
+
+		if message, ok := crawlScheduleErrors[err]; ok {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, message))
+			return
+		}
+		if err != nil {
+			botLogger.Error("Error adding crawl schedule", zap.Error(err))
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "خطایی هنگام افزودن زمان‌بندی رخ داد!"))
+			return
+		}
+		reloadScheduler(ctx)
+		bot.Send(tgbotapi.NewMessage(state.ChatId, "زمان‌بندی اضافه شد."+nextRunText(ctx, schedule)))
+	}
+}
+
+// EditCrawlScheduleConversation asks for a new cron expression of a schedule
+func EditCrawlScheduleConversation(ctx context.Context, state cache.UserState, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	userStates := ctx.Value("user_state").(*cache.UserCache)
+	actionStates := ctx.Value("action_state").(*cache.ActionCache)
+
+	switch state.Stage {
+	case "init":
+		action := update.CallbackQuery.Data
+		if len(action) <= len("/edit_crawl_schedule:") {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "خطای غیرمنتظره‌ای رخ داد!"))
+			return
+		}
+
+		actionStates.SetUserState(ctx, state.ChatId, cache.ActionState{
+			ChatId:       state.ChatId,
+			UserId:       state.UserId,
+			Conversation: "edit_crawl_schedule",
+			Action:       "edit_crawl_schedule",
+			ActionData:   map[string]interface{}{"scheduleID": action[len("/edit_crawl_schedule:"):]},
+		})
+		msg := tgbotapi.NewMessage(state.ChatId, specHelp)
+		msg.ParseMode = "Markdown"
+		bot.Send(msg)
+		userStates.SetUserCache(ctx, state.ChatId, cache.UserState{
+			ChatId:       state.ChatId,
+			UserId:       state.UserId,
+			Conversation: "edit_crawl_schedule",
+			Stage:        "get_spec",
+		})
+
+	case "get_spec":
+		currentAction, _ := actionStates.GetActionState(ctx, state.ChatId)
+		scheduleID, _ := currentAction.ActionData["scheduleID"].(string)
+
+		schedule, err := crawlScheduleService.UpdateScheduleSpec(database.DB, scheduleID, update.Message.Text)
+		if errors.Is(err, crawlScheduleService.ErrInvalidSpec) {
+			msg := tgbotapi.NewMessage(state.ChatId, crawlScheduleErrors[err])
+			msg.ParseMode = "Markdown"
+			bot.Send(msg)
+			return
+		}
+
+		userStates.ClearUserCache(ctx, state.ChatId)
+		actionStates.ClearActionState(ctx, state.ChatId)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "این زمان‌بندی وجود ندارد."))
+			return
+		}
+		if err != nil {
+			botLogger.Error("Error updating crawl schedule", zap.String("id", scheduleID), zap.Error(err))
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "خطایی هنگام ویرایش زمان‌بندی رخ داد!"))
+			return
+		}
+		reloadScheduler(ctx)
+		bot.Send(tgbotapi.NewMessage(state.ChatId, "زمان‌بندی ویرایش شد."+nextRunText(ctx, schedule)))
+	}
+}
+
+// reloadScheduler applies changed schedules right away instead of on the next periodic reload
+func reloadScheduler(ctx context.Context) {
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+
+	if scheduler := crawler.SchedulerFromContext(ctx); scheduler != nil {
+		if err := scheduler.Reload(); err != nil {
+			botLogger.Error("Error reloading crawl schedules", zap.Error(err))
+		}
+	}
+}
+
+func nextRunText(ctx context.Context, schedule models.CrawlSchedule) string {
+	if next, ok := crawler.SchedulerFromContext(ctx).Next(schedule.ID); ok {
+		return fmt.Sprintf("\nاجرای بعدی: %s", next.Format("2006-01-02 15:04"))
+	}
+	return ""
+}
@@ -0,0 +1,232 @@
+package configs
+
+import (
+	"Crawlzilla/database"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/cache"
+	crawlTargetService "Crawlzilla/services/crawl_targets"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// crawlTargetErrors are the Persian messages of the target validation errors
+var crawlTargetErrors = map[error]string{
+	crawlTargetService.ErrUnknownSource:       "منبع نامعتبر است. لطفاً divar یا sheypoor را وارد کنید.",
+	crawlTargetService.ErrInvalidSlug:         "شهر و دسته‌بندی باید به صورت انگلیسی و مانند آدرس سایت باشند، مثلاً tehran یا buy-apartment.",
+	crawlTargetService.ErrUnsupportedCategory: "این دسته‌بندی شیپور پشتیبانی نمی‌شود.",
+	crawlTargetService.ErrInvalidBudget:       "سقف صفحات و آگهی‌ها نمی‌تواند منفی باشد.",
+	crawlTargetService.ErrDuplicateTarget:     "این هدف قبلاً اضافه شده است.",
+}
+
+// GetCrawlTargetsConversation lists the crawl targets with buttons to turn them on or off and remove them
+func GetCrawlTargetsConversation(ctx context.Context, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	targets, err := crawlTargetService.GetTargets(database.DB)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "خطا در دریافت اهداف کرال!"))
+		botLogger.Error("Error fetching crawl targets", zap.Error(err))
+		return
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	response := "🎯 اهداف کرال:\n\n"
+	if len(targets) == 0 {
+		response += "هدفی تعریف نشده است، کل ایران کرال می‌شود.\n"
+	}
+	for i, target := range targets {
+		response += formatCrawlTarget(i+1, target)
+
+		toggle := fmt.Sprintf("⏸️ غیرفعال %d", i+1)
+		if !target.Enabled {
+			toggle = fmt.Sprintf("▶️ فعال %d", i+1)
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(toggle, fmt.Sprintf("/toggle_crawl_target:%s", target.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑️ حذف %d", i+1), fmt.Sprintf("/delete_crawl_target:%s", target.ID)),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ افزودن هدف", "/add_crawl_target"),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, response)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	bot.Send(msg)
+}
+
+func formatCrawlTarget(number int, target models.CrawlTarget) string {
+	status := "✅ فعال"
+	if !target.Enabled {
+		status = "⏸️ غیرفعال"
+	}
+	lastRun := "هنوز کرال نشده"
+	if !target.LastRunAt.IsZero() {
+		lastRun = target.LastRunAt.Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf(
+		"%d. %s: %s - %s\n"+
+			"📄 سقف صفحات: %s | 🏠 سقف آگهی‌ها: %s\n"+
+			"🕓 آخرین اجرا: %s\n\n",
+		number, target.Reference, target.Name(), status,
+		formatBudget(target.MaxPages), formatBudget(target.MaxAds),
+		lastRun,
+	)
+}
+
+// formatBudget shows a zero budget as the default of the crawler config
+func formatBudget(budget int) string {
+	if budget == 0 {
+		return "پیش‌فرض"
+	}
+	return strconv.Itoa(budget)
+}
+
+// ChangeCrawlTargetConversation turns a target on or off, or removes it
+func ChangeCrawlTargetConversation(ctx context.Context, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	action := update.CallbackQuery.Data
+	var err error
+	var response string
+	switch {
+	case strings.HasPrefix(action, "/toggle_crawl_target:"):
+		var target models.CrawlTarget
+		target, err = crawlTargetService.ToggleTarget(database.DB, action[len("/toggle_crawl_target:"):])
+		response = fmt.Sprintf("هدف %s: %s فعال شد.", target.Reference, target.Name())
+		if !target.Enabled {
+			response = fmt.Sprintf("هدف %s: %s غیرفعال شد.", target.Reference, target.Name())
+		}
+	case strings.HasPrefix(action, "/delete_crawl_target:"):
+		err = crawlTargetService.RemoveTarget(database.DB, action[len("/delete_crawl_target:"):])
+		response = "هدف و زمان‌بندی‌های آن حذف شد."
+	default:
+		bot.Send(tgbotapi.NewMessage(chatID, "خطای غیرمنتظره‌ای رخ داد!"))
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bot.Send(tgbotapi.NewMessage(chatID, "این هدف وجود ندارد."))
+		return
+	}
+	if err != nil {
+		botLogger.Error("Error changing crawl target", zap.String("action", action), zap.Error(err))
+		bot.Send(tgbotapi.NewMessage(chatID, "خطایی هنگام تغییر هدف رخ داد!"))
+		return
+	}
+	reloadScheduler(ctx)
+	bot.Send(tgbotapi.NewMessage(chatID, response))
+}
+
+// AddCrawlTargetConversation asks for the source, city, category and budgets of a new target
+func AddCrawlTargetConversation(ctx context.Context, state cache.UserState, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	userStates := ctx.Value("user_state").(*cache.UserCache)
+	actionStates := ctx.Value("action_state").(*cache.ActionCache)
+
+	// saveAnswer keeps an answer of the conversation and moves it to the next stage
+	saveAnswer := func(key string, value interface{}, nextStage string, question string) {
+		currentAction, _ := actionStates.GetActionState(ctx, state.ChatId)
+		actionData := currentAction.ActionData
+		if actionData == nil {
+			actionData = make(map[string]interface{})
+		}
+		actionData[key] = value
+
+		actionStates.SetUserState(ctx, state.ChatId, cache.ActionState{
+			ChatId:       state.ChatId,
+			UserId:       state.UserId,
+			Conversation: "add_crawl_target",
+			Action:       "add_crawl_target",
+			ActionData:   actionData,
+		})
+		bot.Send(tgbotapi.NewMessage(state.ChatId, question))
+		userStates.UpdateUserCache(ctx, state.ChatId, map[string]interface{}{
+			"Stage": nextStage,
+		})
+	}
+
+	switch state.Stage {
+	case "init":
+		bot.Send(tgbotapi.NewMessage(state.ChatId, fmt.Sprintf("منبع هدف را وارد کنید (%s):", strings.Join(crawlTargetService.References(), " یا "))))
+		userStates.SetUserCache(ctx, state.ChatId, cache.UserState{
+			ChatId:       state.ChatId,
+			UserId:       state.UserId,
+			Conversation: "add_crawl_target",
+			Stage:        "get_source",
+		})
+
+	case "get_source":
+		reference := strings.ToLower(strings.TrimSpace(update.Message.Text))
+		if !slices.Contains(crawlTargetService.References(), reference) {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, crawlTargetErrors[crawlTargetService.ErrUnknownSource]))
+			return
+		}
+		saveAnswer("reference", reference, "get_city", "نام شهر را همانطور که در آدرس سایت آمده وارد کنید (مثلاً tehran):")
+
+	case "get_city":
+		saveAnswer("city", strings.TrimSpace(update.Message.Text), "get_category", "دسته‌بندی را همانطور که در آدرس سایت آمده وارد کنید (مثلاً buy-apartment در دیوار یا houses-apartments-for-sale در شیپور):")
+
+	case "get_category":
+		saveAnswer("category", strings.TrimSpace(update.Message.Text), "get_max_pages", "سقف تعداد صفحات این هدف را وارد کنید (۰ برای مقدار پیش‌فرض):")
+
+	case "get_max_pages":
+		maxPages, err := strconv.Atoi(strings.TrimSpace(update.Message.Text))
+		if err != nil || maxPages < 0 {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "عدد وارد شده نامعتبر است. لطفاً عددی معتبر وارد کنید."))
+			return
+		}
+		saveAnswer("maxPages", maxPages, "get_max_ads", "سقف تعداد آگهی‌های این هدف را وارد کنید (۰ برای مقدار پیش‌فرض):")
+
+	case "get_max_ads":
+		maxAds, err := strconv.Atoi(strings.TrimSpace(update.Message.Text))
+		if err != nil || maxAds < 0 {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "عدد وارد شده نامعتبر است. لطفاً عددی معتبر وارد کنید."))
+			return
+		}
+
+		currentAction, _ := actionStates.GetActionState(ctx, state.ChatId)
+		actionData := currentAction.ActionData
+		reference, _ := actionData["reference"].(string)
+		city, _ := actionData["city"].(string)
+		category, _ := actionData["category"].(string)
+		maxPages, ok := actionData["maxPages"].(float64)
+		if !ok {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "خطا در بازیابی سقف صفحات!"))
+			return
+		}
+
+		// The answers are done with, a failed target is started over
+		userStates.ClearUserCache(ctx, state.ChatId)
+		actionStates.ClearActionState(ctx, state.ChatId)
+
+		target, err := crawlTargetService.AddTarget(database.DB, reference, city, category, int(maxPages), maxAds)
+		if message, ok := crawlTargetErrors[err]; ok {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, message))
+			return
+		}
+		if err != nil {
+			botLogger.Error("Error adding crawl target", zap.Error(err))
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "خطایی هنگام افزودن هدف رخ داد!"))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(state.ChatId, fmt.Sprintf("هدف %s: %s اضافه شد و از اجرای بعدی کرالر کرال می‌شود.", target.Reference, target.Name())))
+	}
+}
@@ -2,15 +2,28 @@ package configs
 
 import (
 	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/models"
 	"Crawlzilla/services/cache"
 	crawlerConfigService "Crawlzilla/services/crawler"
 	"context"
+	"fmt"
 	"strconv"
 	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// maxWorkers caps the worker count, every worker keeps a Chrome tab open
+const maxWorkers = 16
+
+// crawlModes maps the accepted answers to the crawl modes
+var crawlModes = map[string]string{
+	"کامل":                       crawler.CrawlModeFull,
+	"افزایشی":                    crawler.CrawlModeIncremental,
+	crawler.CrawlModeFull:        crawler.CrawlModeFull,
+	crawler.CrawlModeIncremental: crawler.CrawlModeIncremental,
+}
+
 func ConfigCrawlerConversation(ctx context.Context, state cache.UserState, update tgbotapi.Update) {
 	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
 	userStates := ctx.Value("user_state").(*cache.UserCache)
@@ -128,6 +141,64 @@ func ConfigCrawlerConversation(ctx context.Context, state cache.UserState, updat
 			return
 		}
 
+		// Update action state with max scroll
+		currentAction, _ := actionStates.GetActionState(ctx, state.ChatId)
+		actionData := currentAction.ActionData
+		actionData["maxScroll"] = maxScroll
+
+		actionStates.SetUserState(ctx, state.ChatId, cache.ActionState{
+			ChatId:       state.ChatId,
+			UserId:       state.UserId,
+			Conversation: "config_crawler",
+			Action:       "set_crawler_config",
+			ActionData:   actionData,
+		})
+
+		// Ask for the next parameter
+		bot.Send(tgbotapi.NewMessage(state.ChatId, "لطفاً تعداد ورکرهای همزمان (workers) را وارد کنید:"))
+
+		// Update user state
+		userStates.UpdateUserCache(ctx, state.ChatId, map[string]interface{}{
+			"Stage": "get_workers",
+		})
+
+	case "get_workers":
+		// Parse worker count
+		workers, err := strconv.Atoi(strings.TrimSpace(update.Message.Text))
+		if err != nil || workers <= 0 || workers > maxWorkers {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, fmt.Sprintf("عدد وارد شده نامعتبر است. لطفاً عددی بین ۱ و %d وارد کنید.", maxWorkers)))
+			return
+		}
+
+		// Update action state with worker count
+		currentAction, _ := actionStates.GetActionState(ctx, state.ChatId)
+		actionData := currentAction.ActionData
+		actionData["workers"] = workers
+
+		actionStates.SetUserState(ctx, state.ChatId, cache.ActionState{
+			ChatId:       state.ChatId,
+			UserId:       state.UserId,
+			Conversation: "config_crawler",
+			Action:       "set_crawler_config",
+			ActionData:   actionData,
+		})
+
+		// Ask for the crawl mode
+		bot.Send(tgbotapi.NewMessage(state.ChatId, "نوع اجرای کرالر را وارد کنید:\n- کامل: همه آگهی‌ها دوباره اسکرپ می‌شوند\n- افزایشی: آگهی‌های موجود رد می‌شوند و با رسیدن به آگهی‌های قبلی اسکرول متوقف می‌شود"))
+
+		// Update user state
+		userStates.UpdateUserCache(ctx, state.ChatId, map[string]interface{}{
+			"Stage": "get_crawl_mode",
+		})
+
+	case "get_crawl_mode":
+		// Parse crawl mode
+		mode, ok := crawlModes[strings.ToLower(strings.TrimSpace(update.Message.Text))]
+		if !ok {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "نوع اجرا نامعتبر است. لطفاً «کامل» یا «افزایشی» را وارد کنید."))
+			return
+		}
+
 		// Retrieve all action data
 		currentAction, _ := actionStates.GetActionState(ctx, state.ChatId)
 		actionData := currentAction.ActionData
@@ -148,13 +219,25 @@ func ConfigCrawlerConversation(ctx context.Context, state cache.UserState, updat
 			bot.Send(tgbotapi.NewMessage(state.ChatId, "خطا در بازیابی تعداد آگهی‌ها!"))
 			return
 		}
+		maxScroll, ok := actionData["maxScroll"].(float64)
+		if !ok {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "خطا در بازیابی تعداد اسکرول‌ها!"))
+			return
+		}
+		workers, ok := actionData["workers"].(float64)
+		if !ok {
+			bot.Send(tgbotapi.NewMessage(state.ChatId, "خطا در بازیابی تعداد ورکرها!"))
+			return
+		}
 
 		// Call the crawler config service
 		crawlerConfigService.SetCrawlerConfig(
 			int(crawlTime),     // Convert float64 to int
 			int(pageScrapTime), // Convert float64 to int
 			int(adCount),       // Convert float64 to int
-			maxScroll,          // Already an int
+			int(maxScroll),     // Convert float64 to int
+			int(workers),       // Convert float64 to int
+			mode,
 		)
 
 		// Clear cache
@@ -162,13 +245,28 @@ func ConfigCrawlerConversation(ctx context.Context, state cache.UserState, updat
 		actionStates.ClearActionState(ctx, state.ChatId)
 
 		// Inform user of success
-		bot.Send(tgbotapi.NewMessage(state.ChatId, "تنظیمات کرالر با موفقیت اعمال شد!"))
+		bot.Send(tgbotapi.NewMessage(state.ChatId, "تنظیمات کرالر با موفقیت اعمال شد! تعداد ورکرها و نوع اجرا از اجرای بعدی کرالر اعمال می‌شود."))
 	}
 }
 
+// StartCrawlerConversation runs the divar crawler now, through the scheduler so it never overlaps a scheduled run
 func StartCrawlerConversation(ctx context.Context, update tgbotapi.Update) {
 	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	chatID := update.CallbackQuery.Message.Chat.ID
 
-	bot.Send(tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "کرالر شروع کرد!"))
-	go crawler.RunCrawler(ctx)
+	scheduler := crawler.SchedulerFromContext(ctx)
+	if scheduler == nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "کرالر شروع کرد!"))
+		go crawler.RunDivarCrawler(ctx)
+		return
+	}
+
+	switch scheduler.Trigger(models.CrawlSchedule{Reference: "divar"}) {
+	case crawler.RunStarted:
+		bot.Send(tgbotapi.NewMessage(chatID, "کرالر شروع کرد!"))
+	case crawler.RunQueued:
+		bot.Send(tgbotapi.NewMessage(chatID, "کرالر در حال اجراست، اجرای جدید پس از پایان آن شروع می‌شود."))
+	case crawler.RunSkipped:
+		bot.Send(tgbotapi.NewMessage(chatID, "کرالر در حال اجراست، لطفاً پس از پایان اجرای فعلی دوباره تلاش کنید."))
+	}
 }
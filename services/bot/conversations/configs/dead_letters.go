@@ -0,0 +1,151 @@
+package configs
+
+import (
+	"Crawlzilla/database"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	deadLetterService "Crawlzilla/services/dead_letters"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// failureKindNames are the Persian names of the scrape failure kinds
+var failureKindNames = map[models.FailureKind]string{
+	models.FailureTimeout:     "پایان زمان",
+	models.FailureNavigation:  "خطای بارگذاری صفحه",
+	models.FailureUnsupported: "دسته‌بندی پشتیبانی نشده",
+	models.FailureParse:       "خطای استخراج اطلاعات",
+	models.FailureDatabase:    "خطای پایگاه داده",
+	models.FailureDisallowed:  "ممنوع در robots.txt",
+}
+
+// maxDeadLetterError keeps the error of a dead letter short in the list
+const maxDeadLetterError = 120
+
+// GetDeadLettersConversation lists the URLs the crawler gave up on with buttons to re-queue them
+func GetDeadLettersConversation(ctx context.Context, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	// Extract page number from callback data (if provided)
+	page := 1
+	action := update.CallbackQuery.Data
+	if len(action) > len("/dead_letters:") && action[:len("/dead_letters:")] == "/dead_letters:" {
+		if p, err := strconv.Atoi(action[len("/dead_letters:"):]); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	pageSize := 5
+	letters, err := deadLetterService.GetDeadLetters(database.DB, page, pageSize)
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, "خطا در دریافت آگهی‌های ناموفق!"))
+		botLogger.Error("Error fetching dead letters", zap.Error(err))
+		return
+	}
+
+	if len(letters.Data) == 0 {
+		bot.Send(tgbotapi.NewMessage(chatID, "آگهی ناموفقی وجود ندارد."))
+		return
+	}
+
+	response := fmt.Sprintf("☠️ آگهی‌های ناموفق (صفحه %d از %d):\n\n", letters.PageIndex, letters.TotalPages)
+	for _, kind := range []models.FailureKind{models.FailureTimeout, models.FailureNavigation, models.FailureUnsupported, models.FailureParse, models.FailureDatabase, models.FailureDisallowed} {
+		if count := letters.Counts[kind]; count > 0 {
+			response += fmt.Sprintf("• %s: %d\n", failureKindNames[kind], count)
+		}
+	}
+	response += "\n"
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for i, letter := range letters.Data {
+		errorText := []rune(letter.Error)
+		if len(errorText) > maxDeadLetterError {
+			errorText = append(errorText[:maxDeadLetterError], '…')
+		}
+		number := (letters.PageIndex-1)*pageSize + i + 1
+		response += fmt.Sprintf(
+			"%d. 🔗 %s\n"+
+				"🌐 مرجع: %s\n"+
+				"⚠️ نوع خطا: %s\n"+
+				"🔁 تعداد تلاش: %d\n"+
+				"📝 خطا: %s\n"+
+				"🕓 زمان: %s\n\n",
+			number, letter.URL, letter.Reference, failureKindNames[letter.Kind], letter.Attempts, string(errorText), letter.UpdatedAt.Format("2006-01-02 15:04:05"),
+		)
+
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🔁 صف مجدد %d", number), fmt.Sprintf("/requeue_dead_letter:%s", letter.ID)),
+		))
+	}
+
+	// Add pagination buttons
+	if letters.PageIndex > 1 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬅️ صفحه قبلی", fmt.Sprintf("/dead_letters:%d", letters.PageIndex-1)),
+		))
+	}
+	if letters.PageIndex < letters.TotalPages {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➡️ صفحه بعدی", fmt.Sprintf("/dead_letters:%d", letters.PageIndex+1)),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔁 صف مجدد همه", "/requeue_all_dead_letters"),
+	))
+
+	// Sent as plain text, URLs and errors would break the Markdown
+	msg := tgbotapi.NewMessage(chatID, response)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	msg.DisableWebPagePreview = true
+	bot.Send(msg)
+}
+
+// RequeueDeadLetterConversation queues one dead letter, or all of them, for the next crawl run
+func RequeueDeadLetterConversation(ctx context.Context, update tgbotapi.Update) {
+	bot := ctx.Value("bot").(*tgbotapi.BotAPI)
+	configLogger := ctx.Value("configLogger").(cfg.ConfigLoggerType)
+	botLogger, _ := configLogger("bot")
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	action := update.CallbackQuery.Data
+	if action == "/requeue_all_dead_letters" {
+		count, err := deadLetterService.RequeueAllDeadLetters(database.DB)
+		if err != nil {
+			botLogger.Error("Error requeueing dead letters", zap.Error(err))
+			bot.Send(tgbotapi.NewMessage(chatID, "خطایی هنگام صف مجدد آگهی‌ها رخ داد!"))
+			return
+		}
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("%d آگهی در صف اجرای بعدی کرالر قرار گرفت.", count)))
+		return
+	}
+
+	if len(action) <= len("/requeue_dead_letter:") {
+		bot.Send(tgbotapi.NewMessage(chatID, "خطای غیرمنتظره‌ای رخ داد!"))
+		return
+	}
+	id := action[len("/requeue_dead_letter:"):]
+
+	letter, err := deadLetterService.RequeueDeadLetter(database.DB, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			bot.Send(tgbotapi.NewMessage(chatID, "این آگهی قبلاً در صف قرار گرفته است."))
+		} else {
+			botLogger.Error("Error requeueing dead letter", zap.String("id", id), zap.Error(err))
+			bot.Send(tgbotapi.NewMessage(chatID, "خطایی هنگام صف مجدد آگهی رخ داد!"))
+		}
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("آگهی در صف اجرای بعدی کرالر %s قرار گرفت:\n%s", letter.Reference, letter.URL))
+	msg.DisableWebPagePreview = true
+	bot.Send(msg)
+}
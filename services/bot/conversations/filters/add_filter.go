@@ -89,22 +89,29 @@ func AddFilterConversation(ctx context.Context, state cache.UserState, update tg
 مرجع: دیوار/شیپور/ادمین 
 محله: تجریش  
 نوع آگهی: فروش  
-نوع ملک: آپارتمانی  
+نوع ملک: آپارتمانی | ویلایی | اداری | مغازه | زمین | پیش‌فروش  
 حداقل متراژ: 50  
 حداکثر متراژ: 200  
 حداقل قیمت: 2000000000  
 حداکثر قیمت: 10000000000  
+حداقل ودیعه: 100,000,000  
+حداکثر ودیعه: 500,000,000  
 حداقل اجاره: 2,000,000  
 حداکثر اجاره: 10,000,000  
 حداقل تعداد اتاق: 2  
 حداکثر تعداد اتاق: 4  
 حداقل تعداد طبقه: 1  
 حداکثر تعداد طبقه: 5  
+حداقل سال ساخت: 1395  
+حداکثر سال ساخت: 1403  
+حداقل تعداد پارکینگ: 1  
 آسانسور داشته باشد؟ بله  
 انباری داشته باشد؟ خیر  
 پارکینگ داشته باشد؟ بله  
 بالکن داشته باشد؟ بله  
-مرتب سازی: قیمت | اجاره | مساحت | اتاق | طبقه | تعداد بازدید | تاریخ ایجاد  
+آگهی‌های منقضی و فروخته شده هم نمایش داده شود؟ خیر  
+آگهی‌های تکراری یک ملک یکی شوند؟ بله  
+مرتب سازی: قیمت | ودیعه | اجاره | مساحت | اتاق | طبقه | سال ساخت | تعداد بازدید | تاریخ ایجاد  
 ترتیب: سعودی | نزولی`))
 
 	case "ask_text_details":
@@ -139,19 +146,26 @@ func AddFilterConversation(ctx context.Context, state cache.UserState, update tg
 			"MaxArea":        `(?i)حداکثر متراژ[:：\s]*(\d+)`,
 			"MinPrice":       `(?i)حداقل قیمت[:：\s]*([\d,]+)`,
 			"MaxPrice":       `(?i)حداکثر قیمت[:：\s]*([\d,]+)`,
+			"MinDeposit":     `(?i)حداقل ودیعه[:：\s]*([\d,]+)`,
+			"MaxDeposit":     `(?i)حداکثر ودیعه[:：\s]*([\d,]+)`,
 			"MinRent":        `(?i)حداقل اجاره[:：\s]*([\d,]+)`,
 			"MaxRent":        `(?i)حداکثر اجاره[:：\s]*([\d,]+)`,
 			"MinRoom":        `(?i)حداقل تعداد اتاق[:：\s]*(\d+)`,
 			"MaxRoom":        `(?i)حداکثر تعداد اتاق[:：\s]*(\d+)`,
 			"MinFloorNumber": `(?i)حداقل تعداد طبقه[:：\s]*(\d+)`,
 			"MaxFloorNumber": `(?i)حداکثر تعداد طبقه[:：\s]*(\d+)`,
+			"MinYearBuilt":   `(?i)حداقل سال ساخت[:：\s]*(\d+)`,
+			"MaxYearBuilt":   `(?i)حداکثر سال ساخت[:：\s]*(\d+)`,
+			"MinParking":     `(?i)حداقل تعداد پارکینگ[:：\s]*(\d+)`,
 		}
 
 		booleanFields := map[string]string{
-			"HasElevator": `(?i)آسانسور داشته باشد؟[:：\s]*(بله|خیر)`,
-			"HasStorage":  `(?i)انباری داشته باشد؟[:：\s]*(بله|خیر)`,
-			"HasParking":  `(?i)پارکینگ داشته باشد؟[:：\s]*(بله|خیر)`,
-			"HasBalcony":  `(?i)بالکن داشته باشد؟[:：\s]*(بله|خیر)`,
+			"HasElevator":        `(?i)آسانسور داشته باشد؟[:：\s]*(بله|خیر)`,
+			"HasStorage":         `(?i)انباری داشته باشد؟[:：\s]*(بله|خیر)`,
+			"HasParking":         `(?i)پارکینگ داشته باشد؟[:：\s]*(بله|خیر)`,
+			"HasBalcony":         `(?i)بالکن داشته باشد؟[:：\s]*(بله|خیر)`,
+			"IncludeInactive":    `(?i)منقضی و فروخته شده هم نمایش داده شود؟[:：\s]*(بله|خیر)`,
+			"CollapseDuplicates": `(?i)تکراری یک ملک یکی شوند؟[:：\s]*(بله|خیر)`,
 		}
 
 		var filter models.Filters
@@ -208,6 +222,8 @@ func mapSortField(value string) string {
 	switch strings.TrimSpace(value) {
 	case "قیمت":
 		return "price"
+	case "ودیعه":
+		return "deposit"
 	case "اجاره":
 		return "rent"
 	case "مساحت":
@@ -216,6 +232,8 @@ func mapSortField(value string) string {
 		return "room"
 	case "طبقه":
 		return "floor_number"
+	case "سال ساخت":
+		return "year_built"
 	case "تعداد بازدید":
 		return "visit_count"
 	case "تاریخ ایجاد":
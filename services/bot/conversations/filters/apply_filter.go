@@ -3,6 +3,7 @@ package filters
 import (
 	"Crawlzilla/database"
 	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
 	"Crawlzilla/services/cache"
 	"Crawlzilla/services/search"
 	"context"
@@ -59,6 +60,7 @@ func ApplyFilterConversation(ctx context.Context, state cache.UserState, update
 				"🏙️ *شهر:* %s\n"+
 				"📍 *محله:* %s\n"+
 				"💰 *قیمت:* %d\n"+
+				"🔐 *ودیعه:* %d\n"+
 				"🚪 *اتاق‌ها:* %d\n"+
 				"📐 *متراژ:* %d\n"+
 				"🔍 [مشاهده جزئیات](%s)\n\n",
@@ -66,10 +68,14 @@ func ApplyFilterConversation(ctx context.Context, state cache.UserState, update
 			ad.City,
 			ad.Neighborhood,
 			ad.Price,
+			ad.Deposit,
 			ad.Room,
 			ad.Area,
 			fmt.Sprintf("/view_ad:%s", ad.ID),
 		)
+		if duplicates := adsData.Duplicates[ad.ID]; len(duplicates) > 0 {
+			response = strings.TrimSuffix(response, "\n") + formatDuplicates(ad, duplicates)
+		}
 
 		// Add a button to view the ad details
 		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
@@ -134,3 +140,21 @@ func ApplyFilterConversation(ctx context.Context, state cache.UserState, update
 		return
 	}
 }
+
+// formatDuplicates lists the other listings of the same property, a line per source
+func formatDuplicates(ad models.Ads, duplicates []models.Ads) string {
+	counts := map[string]int{ad.Reference: 1}
+	sources := []string{ad.Reference}
+	for _, duplicate := range duplicates {
+		if counts[duplicate.Reference] == 0 {
+			sources = append(sources, duplicate.Reference)
+		}
+		counts[duplicate.Reference]++
+	}
+
+	response := fmt.Sprintf("🔗 *این ملک در %d آگهی:*\n", len(duplicates)+1)
+	for _, source := range sources {
+		response += fmt.Sprintf("• %s: %d آگهی\n", source, counts[source])
+	}
+	return response + "\n"
+}
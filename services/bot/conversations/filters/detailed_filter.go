@@ -83,16 +83,23 @@ func ViewFilterDetailsConversation(ctx context.Context, state cache.UserState, u
 			"📐 *حداکثر متراژ:* %d\n"+
 			"💰 *حداقل قیمت:* %d\n"+
 			"💰 *حداکثر قیمت:* %d\n"+
+			"🔐 *حداقل ودیعه:* %d\n"+
+			"🔐 *حداکثر ودیعه:* %d\n"+
 			"💸 *حداقل اجاره:* %d\n"+
 			"💸 *حداکثر اجاره:* %d\n"+
 			"🚪 *حداقل تعداد اتاق:* %d\n"+
 			"🚪 *حداکثر تعداد اتاق:* %d\n"+
 			"🏗️ *حداقل تعداد طبقات:* %d\n"+
 			"🏗️ *حداکثر تعداد طبقات:* %d\n"+
+			"📅 *حداقل سال ساخت:* %d\n"+
+			"📅 *حداکثر سال ساخت:* %d\n"+
+			"🚗 *حداقل تعداد پارکینگ:* %d\n"+
 			"🚪 *آسانسور:* %s\n"+
 			"📦 *انباری:* %s\n"+
 			"🚗 *پارکینگ:* %s\n"+
 			"🌳 *بالکن:* %s\n"+
+			"🗃️ *آگهی‌های غیرفعال:* %s\n"+
+			"🔗 *یکی کردن آگهی‌های تکراری:* %s\n"+
 			"🕓 *مرتب‌سازی بر اساس:* %s\n"+
 			"🔀 *ترتیب:* %s\n"+
 			"🆔 *تاریخ ایجاد:* %s\n",
@@ -104,13 +111,18 @@ func ViewFilterDetailsConversation(ctx context.Context, state cache.UserState, u
 		filter.PropertyType,
 		filter.MinArea, filter.MaxArea,
 		filter.MinPrice, filter.MaxPrice,
+		filter.MinDeposit, filter.MaxDeposit,
 		filter.MinRent, filter.MaxRent,
 		filter.MinRoom, filter.MaxRoom,
 		filter.MinFloorNumber, filter.MaxFloorNumber,
+		filter.MinYearBuilt, filter.MaxYearBuilt,
+		filter.MinParking,
 		boolToEmoji(filter.HasElevator),
 		boolToEmoji(filter.HasStorage),
 		boolToEmoji(filter.HasParking),
 		boolToEmoji(filter.HasBalcony),
+		boolToEmoji(filter.IncludeInactive),
+		boolToEmoji(filter.CollapseDuplicates),
 		sortKeyToName(filter.Sort),
 		orderKeyToName(filter.Order),
 		filter.CreatedAt.Format("2006-01-02 15:04:05"),
@@ -183,6 +195,8 @@ func sortKeyToName(sortKey string) string {
 	switch sortKey {
 	case "price":
 		return "قیمت"
+	case "deposit":
+		return "ودیعه"
 	case "rent":
 		return "اجاره"
 	case "area":
@@ -191,6 +205,8 @@ func sortKeyToName(sortKey string) string {
 		return "اتاق"
 	case "floor_number":
 		return "تعداد طبقات"
+	case "year_built":
+		return "سال ساخت"
 	case "visit_count":
 		return "تعداد بازدید"
 	case "created_at":
@@ -77,7 +77,7 @@ func ExportFilteredResultsConversation(ctx context.Context, state cache.UserStat
 	defer writer.Flush()
 
 	// Write header
-	err = writer.Write([]string{"ID", "Title", "City", "Neighborhood", "Price", "Rooms", "Area", "Details URL"})
+	err = writer.Write([]string{"ID", "Title", "City", "Neighborhood", "Property Type", "Price", "Deposit", "Rent", "Rooms", "Area", "Year Built", "Parking", "Details URL"})
 	if err != nil {
 		bot.Send(tgbotapi.NewMessage(state.ChatId, "خطا در نوشتن به فایل CSV!"))
 		botLogger.Error("Error writing CSV header", zap.Error(err))
@@ -91,9 +91,14 @@ func ExportFilteredResultsConversation(ctx context.Context, state cache.UserStat
 			ad.Title,
 			ad.City,
 			ad.Neighborhood,
+			ad.PropertyType,
 			strconv.Itoa(ad.Price),
+			strconv.Itoa(ad.Deposit),
+			strconv.Itoa(ad.Rent),
 			strconv.Itoa(ad.Room),
 			strconv.Itoa(ad.Area),
+			strconv.Itoa(ad.YearBuilt),
+			strconv.Itoa(ad.ParkingCount),
 			ad.URL,
 		})
 		if err != nil {
@@ -56,6 +56,32 @@ func HandleCallbacks(ctx context.Context, update tgbotapi.Update) {
 		ads.GetMostFilteredAdsConversation(ctx, cache.CreateNewUserState("most_filtered_ads", update.CallbackQuery), update)
 	case action == "/start_crawler":
 		configs.StartCrawlerConversation(ctx, update)
+	case len(action) >= len("/crawl_runs") && action[:len("/crawl_runs")] == "/crawl_runs":
+		configs.GetCrawlRunsConversation(ctx, update)
+	case len(action) >= len("/dead_letters") && action[:len("/dead_letters")] == "/dead_letters":
+		configs.GetDeadLettersConversation(ctx, update)
+	case action == "/crawl_targets":
+		configs.GetCrawlTargetsConversation(ctx, update)
+	case action == "/add_crawl_target":
+		configs.AddCrawlTargetConversation(ctx, cache.CreateNewUserState("add_crawl_target", update.CallbackQuery), update)
+	case len(action) > len("/toggle_crawl_target:") && action[:len("/toggle_crawl_target:")] == "/toggle_crawl_target:":
+		configs.ChangeCrawlTargetConversation(ctx, update)
+	case len(action) > len("/delete_crawl_target:") && action[:len("/delete_crawl_target:")] == "/delete_crawl_target:":
+		configs.ChangeCrawlTargetConversation(ctx, update)
+	case action == "/crawl_schedules":
+		configs.GetCrawlSchedulesConversation(ctx, update)
+	case action == "/add_crawl_schedule":
+		configs.AddCrawlScheduleConversation(ctx, cache.CreateNewUserState("add_crawl_schedule", update.CallbackQuery), update)
+	case len(action) > len("/edit_crawl_schedule:") && action[:len("/edit_crawl_schedule:")] == "/edit_crawl_schedule:":
+		configs.EditCrawlScheduleConversation(ctx, cache.CreateNewUserState("edit_crawl_schedule", update.CallbackQuery), update)
+	case len(action) > len("/toggle_crawl_schedule:") && action[:len("/toggle_crawl_schedule:")] == "/toggle_crawl_schedule:":
+		configs.ChangeCrawlScheduleConversation(ctx, update)
+	case len(action) > len("/delete_crawl_schedule:") && action[:len("/delete_crawl_schedule:")] == "/delete_crawl_schedule:":
+		configs.ChangeCrawlScheduleConversation(ctx, update)
+	case action == "/requeue_all_dead_letters":
+		configs.RequeueDeadLetterConversation(ctx, update)
+	case len(action) > len("/requeue_dead_letter:") && action[:len("/requeue_dead_letter:")] == "/requeue_dead_letter:":
+		configs.RequeueDeadLetterConversation(ctx, update)
 	}
 
 	// Acknowledge the callback to prevent the loading indicator
@@ -56,5 +56,11 @@ func HandleConversation(ctx context.Context, update tgbotapi.Update) {
 		filters.ViewFilterDetailsConversation(ctx, userState, update)
 	case "config_crawler":
 		configs.ConfigCrawlerConversation(ctx, userState, update)
+	case "add_crawl_target":
+		configs.AddCrawlTargetConversation(ctx, userState, update)
+	case "add_crawl_schedule":
+		configs.AddCrawlScheduleConversation(ctx, userState, update)
+	case "edit_crawl_schedule":
+		configs.EditCrawlScheduleConversation(ctx, userState, update)
 	}
 }
@@ -5,6 +5,14 @@ var MainMenu = [][]MenuItem{
 		{Path: "/config", IsAdmin: true, Name: "پیکربندی کرالر"},
 		{Path: "/start_crawler", IsAdmin: true, Name: "استارت کرالر"},
 	},
+	{
+		{Path: "/crawl_runs", IsAdmin: true, Name: "تاریخچه اجرای کرالر"},
+		{Path: "/dead_letters", IsAdmin: true, Name: "آگهی‌های ناموفق"},
+	},
+	{
+		{Path: "/crawl_targets", IsAdmin: true, Name: "اهداف کرال"},
+		{Path: "/crawl_schedules", IsAdmin: true, Name: "زمان‌بندی کرال"},
+	},
 	{
 		{Path: "/add_admin", IsAdmin: true, Name: "اضافه کردن ادمین"},
 		{Path: "/remove_admin", IsAdmin: true, Name: "حذف کردن ادمین"},
@@ -0,0 +1,76 @@
+package crawl_runs
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RunComparison holds how a run did against the previous run of its source
+type RunComparison struct {
+	Previous     models.CrawlRun
+	Duration     time.Duration
+	Scraped      int
+	Inserted     int
+	Updated      int
+	Failed       int
+	AdsPerMinute float64
+}
+
+// RunReport is a crawl run with its comparison, Comparison is nil for the first run of a source
+type RunReport struct {
+	Run        models.CrawlRun
+	Comparison *RunComparison
+}
+
+// Compare returns the changes from previous to run
+func Compare(run models.CrawlRun, previous models.CrawlRun) RunComparison {
+	return RunComparison{
+		Previous:     previous,
+		Duration:     run.Duration() - previous.Duration(),
+		Scraped:      run.ScrapedCount() - previous.ScrapedCount(),
+		Inserted:     run.InsertedCount - previous.InsertedCount,
+		Updated:      run.UpdatedCount - previous.UpdatedCount,
+		Failed:       run.FailedCount - previous.FailedCount,
+		AdsPerMinute: run.AdsPerMinute() - previous.AdsPerMinute(),
+	}
+}
+
+// GetRunReport compares a run with the previous run of its source
+func GetRunReport(db *gorm.DB, run models.CrawlRun) (RunReport, error) {
+	previous, err := repositories.GetPreviousCrawlRun(db, run)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return RunReport{Run: run}, nil
+	}
+	if err != nil {
+		return RunReport{}, err
+	}
+	comparison := Compare(run, previous)
+	return RunReport{Run: run, Comparison: &comparison}, nil
+}
+
+// GetLastRuns retrieves the last count runs, newest first, each compared with the run before it.
+// An empty reference returns the runs of every source.
+func GetLastRuns(db *gorm.DB, reference string, count int) ([]RunReport, error) {
+	if count < 1 {
+		return nil, errors.New("count must be greater than 0")
+	}
+
+	runs, err := repositories.GetLastCrawlRuns(db, reference, count)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]RunReport, 0, len(runs))
+	for _, run := range runs {
+		report, err := GetRunReport(db, run)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
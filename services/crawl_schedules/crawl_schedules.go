@@ -0,0 +1,88 @@
+package crawl_schedules
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawl_targets"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownSource = errors.New("unknown crawl schedule source")
+	ErrUnknownTarget = errors.New("the source has no such crawl target")
+	ErrInvalidSpec   = errors.New("invalid cron expression")
+)
+
+// ParseSpec checks a cron expression, it accepts five fields or a descriptor like @daily or @every 6h
+func ParseSpec(spec string) (string, error) {
+	spec = strings.Join(strings.Fields(spec), " ")
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return spec, ErrInvalidSpec
+	}
+	return spec, nil
+}
+
+// AddSchedule stores an enabled schedule of a source. target is the city/category of one of
+// its targets, an empty target runs every target of the source.
+func AddSchedule(db *gorm.DB, reference string, target string, spec string) (models.CrawlSchedule, error) {
+	reference = strings.ToLower(strings.TrimSpace(reference))
+	if !slices.Contains(crawl_targets.References(), reference) {
+		return models.CrawlSchedule{}, ErrUnknownSource
+	}
+	spec, err := ParseSpec(spec)
+	if err != nil {
+		return models.CrawlSchedule{}, err
+	}
+
+	schedule := models.CrawlSchedule{Reference: reference, Spec: spec, Enabled: true}
+	if target = strings.ToLower(strings.TrimSpace(target)); target != "" {
+		city, category, _ := strings.Cut(target, "/")
+		stored, err := repositories.GetCrawlTarget(db, reference, city, category)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return schedule, ErrUnknownTarget
+		}
+		if err != nil {
+			return schedule, err
+		}
+		schedule.TargetID = stored.ID
+	}
+
+	return schedule, repositories.CreateCrawlSchedule(db, &schedule)
+}
+
+// GetSchedules retrieves every crawl schedule
+func GetSchedules(db *gorm.DB) ([]models.CrawlSchedule, error) {
+	return repositories.GetCrawlSchedules(db)
+}
+
+// UpdateScheduleSpec changes the cron expression of a schedule
+func UpdateScheduleSpec(db *gorm.DB, id string, spec string) (models.CrawlSchedule, error) {
+	schedule, err := repositories.GetCrawlScheduleByID(db, id)
+	if err != nil {
+		return schedule, err
+	}
+	if schedule.Spec, err = ParseSpec(spec); err != nil {
+		return schedule, err
+	}
+	return schedule, repositories.UpdateCrawlSchedule(db, id, schedule.Spec, schedule.Enabled)
+}
+
+// ToggleSchedule turns a schedule off when it is on and on when it is off
+func ToggleSchedule(db *gorm.DB, id string) (models.CrawlSchedule, error) {
+	schedule, err := repositories.GetCrawlScheduleByID(db, id)
+	if err != nil {
+		return schedule, err
+	}
+	schedule.Enabled = !schedule.Enabled
+	return schedule, repositories.UpdateCrawlSchedule(db, id, schedule.Spec, schedule.Enabled)
+}
+
+// RemoveSchedule deletes a crawl schedule
+func RemoveSchedule(db *gorm.DB, id string) error {
+	return repositories.DeleteCrawlSchedule(db, id)
+}
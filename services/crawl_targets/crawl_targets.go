@@ -0,0 +1,114 @@
+package crawl_targets
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/generic"
+	"Crawlzilla/services/crawler/sheypoor"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Sources are the references of the built-in scrapers
+var Sources = []string{"divar", "sheypoor"}
+
+// References returns the references a target can be added for, the built-in
+// scrapers and the sites defined in SITES_DIR
+func References() []string {
+	return append(slices.Clone(Sources), generic.Default().Names()...)
+}
+
+var (
+	ErrUnknownSource       = errors.New("unknown crawl target source")
+	ErrInvalidSlug         = errors.New("city and category must be slugs like tehran or buy-apartment")
+	ErrUnsupportedCategory = errors.New("category is not supported by the scraper of the source")
+	ErrInvalidBudget       = errors.New("budgets must not be negative")
+	ErrDuplicateTarget     = errors.New("crawl target already exists")
+)
+
+// slugPattern matches the city and category slugs used in the URLs of the sites
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// NewTarget checks a target before it is added, slugs are lower-cased
+func NewTarget(reference, city, category string, maxPages, maxAds int) (models.CrawlTarget, error) {
+	reference = strings.ToLower(strings.TrimSpace(reference))
+	city = strings.ToLower(strings.TrimSpace(city))
+	category = strings.ToLower(strings.TrimSpace(category))
+
+	if !slices.Contains(References(), reference) {
+		return models.CrawlTarget{}, ErrUnknownSource
+	}
+	if !slugPattern.MatchString(city) || !slugPattern.MatchString(category) {
+		return models.CrawlTarget{}, ErrInvalidSlug
+	}
+	// Sheypoor ads are parsed by category, divar pages tell their own type
+	if reference == "sheypoor" && !sheypoor.SupportsCategory(category) {
+		return models.CrawlTarget{}, ErrUnsupportedCategory
+	}
+	// Defined sites only know the categories of their definition
+	if site, ok := generic.Default().Site(reference); ok && !site.SupportsCategory(category) {
+		return models.CrawlTarget{}, ErrUnsupportedCategory
+	}
+	if maxPages < 0 || maxAds < 0 {
+		return models.CrawlTarget{}, ErrInvalidBudget
+	}
+
+	return models.CrawlTarget{
+		Reference: reference,
+		City:      city,
+		Category:  category,
+		MaxPages:  maxPages,
+		MaxAds:    maxAds,
+		Enabled:   true,
+	}, nil
+}
+
+// AddTarget validates and stores a crawl target
+func AddTarget(db *gorm.DB, reference, city, category string, maxPages, maxAds int) (models.CrawlTarget, error) {
+	target, err := NewTarget(reference, city, category, maxPages, maxAds)
+	if err != nil {
+		return target, err
+	}
+
+	var count int64
+	err = db.Model(&models.CrawlTarget{}).
+		Where("reference = ? AND city = ? AND category = ?", target.Reference, target.City, target.Category).
+		Count(&count).Error
+	if err != nil {
+		return target, err
+	}
+	if count > 0 {
+		return target, ErrDuplicateTarget
+	}
+
+	return target, repositories.CreateCrawlTarget(db, &target)
+}
+
+// GetTargets retrieves every crawl target
+func GetTargets(db *gorm.DB) ([]models.CrawlTarget, error) {
+	return repositories.GetCrawlTargets(db)
+}
+
+// ToggleTarget turns a target off when it is on and on when it is off
+func ToggleTarget(db *gorm.DB, id string) (models.CrawlTarget, error) {
+	target, err := repositories.GetCrawlTargetByID(db, id)
+	if err != nil {
+		return target, err
+	}
+	target.Enabled = !target.Enabled
+	return target, repositories.SetCrawlTargetEnabled(db, id, target.Enabled)
+}
+
+// RemoveTarget deletes a crawl target and its schedules
+func RemoveTarget(db *gorm.DB, id string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := repositories.DeleteCrawlSchedulesOfTarget(tx, id); err != nil {
+			return err
+		}
+		return repositories.DeleteCrawlTarget(tx, id)
+	})
+}
@@ -0,0 +1,194 @@
+package browser
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Pool shares one headless Chrome between the crawler workers. Workers lease
+// a tab for every page instead of launching a new browser per ad.
+type Pool struct {
+	parent   context.Context
+	maxPages int
+	// idle holds the free tabs, a nil entry is a free slot without an open tab
+	idle chan *Tab
+
+	mu            sync.Mutex
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+}
+
+// Tab is a Chrome tab leased from a pool
+type Tab struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	pages  int
+	pool   *Pool
+}
+
+// NewPool creates a pool of at most size tabs. A tab is closed and replaced after
+// maxPages pages (0 keeps it open) or after a page failed in it. Chrome is only
+// started when the first tab is leased.
+func NewPool(ctx context.Context, size int, maxPages int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	pool := &Pool{parent: ctx, maxPages: maxPages, idle: make(chan *Tab, size)}
+	for i := 0; i < size; i++ {
+		pool.idle <- nil
+	}
+	return pool
+}
+
+// Size returns the number of tabs the pool can open
+func (p *Pool) Size() int {
+	return cap(p.idle)
+}
+
+// Acquire waits for a free tab, opening a new one if needed
+func (p *Pool) Acquire(ctx context.Context) (*Tab, error) {
+	var tab *Tab
+	select {
+	case tab = <-p.idle:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Reuse the tab unless it was closed, for example because the browser crashed
+	if tab != nil && tab.ctx.Err() == nil {
+		return tab, nil
+	}
+
+	tab, err := p.openTab()
+	if err != nil {
+		// Give the slot back so another worker can try again
+		p.idle <- nil
+		return nil, err
+	}
+	return tab, nil
+}
+
+// Close closes every tab and the browser
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.browserCancel != nil {
+		p.browserCancel()
+		p.browserCtx, p.browserCancel = nil, nil
+	}
+}
+
+func (p *Pool) openTab() (*Tab, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Start the browser on first use and again if it went away
+	if p.browserCtx == nil || p.browserCtx.Err() != nil {
+		browserCtx, browserCancel := chromedp.NewContext(p.parent)
+		if err := chromedp.Run(browserCtx); err != nil {
+			browserCancel()
+			return nil, err
+		}
+		p.browserCtx, p.browserCancel = browserCtx, browserCancel
+	}
+
+	tabCtx, cancel := chromedp.NewContext(p.browserCtx)
+	if err := chromedp.Run(tabCtx); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &Tab{ctx: tabCtx, cancel: cancel, pool: p}, nil
+}
+
+func (p *Pool) release(tab *Tab, err error) {
+	tab.pages++
+	if err != nil || (p.maxPages > 0 && tab.pages >= p.maxPages) {
+		// Recycle the tab, the next lease opens a fresh one
+		tab.cancel()
+		p.idle <- nil
+		return
+	}
+	p.idle <- tab
+}
+
+// Lease returns a tab from the pool the crawler stored in ctx. Outside a crawl
+// run there is no pool and a standalone browser is started for the page.
+func Lease(ctx context.Context) (*Tab, error) {
+	if pool, ok := ctx.Value("browser_pool").(*Pool); ok && pool != nil {
+		return pool.Acquire(ctx)
+	}
+	tabCtx, cancel := chromedp.NewContext(ctx)
+	return &Tab{ctx: tabCtx, cancel: cancel}, nil
+}
+
+// Context returns a chromedp context running in the tab that is also canceled with ctx
+func (t *Tab) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	tabCtx, cancel := context.WithCancel(t.ctx)
+	stop := context.AfterFunc(ctx, cancel)
+	return tabCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Release gives the tab back to its pool, err is the error of the page loaded in it
+func (t *Tab) Release(err error) {
+	if t.pool == nil {
+		t.cancel()
+		return
+	}
+	t.pool.release(t, err)
+}
+
+// LoadPage opens pageURL in a leased tab and returns the HTML after letting the page render for settle
+func LoadPage(ctx context.Context, pageURL string, settle time.Duration) (html string, err error) {
+	tab, err := Lease(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { tab.Release(err) }()
+	ctx, cancel := tab.Context(ctx)
+	defer cancel()
+
+	if err = Navigate(ctx, pageURL); err != nil {
+		return "", err
+	}
+	err = chromedp.Run(ctx,
+		chromedp.WaitReady("body", chromedp.ByQuery),
+		chromedp.Sleep(settle),
+		chromedp.OuterHTML("html", &html),
+	)
+	if err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// Navigate loads pageURL in the tab of ctx once the politeness layer lets it hit the host.
+// Rate limit and server error responses back the host off and are returned as errors.
+func Navigate(ctx context.Context, pageURL string) error {
+	polite := politeness.FromContext(ctx)
+	if err := polite.Wait(ctx, pageURL); err != nil {
+		if errors.Is(err, politeness.ErrDisallowed) {
+			// A URL robots.txt excludes is refused on every attempt, it is not retried
+			return source.Fail(models.FailureDisallowed, err)
+		}
+		return err
+	}
+
+	resp, err := chromedp.RunResponse(ctx, chromedp.Navigate(pageURL))
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	return polite.Report(ctx, pageURL, int(resp.Status))
+}
@@ -0,0 +1,225 @@
+package browser
+
+import (
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Defaults used when BROWSER_MAX_RECOVERIES or BROWSER_STALL_TIMEOUT are not set
+const (
+	defaultMaxRecoveries = 3
+	defaultStallTimeout  = 30 // seconds
+	defaultMaxErrors     = 3
+)
+
+var (
+	// ErrStalled is returned by a step that did not finish within the stall timeout
+	ErrStalled = errors.New("browser stalled")
+	// ErrGaveUp is returned once a supervisor restarted the browser as often as it may
+	ErrGaveUp = errors.New("browser kept failing, gave up")
+)
+
+// SupervisorConfig sets how a supervisor watches its browser
+type SupervisorConfig struct {
+	MaxRecoveries int           // Restarts allowed before giving up
+	StallTimeout  time.Duration // Longest a step may take
+	MaxErrors     int           // Failed steps in a row in a responsive browser before it is restarted anyway
+
+	// Launch starts a browser and returns its context, Probe checks that it still answers.
+	// Both default to headless Chrome, tests replace them.
+	Launch func(ctx context.Context) (context.Context, context.CancelFunc, error)
+	Probe  func(ctx context.Context) error
+}
+
+// SupervisorConfigFromEnv reads BROWSER_MAX_RECOVERIES and BROWSER_STALL_TIMEOUT (seconds) from the environment
+func SupervisorConfigFromEnv() SupervisorConfig {
+	config := SupervisorConfig{MaxRecoveries: defaultMaxRecoveries, StallTimeout: defaultStallTimeout * time.Second, MaxErrors: defaultMaxErrors}
+	if recoveries, err := strconv.Atoi(os.Getenv("BROWSER_MAX_RECOVERIES")); err == nil && recoveries >= 0 {
+		config.MaxRecoveries = recoveries
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("BROWSER_STALL_TIMEOUT")); err == nil && seconds > 0 {
+		config.StallTimeout = time.Duration(seconds) * time.Second
+	}
+	return config
+}
+
+// Supervisor keeps the browser a listing page is scrolled in working. Every step runs with
+// a stall timeout, and a step that stalled, failed in a dead browser or failed too often in
+// a row restarts the browser, after which the scroller repositions itself at the page it
+// reached. Recoveries are reported to the run in the context.
+type Supervisor struct {
+	parent context.Context
+	config SupervisorConfig
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	errors     int
+	recoveries int
+}
+
+// NewSupervisor creates a supervisor for browsers running under ctx, Start launches the first one
+func NewSupervisor(ctx context.Context, config SupervisorConfig) *Supervisor {
+	if config.Launch == nil {
+		config.Launch = launchChrome
+	}
+	if config.Probe == nil {
+		config.Probe = probeChrome
+	}
+	if config.MaxErrors < 1 {
+		config.MaxErrors = defaultMaxErrors
+	}
+	if config.StallTimeout <= 0 {
+		config.StallTimeout = defaultStallTimeout * time.Second
+	}
+	return &Supervisor{parent: ctx, config: config}
+}
+
+func launchChrome(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	browserCtx, cancel := chromedp.NewContext(ctx)
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return browserCtx, cancel, nil
+}
+
+func probeChrome(ctx context.Context) error {
+	var result int
+	return chromedp.Run(ctx, chromedp.Evaluate(`1`, &result))
+}
+
+// Start launches the browser
+func (s *Supervisor) Start() error {
+	s.Close()
+	ctx, cancel, err := s.config.Launch(s.parent)
+	if err != nil {
+		return err
+	}
+	s.ctx, s.cancel = ctx, cancel
+	return nil
+}
+
+// Close closes the browser
+func (s *Supervisor) Close() {
+	if s.cancel != nil {
+		s.cancel()
+		s.ctx, s.cancel = nil, nil
+	}
+}
+
+// Recoveries returns how often the browser was restarted
+func (s *Supervisor) Recoveries() int {
+	return s.recoveries
+}
+
+// Do runs a step in the browser and returns ErrStalled if it doesn't finish within the stall timeout.
+// A step that succeeds clears the failed steps counted by Check.
+func (s *Supervisor) Do(step func(ctx context.Context) error) error {
+	err := s.run(step)
+	if err == nil {
+		s.errors = 0
+	}
+	return err
+}
+
+// run runs a step with the stall timeout, without touching the failed steps
+func (s *Supervisor) run(step func(ctx context.Context) error) error {
+	if s.ctx == nil {
+		return errors.New("browser is not running")
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, s.config.StallTimeout)
+	defer cancel()
+
+	err := step(ctx)
+	if err != nil && s.parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrStalled, err)
+	}
+	return err
+}
+
+// Check handles a failed step. It returns nil when the scroller can go on: the step may just be
+// retried, or the browser was restarted and repositioned. It returns an error when the scroller
+// has to stop, because ctx is done or the recoveries ran out.
+func (s *Supervisor) Check(err error, reposition func() error) error {
+	if s.parent.Err() != nil {
+		return s.parent.Err()
+	}
+	s.errors++
+	if !errors.Is(err, ErrStalled) && s.errors < s.config.MaxErrors && s.alive() {
+		// Give the page a moment before the step is retried
+		timer := time.NewTimer(time.Second)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-s.parent.Done():
+			return s.parent.Err()
+		}
+		return nil
+	}
+	return s.Recover(err, reposition)
+}
+
+// alive reports whether the browser still answers. The probe is not a step of the
+// scroller, so it doesn't clear the failed steps.
+func (s *Supervisor) alive() bool {
+	return s.ctx != nil && s.ctx.Err() == nil && s.run(s.config.Probe) == nil
+}
+
+// Recover restarts the browser because of cause and runs reposition in the new one, trying again
+// while recoveries are left. It returns ErrGaveUp once they ran out.
+func (s *Supervisor) Recover(cause error, reposition func() error) error {
+	for {
+		if s.parent.Err() != nil {
+			return s.parent.Err()
+		}
+		if s.recoveries >= s.config.MaxRecoveries {
+			s.Close()
+			return fmt.Errorf("%w after %d recoveries: %v", ErrGaveUp, s.recoveries, cause)
+		}
+		s.recoveries++
+		s.errors = 0
+		source.ReportRecovery(s.parent)
+
+		if err := s.Start(); err != nil {
+			cause = err
+			continue
+		}
+		if reposition != nil {
+			if err := reposition(); err != nil {
+				cause = err
+				continue
+			}
+		}
+		return nil
+	}
+}
+
+// ScrollTracker notices a list that stopped growing: the same scroll height measured Limit times in a row
+type ScrollTracker struct {
+	Limit int
+	last  int64
+	same  int
+}
+
+// Measure records the height of the page. grew reports whether it changed since the last
+// measure, stuck whether it stayed the same Limit times in a row.
+func (t *ScrollTracker) Measure(height int64) (grew bool, stuck bool) {
+	if height != t.last {
+		t.last, t.same = height, 0
+		return true, false
+	}
+	t.same++
+	return false, t.same >= t.Limit
+}
+
+// Reset forgets the measured heights, after the page was loaded again
+func (t *ScrollTracker) Reset() {
+	t.last, t.same = 0, 0
+}
@@ -6,7 +6,7 @@ import (
 	"strconv"
 )
 
-func SetCrawlerConfig(crawlTime int, pageScrapTime int, adCount int, maxScroll int) {
+func SetCrawlerConfig(crawlTime int, pageScrapTime int, adCount int, maxScroll int, workers int, mode string) {
 
 	if crawlTime != 0 {
 		err := os.Setenv("MAX_CRAWL_TIME", strconv.Itoa(crawlTime))
@@ -35,4 +35,18 @@ func SetCrawlerConfig(crawlTime int, pageScrapTime int, adCount int, maxScroll i
 			log.Println("error setting crawlTime: ", err)
 		}
 	}
+
+	if workers != 0 {
+		err := os.Setenv("MAX_WORKERS", strconv.Itoa(workers))
+		if err != nil {
+			log.Println("error setting workers: ", err)
+		}
+	}
+
+	if mode != "" {
+		err := os.Setenv("CRAWL_MODE", mode)
+		if err != nil {
+			log.Println("error setting crawl mode: ", err)
+		}
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"strconv"
@@ -12,26 +13,34 @@ import (
 	"time"
 
 	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/selectors"
+	"Crawlzilla/services/crawler/source"
 	"Crawlzilla/utils"
 
-	"github.com/chromedp/cdproto/cdp"
+	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
 
-// ScrapPropertyPage scraps the given URL, fills the Ads struct, and returns it
-func ScrapPropertyPage(pageURL string) (models.Ads, error) {
-	result := models.Ads{}
-
-	fmt.Println("SCRAPING: ", pageURL)
-
+// LoadPageWithChrome opens the page in a leased Chrome tab, reveals the contact number and returns the rendered HTML
+func LoadPageWithChrome(ctx context.Context, pageURL string) (html string, err error) {
 	DIVAR_TOKEN := os.Getenv("DIVAR_TOKEN")
 	if DIVAR_TOKEN == "" {
 		log.Println("DIVAR_TOKEN environment variable is not set")
 	}
 
-	// Create a new Chrome context
-	ctx, cancel := chromedp.NewContext(context.Background())
+	spec := Selectors.Get()
+
+	// Lease a Chrome tab, a failed page recycles it
+	tab, err := browser.Lease(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { tab.Release(err) }()
+	ctx, cancel := tab.Context(ctx)
 	defer cancel()
 
 	// Set timeout for the scraping task
@@ -62,82 +71,155 @@ func ScrapPropertyPage(pageURL string) (models.Ads, error) {
 
 	// Run the Chromedp tasks
 	err = chromedp.Run(ctx,
-		network.Enable(),           // Enable the network domain to apply cookies
-		setCookie,                  // Set the cookie
-		chromedp.Navigate(pageURL)) // Navigate to the page
-
+		network.Enable(), // Enable the network domain to apply cookies
+		setCookie,        // Set the cookie
+	)
+	if err != nil {
+		return "", err
+	}
+	if err = browser.Navigate(ctx, pageURL); err != nil {
+		log.Println("Cant navigate URL:", err)
+		return "", err
+	}
+	err = chromedp.Run(ctx, chromedp.WaitReady(strings.Join(spec.Selectors("category"), ", "))) // Wait for the post to render
 	if err != nil {
 		log.Println("Cant navigate URL:", err)
+		return "", err
+	}
+
+	// Reveal the contact number if the post has one
+	for _, contactButtonSelector := range spec.Selectors("contact_button") {
+		var contactExists bool
+		err = chromedp.Run(ctx,
+			chromedp.EvaluateAsDevTools(fmt.Sprintf(`document.querySelector(%q) !== null`, contactButtonSelector), &contactExists),
+		)
+		if err != nil {
+			log.Println("Cant get Contact Number element:", err)
+		}
+		if !contactExists {
+			continue
+		}
+		err = chromedp.Run(ctx,
+			chromedp.Click(contactButtonSelector, chromedp.NodeVisible),
+			chromedp.Sleep(2*time.Second),
+		)
+		if err != nil {
+			log.Println("Cant get Contact Number element:", err)
+		}
+		break
+	}
+
+	if err := chromedp.Run(ctx, chromedp.OuterHTML("html", &html)); err != nil {
+		return "", err
+	}
+	captureScreenshot(ctx)
+	if err = politeness.FromContext(ctx).DetectBlock(ctx, pageURL, html, spec.Labels["blocked"]); err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// LoadPageWithHTTP fetches the server rendered HTML of a post without a browser.
+// The contact number is only revealed by a click, so it is missing from the page.
+func LoadPageWithHTTP(ctx context.Context, pageURL string) (string, error) {
+	header := http.Header{}
+	if DIVAR_TOKEN := os.Getenv("DIVAR_TOKEN"); DIVAR_TOKEN != "" {
+		header.Set("Cookie", (&http.Cookie{Name: "token", Value: DIVAR_TOKEN}).String())
+	}
+	html, err := fetch.Get(ctx, pageURL, header)
+	if err != nil {
+		return "", err
+	}
+	if err = politeness.FromContext(ctx).DetectBlock(ctx, pageURL, html, Selectors.Get().Labels["blocked"]); err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// captureScreenshot hands a screenshot of the page to the recorder in ctx when it asks for one
+func captureScreenshot(ctx context.Context) {
+	recorder := source.RecorderFromContext(ctx)
+	if !recorder.WantsScreenshot() {
+		return
 	}
+	var screenshot []byte
+	if err := chromedp.Run(ctx, chromedp.FullScreenshot(&screenshot, 80)); err != nil {
+		log.Println("Cant capture screenshot:", err)
+		return
+	}
+	recorder.RecordScreenshot(screenshot)
+}
+
+// ParsePropertyPage extracts an Ads struct from the rendered HTML of a divar post
+func ParsePropertyPage(pageURL string, html string) (models.Ads, error) {
+	result := models.Ads{}
+	spec := Selectors.Get()
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return result, err
+	}
+	page := doc.Selection
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Extract Category
-	var categoryText string
-	err = chromedp.Run(ctx,
-		chromedp.Text(`#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > div > nav > div > a > button > span`, &categoryText),
-	)
+	categoryText, err := spec.Text(page, "category")
 	if err != nil {
 		log.Println("cant get category string:", err)
-		return result, errors.New("")
+		return result, errors.New("category not found on page")
 	}
 
 	category_property := strings.Split(categoryText, " ")
+	if len(category_property) < 2 {
+		return result, source.Fail(models.FailureUnsupported, errors.New("category not found"))
+	}
 	category := category_property[0]
 	property := category_property[1]
 
-	if category == "فروش" {
+	if spec.Is("presale", category) {
+		// Pre-sale projects are sold before the building is finished
 		result.CategoryType = "sell"
-		if property == "خانه" {
-			result.PropertyType = "vila"
-		} else if property == "آپارتمان" {
-			result.PropertyType = "apartment"
+		result.PropertyType = models.PropertyPresale
+	} else {
+		if spec.Is("sell", category) {
+			result.CategoryType = "sell"
+		} else if spec.Is("rent", category) {
+			result.CategoryType = "rent"
 		} else {
-			return result, errors.New("property type not found")
+			return result, source.Fail(models.FailureUnsupported, errors.New("category not found"))
 		}
-	} else if category == "اجارهٔ" {
-		result.CategoryType = "rent"
-		if property == "خانه" {
-			result.PropertyType = "vila"
-		} else if property == "آپارتمان" {
-			result.PropertyType = "apartment"
-		} else {
-			return result, errors.New("property type not found")
+		result.PropertyType = parsePropertyType(spec, property)
+		if result.PropertyType == "" {
+			return result, source.Fail(models.FailureUnsupported, errors.New("property type not found"))
 		}
-	} else {
-		return result, errors.New("category not found")
 	}
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Extract Title
-	err = chromedp.Run(ctx,
-		chromedp.Text(`#app div.container--has-footer-d86a9.kt-container div main article div div.kt-col-5 section:nth-child(1) div.kt-page-title div h1`, &result.Title),
-	)
+	result.Title, err = spec.Text(page, "title")
 	if err != nil {
 		log.Println("Cant get Title:", err)
 	}
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Extract City
-	var stringCity string
-
-	err = chromedp.Run(ctx,
-		chromedp.Text(`#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > section:nth-child(1) > div.kt-page-title > div > div`, &stringCity),
-	)
+	stringCity, err := spec.Text(page, "subtitle")
 	if err != nil {
 		log.Println("Cant Get City:", err)
 	}
 
 	// Find the index of "در"
-	index := strings.Index(stringCity, "در ")
+	locationPrefix := spec.Label("location_prefix")
+	index := strings.Index(stringCity, locationPrefix)
 	if index == -1 {
 		fmt.Println("The text does not contain 'در'")
-		return result, errors.New("")
+		return result, errors.New("city not found")
 	}
 
 	// Get the part of the text after "در" and trim any leading or trailing spaces
-	locationPart := strings.TrimSpace(stringCity[index+len("در "):])
+	locationPart := strings.TrimSpace(stringCity[index+len(locationPrefix):])
 
 	// Split the location part by spaces
-	locationParts := strings.Split(locationPart, "، ")
+	locationParts := strings.Split(locationPart, spec.Label("location_separator"))
 
 	// Check if there is at least one part for the city
 	if len(locationParts) > 0 {
@@ -152,15 +234,11 @@ func ScrapPropertyPage(pageURL string) (models.Ads, error) {
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Extract Room
-	var stringRoom string
-
-	err = chromedp.Run(ctx,
-		chromedp.Text(`#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > section:nth-child(1) > div.post-page__section--padded > table:nth-child(1) > tbody > tr > td:nth-child(3)`, &stringRoom),
-	)
+	stringRoom, err := spec.Text(page, "room")
 	if err != nil {
 		log.Println("Cant get Room:", err)
 	}
-	if stringRoom == "بدون اتاق" {
+	if spec.Is("no_room", stringRoom) {
 		result.Room = 0
 	} else {
 		// Convert extracted Persian Room text to integer
@@ -172,11 +250,7 @@ func ScrapPropertyPage(pageURL string) (models.Ads, error) {
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Extract Area
-	var stringArea string
-
-	err = chromedp.Run(ctx,
-		chromedp.Text(`#app div.container--has-footer-d86a9.kt-container div main article div div.kt-col-5 section:nth-child(1) div.post-page__section--padded table:nth-child(1) tbody tr td:nth-child(1)`, &stringArea),
-	)
+	stringArea, err := spec.Text(page, "area")
 	if err != nil {
 		log.Println("Cant get Area:", err)
 	}
@@ -184,340 +258,110 @@ func ScrapPropertyPage(pageURL string) (models.Ads, error) {
 	result.Area, _ = utils.ConvertPersianNumber(stringArea)
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
-	// Extract Rent, Price, Floors
-	var stringPrice string
-	var stringRent string
-	var stringFloors string
-
-	err = chromedp.Run(ctx,
-
-		// Retrieve all rows within the container
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			var rows []*cdp.Node
-			// Find all rows that match the class selector
-			err := chromedp.Nodes(`div.post-page__section--padded div.kt-base-row.kt-base-row--large.kt-unexpandable-row`, &rows, chromedp.ByQueryAll).Do(ctx)
-			if err != nil {
-				return err
-			}
-
-			// Loop through each row and extract title and value
-			for _, row := range rows {
-				var title, value string
-
-				// Extract the title text from within each row
-				if err := chromedp.Text(`.kt-base-row__title.kt-unexpandable-row__title`, &title, chromedp.ByQuery, chromedp.FromNode(row)).Do(ctx); err != nil {
-					log.Printf("Failed to extract title for row: %v", err)
-					continue
-				}
-				title = strings.TrimSpace(title)
-
-				// Extract the value text from within each row
-				if err := chromedp.Text(`.kt-unexpandable-row__value`, &value, chromedp.ByQuery, chromedp.FromNode(row)).Do(ctx); err != nil {
-					log.Printf("Failed to extract value for row: %v", err)
-					continue
-				}
-				value = strings.TrimSpace(value)
-
-				// Assign value based on title
-				switch title {
-				case "قیمت کل":
-					stringPrice = value
-					// remove price text
-					stringPrice = strings.Split(stringPrice, " ")[0]
-					if stringPrice == "مجانی" {
-						stringPrice = "0"
-					}
-					priceInt, err := utils.ConvertPersianNumber(stringPrice)
-					if err != nil {
-						log.Println("Cant convert or get Price value:", err)
-					}
-					result.Price = priceInt // Fill the Price field
-
-				case "ودیعه":
-					stringPrice = value
-					// remove price text
-					stringPrice = strings.Split(stringPrice, " ")[0]
-					if stringPrice == "مجانی" {
-						stringPrice = "0"
-					}
-					priceInt, err := utils.ConvertPersianNumber(stringPrice)
-					if err != nil {
-						log.Println("Cant convert or get Price value:", err)
-					}
-					result.Price = priceInt // Fill the Price field
-
-				case "اجارهٔ ماهانه":
-					stringRent = value
-					// remove rent text
-					stringRent = strings.Split(stringRent, " ")[0]
-					if stringRent == "مجانی" {
-						stringRent = "0"
-					}
-					rentInt, err := utils.ConvertPersianNumber(stringRent) // Fill the Area field
-					if err != nil {
-						log.Println("Cant convert or get Price value:", err)
-					}
-					result.Rent = rentInt // Fill the Price field
-
-				case "طبقه":
-					stringFloors = value
-					// separate floor number and total floors
-					floorsSplit := strings.Split(stringFloors, " ")
-					if len(floorsSplit) == 1 {
-						// Check if the floor value is "همکف"
-						if floorsSplit[0] == "همکف" {
-							result.FloorNumber = 0
-							result.TotalFloors = 0
-						} else {
-							floorNumberInt, err := utils.ConvertPersianNumber(floorsSplit[0]) // Convert the floor number
-							if err != nil {
-								log.Println("Cant convert or get Floor Number value:", err)
-							}
-							result.FloorNumber = floorNumberInt
-							result.TotalFloors = 0
-						}
-					} else {
-						// Check if the floor value is "همکف"
-						if floorsSplit[0] == "همکف" {
-							result.FloorNumber = 0
-						} else {
-							floorNumberInt, err := utils.ConvertPersianNumber(floorsSplit[0]) // Convert the floor number
-							if err != nil {
-								log.Println("Cant convert or get Floor Number value:", err)
-							}
-							result.FloorNumber = floorNumberInt
-						}
-
-						// Check if the total floors value is "همکف"
-						if floorsSplit[2] == "همکف" {
-							result.TotalFloors = 0
-						} else {
-							totalFloorInt, err := utils.ConvertPersianNumber(floorsSplit[2]) // Convert the total floors
-							if err != nil {
-								log.Println("Cant convert or get Total Floor value:", err)
-							}
-							result.TotalFloors = totalFloorInt
-						}
-					}
-				}
-			}
-			return nil
-		}),
-	)
-
-	if err != nil {
-		log.Println("cant extract floor or prirce or rent", err)
-
+	// Extract Year Built, older buildings are shown as "قبل از ۱۳۷۰"
+	if stringYearBuilt, err := spec.Text(page, "year_built"); err == nil {
+		if result.YearBuilt, err = utils.ExtractNumber(stringYearBuilt); err != nil {
+			log.Println("Cant convert year built string to int:", err)
+		}
 	}
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
-	// Check Price Slider Existed
-	var sliderExist bool
+	// Extract Rent, Price, Deposit, Floors, Parking Count
 
-	err = chromedp.Run(ctx,
-		chromedp.EvaluateAsDevTools(`
-			document.querySelector("#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > section:nth-child(1) > div.post-page__section--padded > div.convert-slider > table > tbody > tr") !== null
-		`, &sliderExist),
-	)
-	if err != nil {
-		log.Println("Cant get Parking:", err)
-	}
-
-	if sliderExist {
-		err = chromedp.Run(ctx,
-			chromedp.Text(`#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > section:nth-child(1) > div.post-page__section--padded > div.convert-slider > table > tbody > tr > td:nth-child(1)`, &stringPrice),
-		)
+	// Loop through each row and extract title and value
+	spec.Find(page, "info_row").Each(func(i int, row *goquery.Selection) {
+		title, err := spec.Text(row, "info_row_title")
 		if err != nil {
-			log.Println("Cant Extract Slider price and rent:", err)
+			log.Printf("Failed to extract title for row: %v", err)
+			return
 		}
-		err = chromedp.Run(ctx,
-			chromedp.Text(`#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > section:nth-child(1) > div.post-page__section--padded > div.convert-slider > table > tbody > tr > td:nth-child(2)`, &stringRent),
-		)
+
+		value, err := spec.Text(row, "info_row_value")
 		if err != nil {
-			log.Println("Cant Extract Slider price and rent:", err)
+			log.Printf("Failed to extract value for row: %v", err)
+			return
 		}
 
-		// remove price text
-		stringPriceParts := strings.Split(stringPrice, " ")
-
-		var stringPriceValue, currencyPrice string
+		// Assign value based on title
+		switch {
+		case spec.Is("total_price", title):
+			result.Price = parseAmount(spec, strings.Split(value, " ")[0]) // Fill the Price field
+
+		case spec.Is("deposit", title):
+			result.Deposit = parseAmount(spec, strings.Split(value, " ")[0]) // Fill the Deposit field
+
+		case spec.Is("monthly_rent", title):
+			result.Rent = parseAmount(spec, strings.Split(value, " ")[0]) // Fill the Rent field
+
+		case spec.Is("floor", title):
+			// separate floor number and total floors
+			floorsSplit := strings.Split(value, " ")
+			result.FloorNumber = parseFloor(spec, floorsSplit[0])
+			if len(floorsSplit) >= 3 {
+				result.TotalFloors = parseFloor(spec, floorsSplit[2])
+			} else {
+				result.TotalFloors = 0
+			}
 
-		if len(stringPriceParts) == 2 {
-			// If there are two parts, assign each part separately
-			stringPriceValue = stringPriceParts[0]
-			currencyPrice = stringPriceParts[1]
-		} else if len(stringPriceParts) == 1 {
-			// If there is only one part, assign it to stringPriceValue and leave currencyPrice empty
-			stringPriceValue = stringPriceParts[0]
-			currencyPrice = "" // or some default value if needed
-		} else {
-			// Handle any unexpected cases, such as an empty string
-			stringPriceValue = "0"
-			currencyPrice = "0"
-		}
-		if stringPriceValue == "مجانی" {
-			stringPriceValue = "0"
-		}
-		if stringPriceValue == "رایگان" {
-			stringPriceValue = "0"
-		}
-		if stringPriceValue == "توافقی" {
-			stringPriceValue = "0"
-		}
-		priceInt, err := utils.ConvertPersianNumber(stringPriceValue)
-		if err != nil {
-			log.Println("Cant convert or get Price value:", err)
-		}
-		if currencyPrice == "میلیارد" {
-			result.Price = priceInt * 1000000000
-		} else if currencyPrice == "میلیون" {
-			result.Price = priceInt * 1000000
-		} else {
-			result.Price = priceInt // Fill the Price field
+		case spec.Is("parking_count", title):
+			result.ParkingCount = parseAmount(spec, value)
 		}
+	})
 
-		// remove rent text
-		stringRentParts := strings.Split(stringRent, " ")
-
-		var stringRentValue, currencyRent string
+	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
+	// Check Deposit Slider Existed
+	sliderRow := spec.Find(page, "slider_row").First()
 
-		if len(stringRentParts) == 2 {
-			// If there are two parts, assign each part separately
-			stringRentValue = stringRentParts[0]
-			currencyRent = stringRentParts[1]
-		} else if len(stringRentParts) == 1 {
-			// If there is only one part, assign it to stringRentValue and leave currencyRent empty
-			stringRentValue = stringRentParts[0]
-			currencyRent = "" // or some default value if needed
-		} else {
-			// Handle any unexpected cases, such as an empty string
-			stringRentValue = "0"
-			currencyRent = "0"
-		}
-		if stringRentValue == "مجانی" {
-			stringRentValue = "0"
-		}
-		if stringRentValue == "رایگان" {
-			stringRentValue = "0"
-		}
-		if stringRentValue == "توافقی" {
-			stringRentValue = "0"
-		}
-		rentInt, err := utils.ConvertPersianNumber(stringRentValue) // Fill the Area field
-		if err != nil {
-			log.Println("Cant convert or get Rent value:", err)
-		}
-		if currencyRent == "میلیارد" {
-			result.Rent = rentInt * 1000000000
-		} else if currencyRent == "میلیون" {
-			result.Rent = rentInt * 1000000
-		} else {
-			result.Rent = rentInt // Fill the Price field
-		}
+	if sliderRow.Length() > 0 {
+		stringDeposit, _ := spec.Text(sliderRow, "slider_price")
+		stringRent, _ := spec.Text(sliderRow, "slider_rent")
 
+		result.Deposit = parseSliderAmount(spec, stringDeposit)
+		result.Rent = parseSliderAmount(spec, stringRent)
 	}
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Check Elevator, Balcony, Storage, Parking
-
-	// Run Chromedp tasks
-	err = chromedp.Run(ctx,
-
-		// Retrieve the row and check its child td elements
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			var rowNodes []*cdp.Node
-			// Find the main row element
-			err := chromedp.Nodes(`tr.kt-group-row__data-row td.kt-group-row-item__value`, &rowNodes, chromedp.ByQueryAll).Do(ctx)
-			if err != nil {
-				return err
-			}
-
-			// Loop through each <td> element and check for keywords
-			for _, node := range rowNodes {
-				var featureText string
-				// Extract the text of the current <td> using its NodeID
-				if err := chromedp.Text(node.FullXPath(), &featureText, chromedp.BySearch).Do(ctx); err != nil {
-					log.Printf("Failed to extract text for td element: %v", err)
-					continue
-				}
-				featureText = strings.TrimSpace(featureText)
-
-				// Switch case to check if the feature exists and set the corresponding variable
-				switch featureText {
-				case "پارکینگ":
-					result.HasParking = true
-				case "انباری":
-					result.HasStorage = true
-				case "بالکن":
-					result.HasBalcony = true
-				case "آسانسور":
-					result.HasElevator = true
-				}
-			}
-			return nil
-		}),
-	)
-
-	if err != nil {
-		log.Printf("cant get elevator balcony storage parking: %v", err)
+	spec.Find(page, "feature").Each(func(i int, node *goquery.Selection) {
+		featureText := strings.TrimSpace(node.Text())
+
+		// Switch case to check if the feature exists and set the corresponding variable
+		switch {
+		case spec.Is("parking", featureText):
+			result.HasParking = true
+		case spec.Is("storage", featureText):
+			result.HasStorage = true
+		case spec.Is("balcony", featureText):
+			result.HasBalcony = true
+		case spec.Is("elevator", featureText):
+			result.HasElevator = true
+		}
+	})
+	// A listing with parking has at least one spot when the count is not shown
+	if result.HasParking && result.ParkingCount == 0 {
+		result.ParkingCount = 1
 	}
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Extract Description
-	err = chromedp.Run(ctx,
-		chromedp.Text(`#app div.container--has-footer-d86a9.kt-container div main article div div.kt-col-5 section.post-page__section--padded div div.kt-base-row.kt-base-row--large.kt-description-row div p`, &result.Description),
-	)
+	result.Description, err = spec.Text(page, "description")
 	if err != nil {
 		log.Println("Cant get Description:", err)
 	}
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Contact number
-	var contactExists bool
-	var stringContactNumber string
-
-	err = chromedp.Run(ctx,
-		chromedp.Click(`#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > section:nth-child(1) > div.post-actions > button.kt-button.kt-button--primary.post-actions__get-contact`, chromedp.NodeVisible),
-		chromedp.Sleep(2*time.Second),
-		chromedp.EvaluateAsDevTools(`document.querySelector("#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > section:nth-child(1) > div.expandable-box > div.copy-row > div > div.kt-base-row__end.kt-unexpandable-row__value-box > a") !== null`, &contactExists),
-	)
+	result.ContactNumber, err = spec.Text(page, "contact")
 	if err != nil {
-		log.Println("Cant get Contact Number element:", err)
-	}
-
-	if contactExists {
-		err = chromedp.Run(ctx,
-			chromedp.Text(`#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-5 > section:nth-child(1) > div.expandable-box > div.copy-row > div > div.kt-base-row__end.kt-unexpandable-row__value-box > a`, &stringContactNumber),
-		)
-		if err != nil {
-			log.Println("Cant get Contact Number:", err)
-		}
-		// Convert extracted Persian Contact number text to integer
-		result.ContactNumber = stringContactNumber
-
-	} else {
 		log.Println("phone number is not exist")
 	}
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	// Location
-	// Check if Location URL element exists before extracting
-	err = chromedp.Run(ctx,
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			var exists bool
-			// Check if the selector exists
-			err := chromedp.Run(ctx, chromedp.EvaluateAsDevTools(
-				`document.querySelector("a.map-cm__attribution.map-cm__button") !== null`, &exists))
-			if err != nil || !exists {
-				// Element not found or error occurred, skip extraction
-				return errors.New("location not found")
-			}
-			// Extract href attribute if element exists
-			return chromedp.AttributeValue(`a.map-cm__attribution.map-cm__button`, "href", &result.LocationURL, nil).Do(ctx)
-		}),
-	)
-	if err != nil {
-		log.Println("Cant get Location:", err)
+	if href, exists := spec.Attr(page, "location", "href"); exists {
+		result.LocationURL = href
+	} else {
+		log.Println("Cant get Location:", errors.New("location not found"))
 	}
 
 	// Parse latitude and longitude from the location URL
@@ -537,29 +381,89 @@ func ScrapPropertyPage(pageURL string) (models.Ads, error) {
 	}
 
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
-	// Image
-	// Check if Image element exists before extracting
-	err = chromedp.Run(ctx,
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			var exists bool
-			// Check if the selector exists
-			err := chromedp.Run(ctx, chromedp.EvaluateAsDevTools(
-				`document.querySelector("#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-6.kt-offset-1 > section:nth-child(1) > div > div > div.keen-slider.kt-base-carousel__slides.slides-d6304 > div:nth-child(2) > figure > div > picture > img") !== null`, &exists))
-			if err != nil || !exists {
-				// Element not found or error occurred, skip extraction
-				return errors.New("image not found")
-			}
-			// Extract src attribute if element exists
-			return chromedp.AttributeValue(`#app > div.container--has-footer-d86a9.kt-container > div > main > article > div > div.kt-col-6.kt-offset-1 > section:nth-child(1) > div > div > div.keen-slider.kt-base-carousel__slides.slides-d6304 > div:nth-child(2) > figure > div > picture > img`, "src", &result.ImageURL, nil).Do(ctx)
-		}),
-	)
-	if err != nil {
-		log.Println("Cant get Image:", err)
+	// Images, every slide of the gallery in order
+	var imageURLs []string
+	spec.Find(page, "gallery_image").Each(func(i int, img *goquery.Selection) {
+		if src, exists := img.Attr("src"); exists && src != "" {
+			imageURLs = append(imageURLs, src)
+		}
+	})
+	result.SetImages(imageURLs)
+	if result.ImageURL == "" {
+		if src, exists := spec.Attr(page, "image", "src"); exists {
+			result.ImageURL = src
+		} else {
+			log.Println("Cant get Image:", errors.New("image not found"))
+		}
 	}
 
 	// Add URL and Reference divar
 	result.Reference = "divar"
 	result.URL = pageURL
+	result.SourceListingID = utils.ExtractDivarToken(pageURL)
 	//------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------
 	return result, nil
 }
+
+// parsePropertyType returns the property type named by the category text, empty when it is not supported
+func parsePropertyType(spec *selectors.Spec, property string) string {
+	for _, propertyType := range models.PropertyTypes {
+		if spec.Is(propertyType, property) {
+			return propertyType
+		}
+	}
+	return ""
+}
+
+// parseAmount converts a Persian amount to an integer, free amounts are 0
+func parseAmount(spec *selectors.Spec, amount string) int {
+	if spec.Is("free", amount) {
+		return 0
+	}
+	amountInt, err := utils.ConvertPersianNumber(amount)
+	if err != nil {
+		log.Println("Cant convert or get Price value:", err)
+	}
+	return amountInt
+}
+
+// parseFloor converts a Persian floor number to an integer, the ground floor is 0
+func parseFloor(spec *selectors.Spec, floor string) int {
+	if spec.Is("ground_floor", floor) {
+		return 0
+	}
+	floorInt, err := utils.ConvertPersianNumber(floor)
+	if err != nil {
+		log.Println("Cant convert or get Floor Number value:", err)
+	}
+	return floorInt
+}
+
+// parseSliderAmount converts a slider amount like "۱٫۵ میلیارد" to toman
+func parseSliderAmount(spec *selectors.Spec, amount string) int {
+	// remove price text
+	amountParts := strings.Split(amount, " ")
+
+	var amountValue, currency string
+
+	if len(amountParts) == 2 {
+		// If there are two parts, assign each part separately
+		amountValue = amountParts[0]
+		currency = amountParts[1]
+	} else if len(amountParts) == 1 {
+		// If there is only one part, assign it to amountValue and leave currency empty
+		amountValue = amountParts[0]
+		currency = "" // or some default value if needed
+	} else {
+		// Handle any unexpected cases, such as an empty string
+		amountValue = "0"
+		currency = "0"
+	}
+	amountInt := parseAmount(spec, amountValue)
+	if spec.Is("billion", currency) {
+		return amountInt * 1000000000
+	} else if spec.Is("million", currency) {
+		return amountInt * 1000000
+	}
+	return amountInt
+}
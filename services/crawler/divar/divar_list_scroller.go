@@ -2,7 +2,11 @@ package divar
 
 import (
 	"Crawlzilla/logger"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -14,20 +18,17 @@ import (
 	"go.uber.org/zap"
 )
 
-// Job represents a single URL to scrap
-type Job struct {
-	URL string
-}
+// maxSameHeights is how many times in a row the list may keep its height before it is considered stuck
+const maxSameHeights = 3
 
-func CrawlDivarAds(ctx context.Context, url string, jobs chan<- Job) {
+// CrawlDivarAds scrolls the listing page at url and sends the ads it finds to jobs. Chrome runs under
+// a supervisor: a crashed or stalled browser is restarted and scrolled back to the page it reached,
+// until BROWSER_MAX_RECOVERIES restarts were used up.
+func CrawlDivarAds(ctx context.Context, url string, jobs chan<- source.Job) {
 
 	configLogger := logger.ConfigLogger()
 	crawlerLogger, _ := configLogger("crawler")
 
-	// Create a ChromeDP context with a timeout
-	ctx, cancel := chromedp.NewContext(ctx)
-	defer cancel()
-
 	// Set timeout for the scraping task
 	maxCrawlTime, err := strconv.Atoi(os.Getenv("MAX_CRAWL_TIME"))
 	if err != nil {
@@ -35,26 +36,77 @@ func CrawlDivarAds(ctx context.Context, url string, jobs chan<- Job) {
 	}
 	maxCrawlDuration := time.Duration(maxCrawlTime) * time.Minute
 
-	ctx, cancel = context.WithTimeout(ctx, maxCrawlDuration)
+	ctx, cancel := context.WithTimeout(ctx, maxCrawlDuration)
 	defer cancel()
 
 	htmlChan := make(chan string)
+	// Unblock the scrolling goroutine if extraction stops early, it returns once ctx is canceled
+	defer func() {
+		for range htmlChan {
+		}
+	}()
+	polite := politeness.FromContext(ctx)
+	// Incremental runs skip the listings that are already stored
+	known := source.NewKnownTracker(ctx)
+	// Every load re-renders the whole list, posts sent from an earlier page are skipped
+	seen := make(map[string]bool)
 
 	// Goroutine to scroll and load content
 	go func() {
 		defer close(htmlChan)
 
 		page := 0
-		maxPage, err := strconv.Atoi(os.Getenv("MAX_PAGE"))
+		maxPage, err := source.MaxPages(ctx)
 		if err != nil {
 			crawlerLogger.Error("Error reading MAX_PAGE from .env", zap.Error(err))
 		}
-		var lastHeight, newHeight int64
 
-		if err := chromedp.Run(ctx, chromedp.Navigate(url)); err != nil {
-			crawlerLogger.Error("Navigation error:", zap.Error(err))
+		supervisor := browser.NewSupervisor(ctx, browser.SupervisorConfigFromEnv())
+		defer supervisor.Close()
+		tracker := browser.ScrollTracker{Limit: maxSameHeights}
+		// stuckHeight is where the list stopped growing before the last restart
+		var stuckHeight int64 = -1
+		repositioned := false
+
+		// reposition opens the list in a fresh browser and loads the pages that were already sent
+		reposition := func() error {
+			tracker.Reset()
+			err := supervisor.Do(func(ctx context.Context) error {
+				if err := browser.Navigate(ctx, url); err != nil {
+					return err
+				}
+				return chromedp.Run(ctx, chromedp.Sleep(2*time.Second))
+			})
+			if err != nil {
+				return err
+			}
+			for i := 0; i < page; i++ {
+				if err := supervisor.Do(loadMore); err != nil {
+					return err
+				}
+			}
+			repositioned = page > 0
+			return nil
+		}
+		// check decides whether scrolling goes on after a failed step
+		check := func(step string, err error) bool {
+			crawlerLogger.Error("Error "+step+":", zap.Error(err))
+			if err := supervisor.Check(err, reposition); err != nil {
+				if ctx.Err() == nil {
+					crawlerLogger.Error("browser could not be recovered, stopping...", zap.Int("page", page), zap.Error(err))
+				}
+				return false
+			}
+			return true
+		}
+
+		if err := supervisor.Start(); err != nil {
+			crawlerLogger.Error("Error starting browser:", zap.Error(err))
+			return
+		}
+		if err := reposition(); err != nil && !check("navigating", err) {
+			return
 		}
-		chromedp.Run(ctx, chromedp.Sleep(2*time.Second))
 		for {
 			select {
 			case <-ctx.Done():
@@ -65,48 +117,74 @@ func CrawlDivarAds(ctx context.Context, url string, jobs chan<- Job) {
 				crawlerLogger.Info("LOADING PAGE:", zap.Int("page", page))
 				fmt.Println()
 
-				if err := chromedp.Run(ctx, chromedp.Evaluate(`document.body.scrollHeight`, &newHeight)); err != nil {
-					crawlerLogger.Error("Error getting scroll height:", zap.Error(err))
-					continue
-				}
-
-				if newHeight == lastHeight {
-					crawlerLogger.Info("No more content to load.")
+				var newHeight int64
+				err := supervisor.Do(func(ctx context.Context) error {
+					return chromedp.Run(ctx, chromedp.Evaluate(`document.body.scrollHeight`, &newHeight))
+				})
+				if err != nil {
+					if !check("getting scroll height", err) {
+						return
+					}
 					continue
 				}
-				lastHeight = newHeight
 
-				var buttonExists bool
-				if err := chromedp.Run(ctx, chromedp.Evaluate(`document.querySelector('.post-list__load-more-btn-be092') !== null`, &buttonExists)); err != nil {
-					crawlerLogger.Error("Error checking 'Load More' button:", zap.Error(err))
+				grew, stuck := tracker.Measure(newHeight)
+				if stuck {
+					// Either the list ended or the browser stopped loading it, a fresh browser tells them apart
+					if newHeight <= stuckHeight {
+						crawlerLogger.Info("No more content to load.")
+						return
+					}
+					stuckHeight = newHeight
+					crawlerLogger.Warn("scroll height stopped changing, restarting browser", zap.Int64("height", newHeight))
+					if err := supervisor.Recover(errors.New("scroll height stopped changing"), reposition); err != nil {
+						crawlerLogger.Error("browser could not be recovered, stopping...", zap.Int("page", page), zap.Error(err))
+						return
+					}
 					continue
 				}
 
-				if buttonExists {
-					if err := chromedp.Run(ctx, chromedp.Click(".post-list__load-more-btn-be092", chromedp.ByQuery), chromedp.Sleep(500*time.Millisecond)); err != nil {
-						crawlerLogger.Error("Error clicking 'Load More':", zap.Error(err))
+				// Only a list that grew has new posts
+				if grew {
+					var html string
+					err = supervisor.Do(func(ctx context.Context) error {
+						return chromedp.Run(ctx, chromedp.OuterHTML("html", &html))
+					})
+					if err != nil {
+						if !check("getting HTML content", err) {
+							return
+						}
 						continue
 					}
-					fmt.Println("\nClicked 'Load More'")
-				} else {
-					if err := chromedp.Run(ctx, chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil), chromedp.Sleep(500*time.Millisecond)); err != nil {
-						crawlerLogger.Error("Error scrolling:", zap.Error(err))
+					if err := polite.DetectBlock(ctx, url, html, Selectors.Get().Labels["blocked"]); err != nil {
 						continue
 					}
+					htmlChan <- html
+					// The first page after a restart was already sent before it
+					if repositioned {
+						repositioned = false
+					} else {
+						page++
+						source.ReportPage(ctx)
+					}
+					if page >= maxPage {
+						crawlerLogger.Info("max page reached, stopping...")
+						cancel() // Trigger context cancellation
+						return
+					}
 				}
 
-				var html string
-				if err := chromedp.Run(ctx, chromedp.OuterHTML("html", &html)); err != nil {
-					crawlerLogger.Error("Error getting HTML content:", zap.Error(err))
-					continue
-				}
-				htmlChan <- html
-				page++
-				if page >= maxPage {
-					crawlerLogger.Info("max page reached, stopping...")
-					cancel() // Trigger context cancellation
+				// Loading more posts is another request to the site
+				if err := polite.Wait(ctx, url); err != nil {
+					crawlerLogger.Info("Stopping list", zap.Error(err))
 					return
 				}
+				if err := supervisor.Do(loadMore); err != nil {
+					if !check("loading more posts", err) {
+						return
+					}
+					continue
+				}
 			}
 		}
 	}()
@@ -125,20 +203,55 @@ func CrawlDivarAds(ctx context.Context, url string, jobs chan<- Job) {
 			}
 
 			// Extract links and send jobs to channel
-			doc.Find("a.kt-post-card__action").Each(func(i int, s *goquery.Selection) {
-				if href, exists := s.Attr("href"); exists {
-					select {
-					case jobs <- Job{URL: href}:
-						crawlerLogger.Info("scrap started", zap.String("url", href))
-					case <-ctx.Done():
-						crawlerLogger.Info("Job sending received shutdown signal, stopping...")
-						return
-					}
-				} else {
+			Selectors.Get().Find(doc.Selection, "post_card_link").EachWithBreak(func(i int, s *goquery.Selection) bool {
+				href, exists := s.Attr("href")
+				if !exists {
 					crawlerLogger.Info("No href found in the link.")
+					return true
+				}
+				if seen[href] {
+					return true
+				}
+				seen[href] = true
+				if known.Known(baseURL + href) {
+					return !known.Done()
+				}
+				select {
+				case jobs <- source.Job{URL: baseURL + href}:
+					crawlerLogger.Info("scrap started", zap.String("url", href))
+					return true
+				case <-ctx.Done():
+					crawlerLogger.Info("Job sending received shutdown signal, stopping...")
+					return false
 				}
 			})
+
+			if known.Done() {
+				crawlerLogger.Info("reached already crawled listings, stopping...", zap.Int("skipped", known.Skipped()))
+				cancel() // Stop scrolling
+				return
+			}
 		}
 	}
 	crawlerLogger.Info("Scrolling and extraction completed.")
 }
+
+// loadMore clicks the "Load More" button of the list, or scrolls to its end when there is none
+func loadMore(ctx context.Context) error {
+	loadMoreButton := ""
+	for _, selector := range Selectors.Get().Selectors("load_more_button") {
+		var buttonExists bool
+		if err := chromedp.Run(ctx, chromedp.Evaluate(fmt.Sprintf(`document.querySelector(%q) !== null`, selector), &buttonExists)); err != nil {
+			return err
+		}
+		if buttonExists {
+			loadMoreButton = selector
+			break
+		}
+	}
+
+	if loadMoreButton != "" {
+		return chromedp.Run(ctx, chromedp.Click(loadMoreButton, chromedp.ByQuery), chromedp.Sleep(500*time.Millisecond))
+	}
+	return chromedp.Run(ctx, chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil), chromedp.Sleep(500*time.Millisecond))
+}
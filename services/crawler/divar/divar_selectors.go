@@ -0,0 +1,17 @@
+package divar
+
+import (
+	"Crawlzilla/services/crawler/selectors"
+	_ "embed"
+)
+
+//go:embed selectors.json
+var defaultSelectors []byte
+
+// Selectors holds the CSS selectors and label texts of divar pages.
+// Put a divar.json in SELECTORS_DIR to override them without a rebuild.
+var Selectors = selectors.NewRegistry("divar", defaultSelectors,
+	"category", "title", "subtitle", "room", "area", "info_row", "info_row_title", "info_row_value",
+	"slider_row", "slider_price", "slider_rent", "feature", "description", "contact_button", "contact",
+	"location", "image", "post_card_link", "load_more_button",
+)
@@ -0,0 +1,58 @@
+package divar
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/source"
+	"context"
+)
+
+const baseURL = "https://divar.ir"
+
+// Source crawls real-estate ads from divar.ir
+type Source struct {
+	ListURL      string
+	Loader       source.PageLoader // Renders listings in Chrome
+	HTTPLoader   source.PageLoader // Fetches listings without a browser
+	StatusLoader source.PageLoader
+	Fetch        fetch.Config
+}
+
+// NewSource returns a divar source crawling all of Iran
+func NewSource() *Source {
+	return &Source{
+		ListURL:      baseURL + "/s/iran/real-estate",
+		Loader:       LoadPageWithChrome,
+		HTTPLoader:   LoadPageWithHTTP,
+		StatusLoader: LoadStatusPageWithChrome,
+		// Most listings hide the contact number, so it is not a browser field unless FETCH_BROWSER_FIELDS_DIVAR makes it one
+		Fetch: fetch.ConfigFromEnv("divar", fetch.Config{Mode: fetch.ModeChrome}),
+	}
+}
+
+// NewTargetSource returns a divar source crawling one category of a city
+func NewTargetSource(city string, category string) *Source {
+	src := NewSource()
+	src.ListURL = baseURL + "/s/" + city + "/" + category
+	return src
+}
+
+func (s *Source) Name() string {
+	return "divar"
+}
+
+func (s *Source) Discover(ctx context.Context, jobs chan<- source.Job) {
+	CrawlDivarAds(ctx, s.ListURL, jobs)
+}
+
+// Scrap loads a listing with Chrome or over HTTP, as set by the fetch mode of the source
+func (s *Source) Scrap(ctx context.Context, job source.Job) (models.Ads, error) {
+	strategy := fetch.Strategy{Config: s.Fetch, HTTP: s.HTTPLoader, Chrome: s.Loader, Parse: s.Parse}
+	return strategy.Scrap(ctx, job)
+}
+
+// Parse extracts an ad from the archived HTML of a listing
+func (s *Source) Parse(job source.Job, html string) (models.Ads, error) {
+	result, err := ParsePropertyPage(job.URL, html)
+	return result, source.Fail(models.FailureParse, err)
+}
@@ -0,0 +1,71 @@
+package divar
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/politeness"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// statusSettleTime lets a removed post render its notice before the page is read
+const statusSettleTime = 2 * time.Second
+
+// LoadStatusPageWithChrome loads a post without waiting for the post content, which a removed post never renders
+func LoadStatusPageWithChrome(ctx context.Context, pageURL string) (string, error) {
+	maxScrapTime, err := strconv.Atoi(os.Getenv("MAX_SCRAP_TIME"))
+	if err != nil {
+		log.Printf("Error reading MAX_SCRAP_TIME from .env: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(maxScrapTime)*time.Second)
+	defer cancel()
+
+	html, err := browser.LoadPage(ctx, pageURL, statusSettleTime)
+	if err != nil {
+		return "", err
+	}
+	if err := politeness.FromContext(ctx).DetectBlock(ctx, pageURL, html, Selectors.Get().Labels["blocked"]); err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// Check visits the post of a stored ad and tells whether it is still online
+func (s *Source) Check(ctx context.Context, ad models.Ads) (models.AdStatus, error) {
+	html, err := s.StatusLoader(ctx, ad.URL)
+	if err != nil {
+		return "", err
+	}
+	return ParseListingStatus(html)
+}
+
+// ParseListingStatus tells from a post page whether the post is active, sold or removed
+func ParseListingStatus(html string) (models.AdStatus, error) {
+	spec := Selectors.Get()
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return "", err
+	}
+
+	// The seller's description may mention the notice texts, only look at the page itself
+	spec.Find(doc.Selection, "description").Remove()
+	text := doc.Find("body").Text()
+
+	switch {
+	case spec.Contains("sold", text):
+		return models.AdSold, nil
+	case spec.Contains("expired", text):
+		return models.AdExpired, nil
+	case spec.Find(doc.Selection, "category").Length() > 0:
+		return models.AdActive, nil
+	}
+	return "", errors.New("listing status not recognized")
+}
@@ -0,0 +1,175 @@
+package fetch
+
+import (
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Mode selects how the listings of a source are loaded
+type Mode string
+
+const (
+	// ModeChrome renders every listing in a Chrome tab
+	ModeChrome Mode = "chrome"
+	// ModeHTTP fetches listings with a plain HTTP request, for server rendered pages
+	ModeHTTP Mode = "http"
+	// ModeAuto fetches listings over HTTP and renders them in Chrome only when
+	// the page could not be parsed or a browser field came back empty
+	ModeAuto Mode = "auto"
+)
+
+// ParseMode reads a fetch mode, an empty value is the Chrome mode
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ModeChrome, nil
+	case ModeChrome, ModeHTTP, ModeAuto:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown fetch mode %q, expected chrome, http or auto", value)
+}
+
+// Config sets how a source loads its listings
+type Config struct {
+	Mode Mode
+	// BrowserFields are the ad fields only a rendered page fills, like a contact number
+	// revealed by a click. In auto mode a listing missing one of them is loaded again with Chrome.
+	BrowserFields []string
+}
+
+// ConfigFromEnv reads the fetch settings of a source from FETCH_MODE and FETCH_BROWSER_FIELDS.
+// FETCH_MODE_<SOURCE> and FETCH_BROWSER_FIELDS_<SOURCE> override them for one source,
+// settings that are not set keep the defaults of the source.
+func ConfigFromEnv(name string, defaults Config) Config {
+	settings := defaults
+	suffix := "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+
+	for _, key := range []string{"FETCH_MODE" + suffix, "FETCH_MODE"} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		mode, err := ParseMode(value)
+		if err != nil {
+			log.Printf("Error reading %s from .env: %v", key, err)
+			continue
+		}
+		settings.Mode = mode
+		break
+	}
+	for _, key := range []string{"FETCH_BROWSER_FIELDS" + suffix, "FETCH_BROWSER_FIELDS"} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		var fields []string
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+		if err := CheckFields(fields); err != nil {
+			log.Printf("Error reading %s from .env: %v", key, err)
+			continue
+		}
+		settings.BrowserFields = fields
+		break
+	}
+	if settings.Mode == "" {
+		settings.Mode = ModeChrome
+	}
+	return settings
+}
+
+// CheckFields returns an error for a name that is not a field of models.Ads
+func CheckFields(fields []string) error {
+	ad := reflect.TypeOf(models.Ads{})
+	for _, field := range fields {
+		if _, ok := ad.FieldByName(field); !ok {
+			return fmt.Errorf("unknown ad field %q", field)
+		}
+	}
+	return nil
+}
+
+// Missing returns the fields of ad that are left empty
+func Missing(ad models.Ads, fields []string) []string {
+	var missing []string
+	value := reflect.ValueOf(ad)
+	for _, field := range fields {
+		if f := value.FieldByName(field); !f.IsValid() || f.IsZero() {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// Strategy loads a listing the way its source is configured and parses it
+type Strategy struct {
+	Config
+	HTTP   source.PageLoader
+	Chrome source.PageLoader
+	Parse  func(job source.Job, html string) (models.Ads, error)
+}
+
+// Scrap loads and parses a listing. Only the page the ad was parsed from is recorded.
+func (s Strategy) Scrap(ctx context.Context, job source.Job) (models.Ads, error) {
+	switch s.Mode {
+	case ModeHTTP:
+		return s.scrap(ctx, s.HTTP, job)
+	case ModeAuto:
+		result, err := s.try(ctx, job)
+		if err == nil || !s.fallsBack(ctx, err) {
+			return result, err
+		}
+		cfg.FromContext(ctx, "crawler").Info("listing needs a browser, loading it with Chrome", zap.String("url", job.URL), zap.Error(err))
+		return s.scrap(ctx, s.Chrome, job)
+	}
+	return s.scrap(ctx, s.Chrome, job)
+}
+
+// errBrowserFields is returned when a page fetched over HTTP lacks fields only a browser fills
+var errBrowserFields = errors.New("browser fields are empty")
+
+// try fetches a listing over HTTP, it fails when a browser field came back empty
+func (s Strategy) try(ctx context.Context, job source.Job) (models.Ads, error) {
+	html, err := s.HTTP(ctx, job.URL)
+	if err != nil {
+		return models.Ads{}, source.Fail(models.FailureNavigation, err)
+	}
+	result, err := s.Parse(job, html)
+	if err != nil {
+		return models.Ads{}, err
+	}
+	if missing := Missing(result, s.BrowserFields); len(missing) > 0 {
+		return models.Ads{}, fmt.Errorf("%w: %s", errBrowserFields, strings.Join(missing, ", "))
+	}
+	source.RecorderFromContext(ctx).Record(html)
+	return result, nil
+}
+
+// fallsBack reports whether a listing that failed over HTTP is worth rendering in Chrome.
+// A category no parser supports, a URL robots.txt excludes or a canceled crawl fails the same way in a browser.
+func (s Strategy) fallsBack(ctx context.Context, err error) bool {
+	kind := source.Classify(err)
+	return ctx.Err() == nil && kind != models.FailureUnsupported && kind != models.FailureDisallowed
+}
+
+func (s Strategy) scrap(ctx context.Context, loader source.PageLoader, job source.Job) (models.Ads, error) {
+	html, err := loader(ctx, job.URL)
+	if err != nil {
+		return models.Ads{}, source.Fail(models.FailureNavigation, err)
+	}
+	source.RecorderFromContext(ctx).Record(html)
+	return s.Parse(job, html)
+}
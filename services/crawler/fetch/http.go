@@ -0,0 +1,78 @@
+package fetch
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// UserAgent is sent with HTTP fetches, sites serve the markup their Chrome visitors get
+const UserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// maxBody is the largest page read, a listing is a few hundred kilobytes
+const maxBody = 10 << 20
+
+// client has no timeout of its own, every fetch is bounded by MAX_SCRAP_TIME
+var client = &http.Client{}
+
+// Get fetches a page without a browser. It waits for the politeness layer like a browser
+// navigation, reports the status of the response to it and returns the body of a successful one.
+func Get(ctx context.Context, pageURL string, header http.Header) (string, error) {
+	polite := politeness.FromContext(ctx)
+	if err := polite.Wait(ctx, pageURL); err != nil {
+		if errors.Is(err, politeness.ErrDisallowed) {
+			// A URL robots.txt excludes is refused on every attempt, it is not retried
+			return "", source.Fail(models.FailureDisallowed, err)
+		}
+		return "", err
+	}
+
+	maxScrapTime, err := strconv.Atoi(os.Getenv("MAX_SCRAP_TIME"))
+	if err != nil {
+		log.Printf("Error reading MAX_SCRAP_TIME from .env: %v", err)
+	}
+	if maxScrapTime <= 0 {
+		maxScrapTime = 30
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(maxScrapTime)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if req.Header.Get("Accept-Language") == "" {
+		req.Header.Set("Accept-Language", "fa-IR,fa;q=0.9,en;q=0.8")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to load URL %s: %w", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	if err := polite.Report(ctx, pageURL, resp.StatusCode); err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("failed to load URL %s: status %d", pageURL, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to read URL %s: %w", pageURL, err)
+	}
+	return string(body), nil
+}
@@ -0,0 +1,68 @@
+package generic
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Catalog holds the sites defined in a directory, one JSON file per site
+type Catalog struct {
+	sites map[string]*Site
+}
+
+// LoadDir reads every *.json site definition of dir. A broken definition is an error,
+// so a typo doesn't silently stop a site from being crawled.
+func LoadDir(dir string) (*Catalog, error) {
+	catalog := &Catalog{sites: make(map[string]*Site)}
+	if dir == "" {
+		return catalog, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return catalog, err
+	}
+	for _, file := range files {
+		site, err := Load(file)
+		if err != nil {
+			return catalog, err
+		}
+		catalog.sites[site.Name] = site
+	}
+	return catalog, nil
+}
+
+var (
+	defaultCatalog *Catalog
+	defaultOnce    sync.Once
+)
+
+// Default returns the sites defined in SITES_DIR, read once per process
+func Default() *Catalog {
+	defaultOnce.Do(func() {
+		catalog, err := LoadDir(os.Getenv("SITES_DIR"))
+		if err != nil {
+			log.Printf("Cant load site definitions from %s: %v", os.Getenv("SITES_DIR"), err)
+		}
+		defaultCatalog = catalog
+	})
+	return defaultCatalog
+}
+
+// Names returns the names of the sites in alphabetical order
+func (c *Catalog) Names() []string {
+	names := make([]string, 0, len(c.sites))
+	for name := range c.sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Site returns the definition of a site
+func (c *Catalog) Site(name string) (*Site, bool) {
+	site, ok := c.sites[name]
+	return site, ok
+}
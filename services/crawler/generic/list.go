@@ -0,0 +1,248 @@
+package generic
+
+import (
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+)
+
+// maxIdleSteps is how many scrolls or clicks in a row may fail or load no new ads before a category is done
+const maxIdleSteps = 3
+
+// lister sends the listings of a category to jobs, skipping the cards the list showed before
+type lister struct {
+	category string
+	jobs     chan<- source.Job
+	known    *source.KnownTracker
+	seen     map[string]bool
+}
+
+func newLister(ctx context.Context, category string, jobs chan<- source.Job) *lister {
+	return &lister{category: category, jobs: jobs, known: source.NewKnownTracker(ctx), seen: make(map[string]bool)}
+}
+
+// send sends the new links of a list page, it returns how many were new and false once the list should stop
+func (l *lister) send(ctx context.Context, urls []string) (int, bool) {
+	found := 0
+	for _, url := range urls {
+		if l.seen[url] {
+			continue
+		}
+		l.seen[url] = true
+		found++
+		if l.known.Known(url) {
+			if l.known.Done() {
+				return found, false
+			}
+			continue
+		}
+		select {
+		case l.jobs <- source.Job{URL: url, Category: l.category}:
+		case <-ctx.Done():
+			return found, false
+		}
+	}
+	return found, true
+}
+
+// paginate loads the numbered pages of a category until a page has no new ads or the page budget is used up
+func (s *Source) paginate(ctx context.Context, ctg string, jobs chan<- source.Job) {
+	crawlerLogger := cfg.FromContext(ctx, "crawler")
+
+	maxPage, err := source.MaxPages(ctx)
+	if err != nil {
+		crawlerLogger.Error("Error reading MAX_PAGE from .env", zap.Error(err))
+	}
+
+	polite := politeness.FromContext(ctx)
+	list := newLister(ctx, ctg, jobs)
+	for page := 0; page < maxPage; page++ {
+		pageURL := s.Site.ListPage(s.City, ctg, s.Site.FirstPage()+page)
+		html, err := s.ListLoader(ctx, pageURL)
+		if err != nil {
+			if ctx.Err() == nil {
+				crawlerLogger.Error("Error loading list page", zap.String("source", s.Name()), zap.String("url", pageURL), zap.Error(err))
+			}
+			return
+		}
+		if err := polite.DetectBlock(ctx, pageURL, html, s.Site.Blocked); err != nil {
+			return
+		}
+		urls, err := s.Site.ExtractLinks(html, pageURL)
+		if err != nil {
+			crawlerLogger.Error("Error extracting URLs", zap.String("source", s.Name()), zap.String("url", pageURL), zap.Error(err))
+			return
+		}
+
+		found, ok := list.send(ctx, urls)
+		if list.known.Done() {
+			crawlerLogger.Info("reached already crawled listings, stopping...", zap.String("source", s.Name()), zap.String("category", ctg), zap.Int("skipped", list.known.Skipped()))
+			return
+		}
+		if !ok {
+			return
+		}
+		if found == 0 {
+			crawlerLogger.Info("No more content to load.", zap.String("source", s.Name()), zap.String("category", ctg))
+			return
+		}
+		source.ReportPage(ctx)
+	}
+	crawlerLogger.Info("max page reached, stopping...", zap.String("source", s.Name()), zap.String("category", ctg))
+}
+
+// scroll keeps a category open in a supervised browser, scrolling or clicking the load more button
+// until the list stops growing, the page budget is used up or BROWSER_MAX_RECOVERIES restarts were used up
+func (s *Source) scroll(ctx context.Context, ctg string, jobs chan<- source.Job) {
+	crawlerLogger := cfg.FromContext(ctx, "crawler")
+
+	maxPage, err := source.MaxPages(ctx)
+	if err != nil {
+		crawlerLogger.Error("Error reading MAX_PAGE from .env", zap.Error(err))
+	}
+
+	listURL := s.Site.ListPage(s.City, ctg, s.Site.FirstPage())
+	polite := politeness.FromContext(ctx)
+
+	supervisor := browser.NewSupervisor(ctx, browser.SupervisorConfigFromEnv())
+	defer supervisor.Close()
+	// steps counts the steps since the list was opened, a restarted browser replays them
+	steps := 0
+	reposition := func() error {
+		if err := supervisor.Do(func(ctx context.Context) error { return browser.Navigate(ctx, listURL) }); err != nil {
+			return err
+		}
+		for i := 0; i < steps; i++ {
+			if err := supervisor.Do(s.Site.loadMore); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// check decides whether the list goes on after a failed step
+	check := func(message string, err error) bool {
+		crawlerLogger.Error(message, zap.String("source", s.Name()), zap.String("category", ctg), zap.Error(err))
+		if err := supervisor.Check(err, reposition); err != nil {
+			if ctx.Err() == nil {
+				crawlerLogger.Error("browser could not be recovered, stopping category", zap.String("source", s.Name()), zap.String("category", ctg), zap.Error(err))
+			}
+			return false
+		}
+		return true
+	}
+
+	if err := supervisor.Start(); err != nil {
+		crawlerLogger.Error("Error starting browser", zap.String("source", s.Name()), zap.Error(err))
+		return
+	}
+	if err := reposition(); err != nil && !check("Failed to navigate to category", err) {
+		return
+	}
+
+	list := newLister(ctx, ctg, jobs)
+	idleSteps := 0
+	idle := func() bool {
+		idleSteps++
+		return idleSteps >= maxIdleSteps
+	}
+	// restarted is set when the browser was restarted because the list stopped finding ads
+	restarted := false
+	for page := 0; ; {
+		if ctx.Err() != nil {
+			crawlerLogger.Info("Crawler received shutdown signal, stopping...", zap.String("source", s.Name()), zap.String("category", ctg))
+			return
+		}
+
+		var html string
+		err := supervisor.Do(func(ctx context.Context) error {
+			return chromedp.Run(ctx, chromedp.OuterHTML("html", &html))
+		})
+		if err != nil {
+			if !check("Error getting HTML content", err) {
+				return
+			}
+			continue
+		}
+
+		found := 0
+		if err := polite.DetectBlock(ctx, listURL, html, s.Site.Blocked); err == nil {
+			urls, err := s.Site.ExtractLinks(html, listURL)
+			if err != nil {
+				crawlerLogger.Error("Error extracting URLs", zap.String("source", s.Name()), zap.String("category", ctg), zap.Error(err))
+			}
+			var ok bool
+			found, ok = list.send(ctx, urls)
+			if list.known.Done() {
+				crawlerLogger.Info("reached already crawled listings, stopping...", zap.String("source", s.Name()), zap.String("category", ctg), zap.Int("skipped", list.known.Skipped()))
+				return
+			}
+			if !ok {
+				return
+			}
+		}
+
+		if found == 0 {
+			if idle() {
+				// A stalled browser stops loading ads too, only a fresh one that finds nothing means the end
+				if restarted {
+					crawlerLogger.Info("No more content to load.", zap.String("source", s.Name()), zap.String("category", ctg))
+					return
+				}
+				restarted = true
+				idleSteps = 0
+				crawlerLogger.Warn("list found no new ads, restarting browser", zap.String("source", s.Name()), zap.String("category", ctg))
+				if err := supervisor.Recover(errors.New("list found no new ads"), reposition); err != nil {
+					crawlerLogger.Error("browser could not be recovered, stopping category", zap.String("source", s.Name()), zap.String("category", ctg), zap.Error(err))
+					return
+				}
+				continue
+			}
+		} else {
+			idleSteps = 0
+			restarted = false
+			page++
+			source.ReportPage(ctx)
+			if page >= maxPage {
+				crawlerLogger.Info("max page reached, stopping...", zap.String("source", s.Name()), zap.String("category", ctg))
+				return
+			}
+		}
+
+		// Loading more ads is another request to the site
+		if err := polite.Wait(ctx, listURL); err != nil {
+			crawlerLogger.Info("Stopping category", zap.String("source", s.Name()), zap.String("category", ctg), zap.Error(err))
+			return
+		}
+		if err := supervisor.Do(s.Site.loadMore); err != nil {
+			if !check("Error loading more ads", err) {
+				return
+			}
+			continue
+		}
+		steps++
+	}
+}
+
+// loadMore clicks the load more button of the list, or scrolls to its end when the site scrolls or shows no button
+func (s *Site) loadMore(ctx context.Context) error {
+	if s.Pagination.Strategy == PaginateLoadMore {
+		for _, selector := range s.Pagination.Button {
+			var buttonExists bool
+			if err := chromedp.Run(ctx, chromedp.Evaluate(fmt.Sprintf(`document.querySelector(%q) !== null`, selector), &buttonExists)); err != nil {
+				return err
+			}
+			if buttonExists {
+				return chromedp.Run(ctx, chromedp.Click(selector, chromedp.ByQuery), chromedp.Sleep(2*time.Second))
+			}
+		}
+	}
+	return chromedp.Run(ctx, chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil), chromedp.Sleep(2*time.Second))
+}
@@ -0,0 +1,216 @@
+package generic
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// errNoValue is returned for a field the page does not have
+var errNoValue = errors.New("no value found")
+
+// ParseAd extracts an ad from the rendered HTML of a listing of the site. The ad starts with the
+// fields of its category, every field rule that finds a value on the page overrides them.
+func (s *Site) ParseAd(job source.Job, html string) (models.Ads, error) {
+	category, ok := s.Categories[job.Category]
+	if !ok {
+		return models.Ads{}, source.Fail(models.FailureUnsupported, fmt.Errorf("site %s has no category %s", s.Name, job.Category))
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return models.Ads{}, err
+	}
+	base, err := url.Parse(job.URL)
+	if err != nil {
+		return models.Ads{}, err
+	}
+
+	ad := models.Ads{
+		Reference:       s.Name,
+		URL:             job.URL,
+		SourceListingID: s.ExtractListingID(job.URL),
+	}
+	value := reflect.ValueOf(&ad).Elem()
+	for name, constant := range category.Fields {
+		// Constants were checked when the definition was loaded
+		_ = setField(value.FieldByName(name), constant)
+	}
+
+	// Fields are extracted in a fixed order so errors are reproducible
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	seenAt := job.SeenTime()
+	for _, name := range names {
+		field := s.Fields[name]
+		if name == "Images" {
+			ad.SetImages(field.extractAll(doc.Selection, base, seenAt))
+			continue
+		}
+
+		text, err := field.extract(doc.Selection, base, seenAt)
+		if err == nil {
+			err = setField(value.FieldByName(name), text)
+		}
+		if err == nil && name == "YearBuilt" && slices.Contains(field.Transforms, "year_from_age") {
+			ad.AgeBasedYear = true
+		}
+		// Every ad needs a title
+		if err != nil && (field.Required || name == "Title") {
+			return models.Ads{}, fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return ad, nil
+}
+
+// extract returns the value of a field rule on a page loaded at seenAt, transformed for the ad
+func (f Field) extract(root *goquery.Selection, base *url.URL, seenAt time.Time) (string, error) {
+	selection := f.find(root)
+	if f.Exists {
+		return strconv.FormatBool(selection.Length() > 0), nil
+	}
+	if selection.Length() == 0 {
+		return "", errNoValue
+	}
+	return f.transform(f.text(selection.First(), base), seenAt)
+}
+
+// extractAll returns the values of every element matched by a field rule, for galleries
+func (f Field) extractAll(root *goquery.Selection, base *url.URL, seenAt time.Time) []string {
+	var values []string
+	f.find(root).Each(func(i int, element *goquery.Selection) {
+		if value, err := f.transform(f.text(element, base), seenAt); err == nil && value != "" {
+			values = append(values, value)
+		}
+	})
+	return values
+}
+
+// find returns the elements matched by the first selector that matches, narrowed to the labelled one
+func (f Field) find(root *goquery.Selection) *goquery.Selection {
+	for _, selector := range f.Selectors {
+		selection := root.Find(selector)
+		if f.Label != "" {
+			selection = selection.FilterFunction(func(i int, element *goquery.Selection) bool {
+				return strings.Contains(element.Text(), f.Label)
+			}).First()
+		}
+		if selection.Length() > 0 {
+			return selection
+		}
+	}
+	return root.Find("__no_match__")
+}
+
+// text returns the raw value of an element, links are made absolute
+func (f Field) text(element *goquery.Selection, base *url.URL) string {
+	if f.Value != "" {
+		element = element.Find(f.Value).First()
+	}
+	if f.Attr != "" {
+		attr, _ := element.Attr(f.Attr)
+		if ref, err := url.Parse(strings.TrimSpace(attr)); err == nil && attr != "" && (f.Attr == "href" || f.Attr == "src") {
+			return base.ResolveReference(ref).String()
+		}
+		return strings.TrimSpace(attr)
+	}
+	text := strings.TrimSpace(element.Text())
+	if f.Label != "" && f.Value == "" {
+		text = strings.TrimSpace(strings.Replace(text, f.Label, "", 1))
+		text = strings.TrimSpace(strings.TrimLeft(text, ":："))
+	}
+	return text
+}
+
+// transform runs the pattern and the transformers of a field rule over a raw value
+func (f Field) transform(value string, seenAt time.Time) (string, error) {
+	if f.pattern != nil {
+		match := f.pattern.FindStringSubmatch(value)
+		switch {
+		case match == nil:
+			return "", errNoValue
+		case len(match) > 1:
+			value = match[1]
+		default:
+			value = match[0]
+		}
+	}
+	for _, name := range f.Transforms {
+		var err error
+		if value, err = transforms[name](value, seenAt); err != nil {
+			return "", err
+		}
+	}
+	if value == "" {
+		return "", errNoValue
+	}
+	return value, nil
+}
+
+// setField stores a value in a field of the ad, converted to the type of the field
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("can't store %q in a %s field", value, field.Kind())
+	}
+	return nil
+}
+
+// ExtractLinks returns the absolute URLs of the listing cards on a list page, in page order
+func (s *Site) ExtractLinks(html string, pageURL string) ([]string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, selector := range s.CardLinks {
+		doc.Find(selector).Each(func(i int, link *goquery.Selection) {
+			href, _ := link.Attr("href")
+			if ref, err := url.Parse(strings.TrimSpace(href)); err == nil && href != "" {
+				urls = append(urls, base.ResolveReference(ref).String())
+			}
+		})
+		if len(urls) > 0 {
+			break
+		}
+	}
+	return urls, nil
+}
@@ -0,0 +1,318 @@
+package generic
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/fetch"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pagination strategies of a list page
+const (
+	PaginateScroll    = "scroll"     // Scrolling to the end of the page loads more cards
+	PaginateLoadMore  = "load_more"  // A button loads more cards
+	PaginatePageParam = "page_param" // Every page of the list has its own URL
+)
+
+// namePattern matches the reference of a site, it is stored on every ad
+var namePattern = regexp.MustCompile(`^[a-z0-9]{1,10}$`)
+
+// Site is the declarative definition of a marketplace crawled by the generic adapter
+type Site struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// ListURL is the URL of a list page, {city}, {category} and {page} are replaced
+	ListURL    string              `json:"list_url"`
+	City       string              `json:"city"` // City crawled without a target
+	Categories map[string]Category `json:"categories"`
+	Pagination Pagination          `json:"pagination"`
+	// CardLinks select the links of the listing cards on a list page, tried in order
+	CardLinks []string `json:"card_links"`
+	// ListingID is a pattern whose first group is the ID of a listing in its URL, the last path segment by default
+	ListingID string `json:"listing_id"`
+	// Ready is a selector that is visible once a listing page is rendered
+	Ready   string   `json:"ready"`
+	Blocked []string `json:"blocked"` // Texts of the pages shown to blocked crawlers
+	// Fetch is how listing pages are loaded: chrome, the default, http or auto
+	Fetch  string           `json:"fetch"`
+	Fields map[string]Field `json:"fields"`
+
+	listingID *regexp.Regexp
+}
+
+// Category is a category of the site, its fields are the values every ad of the category starts with
+type Category struct {
+	Fields map[string]string `json:"fields"`
+}
+
+// Pagination tells how the next cards of a list are loaded
+type Pagination struct {
+	Strategy string   `json:"strategy"`
+	Button   []string `json:"button"` // Selectors of the load more button
+	Start    int      `json:"start"`  // Number of the first page for page_param, 1 by default
+}
+
+// Field is how a field of the ad is extracted from a listing page. The text, or the attribute,
+// of the first element matched by Selectors is run through Pattern and Transforms in that order.
+type Field struct {
+	Selectors []string `json:"selectors"`
+	// Label picks the first matched element whose text contains it, the value is the text of
+	// Value inside that element, or the text of the element without the label
+	Label      string   `json:"label"`
+	Value      string   `json:"value"`
+	Attr       string   `json:"attr"`
+	All        bool     `json:"all"`     // Every matched element is a value, for Images
+	Exists     bool     `json:"exists"`  // The field is true when a selector matches
+	Pattern    string   `json:"pattern"` // Its first group, or whole match, is kept
+	Transforms []string `json:"transforms"`
+	Required   bool     `json:"required"` // A page without the field fails to parse
+	// Browser marks a field only a rendered page fills, in auto mode a listing
+	// fetched over HTTP without it is loaded again with Chrome
+	Browser bool `json:"browser"`
+
+	pattern *regexp.Regexp
+}
+
+// Load reads a site definition from a JSON file
+func Load(file string) (*Site, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	site, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return site, nil
+}
+
+// Parse reads a site definition and checks it
+func Parse(data []byte) (*Site, error) {
+	var site Site
+	if err := json.Unmarshal(data, &site); err != nil {
+		return nil, err
+	}
+	if err := site.Validate(); err != nil {
+		return nil, err
+	}
+	return &site, nil
+}
+
+// Validate checks the definition and compiles its patterns
+func (s *Site) Validate() error {
+	if !namePattern.MatchString(s.Name) {
+		return fmt.Errorf("site name %q must be up to 10 lower case letters and digits", s.Name)
+	}
+	if !strings.Contains(s.ListURL, "{category}") {
+		return fmt.Errorf("site %s: list_url must contain {category}", s.Name)
+	}
+	if strings.Contains(s.ListURL, "{city}") && s.City == "" {
+		return fmt.Errorf("site %s: list_url has {city} but no default city is set", s.Name)
+	}
+	if len(s.Categories) == 0 {
+		return fmt.Errorf("site %s has no categories", s.Name)
+	}
+	switch s.Pagination.Strategy {
+	case PaginateScroll:
+	case PaginateLoadMore:
+		if len(s.Pagination.Button) == 0 {
+			return fmt.Errorf("site %s: load_more pagination needs a button selector", s.Name)
+		}
+	case PaginatePageParam:
+		if !strings.Contains(s.ListURL, "{page}") {
+			return fmt.Errorf("site %s: page_param pagination needs {page} in list_url", s.Name)
+		}
+	default:
+		return fmt.Errorf("site %s: unknown pagination strategy %q", s.Name, s.Pagination.Strategy)
+	}
+	if _, err := fetch.ParseMode(s.Fetch); err != nil {
+		return fmt.Errorf("site %s: %w", s.Name, err)
+	}
+	if len(s.CardLinks) == 0 {
+		return fmt.Errorf("site %s has no card_links selector", s.Name)
+	}
+	if _, ok := s.Fields["Title"]; !ok {
+		return fmt.Errorf("site %s has no rule for Title", s.Name)
+	}
+
+	if s.ListingID != "" {
+		pattern, err := regexp.Compile(s.ListingID)
+		if err != nil {
+			return fmt.Errorf("site %s: listing_id: %w", s.Name, err)
+		}
+		s.listingID = pattern
+	}
+	for slug, category := range s.Categories {
+		for name, value := range category.Fields {
+			if err := checkConstant(name, value); err != nil {
+				return fmt.Errorf("site %s: category %s: %w", s.Name, slug, err)
+			}
+		}
+	}
+	for name, field := range s.Fields {
+		if err := field.compile(name); err != nil {
+			return fmt.Errorf("site %s: field %s: %w", s.Name, name, err)
+		}
+		s.Fields[name] = field
+	}
+	return nil
+}
+
+// FetchConfig returns how the listing pages of the site are loaded
+func (s *Site) FetchConfig() fetch.Config {
+	mode, _ := fetch.ParseMode(s.Fetch)
+	config := fetch.Config{Mode: mode}
+	for name, field := range s.Fields {
+		if field.Browser {
+			config.BrowserFields = append(config.BrowserFields, name)
+		}
+	}
+	sort.Strings(config.BrowserFields)
+	return config
+}
+
+// compile checks a field rule against the ad field it fills
+func (f *Field) compile(name string) error {
+	kind, err := fieldKind(name)
+	if err != nil {
+		return err
+	}
+	if len(f.Selectors) == 0 {
+		return errors.New("no selectors")
+	}
+	if f.All != (name == "Images") {
+		return errors.New("all is only used for Images and Images needs it")
+	}
+	if f.Exists && kind != reflect.Bool {
+		return errors.New("exists is only used for true/false fields")
+	}
+	if f.Browser && kind == reflect.Bool {
+		return errors.New("browser is not used for true/false fields, false is a value")
+	}
+	for _, transform := range f.Transforms {
+		if _, ok := transforms[transform]; !ok {
+			return fmt.Errorf("unknown transform %q", transform)
+		}
+	}
+	if f.Pattern != "" {
+		pattern, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return err
+		}
+		f.pattern = pattern
+	}
+	return nil
+}
+
+// fieldKind returns the kind of an ad field a site may fill
+func fieldKind(name string) (reflect.Kind, error) {
+	field, ok := reflect.TypeOf(models.Ads{}).FieldByName(name)
+	if !ok || reservedFields[name] {
+		return reflect.Invalid, fmt.Errorf("ads have no field %s a site can fill", name)
+	}
+	switch kind := field.Type.Kind(); kind {
+	case reflect.String, reflect.Int, reflect.Float64, reflect.Bool, reflect.Slice:
+		return kind, nil
+	}
+	return reflect.Invalid, fmt.Errorf("field %s can't be filled from a page", name)
+}
+
+// checkConstant checks a value every ad of a category starts with
+func checkConstant(name string, value string) error {
+	kind, err := fieldKind(name)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case reflect.Int:
+		_, err = strconv.Atoi(value)
+	case reflect.Float64:
+		_, err = strconv.ParseFloat(value, 64)
+	case reflect.Bool:
+		_, err = strconv.ParseBool(value)
+	case reflect.Slice:
+		err = errors.New("images can't be a constant")
+	}
+	return err
+}
+
+// reservedFields are set by the adapter or the database, not by the definition
+var reservedFields = map[string]bool{
+	"ID":              true,
+	"Hash":            true,
+	"SourceListingID": true,
+	"ClusterID":       true,
+	"CreatedAt":       true,
+	"LastSeenAt":      true,
+	"Status":          true,
+	"StatusChangedAt": true,
+	"LastCheckedAt":   true,
+	"Reference":       true,
+	"URL":             true,
+	"AgeBasedYear":    true,
+}
+
+// ListPage returns the URL of a page of the list of a category in a city
+func (s *Site) ListPage(city string, category string, page int) string {
+	return strings.NewReplacer(
+		"{city}", url.PathEscape(city),
+		"{category}", url.PathEscape(category),
+		"{page}", strconv.Itoa(page),
+	).Replace(s.ListURL)
+}
+
+// FirstPage returns the number of the first page of a list
+func (s *Site) FirstPage() int {
+	if s.Pagination.Start > 0 {
+		return s.Pagination.Start
+	}
+	return 1
+}
+
+// SupportsCategory reports whether the site defines a category
+func (s *Site) SupportsCategory(category string) bool {
+	_, ok := s.Categories[category]
+	return ok
+}
+
+// CategorySlugs returns the categories of the site in alphabetical order
+func (s *Site) CategorySlugs() []string {
+	slugs := make([]string, 0, len(s.Categories))
+	for slug := range s.Categories {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	return slugs
+}
+
+// ExtractListingID returns the ID of a listing in its URL
+func (s *Site) ExtractListingID(adURL string) string {
+	if s.listingID != nil {
+		match := s.listingID.FindStringSubmatch(adURL)
+		switch {
+		case len(match) > 1:
+			return match[1]
+		case len(match) == 1:
+			return match[0]
+		}
+		return ""
+	}
+	parsedURL, err := url.Parse(adURL)
+	if err != nil {
+		return ""
+	}
+	id := path.Base(strings.TrimRight(parsedURL.Path, "/"))
+	if id == "." || id == "/" {
+		return ""
+	}
+	return id
+}
@@ -0,0 +1,170 @@
+package generic
+
+import (
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+)
+
+// Source crawls a marketplace described by a site definition
+type Source struct {
+	Site       *Site
+	City       string
+	Categories []string
+	Loader     source.PageLoader // Renders listing pages in Chrome
+	HTTPLoader source.PageLoader // Fetches listing pages without a browser
+	ListLoader source.PageLoader // Loads the list pages of page_param sites
+	Fetch      fetch.Config
+}
+
+// NewSource returns a source crawling every category of the site in its default city
+func NewSource(site *Site) *Source {
+	return NewTargetSource(site, site.City, "")
+}
+
+// NewTargetSource returns a source crawling one category of a city, or all categories when category is empty
+func NewTargetSource(site *Site, city string, category string) *Source {
+	src := &Source{
+		Site:       site,
+		City:       city,
+		Categories: site.CategorySlugs(),
+		ListLoader: LoadListWithChrome,
+		Fetch:      fetch.ConfigFromEnv(site.Name, site.FetchConfig()),
+	}
+	src.Loader = src.LoadPageWithChrome
+	src.HTTPLoader = src.LoadPageWithHTTP
+	if src.Fetch.Mode == fetch.ModeHTTP {
+		// The list pages of a site served without a browser are too
+		src.ListLoader = LoadListWithHTTP
+	}
+	if category != "" {
+		src.Categories = []string{category}
+	}
+	return src
+}
+
+func (s *Source) Name() string {
+	return s.Site.Name
+}
+
+// Discover walks the list of every category and sends found ads to jobs.
+// It returns when every category is done, MAX_CRAWL_TIME passed or ctx is canceled.
+func (s *Source) Discover(ctx context.Context, jobs chan<- source.Job) {
+	crawlerLogger := cfg.FromContext(ctx, "crawler")
+
+	maxCrawlTime, err := strconv.Atoi(os.Getenv("MAX_CRAWL_TIME"))
+	if err != nil {
+		crawlerLogger.Error("Error reading MAX_CRAWL_TIME from .env:", zap.Error(err))
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(maxCrawlTime)*time.Minute)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, ctg := range s.Categories {
+		wg.Add(1)
+		go func(ctg string) {
+			defer wg.Done()
+			if s.Site.Pagination.Strategy == PaginatePageParam {
+				s.paginate(ctx, ctg, jobs)
+			} else {
+				s.scroll(ctx, ctg, jobs)
+			}
+		}(ctg)
+	}
+	wg.Wait()
+}
+
+// Scrap loads a listing with Chrome or over HTTP, as set by the fetch mode of the site
+func (s *Source) Scrap(ctx context.Context, job source.Job) (models.Ads, error) {
+	strategy := fetch.Strategy{Config: s.Fetch, HTTP: s.HTTPLoader, Chrome: s.Loader, Parse: s.Parse}
+	return strategy.Scrap(ctx, job)
+}
+
+// Parse extracts an ad from the archived HTML of a listing
+func (s *Source) Parse(job source.Job, html string) (models.Ads, error) {
+	result, err := s.Site.ParseAd(job, html)
+	return result, source.Fail(models.FailureParse, err)
+}
+
+// ListingID returns the ID of a listing in its URL
+func (s *Source) ListingID(url string) string {
+	return s.Site.ExtractListingID(url)
+}
+
+// LoadPageWithChrome opens a listing in a leased Chrome tab and returns the rendered HTML
+func (s *Source) LoadPageWithChrome(ctx context.Context, pageURL string) (html string, err error) {
+	// Lease a Chrome tab, a failed page recycles it
+	tab, err := browser.Lease(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer func() { tab.Release(err) }()
+	ctx, cancel := tab.Context(ctx)
+	defer cancel()
+
+	// Set timeout for the scraping task
+	maxScrapTime, err := strconv.Atoi(os.Getenv("MAX_SCRAP_TIME"))
+	if err != nil {
+		log.Printf("Error reading MAX_SCRAP_TIME from .env: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(ctx, time.Duration(maxScrapTime)*time.Second)
+	defer cancel()
+
+	if err = browser.Navigate(ctx, pageURL); err != nil {
+		return "", fmt.Errorf("failed to load URL %s: %w", pageURL, err)
+	}
+	ready := chromedp.WaitReady("body", chromedp.ByQuery)
+	if s.Site.Ready != "" {
+		ready = chromedp.WaitVisible(s.Site.Ready, chromedp.ByQuery)
+	}
+	if err = chromedp.Run(ctx, ready, chromedp.OuterHTML("html", &html)); err != nil {
+		return "", fmt.Errorf("failed to load URL %s: %w", pageURL, err)
+	}
+	if recorder := source.RecorderFromContext(ctx); recorder.WantsScreenshot() {
+		var screenshot []byte
+		if err := chromedp.Run(ctx, chromedp.FullScreenshot(&screenshot, 80)); err != nil {
+			log.Printf("failed to capture screenshot of %s: %v", pageURL, err)
+		} else {
+			recorder.RecordScreenshot(screenshot)
+		}
+	}
+	if err = politeness.FromContext(ctx).DetectBlock(ctx, pageURL, html, s.Site.Blocked); err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// LoadPageWithHTTP fetches the server rendered HTML of a listing without a browser
+func (s *Source) LoadPageWithHTTP(ctx context.Context, pageURL string) (string, error) {
+	html, err := fetch.Get(ctx, pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if err = politeness.FromContext(ctx).DetectBlock(ctx, pageURL, html, s.Site.Blocked); err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// LoadListWithChrome opens a list page in a leased Chrome tab and returns the HTML once its cards rendered
+func LoadListWithChrome(ctx context.Context, pageURL string) (string, error) {
+	return browser.LoadPage(ctx, pageURL, 2*time.Second)
+}
+
+// LoadListWithHTTP fetches a list page without a browser
+func LoadListWithHTTP(ctx context.Context, pageURL string) (string, error) {
+	return fetch.Get(ctx, pageURL, nil)
+}
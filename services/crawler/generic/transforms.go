@@ -0,0 +1,86 @@
+package generic
+
+import (
+	"Crawlzilla/utils"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Transform turns the text extracted for a field into the value stored in the ad,
+// seenAt is when the page was loaded for values relative to it
+type Transform func(value string, seenAt time.Time) (string, error)
+
+// transforms are the transformers a field rule can name
+var transforms = map[string]Transform{
+	"persian_digits": persianDigits,
+	"strip_toman":    stripToman,
+	"number":         number,
+	"decimal":        decimal,
+	"yes_no":         yesNo,
+	"year_from_age":  yearFromAge,
+	"lower":          func(value string, seenAt time.Time) (string, error) { return strings.ToLower(value), nil },
+}
+
+// digits maps Persian and Arabic digits to ASCII ones
+var digits = strings.NewReplacer(
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4", "۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4", "٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+)
+
+// persianDigits writes the Persian and Arabic digits of a value as ASCII digits
+func persianDigits(value string, seenAt time.Time) (string, error) {
+	return digits.Replace(value), nil
+}
+
+// stripToman removes the currency from a price like "۱۲٬۰۰۰٬۰۰۰ تومان"
+func stripToman(value string, seenAt time.Time) (string, error) {
+	return strings.TrimSpace(strings.NewReplacer("تومان", "", "toman", "", "Toman", "").Replace(value)), nil
+}
+
+// number keeps the digits of a value like "۱۲٬۰۰۰٬۰۰۰" or "۸۵ متر", dropping separators and words
+func number(value string, seenAt time.Time) (string, error) {
+	n, err := utils.ExtractNumber(value)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(n), nil
+}
+
+// decimal reads a number with a fraction like "۳۵٫۷۰۱۲", for coordinates
+func decimal(value string, seenAt time.Time) (string, error) {
+	value = strings.NewReplacer("٫", ".", "٬", "", ",", "").Replace(digits.Replace(value))
+	var builder strings.Builder
+	for _, r := range value {
+		if (r >= '0' && r <= '9') || r == '.' || (r == '-' && builder.Len() == 0) {
+			builder.WriteRune(r)
+		}
+	}
+	if builder.Len() == 0 {
+		return "", fmt.Errorf("no number found in %s", value)
+	}
+	return builder.String(), nil
+}
+
+// yesNo reads the Persian yes and no words of the attribute tables
+func yesNo(value string, seenAt time.Time) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "دارد", "بله", "هست", "yes", "true":
+		return "true", nil
+	case "ندارد", "خیر", "نیست", "no", "false":
+		return "false", nil
+	}
+	return "", fmt.Errorf("%q is neither yes nor no", value)
+}
+
+// yearFromAge converts a building age like "۵ سال" or "نوساز" to the Solar Hijri year it was built in
+func yearFromAge(value string, seenAt time.Time) (string, error) {
+	if strings.Contains(value, "نوساز") {
+		return fmt.Sprint(utils.YearBuiltFromAge(0, seenAt)), nil
+	}
+	age, err := utils.ExtractNumber(value)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(utils.YearBuiltFromAge(age, seenAt)), nil
+}
@@ -0,0 +1,315 @@
+package politeness
+
+import (
+	"Crawlzilla/config"
+	cfg "Crawlzilla/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrThrottled is returned for responses telling us to slow down
+	ErrThrottled = errors.New("host is throttling requests")
+	// ErrBlocked is returned when a host served a block page instead of the content
+	ErrBlocked = errors.New("host served a block page")
+	// ErrDisallowed is returned for URLs excluded by robots.txt
+	ErrDisallowed = errors.New("url is disallowed by robots.txt")
+)
+
+// Config sets how hard the crawlers may hit a single host
+type Config struct {
+	Rate       float64       // Requests per second per host, 0 disables the limit
+	Burst      int           // Requests a rested host may receive at once
+	MinBackoff time.Duration // Pause after the first throttled response
+	MaxBackoff time.Duration // Longest pause, the backoff doubles until it gets there
+	Robots     bool          // Honour robots.txt
+	UserAgent  string        // Agent name matched against robots.txt groups
+	Limiter    Limiter       // Shares the token buckets with other processes, nil keeps them in this one
+}
+
+// Limiter keeps the token buckets of the hosts outside the process, so crawlers
+// running in several processes share one rate limit per host
+type Limiter interface {
+	// Reserve takes a token of host, or returns how long to wait before trying again
+	Reserve(ctx context.Context, host string, rate float64, burst int) (time.Duration, error)
+}
+
+// ConfigFromEnv reads the politeness settings from CRAWL_RATE, CRAWL_BURST,
+// CRAWL_BACKOFF_MIN, CRAWL_BACKOFF_MAX and RESPECT_ROBOTS
+func ConfigFromEnv() Config {
+	settings := Config{
+		Rate:       1,
+		Burst:      3,
+		MinBackoff: 5 * time.Second,
+		MaxBackoff: 5 * time.Minute,
+		Robots:     config.GetBoolean("RESPECT_ROBOTS"),
+		UserAgent:  "Crawlzilla",
+	}
+	if rate, err := strconv.ParseFloat(os.Getenv("CRAWL_RATE"), 64); err == nil && rate >= 0 {
+		settings.Rate = rate
+	}
+	if burst, err := strconv.Atoi(os.Getenv("CRAWL_BURST")); err == nil && burst > 0 {
+		settings.Burst = burst
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("CRAWL_BACKOFF_MIN")); err == nil && seconds > 0 {
+		settings.MinBackoff = time.Duration(seconds) * time.Second
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("CRAWL_BACKOFF_MAX")); err == nil && seconds > 0 {
+		settings.MaxBackoff = time.Duration(seconds) * time.Second
+	}
+	return settings
+}
+
+// Politeness paces the requests of all crawlers per host. Every host gets a token
+// bucket, hosts that throttle us are backed off exponentially and robots.txt is
+// honoured when enabled.
+type Politeness struct {
+	config Config
+	client *http.Client
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	tokens   float64
+	refilled time.Time
+	// delay is the Crawl-delay of robots.txt
+	delay time.Duration
+
+	backoff      time.Duration
+	blockedUntil time.Time
+	blocks       int
+
+	robotsOnce sync.Once
+	robots     *robotsRules
+}
+
+// HostState is a snapshot of the throttle state of a host
+type HostState struct {
+	Tokens       float64
+	Backoff      time.Duration
+	BlockedUntil time.Time
+	Blocks       int
+}
+
+// New creates a politeness layer with its own host states
+func New(config Config) *Politeness {
+	if config.Burst < 1 {
+		config.Burst = 1
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+	return &Politeness{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		hosts:  make(map[string]*hostState),
+	}
+}
+
+var (
+	shared     *Politeness
+	sharedOnce sync.Once
+)
+
+// Default returns the process wide politeness layer, so crawls running side by side share their limits
+func Default() *Politeness {
+	sharedOnce.Do(func() {
+		shared = New(ConfigFromEnv())
+	})
+	return shared
+}
+
+// FromContext returns the politeness layer stored in ctx under "politeness", or the default one
+func FromContext(ctx context.Context) *Politeness {
+	if polite, ok := ctx.Value("politeness").(*Politeness); ok && polite != nil {
+		return polite
+	}
+	return Default()
+}
+
+// Wait blocks until a request to the host of rawURL is allowed.
+// It returns ErrDisallowed for URLs excluded by robots.txt, or the error of ctx.
+func (p *Politeness) Wait(ctx context.Context, rawURL string) error {
+	host, err := hostOf(rawURL)
+	if err != nil {
+		return err
+	}
+	if p.config.Robots && !p.allowed(ctx, host, rawURL) {
+		cfg.FromContext(ctx, "crawler").Info("url disallowed by robots.txt", zap.String("url", rawURL))
+		return fmt.Errorf("%w: %s", ErrDisallowed, rawURL)
+	}
+
+	for {
+		wait, backingOff := p.reserve(ctx, host)
+		if wait <= 0 {
+			return nil
+		}
+		if backingOff {
+			cfg.FromContext(ctx, "crawler").Info("waiting for host backoff", zap.String("host", host), zap.Duration("wait", wait), zap.Int("blocks", p.State(host).Blocks))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token of host, or returns how long to wait before trying again.
+// backingOff is true if the wait comes from a backoff instead of the rate limit.
+func (p *Politeness) reserve(ctx context.Context, host string) (wait time.Duration, backingOff bool) {
+	p.mu.Lock()
+	state := p.host(host)
+	now := time.Now()
+	if now.Before(state.blockedUntil) {
+		p.mu.Unlock()
+		return state.blockedUntil.Sub(now), true
+	}
+
+	rate, burst := p.config.Rate, float64(p.config.Burst)
+	if state.delay > 0 {
+		// Crawl-delay allows a single request per delay
+		rate, burst = 1/state.delay.Seconds(), 1
+		if p.config.Rate > 0 {
+			rate = min(rate, p.config.Rate)
+		}
+	}
+	if rate <= 0 {
+		p.mu.Unlock()
+		return 0, false
+	}
+
+	if p.config.Limiter != nil {
+		p.mu.Unlock()
+		wait, err := p.config.Limiter.Reserve(ctx, host, rate, int(burst))
+		if err == nil {
+			return wait, false
+		}
+		cfg.FromContext(ctx, "crawler").Warn("shared rate limit unavailable, limiting this process only", zap.String("host", host), zap.Error(err))
+		p.mu.Lock()
+	}
+	defer p.mu.Unlock()
+
+	state.tokens = min(burst, state.tokens+now.Sub(state.refilled).Seconds()*rate)
+	state.refilled = now
+	if state.tokens >= 1 {
+		state.tokens--
+		return 0, false
+	}
+	return time.Duration((1 - state.tokens) / rate * float64(time.Second)), false
+}
+
+// Report records the HTTP status of a response from the host of rawURL.
+// Rate limit and server errors back the host off and return ErrThrottled.
+func (p *Politeness) Report(ctx context.Context, rawURL string, status int) error {
+	host, err := hostOf(rawURL)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+		p.throttle(ctx, host, fmt.Sprintf("status %d", status))
+		return fmt.Errorf("%w: %s returned status %d", ErrThrottled, rawURL, status)
+	}
+	p.recover(ctx, host)
+	return nil
+}
+
+// Block backs off the host of rawURL after it refused to serve a page
+func (p *Politeness) Block(ctx context.Context, rawURL string, reason string) {
+	host, err := hostOf(rawURL)
+	if err != nil {
+		return
+	}
+	p.throttle(ctx, host, reason)
+}
+
+// DetectBlock checks a loaded page for the markers of a block page. A blocked page
+// backs off its host and returns ErrBlocked.
+func (p *Politeness) DetectBlock(ctx context.Context, rawURL string, html string, markers []string) error {
+	for _, marker := range markers {
+		if marker != "" && strings.Contains(html, marker) {
+			p.Block(ctx, rawURL, "block page: "+marker)
+			return fmt.Errorf("%w: %s", ErrBlocked, rawURL)
+		}
+	}
+	return nil
+}
+
+// State returns the current throttle state of a host
+func (p *Politeness) State(host string) HostState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.host(host)
+	return HostState{
+		Tokens:       state.tokens,
+		Backoff:      state.backoff,
+		BlockedUntil: state.blockedUntil,
+		Blocks:       state.blocks,
+	}
+}
+
+func (p *Politeness) throttle(ctx context.Context, host string, reason string) {
+	p.mu.Lock()
+	state := p.host(host)
+	if state.backoff == 0 {
+		state.backoff = p.config.MinBackoff
+	} else {
+		state.backoff = min(state.backoff*2, p.config.MaxBackoff)
+	}
+	state.blocks++
+	state.blockedUntil = time.Now().Add(state.backoff)
+	backoff, blocks := state.backoff, state.blocks
+	p.mu.Unlock()
+
+	cfg.FromContext(ctx, "crawler").Warn("host throttled, backing off", zap.String("host", host), zap.String("reason", reason), zap.Duration("backoff", backoff), zap.Int("blocks", blocks))
+}
+
+func (p *Politeness) recover(ctx context.Context, host string) {
+	p.mu.Lock()
+	state := p.host(host)
+	blocks := state.blocks
+	state.backoff = 0
+	state.blocks = 0
+	p.mu.Unlock()
+
+	if blocks > 0 {
+		cfg.FromContext(ctx, "crawler").Info("host recovered from backoff", zap.String("host", host), zap.Int("blocks", blocks))
+	}
+}
+
+// host returns the state of a host, the caller must hold p.mu
+func (p *Politeness) host(host string) *hostState {
+	state, ok := p.hosts[host]
+	if !ok {
+		state = &hostState{tokens: float64(p.config.Burst), refilled: time.Now()}
+		p.hosts[host] = state
+	}
+	return state
+}
+
+func hostOf(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("url %s has no host", rawURL)
+	}
+	return strings.ToLower(u.Host), nil
+}
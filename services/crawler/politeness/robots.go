@@ -0,0 +1,188 @@
+package politeness
+
+import (
+	cfg "Crawlzilla/logger"
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// robotsRules are the robots.txt rules of the group matching our user agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	pattern *regexp.Regexp
+	length  int
+	allow   bool
+}
+
+// allows applies the longest matching rule, an allow rule wins a tie
+func (r *robotsRules) allows(path string) bool {
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > longest || (rule.length == longest && rule.allow) {
+			allowed, longest = rule.allow, rule.length
+		}
+	}
+	return allowed
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// parseRobots reads a robots.txt and keeps the group for userAgent, falling back to the * group
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share one group
+			if current == nil || inRules {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				inRules = false
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			// An empty disallow allows everything
+			if value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{pattern: robotsPattern(value), length: len(value), allow: key == "allow"})
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	agent := strings.ToLower(userAgent)
+	var wildcard *robotsGroup
+	for _, group := range groups {
+		for _, name := range group.agents {
+			if name == "*" {
+				if wildcard == nil {
+					wildcard = group
+				}
+			} else if name != "" && strings.Contains(agent, name) {
+				return &robotsRules{rules: group.rules, crawlDelay: group.crawlDelay}
+			}
+		}
+	}
+	if wildcard != nil {
+		return &robotsRules{rules: wildcard.rules, crawlDelay: wildcard.crawlDelay}
+	}
+	return &robotsRules{}
+}
+
+// robotsPattern turns a robots.txt path with * and $ wildcards into a prefix regexp
+func robotsPattern(path string) *regexp.Regexp {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+
+	pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(path), `\*`, ".*")
+	if anchored {
+		pattern += "$"
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// allowed reports whether robots.txt of host lets us fetch rawURL. robots.txt is
+// fetched once per host, a missing or unreadable file allows everything.
+func (p *Politeness) allowed(ctx context.Context, host string, rawURL string) bool {
+	p.mu.Lock()
+	state := p.host(host)
+	p.mu.Unlock()
+
+	state.robotsOnce.Do(func() {
+		state.robots = p.fetchRobots(ctx, rawURL)
+		if state.robots.crawlDelay > 0 {
+			p.mu.Lock()
+			state.delay = state.robots.crawlDelay
+			p.mu.Unlock()
+			cfg.FromContext(ctx, "crawler").Info("using robots.txt crawl delay", zap.String("host", host), zap.Duration("delay", state.robots.crawlDelay))
+		}
+	})
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return state.robots.allows(path)
+}
+
+func (p *Politeness) fetchRobots(ctx context.Context, rawURL string) *robotsRules {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return &robotsRules{}
+	}
+	robotsURL := u.Scheme + "://" + u.Host + "/robots.txt"
+
+	// The result is cached for the host, so a canceled crawl must not turn it into an allow-all
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return &robotsRules{}
+	}
+	req.Header.Set("User-Agent", p.config.UserAgent)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		cfg.FromContext(ctx, "crawler").Warn("cant fetch robots.txt, allowing all", zap.String("url", robotsURL), zap.Error(err))
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{}
+	}
+	return parseRobots(io.LimitReader(resp.Body, 512*1024), p.config.UserAgent)
+}
@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// reserveScript takes a token of a host bucket kept in Redis and returns the milliseconds
+// to wait when none is left. The clock of Redis is used so the processes agree on the time.
+var reserveScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local clock = redis.call("TIME")
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "refilled")
+local tokens = tonumber(bucket[1]) or burst
+local refilled = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - refilled) / 1000 * rate)
+
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "refilled", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 60000)
+return wait
+`)
+
+// RedisLimiter is a politeness.Limiter keeping the token buckets of the hosts in Redis,
+// so the worker processes of a distributed crawl share the rate limit of every host
+type RedisLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisLimiter creates a limiter on client
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+// limiterKey holds the token bucket of a host
+func limiterKey(host string) string {
+	return "crawl:host:" + host + ":bucket"
+}
+
+func (l *RedisLimiter) Reserve(ctx context.Context, host string, rate float64, burst int) (time.Duration, error) {
+	wait, err := reserveScript.Run(ctx, l.client, []string{limiterKey(host)}, rate, burst).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
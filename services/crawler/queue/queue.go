@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"Crawlzilla/services/fill_rates"
+	"context"
+)
+
+// Task is a listing handed to the workers of the shared queue
+type Task struct {
+	RunID     string // Crawl run the task belongs to, workers report their results to it
+	Reference string // Source the listing belongs to
+	URL       string
+	Category  string
+}
+
+// Job returns the scraping job of the task
+func (t Task) Job() source.Job {
+	return source.Job{URL: t.URL, Category: t.Category}
+}
+
+// Delivery is a task pulled by a worker, it is handed to another worker
+// if it is not acked within the visibility timeout of the queue
+type Delivery struct {
+	ID       string
+	Worker   string // Worker that pulled the task
+	Task     Task
+	Attempts int64 // Times the task was pulled, more than one means a worker died holding it
+}
+
+// Result is the outcome of a task, reported by the worker that scraped it
+type Result struct {
+	RunID   string
+	Worker  string
+	Saved   repositories.AdSaveResult // Empty when the task failed
+	Failure models.FailureKind        // Why the task failed, empty when the ad was saved
+	URL     string
+	Empty   []string // Fields the scraper left empty in the saved ad
+}
+
+// WorkerStats counts the results a worker reported for a run
+type WorkerStats struct {
+	Success   int
+	Failed    int
+	Inserted  int
+	Updated   int
+	Duplicate int
+	Failures  map[models.FailureKind]int
+	Fill      fill_rates.Tally // Fields left empty in the saved ads
+}
+
+// Add counts result in stats
+func (stats *WorkerStats) Add(result Result) {
+	if result.Failure != "" {
+		stats.Failed++
+		if stats.Failures == nil {
+			stats.Failures = make(map[models.FailureKind]int)
+		}
+		stats.Failures[result.Failure]++
+		return
+	}
+	stats.Success++
+	stats.Fill.Add(result.URL, result.Empty)
+	switch result.Saved {
+	case repositories.AdInserted:
+		stats.Inserted++
+	case repositories.AdUpdated:
+		stats.Updated++
+	case repositories.AdUnchanged:
+		stats.Duplicate++
+	}
+}
+
+// Queue passes the listings a discovery process finds to crawler workers in other processes.
+// A task stays in the queue until the worker that pulled it acks it.
+type Queue interface {
+	// Push adds a task for the workers
+	Push(ctx context.Context, task Task) error
+
+	// Pull waits a little for the next task, ok is false when none arrived.
+	// Tasks not acked within the visibility timeout are pulled again.
+	Pull(ctx context.Context, worker string) (delivery Delivery, ok bool, err error)
+
+	// Ack removes a task that is not scraped, like one of a finished run. Like Complete
+	// it does nothing and returns false when another worker took the task over.
+	Ack(ctx context.Context, delivery Delivery) (bool, error)
+
+	// Outstanding returns how many tasks of a run were pushed and not acked yet
+	Outstanding(ctx context.Context, runID string) (int64, error)
+
+	// Complete records the result of a task for the run it belongs to and removes the task,
+	// whether its scrape succeeded or not. It is one step, so a task is counted once: a worker
+	// that held the task past the visibility timeout gets false and nothing is recorded.
+	Complete(ctx context.Context, delivery Delivery, result Result) (bool, error)
+
+	// Stats returns the results reported for a run, by worker
+	Stats(ctx context.Context, runID string) (map[string]WorkerStats, error)
+
+	// Finish marks a run as over, the workers drop the tasks of it that are still queued
+	Finish(ctx context.Context, runID string) error
+
+	// Finished reports whether a run is over
+	Finished(ctx context.Context, runID string) (bool, error)
+}
+
+// FromContext returns the queue stored in ctx as "crawl_queue", ok is false when crawls are not distributed
+func FromContext(ctx context.Context) (Queue, bool) {
+	queue, ok := ctx.Value("crawl_queue").(Queue)
+	return queue, ok && queue != nil
+}
@@ -0,0 +1,322 @@
+package queue
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Defaults used when the CRAWL_QUEUE_* settings are not set
+const (
+	defaultStream     = "crawl:jobs"
+	defaultGroup      = "crawlers"
+	defaultVisibility = 300 // seconds
+	defaultPoll       = 5 * time.Second
+
+	// Run keys are kept a week, long enough to look into a run after it finished
+	runKeyTTL = 7 * 24 * time.Hour
+)
+
+// Config holds the settings of the Redis queue
+type Config struct {
+	Stream     string        // Redis stream holding the tasks
+	Group      string        // Consumer group the workers share
+	Visibility time.Duration // How long a pulled task is left to its worker before it is pulled again
+	Poll       time.Duration // How long Pull waits for a task
+}
+
+// ConfigFromEnv reads CRAWL_QUEUE_STREAM and CRAWL_QUEUE_VISIBILITY (seconds)
+func ConfigFromEnv() Config {
+	config := Config{Stream: defaultStream, Group: defaultGroup, Visibility: defaultVisibility * time.Second, Poll: defaultPoll}
+	if stream := os.Getenv("CRAWL_QUEUE_STREAM"); stream != "" {
+		config.Stream = stream
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("CRAWL_QUEUE_VISIBILITY")); err == nil && seconds > 0 {
+		config.Visibility = time.Duration(seconds) * time.Second
+	}
+	return config
+}
+
+// RedisQueue is a Queue on a Redis stream read by a consumer group. Every worker is a
+// consumer of the group, a task it pulled stays pending in the group until it is acked
+// and is claimed by another worker once it was idle for the visibility timeout.
+// Needs Redis 6.2 or later.
+type RedisQueue struct {
+	client *redis.Client
+	config Config
+
+	mu    sync.Mutex
+	ready bool // Whether the consumer group exists
+}
+
+// NewRedisQueue creates a queue on client
+func NewRedisQueue(client *redis.Client, config Config) *RedisQueue {
+	return &RedisQueue{client: client, config: config}
+}
+
+// outstandingKey counts the tasks of a run that were not acked yet
+func outstandingKey(runID string) string {
+	return "crawl:run:" + runID + ":outstanding"
+}
+
+// statsKey holds the results of a run, as "<worker>|<counter>" fields
+func statsKey(runID string) string {
+	return "crawl:run:" + runID + ":workers"
+}
+
+// finishedKey is set once a run is over
+func finishedKey(runID string) string {
+	return "crawl:run:" + runID + ":finished"
+}
+
+// ensureGroup creates the stream and the consumer group the first time they are needed
+func (q *RedisQueue) ensureGroup(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ready {
+		return nil
+	}
+	err := q.client.XGroupCreateMkStream(ctx, q.config.Stream, q.config.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	q.ready = true
+	return nil
+}
+
+func (q *RedisQueue) Push(ctx context.Context, task Task) error {
+	if err := q.ensureGroup(ctx); err != nil {
+		return err
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, outstandingKey(task.RunID))
+		pipe.Expire(ctx, outstandingKey(task.RunID), runKeyTTL)
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: q.config.Stream, Values: map[string]interface{}{"task": string(data)}})
+		return nil
+	})
+	return err
+}
+
+func (q *RedisQueue) Pull(ctx context.Context, worker string) (Delivery, bool, error) {
+	if err := q.ensureGroup(ctx); err != nil {
+		return Delivery{}, false, err
+	}
+
+	// Tasks left by a dead worker come first
+	stale, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: q.config.Stream,
+		Group:  q.config.Group,
+		Idle:   q.config.Visibility,
+		Start:  "-",
+		End:    "+",
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return Delivery{}, false, err
+	}
+	if len(stale) > 0 {
+		claimed, err := q.client.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   q.config.Stream,
+			Group:    q.config.Group,
+			Consumer: worker,
+			MinIdle:  q.config.Visibility,
+			Messages: []string{stale[0].ID},
+		}).Result()
+		if err != nil {
+			return Delivery{}, false, err
+		}
+		// Another worker may have claimed it first
+		if len(claimed) > 0 {
+			return q.decode(ctx, worker, claimed[0], stale[0].RetryCount+1)
+		}
+	}
+
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.config.Group,
+		Consumer: worker,
+		Streams:  []string{q.config.Stream, ">"},
+		Count:    1,
+		Block:    q.config.Poll,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return Delivery{}, false, nil
+	}
+	if err != nil {
+		return Delivery{}, false, err
+	}
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			return q.decode(ctx, worker, message, 1)
+		}
+	}
+	return Delivery{}, false, nil
+}
+
+// decode reads the task of a message, a message that can't be read is dropped
+func (q *RedisQueue) decode(ctx context.Context, worker string, message redis.XMessage, attempts int64) (Delivery, bool, error) {
+	delivery := Delivery{ID: message.ID, Worker: worker, Attempts: attempts}
+	data, _ := message.Values["task"].(string)
+	if err := json.Unmarshal([]byte(data), &delivery.Task); err != nil {
+		q.client.XAck(ctx, q.config.Stream, q.config.Group, message.ID)
+		q.client.XDel(ctx, q.config.Stream, message.ID)
+		return Delivery{}, false, fmt.Errorf("dropped unreadable task %s: %w", message.ID, err)
+	}
+	return delivery, true, nil
+}
+
+// completeScript acks a task and counts its result in one step, only while the worker
+// that pulled it still holds it. A task claimed by another worker is left to that worker.
+// KEYS are the stream, the outstanding counter and the stats of the run. ARGV are the group,
+// the message, the worker, the TTL of the run keys in seconds, the number of stats fields
+// to increment, those fields, and then pairs of stats fields and values to set.
+var completeScript = redis.NewScript(`
+local held = redis.call("XPENDING", KEYS[1], ARGV[1], ARGV[2], ARGV[2], 1, ARGV[3])
+if #held == 0 then
+	return 0
+end
+redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+redis.call("XDEL", KEYS[1], ARGV[2])
+redis.call("DECR", KEYS[2])
+
+local increments = tonumber(ARGV[5])
+for i = 6, 5 + increments do
+	redis.call("HINCRBY", KEYS[3], ARGV[i], 1)
+end
+for i = 6 + increments, #ARGV, 2 do
+	redis.call("HSET", KEYS[3], ARGV[i], ARGV[i + 1])
+end
+if #ARGV > 5 then
+	redis.call("EXPIRE", KEYS[3], ARGV[4])
+end
+return 1
+`)
+
+func (q *RedisQueue) Ack(ctx context.Context, delivery Delivery) (bool, error) {
+	return q.complete(ctx, delivery, nil, nil)
+}
+
+func (q *RedisQueue) Complete(ctx context.Context, delivery Delivery, result Result) (bool, error) {
+	counters := []string{"success"}
+	if result.Failure != "" {
+		counters = []string{"failed", "failure:" + string(result.Failure)}
+	} else if result.Saved != "" {
+		counters = append(counters, string(result.Saved))
+	}
+	var increments, samples []string
+	for _, counter := range counters {
+		increments = append(increments, result.Worker+"|"+counter)
+	}
+	// Only the last ad missing a field is kept as its sample
+	for _, field := range result.Empty {
+		increments = append(increments, result.Worker+"|empty:"+field)
+		samples = append(samples, result.Worker+"|sample:"+field, result.URL)
+	}
+	return q.complete(ctx, delivery, increments, samples)
+}
+
+func (q *RedisQueue) complete(ctx context.Context, delivery Delivery, increments []string, samples []string) (bool, error) {
+	runID := delivery.Task.RunID
+	keys := []string{q.config.Stream, outstandingKey(runID), statsKey(runID)}
+	args := []interface{}{q.config.Group, delivery.ID, delivery.Worker, int(runKeyTTL.Seconds()), len(increments)}
+	for _, field := range increments {
+		args = append(args, field)
+	}
+	for _, value := range samples {
+		args = append(args, value)
+	}
+	done, err := completeScript.Run(ctx, q.client, keys, args...).Int()
+	return done == 1, err
+}
+
+func (q *RedisQueue) Outstanding(ctx context.Context, runID string) (int64, error) {
+	count, err := q.client.Get(ctx, outstandingKey(runID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (q *RedisQueue) Stats(ctx context.Context, runID string) (map[string]WorkerStats, error) {
+	fields, err := q.client.HGetAll(ctx, statsKey(runID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]WorkerStats)
+	for field, value := range fields {
+		worker, counter, found := strings.Cut(field, "|")
+		if !found {
+			continue
+		}
+		workerStats := stats[worker]
+		if sampled, ok := strings.CutPrefix(counter, "sample:"); ok {
+			if workerStats.Fill.Samples == nil {
+				workerStats.Fill.Samples = make(map[string][]string)
+			}
+			workerStats.Fill.Samples[sampled] = []string{value}
+			stats[worker] = workerStats
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		switch {
+		case counter == "success":
+			workerStats.Success = count
+			workerStats.Fill.Total = count
+		case counter == "failed":
+			workerStats.Failed = count
+		case counter == string(repositories.AdInserted):
+			workerStats.Inserted = count
+		case counter == string(repositories.AdUpdated):
+			workerStats.Updated = count
+		case counter == string(repositories.AdUnchanged):
+			workerStats.Duplicate = count
+		case strings.HasPrefix(counter, "empty:"):
+			if workerStats.Fill.Empty == nil {
+				workerStats.Fill.Empty = make(map[string]int)
+			}
+			workerStats.Fill.Empty[strings.TrimPrefix(counter, "empty:")] = count
+		case strings.HasPrefix(counter, "failure:"):
+			if workerStats.Failures == nil {
+				workerStats.Failures = make(map[models.FailureKind]int)
+			}
+			workerStats.Failures[models.FailureKind(strings.TrimPrefix(counter, "failure:"))] = count
+		}
+		stats[worker] = workerStats
+	}
+	return stats, nil
+}
+
+func (q *RedisQueue) Finish(ctx context.Context, runID string) error {
+	return q.client.Set(ctx, finishedKey(runID), 1, runKeyTTL).Err()
+}
+
+func (q *RedisQueue) Finished(ctx context.Context, runID string) (bool, error) {
+	count, err := q.client.Exists(ctx, finishedKey(runID)).Result()
+	return count > 0, err
+}
+
+// WorkerName returns the name a worker reports its results under, CRAWL_WORKER_NAME or the host and process ID
+func WorkerName() string {
+	if name := os.Getenv("CRAWL_WORKER_NAME"); name != "" {
+		return name
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,227 @@
+package selectors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Spec is a versioned set of CSS selectors and label texts used by a scraper.
+// Every field can list several selectors, they are tried in order until one matches.
+type Spec struct {
+	Version string              `json:"version"`
+	Fields  map[string][]string `json:"fields"`
+	Labels  map[string][]string `json:"labels"`
+}
+
+// Selectors returns the fallback selector list of a field
+func (s *Spec) Selectors(field string) []string {
+	return s.Fields[field]
+}
+
+// Selector returns the primary selector of a field
+func (s *Spec) Selector(field string) string {
+	if selectors := s.Fields[field]; len(selectors) > 0 {
+		return selectors[0]
+	}
+	return ""
+}
+
+// Label returns the primary text of a label
+func (s *Spec) Label(name string) string {
+	if labels := s.Labels[name]; len(labels) > 0 {
+		return labels[0]
+	}
+	return ""
+}
+
+// Is reports whether text matches one of the texts of a label
+func (s *Spec) Is(name string, text string) bool {
+	return slices.Contains(s.Labels[name], strings.TrimSpace(text))
+}
+
+// Contains reports whether text contains one of the texts of a label
+func (s *Spec) Contains(name string, text string) bool {
+	return slices.ContainsFunc(s.Labels[name], func(label string) bool {
+		return strings.Contains(text, label)
+	})
+}
+
+// Find returns the elements matched by the first selector of the field that matches anything
+func (s *Spec) Find(root *goquery.Selection, field string) *goquery.Selection {
+	for _, selector := range s.Fields[field] {
+		if selection := root.Find(selector); selection.Length() > 0 {
+			return selection
+		}
+	}
+	return root.Find("__no_match__")
+}
+
+// Text returns the trimmed text of the first element matched by the field
+func (s *Spec) Text(root *goquery.Selection, field string) (string, error) {
+	selection := s.Find(root, field).First()
+	if selection.Length() == 0 {
+		return "", fmt.Errorf("no selector matched field %s", field)
+	}
+	return strings.TrimSpace(selection.Text()), nil
+}
+
+// Attr returns an attribute of the first element matched by the field
+func (s *Spec) Attr(root *goquery.Selection, field string, attr string) (string, bool) {
+	return s.Find(root, field).First().Attr(attr)
+}
+
+// Validate checks that every required field has at least one selector
+func (s *Spec) Validate(required ...string) error {
+	for _, field := range required {
+		if len(s.Fields[field]) == 0 {
+			return fmt.Errorf("selector spec %s has no selector for field %s", s.Version, field)
+		}
+	}
+	return nil
+}
+
+// Registry holds the current spec of a scraper. The defaults compiled into the
+// binary are overridden by SELECTORS_DIR/<name>.json when that file exists.
+// The file is reloaded when it changes.
+type Registry struct {
+	name     string
+	defaults []byte
+	required []string
+
+	mu      sync.Mutex
+	spec    *Spec
+	path    string
+	modTime time.Time
+}
+
+// NewRegistry creates a registry from the embedded default spec
+func NewRegistry(name string, defaults []byte, required ...string) *Registry {
+	return &Registry{name: name, defaults: defaults, required: required}
+}
+
+// Get returns the current spec, reloading the spec file if it changed since the last call
+func (r *Registry) Get() *Spec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := r.filePath()
+	info, err := os.Stat(path)
+	if path == "" {
+		err = os.ErrNotExist
+	}
+	if errors.Is(err, os.ErrNotExist) && r.path != "" {
+		// The override was removed, go back to the embedded defaults
+		log.Printf("Selectors file %s is gone, using the default %s selectors", r.path, r.name)
+		r.spec, r.path, r.modTime = nil, "", time.Time{}
+	}
+	if err == nil && (r.spec == nil || path != r.path || !info.ModTime().Equal(r.modTime)) {
+		if spec, err := r.loadFile(path); err != nil {
+			log.Printf("Cant load selectors from %s, keeping version %s: %v", path, r.versionLocked(), err)
+		} else {
+			log.Printf("Loaded %s selectors version %s from %s", r.name, spec.Version, path)
+			r.spec = spec
+		}
+		// Remember the file state so a broken file is not reparsed on every call
+		r.path, r.modTime = path, info.ModTime()
+	}
+
+	if r.spec == nil {
+		spec, err := r.parse(r.defaults)
+		if err != nil {
+			// Defaults are compiled in, a broken default spec is a programming error
+			panic(fmt.Sprintf("invalid default %s selectors: %v", r.name, err))
+		}
+		r.spec = spec
+	}
+	return r.spec
+}
+
+// Reload forces the spec file to be read again on the next Get
+func (r *Registry) Reload() *Spec {
+	r.mu.Lock()
+	r.modTime = time.Time{}
+	r.mu.Unlock()
+	return r.Get()
+}
+
+func (r *Registry) filePath() string {
+	dir := os.Getenv("SELECTORS_DIR")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, r.name+".json")
+}
+
+func (r *Registry) versionLocked() string {
+	if r.spec == nil {
+		return "default"
+	}
+	return r.spec.Version
+}
+
+// loadFile reads an override spec. Its fields and labels are merged onto the
+// embedded defaults key by key, so a file only has to list what it changes.
+func (r *Registry) loadFile(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec Spec
+	if err := json.Unmarshal(r.defaults, &spec); err != nil {
+		return nil, fmt.Errorf("invalid default %s selectors: %w", r.name, err)
+	}
+	var override Spec
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, err
+	}
+	if override.Version != "" {
+		spec.Version = override.Version
+	}
+	spec.Fields = merge(spec.Fields, override.Fields)
+	spec.Labels = merge(spec.Labels, override.Labels)
+	return &spec, spec.validate(r.required)
+}
+
+func (r *Registry) parse(data []byte) (*Spec, error) {
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	return &spec, spec.validate(r.required)
+}
+
+// validate checks the required fields and that no label was left without a text,
+// a scraper matching against an empty label would reject every ad
+func (s *Spec) validate(required []string) error {
+	if err := s.Validate(required...); err != nil {
+		return err
+	}
+	for name, texts := range s.Labels {
+		if len(texts) == 0 {
+			return fmt.Errorf("selector spec %s has no text for label %s", s.Version, name)
+		}
+	}
+	return nil
+}
+
+// merge returns base with the keys of override replacing its own
+func merge(base, override map[string][]string) map[string][]string {
+	merged := make(map[string][]string, len(base)+len(override))
+	for key, values := range base {
+		merged[key] = values
+	}
+	for key, values := range override {
+		merged[key] = values
+	}
+	return merged
+}
@@ -1,241 +1,194 @@
 package sheypoor
 
 import (
-	"Crawlzilla/database"
-	"Crawlzilla/database/repositories"
 	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
 	"Crawlzilla/utils"
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/chromedp"
 )
 
 // CategoryHandler is a function type that defines the signature of handlers for each category
-type CategoryHandler func(context.Context, AdURL) error
-
-// StartConsumer starts a consumer for a specific category with a shared Chrome context
-func StartConsumer(category string, adChannel <-chan AdURL) {
-
-	maxCrawlTime, err := strconv.Atoi(os.Getenv("MAX_CRAWL_TIME"))
-	if err != nil {
-		log.Fatalf("Error reading MAX_CRAWL_TIME from .env: %v", err)
-	}
-	maxCrawlDuration := time.Duration(maxCrawlTime) * time.Minute
-	ctx := CreateChromeContext(maxCrawlDuration)
-	defer ctx.Cancel()
-
-	// Define handlers for each category
-	handlers := map[string]CategoryHandler{
-		"villa-for-sale":             handleVillaForSale,
-		"house-apartment-for-rent":   handleHouseApartmentForRent,
-		"houses-apartments-for-sale": handleHouseApartmentForSale,
-	}
+type CategoryHandler func(*goquery.Document, source.Job) (models.Ads, error)
+
+// handlers maps each category to its extractor, the property type is used when the ad does not state one
+var handlers = map[string]CategoryHandler{
+	"villa-for-sale":               handleForSale(models.PropertyVila),
+	"house-apartment-for-rent":     handleForRent(models.PropertyApartment),
+	"houses-apartments-for-sale":   handleForSale(models.PropertyApartment),
+	"commercial-property-for-sale": handleForSale(models.PropertyOffice),
+	"commercial-property-for-rent": handleForRent(models.PropertyOffice),
+	"land-for-sale":                handleForSale(models.PropertyLand),
+}
 
-	// Get the handler for the current category
-	handler, exists := handlers[category]
+// ParseAdPage extracts an Ads struct from the rendered HTML of a sheypoor ad
+func ParseAdPage(ad source.Job, html string) (models.Ads, error) {
+	// Get the handler for the ad category
+	handler, exists := handlers[ad.Category]
 	if !exists {
-		log.Fatalf("No handler found for category %s", category)
+		return models.Ads{}, source.Fail(models.FailureUnsupported, fmt.Errorf("no handler found for category %s", ad.Category))
 	}
 
-	// Process URLs from the adChannel
-	for ad := range adChannel {
-		err := chromedp.Run(ctx.Ctx, chromedp.Navigate(ad.URL))
-		if err != nil {
-			log.Printf("Failed to navigate to URL %s: %v", ad.URL, err)
-			continue
-		}
-
-		// Call the specific handler for the category
-		if err := handler(ctx.Ctx, ad); err != nil {
-			log.Printf("Error handling ad for category %s at URL %s: %v", category, ad.URL, err)
-		}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return models.Ads{}, err
 	}
+
+	// Call the specific handler for the category
+	return handler(doc, ad)
 }
 
-func handleVillaForSale(ctx context.Context, ad AdURL) error {
-	// fmt.Println("-------------------------------------فروش ویلا-------------------------------------")
-	// Extract title
-	title, err := utils.ExtractTitle(ctx)
+// LoadPageWithChrome opens the ad in a leased Chrome tab and returns the rendered HTML
+func LoadPageWithChrome(ctx context.Context, pageURL string) (html string, err error) {
+	// Lease a Chrome tab, a failed page recycles it
+	tab, err := browser.Lease(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
+	defer func() { tab.Release(err) }()
+	ctx, cancel := tab.Context(ctx)
+	defer cancel()
 
-	// Extract attributes
-	attributes, err := utils.ExtractVillaForSale(ctx)
+	// Set timeout for the scraping task
+	maxScrapTime, err := strconv.Atoi(os.Getenv("MAX_SCRAP_TIME"))
 	if err != nil {
-		return err
+		log.Printf("Error reading MAX_SCRAP_TIME from .env: %v", err)
 	}
+	ctx, cancel = context.WithTimeout(ctx, time.Duration(maxScrapTime)*time.Second)
+	defer cancel()
 
-	// Extract image URLs
-	imageURL, err := utils.ExtractImageURL(ctx)
-	if err != nil {
-		return err
+	if err = browser.Navigate(ctx, pageURL); err != nil {
+		return "", fmt.Errorf("failed to load URL %s: %w", pageURL, err)
 	}
-
-	// Extract city and district
-	city, district, err := utils.ExtractCityAndDistrict(ctx)
+	err = chromedp.Run(ctx,
+		chromedp.WaitVisible(Selectors.Get().Selector("title"), chromedp.ByQuery),
+		chromedp.OuterHTML("html", &html),
+	)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to load URL %s: %w", pageURL, err)
 	}
-
-	// Extract description
-	description, err := utils.ExtractDescription(ctx)
-	if err != nil {
-		log.Printf("error extracting description: %v", err)
+	if recorder := source.RecorderFromContext(ctx); recorder.WantsScreenshot() {
+		var screenshot []byte
+		if err := chromedp.Run(ctx, chromedp.FullScreenshot(&screenshot, 80)); err != nil {
+			log.Printf("failed to capture screenshot of %s: %v", pageURL, err)
+		} else {
+			recorder.RecordScreenshot(screenshot)
+		}
 	}
-	price, err := utils.ExtractPrice(ctx)
-	if err != nil {
-		log.Printf("error extracting price: %v", err)
+	if err = politeness.FromContext(ctx).DetectBlock(ctx, pageURL, html, Selectors.Get().Labels["blocked"]); err != nil {
+		return "", err
 	}
-
-	// Construct CrawlResult
-	crawlResult := models.Ads{
-		Reference:    "sheypoor",
-		Title:        title,
-		Description:  description,
-		ImageURL:     imageURL,
-		URL:          ad.URL,
-		PropertyType: attributes.PropertyType,
-		Area:         attributes.Area,
-		Room:         attributes.Room,
-		Price:        price,
-		City:         city,
-		Neighborhood: district,
-		// BuildingAgeType:  attributes.BuildingAgeType,
-		// BuildingAgeValue: attributes.BuildingAgeValue,
-		HasElevator: attributes.HasElevator,
-		HasParking:  attributes.HasParking,
-		HasStorage:  attributes.HasStorage,
-	}
-
-	// log.Println(crawlResult.String())
-	_, createErr := repositories.CreateAd(database.DB, &crawlResult)
-	if createErr != nil {
-		return err
-	}
-	return nil
+	return html, nil
 }
-func handleHouseApartmentForSale(ctx context.Context, ad AdURL) error {
-	// fmt.Println("-------------------------------------فروش خانه و آپارتمان-------------------------------------")
-	// Extract title
-	title, err := utils.ExtractTitle(ctx)
-	if err != nil {
-		return err
-	}
 
-	// Extract attributes
-	attributes, err := utils.ExtractVillaForSale(ctx)
+// LoadPageWithHTTP fetches the server rendered HTML of an ad without a browser
+func LoadPageWithHTTP(ctx context.Context, pageURL string) (string, error) {
+	html, err := fetch.Get(ctx, pageURL, nil)
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	// Extract image URLs
-	imageURL, err := utils.ExtractImageURL(ctx)
-	if err != nil {
-		return err
+	if err = politeness.FromContext(ctx).DetectBlock(ctx, pageURL, html, Selectors.Get().Labels["blocked"]); err != nil {
+		return "", err
 	}
+	return html, nil
+}
 
-	// Extract city and district
-	city, district, err := utils.ExtractCityAndDistrict(ctx)
-	if err != nil {
-		return err
-	}
+// handleForSale returns the extractor of a sale category, sale ads show their price next to the toman icon
+func handleForSale(propertyType string) CategoryHandler {
+	return func(doc *goquery.Document, ad source.Job) (models.Ads, error) {
+		spec := Selectors.Get()
+		crawlResult, err := extractAd(doc, ad, propertyType)
+		if err != nil {
+			return models.Ads{}, err
+		}
 
-	// Extract description
-	description, err := utils.ExtractDescription(ctx)
-	if err != nil {
-		log.Printf("error extracting description: %v", err)
-	}
-	price, err := utils.ExtractPrice(ctx)
-	if err != nil {
-		log.Printf("error extracting price: %v", err)
+		crawlResult.CategoryType = "sell"
+		crawlResult.Price, err = utils.ExtractPrice(spec, doc)
+		if err != nil {
+			log.Printf("error extracting price: %v", err)
+		}
+		return crawlResult, nil
 	}
+}
 
-	crawlResult := models.Ads{
-		Reference:    "sheypoor",
-		Title:        title,
-		Description:  description,
-		ImageURL:     imageURL,
-		URL:          ad.URL,
-		PropertyType: attributes.PropertyType,
-		Area:         attributes.Area,
-		Room:         attributes.Room,
-		Price:        price,
-		City:         city,
-		Neighborhood: district,
-		// BuildingAgeType:  attributes.BuildingAgeType,
-		// BuildingAgeValue: attributes.BuildingAgeValue,
-		HasElevator: attributes.HasElevator,
-		HasParking:  attributes.HasParking,
-		HasStorage:  attributes.HasStorage,
-	}
-
-	// log.Println(crawlResult.String())
-	_, createErr := repositories.CreateAd(database.DB, &crawlResult)
-	if createErr != nil {
-		return err
-	}
-	return nil
+// handleForRent returns the extractor of a rent category, rent ads list their deposit and rent as attributes
+func handleForRent(propertyType string) CategoryHandler {
+	return func(doc *goquery.Document, ad source.Job) (models.Ads, error) {
+		crawlResult, err := extractAd(doc, ad, propertyType)
+		if err != nil {
+			return models.Ads{}, err
+		}
+
+		crawlResult.CategoryType = "rent"
+		return crawlResult, nil
+	}
 }
 
-func handleHouseApartmentForRent(ctx context.Context, ad AdURL) error {
-	// fmt.Println("-------------------------------------رهن و اجاره-------------------------------------")
+// extractAd extracts the fields shared by every category
+func extractAd(doc *goquery.Document, ad source.Job, propertyType string) (models.Ads, error) {
+	spec := Selectors.Get()
 	// Extract title
-	title, err := utils.ExtractTitle(ctx)
+	title, err := utils.ExtractTitle(spec, doc)
 	if err != nil {
-		return err
+		return models.Ads{}, err
 	}
 
 	// Extract attributes
-	attributes, err := utils.ExtractVillaForSale(ctx)
+	attributes, err := utils.ExtractAttributes(spec, doc, ad.SeenTime())
 	if err != nil {
-		return err
+		return models.Ads{}, err
 	}
-
-	// Extract image URLs
-	imageURL, err := utils.ExtractImageURL(ctx)
-	if err != nil {
-		return err
+	if attributes.PropertyType != "" {
+		propertyType = attributes.PropertyType
 	}
 
+	// Extract the gallery image URLs
+	imageURLs := utils.ExtractImageURLs(spec, doc)
+
 	// Extract city and district
-	city, district, err := utils.ExtractCityAndDistrict(ctx)
+	city, district, err := utils.ExtractCityAndDistrict(spec, doc)
 	if err != nil {
-		return err
+		return models.Ads{}, err
 	}
 
 	// Extract description
-	description, err := utils.ExtractDescription(ctx)
+	description, err := utils.ExtractDescription(spec, doc)
 	if err != nil {
 		log.Printf("error extracting description: %v", err)
 	}
+
 	crawlResult := models.Ads{
-		Reference:    "sheypoor",
-		Title:        title,
-		Description:  description,
-		ImageURL:     imageURL,
-		URL:          ad.URL,
-		PropertyType: attributes.PropertyType,
-		Area:         attributes.Area,
-		Room:         attributes.Room,
-		Price:        attributes.Price,
-		Rent:         attributes.Rent,
-		City:         city,
-		Neighborhood: district,
-		// BuildingAgeType:  attributes.BuildingAgeType,
-		// BuildingAgeValue: attributes.BuildingAgeValue,
-		HasElevator: attributes.HasElevator,
-		HasParking:  attributes.HasParking,
-		HasStorage:  attributes.HasStorage,
-	}
-	// log.Println(crawlResult.String())
-	_, createErr := repositories.CreateAd(database.DB, &crawlResult)
-	if createErr != nil {
-		return err
-	}
-	return nil
+		Reference:       "sheypoor",
+		Title:           title,
+		Description:     description,
+		URL:             ad.URL,
+		SourceListingID: utils.ExtractListingID(ad.URL),
+		PropertyType:    propertyType,
+		Area:            attributes.Area,
+		Room:            attributes.Room,
+		Deposit:         attributes.Deposit,
+		Rent:            attributes.Rent,
+		City:            city,
+		Neighborhood:    district,
+		YearBuilt:       attributes.YearBuilt,
+		AgeBasedYear:    attributes.AgeBasedYear,
+		ParkingCount:    attributes.ParkingCount,
+		HasElevator:     attributes.HasElevator,
+		HasParking:      attributes.HasParking,
+		HasStorage:      attributes.HasStorage,
+		HasBalcony:      attributes.HasBalcony,
+	}
+	crawlResult.SetImages(imageURLs)
+	return crawlResult, nil
 }
@@ -1,99 +1,213 @@
 package sheypoor
 
 import (
+	"Crawlzilla/logger"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
 	"context"
-	"log"
+	"errors"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
 )
 
-type AdURL struct {
-	URL      string
-	Category string
-}
+// maxIdleScrolls is how many scrolls in a row may fail or load no new ads before a category is done
+const maxIdleScrolls = 3
 
-func ScrapeCategory(categoryName string, ctx context.Context, ctg string, urlChannel chan<- AdURL, batchSize int) {
-	err := chromedp.Run(ctx,
-		chromedp.Navigate("https://www.sheypoor.com/s/iran/"+ctg),
-	)
+// ScrapeCategory scrolls the page of a category in a city and sends the ads it finds to jobs.
+// It stops after the page budget of the target or MAX_PAGE pages, when scrolling stops loading new ads, when an incremental
+// run reaches listings it already has or when ctx is done. Chrome runs under a supervisor that restarts a crashed or stalled
+// browser and scrolls it back to where it was, until BROWSER_MAX_RECOVERIES restarts were used up.
+func ScrapeCategory(ctx context.Context, city string, ctg string, jobs chan<- source.Job) {
+	configLogger := logger.ConfigLogger()
+	crawlerLogger, _ := configLogger("crawler")
+
+	maxPage, err := source.MaxPages(ctx)
 	if err != nil {
-		log.Fatalf("Failed to navigate to category %s: %v", ctg, err)
+		crawlerLogger.Error("Error reading MAX_PAGE from .env", zap.Error(err))
 	}
-	for {
-		var urls []string
-		err := chromedp.Run(ctx,
-			chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil),
-			chromedp.Sleep(2*time.Second),
-		)
-		if err != nil {
+
+	categoryURL := baseURL + "/s/" + city + "/" + ctg
+	polite := politeness.FromContext(ctx)
+
+	supervisor := browser.NewSupervisor(ctx, browser.SupervisorConfigFromEnv())
+	defer supervisor.Close()
+	// scrolls counts the scrolls since the category was opened, a restarted browser replays them
+	scrolls := 0
+	reposition := func() error {
+		if err := supervisor.Do(func(ctx context.Context) error { return browser.Navigate(ctx, categoryURL) }); err != nil {
+			return err
+		}
+		for i := 0; i < scrolls; i++ {
+			if err := supervisor.Do(scrollDown); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// check decides whether scrolling goes on after a failed step
+	check := func(message string, err error) bool {
+		crawlerLogger.Error(message, zap.String("category", ctg), zap.Error(err))
+		if err := supervisor.Check(err, reposition); err != nil {
+			if ctx.Err() == nil {
+				crawlerLogger.Error("browser could not be recovered, stopping category", zap.String("category", ctg), zap.Error(err))
+			}
+			return false
+		}
+		return true
+	}
+
+	if err := supervisor.Start(); err != nil {
+		crawlerLogger.Error("Error starting browser", zap.String("category", ctg), zap.Error(err))
+		return
+	}
+	if err := reposition(); err != nil && !check("Failed to navigate to category", err) {
+		return
+	}
+
+	// Incremental runs skip the listings that are already stored
+	known := source.NewKnownTracker(ctx)
+	seen := make(map[string]bool)
+	idleScrolls := 0
+	idle := func() bool {
+		idleScrolls++
+		return idleScrolls >= maxIdleScrolls
+	}
+	// restarted is set when the browser was restarted because scrolling stopped finding ads
+	restarted := false
+	for page := 0; ; {
+		if ctx.Err() != nil {
+			crawlerLogger.Info("Crawler received shutdown signal, stopping...", zap.String("category", ctg))
+			return
+		}
+
+		// Scrolling loads the next ads from the site
+		if err := polite.Wait(ctx, categoryURL); err != nil {
+			crawlerLogger.Info("Stopping category", zap.String("category", ctg), zap.Error(err))
+			return
+		}
+		if err := supervisor.Do(scrollDown); err != nil {
+			if !check("Error waiting for new ads", err) {
+				return
+			}
 			continue
 		}
-		err = chromedp.Run(ctx,
-			chromedp.WaitVisible("[data-index]", chromedp.ByQuery),
-		)
+		scrolls++
+		var html string
+		err := supervisor.Do(func(ctx context.Context) error {
+			return chromedp.Run(ctx, chromedp.OuterHTML("html", &html))
+		})
 		if err != nil {
-			log.Printf("Error waiting for new ads in category %s: %v", ctg, err)
+			if !check("Error getting HTML content", err) {
+				return
+			}
 			continue
 		}
-		err = chromedp.Run(ctx,
-			chromedp.Evaluate(`
-                (() => {
-                    let urls = [];
-                    let adCards = document.querySelectorAll("div[data-index][data-item-index]");
-					if(adCards.length == 0) adCards = document.querySelectorAll("section[data-index][data-item-index]");
-                    adCards.forEach(card => {
-                        const link = card.querySelectorAll("a");
-                        link.forEach(ad => {
-                            if (ad && ad.href) {
-                                urls.push(ad.href);
-                            }
-                        });
-                    });
-                    return urls;
-                })()
-            `, &urls),
-		)
-		if err != nil {
-			log.Printf("Error extracting URLs in category %s: %v", ctg, err)
+		if err := polite.DetectBlock(ctx, categoryURL, html, Selectors.Get().Labels["blocked"]); err != nil {
+			if idle() {
+				return
+			}
 			continue
 		}
-		for {
-			availableCapacity := cap(urlChannel) - len(urlChannel)
-			if availableCapacity >= batchSize {
-				break
+		urls, err := extractAdURLs(html, categoryURL)
+		if err != nil {
+			crawlerLogger.Error("Error extracting URLs", zap.String("category", ctg), zap.Error(err))
+			if idle() {
+				return
 			}
-			log.Printf("Waiting for channel capacity in category %s", ctg)
-			time.Sleep(500 * time.Millisecond)
+			continue
 		}
+
+		// The page keeps the cards of earlier scrolls, only new ads are sent
+		found := 0
 		for _, link := range urls {
 			decodedURL, _ := url.QueryUnescape(link)
-			urlChannel <- AdURL{URL: decodedURL, Category: ctg}
+			if seen[decodedURL] {
+				continue
+			}
+			seen[decodedURL] = true
+			found++
+			if known.Known(decodedURL) {
+				if known.Done() {
+					break
+				}
+				continue
+			}
+			select {
+			case jobs <- source.Job{URL: decodedURL, Category: ctg}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if known.Done() {
+			crawlerLogger.Info("reached already crawled listings, stopping...", zap.String("category", ctg), zap.Int("skipped", known.Skipped()))
+			return
 		}
 
-		time.Sleep(3 * time.Second)
+		if found == 0 {
+			if idle() {
+				// A stalled browser stops loading ads too, only a fresh one that finds nothing means the end
+				if restarted {
+					crawlerLogger.Info("No more content to load.", zap.String("category", ctg))
+					return
+				}
+				restarted = true
+				idleScrolls = 0
+				crawlerLogger.Warn("scrolling found no new ads, restarting browser", zap.String("category", ctg))
+				if err := supervisor.Recover(errors.New("scrolling found no new ads"), reposition); err != nil {
+					crawlerLogger.Error("browser could not be recovered, stopping category", zap.String("category", ctg), zap.Error(err))
+					return
+				}
+			}
+			continue
+		}
+		idleScrolls = 0
+		restarted = false
+
+		page++
+		source.ReportPage(ctx)
+		if page >= maxPage {
+			crawlerLogger.Info("max page reached, stopping...", zap.String("category", ctg))
+			return
+		}
 	}
 }
 
-type ChromeContext struct {
-	Ctx    context.Context
-	Cancel context.CancelFunc
+// scrollDown scrolls to the end of the category page and waits for the ads it loads
+func scrollDown(ctx context.Context) error {
+	return chromedp.Run(ctx,
+		chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil),
+		chromedp.Sleep(2*time.Second),
+		chromedp.WaitVisible("[data-index]", chromedp.ByQuery),
+	)
 }
 
-func CreateChromeContext(timeout time.Duration) *ChromeContext {
-	// Create base context for Chrome
-	ctx, cancelChrome := chromedp.NewContext(context.Background())
-
-	// Wrap context with timeout
-
-	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
-
-	return &ChromeContext{
-		Ctx: ctx,
-		Cancel: func() {
-			cancelTimeout() // Cancel the timeout
-			cancelChrome()  // Cancel the Chrome context
-		},
+// extractAdURLs returns the absolute URLs of the ad cards on a category page
+func extractAdURLs(html string, pageURL string) ([]string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
 	}
+
+	spec := Selectors.Get()
+	var urls []string
+	spec.Find(doc.Selection, "ad_card").Each(func(i int, card *goquery.Selection) {
+		spec.Find(card, "ad_card_link").Each(func(i int, link *goquery.Selection) {
+			href, _ := link.Attr("href")
+			if ref, err := url.Parse(href); err == nil && href != "" {
+				urls = append(urls, base.ResolveReference(ref).String())
+			}
+		})
+	})
+	return urls, nil
 }
@@ -0,0 +1,16 @@
+package sheypoor
+
+import (
+	"Crawlzilla/services/crawler/selectors"
+	_ "embed"
+)
+
+//go:embed selectors.json
+var defaultSelectors []byte
+
+// Selectors holds the CSS selectors and label texts of sheypoor pages.
+// Put a sheypoor.json in SELECTORS_DIR to override them without a rebuild.
+var Selectors = selectors.NewRegistry("sheypoor", defaultSelectors,
+	"title", "image", "breadcrumbs", "price_icon", "price_value", "attribute", "attribute_text",
+	"description_block", "ad_card", "ad_card_link",
+)
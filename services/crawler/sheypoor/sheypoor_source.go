@@ -0,0 +1,100 @@
+package sheypoor
+
+import (
+	"Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const baseURL = "https://www.sheypoor.com"
+
+// Source crawls real-estate ads from sheypoor.com
+type Source struct {
+	City         string
+	Categories   []string
+	Loader       source.PageLoader // Renders listings in Chrome
+	HTTPLoader   source.PageLoader // Fetches listings without a browser
+	StatusLoader source.PageLoader
+	Fetch        fetch.Config
+}
+
+// NewSource returns a sheypoor source crawling every supported category of all of Iran
+func NewSource() *Source {
+	return &Source{
+		City: "iran",
+		Categories: []string{
+			"house-apartment-for-rent",
+			"houses-apartments-for-sale",
+			"villa-for-sale",
+			"commercial-property-for-rent",
+			"commercial-property-for-sale",
+			"land-for-sale",
+		},
+		Loader:       LoadPageWithChrome,
+		HTTPLoader:   LoadPageWithHTTP,
+		StatusLoader: LoadStatusPageWithChrome,
+		Fetch:        fetch.ConfigFromEnv("sheypoor", fetch.Config{Mode: fetch.ModeChrome}),
+	}
+}
+
+// NewTargetSource returns a sheypoor source crawling one category of a city
+func NewTargetSource(city string, category string) *Source {
+	src := NewSource()
+	src.City = city
+	src.Categories = []string{category}
+	return src
+}
+
+// SupportsCategory reports whether the ads of a category can be scraped
+func SupportsCategory(category string) bool {
+	_, ok := handlers[category]
+	return ok
+}
+
+func (s *Source) Name() string {
+	return "sheypoor"
+}
+
+// Discover scrolls every category in its own browser and sends found ads to jobs.
+// It returns when every category is done, MAX_CRAWL_TIME passed or ctx is canceled.
+func (s *Source) Discover(ctx context.Context, jobs chan<- source.Job) {
+	configLogger := logger.ConfigLogger()
+	crawlerLogger, _ := configLogger("crawler")
+
+	maxCrawlTime, err := strconv.Atoi(os.Getenv("MAX_CRAWL_TIME"))
+	if err != nil {
+		crawlerLogger.Error("Error reading MAX_CRAWL_TIME from .env:", zap.Error(err))
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(maxCrawlTime)*time.Minute)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, ctg := range s.Categories {
+		wg.Add(1)
+		go func(ctg string) {
+			defer wg.Done()
+			ScrapeCategory(ctx, s.City, ctg, jobs)
+		}(ctg)
+	}
+	wg.Wait()
+}
+
+// Scrap loads a listing with Chrome or over HTTP, as set by the fetch mode of the source
+func (s *Source) Scrap(ctx context.Context, job source.Job) (models.Ads, error) {
+	strategy := fetch.Strategy{Config: s.Fetch, HTTP: s.HTTPLoader, Chrome: s.Loader, Parse: s.Parse}
+	return strategy.Scrap(ctx, job)
+}
+
+// Parse extracts an ad from the archived HTML of a listing
+func (s *Source) Parse(job source.Job, html string) (models.Ads, error) {
+	result, err := ParseAdPage(job, html)
+	return result, source.Fail(models.FailureParse, err)
+}
@@ -0,0 +1,75 @@
+package sheypoor
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/politeness"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// statusSettleTime lets an expired ad render its notice before the page is read
+const statusSettleTime = 2 * time.Second
+
+// LoadStatusPageWithChrome loads an ad without waiting for the listing title, which a removed ad never renders
+func LoadStatusPageWithChrome(ctx context.Context, pageURL string) (string, error) {
+	maxScrapTime, err := strconv.Atoi(os.Getenv("MAX_SCRAP_TIME"))
+	if err != nil {
+		log.Printf("Error reading MAX_SCRAP_TIME from .env: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(maxScrapTime)*time.Second)
+	defer cancel()
+
+	html, err := browser.LoadPage(ctx, pageURL, statusSettleTime)
+	if err != nil {
+		return "", err
+	}
+	if err := politeness.FromContext(ctx).DetectBlock(ctx, pageURL, html, Selectors.Get().Labels["blocked"]); err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// Check visits the page of a stored ad and tells whether it is still online
+func (s *Source) Check(ctx context.Context, ad models.Ads) (models.AdStatus, error) {
+	html, err := s.StatusLoader(ctx, ad.URL)
+	if err != nil {
+		return "", err
+	}
+	return ParseListingStatus(html)
+}
+
+// ParseListingStatus tells from an ad page whether the ad is active, sold or expired
+func ParseListingStatus(html string) (models.AdStatus, error) {
+	spec := Selectors.Get()
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return "", err
+	}
+
+	// The seller's description may mention the notice texts, only look at the page itself
+	spec.Find(doc.Selection, "description_block").Each(func(i int, div *goquery.Selection) {
+		if spec.Is("description_title", div.Text()) {
+			div.Next().Remove()
+		}
+	})
+	text := doc.Find("body").Text()
+
+	switch {
+	case spec.Contains("sold", text):
+		return models.AdSold, nil
+	case spec.Contains("expired", text):
+		return models.AdExpired, nil
+	case spec.Find(doc.Selection, "title").Length() > 0:
+		return models.AdActive, nil
+	}
+	return "", errors.New("listing status not recognized")
+}
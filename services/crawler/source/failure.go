@@ -0,0 +1,43 @@
+package source
+
+import (
+	"Crawlzilla/models"
+	"context"
+	"errors"
+)
+
+// Failure tags a scrape error with its kind, the message of the error is kept as is
+type Failure struct {
+	Kind models.FailureKind
+	Err  error
+}
+
+func (f *Failure) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Fail tags err with a failure kind. An error that already has a kind keeps it and a nil err stays nil.
+func Fail(kind models.FailureKind, err error) error {
+	var failure *Failure
+	if err == nil || errors.As(err, &failure) {
+		return err
+	}
+	return &Failure{Kind: kind, Err: err}
+}
+
+// Classify returns the kind of a scrape error. Deadlines are timeouts whatever
+// step they cut off, untagged errors are treated as navigation errors.
+func Classify(err error) models.FailureKind {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return models.FailureTimeout
+	}
+	var failure *Failure
+	if errors.As(err, &failure) {
+		return failure.Kind
+	}
+	return models.FailureNavigation
+}
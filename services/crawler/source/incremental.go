@@ -0,0 +1,54 @@
+package source
+
+import "context"
+
+// Incremental configures an incremental run, it is stored in ctx under "incremental".
+// Known reports whether the listing of a URL is already stored.
+type Incremental struct {
+	Known     func(url string) bool
+	StopAfter int
+}
+
+// KnownTracker skips the listings an incremental run already has and tells the
+// scroller when to stop. A nil tracker, used by full runs, skips nothing.
+type KnownTracker struct {
+	incremental Incremental
+	consecutive int
+	skipped     int
+}
+
+// NewKnownTracker returns a tracker for one scroller, or nil when ctx holds no incremental run
+func NewKnownTracker(ctx context.Context) *KnownTracker {
+	incremental, ok := ctx.Value("incremental").(Incremental)
+	if !ok || incremental.Known == nil {
+		return nil
+	}
+	return &KnownTracker{incremental: incremental}
+}
+
+// Known reports whether the listing of url is stored and should not be scraped again
+func (t *KnownTracker) Known(url string) bool {
+	if t == nil {
+		return false
+	}
+	if !t.incremental.Known(url) {
+		t.consecutive = 0
+		return false
+	}
+	t.consecutive++
+	t.skipped++
+	return true
+}
+
+// Done reports whether StopAfter known listings came in a row, the rest of the list was seen before
+func (t *KnownTracker) Done() bool {
+	return t != nil && t.incremental.StopAfter > 0 && t.consecutive >= t.incremental.StopAfter
+}
+
+// Skipped returns how many known listings were skipped
+func (t *KnownTracker) Skipped() int {
+	if t == nil {
+		return 0
+	}
+	return t.skipped
+}
@@ -0,0 +1,58 @@
+package source
+
+import (
+	"context"
+	"sync"
+)
+
+// PageRecorder keeps the raw page of the listing a worker scrapes, so it can be archived.
+// The runner stores it in ctx as "page_recorder", scrapers hand it what they loaded.
+type PageRecorder struct {
+	// Screenshots asks the Chrome loaders to capture the page as well
+	Screenshots bool
+
+	mu         sync.Mutex
+	html       string
+	screenshot []byte
+}
+
+// RecorderFromContext returns the recorder stored in ctx, nil when pages are not recorded
+func RecorderFromContext(ctx context.Context) *PageRecorder {
+	recorder, _ := ctx.Value("page_recorder").(*PageRecorder)
+	return recorder
+}
+
+// WantsScreenshot reports whether the loader should capture a screenshot
+func (r *PageRecorder) WantsScreenshot() bool {
+	return r != nil && r.Screenshots
+}
+
+// Record keeps the HTML of the loaded page, a retried scrape replaces the previous attempt
+func (r *PageRecorder) Record(html string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.html = html
+}
+
+// RecordScreenshot keeps the screenshot of the loaded page, loaders take it before returning the HTML
+func (r *PageRecorder) RecordScreenshot(screenshot []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.screenshot = screenshot
+}
+
+// Page returns the recorded HTML and screenshot, ok is false when nothing was loaded
+func (r *PageRecorder) Page() (html string, screenshot []byte, ok bool) {
+	if r == nil {
+		return "", nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.html, r.screenshot, r.html != ""
+}
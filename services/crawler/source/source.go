@@ -0,0 +1,85 @@
+package source
+
+import (
+	"Crawlzilla/models"
+	"context"
+	"time"
+)
+
+// Job represents a single listing URL discovered by a source
+type Job struct {
+	URL      string
+	Category string
+	SeenAt   time.Time // When the page was loaded, zero for a page loaded now
+}
+
+// SeenTime returns when the page of the job was loaded, values relative to it like a building age are read at that time
+func (j Job) SeenTime() time.Time {
+	if j.SeenAt.IsZero() {
+		return time.Now()
+	}
+	return j.SeenAt
+}
+
+// Source is a marketplace the crawler runner can drive
+type Source interface {
+	// Name returns the reference name stored on scraped ads (e.g. "divar")
+	Name() string
+
+	// Discover walks the listing pages and sends every found listing URL to jobs.
+	// It must return when ctx is canceled.
+	Discover(ctx context.Context, jobs chan<- Job)
+
+	// Scrap visits a single listing and fills an Ads struct from it
+	Scrap(ctx context.Context, job Job) (models.Ads, error)
+}
+
+// PageLoader returns the rendered HTML of a listing page. Scrapers parse the
+// returned HTML, so a loader reading saved snapshots can replay a page offline.
+type PageLoader func(ctx context.Context, pageURL string) (string, error)
+
+// Validator is a Source that can tell whether a stored listing is still online
+type Validator interface {
+	// Check visits the listing of a stored ad and returns its current status
+	Check(ctx context.Context, ad models.Ads) (models.AdStatus, error)
+}
+
+// PageReporter is called for every listing page a source loads during discovery
+type PageReporter func()
+
+// ReportPage tells the runner stored in ctx under "page_reporter" that discovery loaded another listing page
+func ReportPage(ctx context.Context) {
+	if report, ok := ctx.Value("page_reporter").(PageReporter); ok {
+		report()
+	}
+}
+
+// RecoveryReporter is called every time a crashed or stalled browser is restarted
+type RecoveryReporter func()
+
+// ReportRecovery tells the runner stored in ctx under "recovery_reporter" that the browser was restarted
+func ReportRecovery(ctx context.Context) {
+	if report, ok := ctx.Value("recovery_reporter").(RecoveryReporter); ok {
+		report()
+	}
+}
+
+// Parser is a Source that can extract an ad from a listing page it loaded earlier
+type Parser interface {
+	// Parse fills an Ads struct from the raw HTML of the listing of job
+	Parse(job Job, html string) (models.Ads, error)
+}
+
+// Identifier is a Source that knows where the ID of a listing is in its URL
+type Identifier interface {
+	// ListingID returns the ID of the listing at url on its site, or "" when the URL has none
+	ListingID(url string) string
+}
+
+// ListingID returns the ID of a listing of src, from src itself when it is an Identifier
+func ListingID(src Source, url string, fallback func(reference string, url string) string) string {
+	if identifier, ok := src.(Identifier); ok {
+		return identifier.ListingID(url)
+	}
+	return fallback(src.Name(), url)
+}
@@ -0,0 +1,37 @@
+package source
+
+import (
+	"context"
+	"os"
+	"strconv"
+)
+
+// Target is the part of a site a run crawls, it is stored in ctx under "crawl_target".
+// Zero budgets fall back to MAX_PAGE and MAX_AD_COUNT.
+type Target struct {
+	Name     string // city/category
+	MaxPages int
+	MaxAds   int
+}
+
+// TargetFromContext returns the target of the run in ctx, a run without one crawls the whole site
+func TargetFromContext(ctx context.Context) (Target, bool) {
+	target, ok := ctx.Value("crawl_target").(Target)
+	return target, ok
+}
+
+// MaxPages returns how many listing pages discovery may load, the budget of the target or MAX_PAGE
+func MaxPages(ctx context.Context) (int, error) {
+	if target, ok := TargetFromContext(ctx); ok && target.MaxPages > 0 {
+		return target.MaxPages, nil
+	}
+	return strconv.Atoi(os.Getenv("MAX_PAGE"))
+}
+
+// MaxAds returns how many ads a run may scrape, the budget of the target or MAX_AD_COUNT
+func MaxAds(ctx context.Context) (int, error) {
+	if target, ok := TargetFromContext(ctx); ok && target.MaxAds > 0 {
+		return target.MaxAds, nil
+	}
+	return strconv.Atoi(os.Getenv("MAX_AD_COUNT"))
+}
@@ -0,0 +1,52 @@
+package dead_letters
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"errors"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// PaginatedDeadLetters represents a page of dead letters with the totals of every failure kind
+type PaginatedDeadLetters struct {
+	Data       []models.DeadLetter          `json:"data"`
+	TotalPages int                          `json:"total_pages"`
+	PageIndex  int                          `json:"page_index"`
+	Counts     map[models.FailureKind]int64 `json:"counts"`
+}
+
+// GetDeadLetters retrieves a page of the URLs the crawler gave up on
+func GetDeadLetters(db *gorm.DB, pageIndex, pageSize int) (PaginatedDeadLetters, error) {
+	// Validate page index
+	if pageIndex < 1 {
+		return PaginatedDeadLetters{}, errors.New("pageIndex must be greater than 0")
+	}
+
+	letters, totalRecords, err := repositories.GetDeadLetters(db, (pageIndex-1)*pageSize, pageSize)
+	if err != nil {
+		return PaginatedDeadLetters{}, err
+	}
+	counts, err := repositories.CountDeadLettersByKind(db)
+	if err != nil {
+		return PaginatedDeadLetters{}, err
+	}
+
+	return PaginatedDeadLetters{
+		Data:       letters,
+		TotalPages: int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		PageIndex:  pageIndex,
+		Counts:     counts,
+	}, nil
+}
+
+// RequeueDeadLetter queues a dead letter for the next crawl run of its source
+func RequeueDeadLetter(db *gorm.DB, id string) (models.DeadLetter, error) {
+	return repositories.RequeueDeadLetter(db, id)
+}
+
+// RequeueAllDeadLetters queues every dead letter for the next crawl run of its source
+func RequeueAllDeadLetters(db *gorm.DB) (int, error) {
+	return repositories.RequeueAllDeadLetters(db)
+}
@@ -0,0 +1,72 @@
+package dedup
+
+import (
+	"Crawlzilla/database/repositories"
+
+	"gorm.io/gorm"
+)
+
+// maxCandidates limits the stored ads an ad is compared with
+const maxCandidates = 500
+
+// maxCandidateDistance is how far in meters a located ad looks for copies of itself,
+// sites move the pin of a listing but not across town
+const maxCandidateDistance = 5000
+
+// AssignCluster compares an ad that has no cluster yet with the stored ads and puts it in
+// the cluster of the best match, or in a cluster of its own. It returns the cluster ID.
+func AssignCluster(db *gorm.DB, adID string) (string, error) {
+	ad, err := repositories.FindAd(db, adID)
+	if err != nil {
+		return "", err
+	}
+	if ad.ClusterID != "" {
+		return ad.ClusterID, nil
+	}
+
+	candidates, err := repositories.GetClusterCandidates(db, ad, maxAreaDifference, maxCandidateDistance, maxCandidates)
+	if err != nil {
+		return "", err
+	}
+
+	self := NewCandidate(ad)
+	bestScore := 0.0
+	var best *Candidate
+	for _, stored := range candidates {
+		candidate := NewCandidate(stored)
+		if score := Score(self, candidate); score >= Threshold && score > bestScore {
+			bestScore = score
+			best = &candidate
+		}
+	}
+
+	// An ad matching nothing is the first ad of its own cluster
+	clusterID := ad.ID
+	members := []string{ad.ID}
+	if best != nil {
+		clusterID = best.Ad.ClusterID
+		if clusterID == "" {
+			clusterID = best.Ad.ID
+			members = append(members, best.Ad.ID)
+		}
+	}
+	if err := repositories.SetClusterID(db, members, clusterID); err != nil {
+		return "", err
+	}
+	return clusterID, nil
+}
+
+// ClusterUnassigned assigns a cluster to up to limit ads that have none, oldest first.
+// It returns how many ads were assigned.
+func ClusterUnassigned(db *gorm.DB, limit int) (int, error) {
+	ids, err := repositories.GetUnclusteredAdIDs(db, limit)
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if _, err := AssignCluster(db, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,144 @@
+package dedup
+
+import (
+	"Crawlzilla/models"
+	"math"
+)
+
+// Threshold is the score from which two ads are taken for the same property
+const Threshold = 0.5
+
+// maxAreaDifference is the relative area difference two copies of a listing may have
+const maxAreaDifference = 0.1
+
+// Candidate is an ad prepared for comparison, normalized once instead of on every comparison
+type Candidate struct {
+	Ad           models.Ads
+	City         string
+	Neighborhood string
+	Phone        string
+	Signature    Signature
+	HasText      bool
+}
+
+// NewCandidate normalizes the fields of an ad used by Score
+func NewCandidate(ad models.Ads) Candidate {
+	signature, hasText := MinHash(ad.Title + " " + ad.Description)
+	return Candidate{
+		Ad:           ad,
+		City:         NormalizePlace(ad.City),
+		Neighborhood: NormalizePlace(ad.Neighborhood),
+		Phone:        NormalizePhone(ad.ContactNumber),
+		Signature:    signature,
+		HasText:      hasText,
+	}
+}
+
+// Score returns how likely two ads are the same property, from 0 to 1.
+// Ads that differ in city, category, property type, room count or area never match.
+func Score(a Candidate, b Candidate) float64 {
+	if !compatible(a, b) {
+		return 0
+	}
+
+	score := 0.0
+	if a.Ad.Area == b.Ad.Area {
+		score += 0.1
+	}
+
+	// The same seller posting twice, or the same agent on two sites
+	if a.Phone != "" && a.Phone == b.Phone {
+		score += 0.35
+	}
+
+	if a.Neighborhood != "" && b.Neighborhood != "" {
+		if a.Neighborhood == b.Neighborhood {
+			score += 0.1
+		} else {
+			score -= 0.2
+		}
+	}
+
+	if hasCoordinates(a.Ad) && hasCoordinates(b.Ad) {
+		switch distance := distanceMeters(a.Ad, b.Ad); {
+		case distance <= 100:
+			score += 0.25
+		case distance <= 300:
+			score += 0.15
+		case distance > 2000:
+			score -= 0.2
+		}
+	}
+
+	score += priceScore(a.Ad.Price, b.Ad.Price)
+	score += priceScore(a.Ad.Deposit, b.Ad.Deposit)
+	score += priceScore(a.Ad.Rent, b.Ad.Rent)
+
+	if a.HasText && b.HasText {
+		score += 0.3 * a.Signature.Similarity(b.Signature)
+	}
+
+	return math.Max(0, math.Min(1, score))
+}
+
+// Match reports whether two ads are likely the same property
+func Match(a Candidate, b Candidate) bool {
+	return Score(a, b) >= Threshold
+}
+
+func compatible(a Candidate, b Candidate) bool {
+	if a.Ad.ID != "" && a.Ad.ID == b.Ad.ID {
+		return false
+	}
+	if a.City != "" && b.City != "" && a.City != b.City {
+		return false
+	}
+	if a.Ad.CategoryType != "" && b.Ad.CategoryType != "" && a.Ad.CategoryType != b.Ad.CategoryType {
+		return false
+	}
+	if a.Ad.PropertyType != "" && b.Ad.PropertyType != "" && a.Ad.PropertyType != b.Ad.PropertyType {
+		return false
+	}
+	if a.Ad.Room > 0 && b.Ad.Room > 0 && a.Ad.Room != b.Ad.Room {
+		return false
+	}
+	// Area is the one size every listing has, without it there is nothing to compare
+	if a.Ad.Area <= 0 || b.Ad.Area <= 0 {
+		return false
+	}
+	return relativeDifference(a.Ad.Area, b.Ad.Area) <= maxAreaDifference
+}
+
+// priceScore rewards close prices and penalizes distant ones, a missing price says nothing
+func priceScore(a int, b int) float64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	switch difference := relativeDifference(a, b); {
+	case difference <= 0.05:
+		return 0.15
+	case difference <= 0.15:
+		return 0.08
+	case difference > 0.3:
+		return -0.2
+	}
+	return 0
+}
+
+func relativeDifference(a int, b int) float64 {
+	return math.Abs(float64(a-b)) / math.Max(float64(a), float64(b))
+}
+
+func hasCoordinates(ad models.Ads) bool {
+	return ad.Latitude != 0 || ad.Longitude != 0
+}
+
+// distanceMeters returns the great-circle distance between the locations of two ads
+func distanceMeters(a models.Ads, b models.Ads) float64 {
+	const earthRadius = 6371000
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,79 @@
+package dedup
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+)
+
+// signatureSize is the number of hash functions of a MinHash signature
+const signatureSize = 64
+
+// Signature is the MinHash signature of a text
+type Signature [signatureSize]uint64
+
+// seeds make the hash functions of a signature independent
+var seeds = func() [signatureSize]uint64 {
+	var seeds [signatureSize]uint64
+	state := uint64(0x9e3779b97f4a7c15)
+	for i := range seeds {
+		state = splitmix64(state)
+		seeds[i] = state
+	}
+	return seeds
+}()
+
+// Shingles returns the word pairs of a normalized text, or its words when it has a single word
+func Shingles(text string) []string {
+	words := strings.Fields(NormalizeText(text))
+	if len(words) < 2 {
+		return words
+	}
+	shingles := make([]string, 0, len(words)-1)
+	for i := 0; i+1 < len(words); i++ {
+		shingles = append(shingles, words[i]+" "+words[i+1])
+	}
+	return shingles
+}
+
+// MinHash returns the signature of a text, texts with many shared shingles get close signatures
+func MinHash(text string) (Signature, bool) {
+	var signature Signature
+	shingles := Shingles(text)
+	if len(shingles) == 0 {
+		return signature, false
+	}
+
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+	for _, shingle := range shingles {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(shingle))
+		base := hasher.Sum64()
+		for i, seed := range seeds {
+			if h := splitmix64(base ^ seed); h < signature[i] {
+				signature[i] = h
+			}
+		}
+	}
+	return signature, true
+}
+
+// Similarity estimates the Jaccard similarity of the shingles of two signed texts
+func (s Signature) Similarity(other Signature) float64 {
+	same := 0
+	for i := range s {
+		if s[i] == other[i] {
+			same++
+		}
+	}
+	return float64(same) / signatureSize
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
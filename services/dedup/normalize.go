@@ -0,0 +1,54 @@
+package dedup
+
+import (
+	"strings"
+	"unicode"
+)
+
+// persianReplacer maps Arabic letters and Persian and Arabic digits to one spelling
+var persianReplacer = strings.NewReplacer(
+	"ي", "ی", "ى", "ی", "ك", "ک", "ة", "ه", "ۀ", "ه",
+	"أ", "ا", "إ", "ا", "آ", "ا",
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4",
+	"۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4",
+	"٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+)
+
+// NormalizeText unifies the spelling of a Persian text and keeps only its words,
+// separated by single spaces
+func NormalizeText(text string) string {
+	text = strings.ToLower(persianReplacer.Replace(text))
+	return strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	}), " ")
+}
+
+// NormalizePlace returns the comparable form of a city or neighborhood name
+func NormalizePlace(name string) string {
+	name = NormalizeText(name)
+	for _, prefix := range []string{"شهر ", "محله "} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	return strings.ReplaceAll(name, " ", "")
+}
+
+// NormalizePhone returns a phone number as its national digits, 09121234567 for +98 912 123 4567
+func NormalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range persianReplacer.Replace(phone) {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	number := digits.String()
+	switch {
+	case strings.HasPrefix(number, "0098"):
+		number = "0" + number[4:]
+	case strings.HasPrefix(number, "98") && len(number) == 12:
+		number = "0" + number[2:]
+	case strings.HasPrefix(number, "9") && len(number) == 10:
+		number = "0" + number
+	}
+	return number
+}
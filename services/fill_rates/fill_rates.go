@@ -0,0 +1,204 @@
+package fill_rates
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Defaults used when the FILL_RATE_* settings are not set
+const (
+	defaultBaselineRuns = 5
+	defaultMinAds       = 20
+	defaultMaxDrop      = 30 // percentage points
+)
+
+// maxSamples is how many URLs of ads missing a field are kept
+const maxSamples = 3
+
+// ignoredFields are set by the database or the crawler, not parsed from the page.
+// Flags are left out too, false is a valid value for them.
+var ignoredFields = map[string]bool{
+	"ID":              true,
+	"Hash":            true,
+	"ClusterID":       true,
+	"CreatedAt":       true,
+	"LastSeenAt":      true,
+	"Status":          true,
+	"StatusChangedAt": true,
+	"LastCheckedAt":   true,
+	"VisitCount":      true,
+	"Reference":       true,
+	"URL":             true,
+}
+
+// Fields returns the fields of an ad whose fill rate is monitored
+func Fields() []string {
+	var fields []string
+	adType := reflect.TypeOf(models.Ads{})
+	for i := 0; i < adType.NumField(); i++ {
+		field := adType.Field(i)
+		if ignoredFields[field.Name] || field.Type.Kind() == reflect.Bool || field.Type.Kind() == reflect.Struct {
+			continue
+		}
+		fields = append(fields, field.Name)
+	}
+	return fields
+}
+
+// EmptyFields returns the monitored fields the scraper left empty in ad
+func EmptyFields(ad models.Ads) []string {
+	var empty []string
+	value := reflect.ValueOf(ad)
+	for _, field := range Fields() {
+		fieldValue := value.FieldByName(field)
+		if fieldValue.IsZero() || (fieldValue.Kind() == reflect.Slice && fieldValue.Len() == 0) {
+			empty = append(empty, field)
+		}
+	}
+	return empty
+}
+
+// Tally counts the empty fields of the ads a run saved, with a few URLs of ads missing each field
+type Tally struct {
+	Total   int
+	Empty   map[string]int
+	Samples map[string][]string
+}
+
+// Add counts the fields left empty in an ad found at url
+func (t *Tally) Add(url string, empty []string) {
+	t.Total++
+	for _, field := range empty {
+		if t.Empty == nil {
+			t.Empty = make(map[string]int)
+			t.Samples = make(map[string][]string)
+		}
+		t.Empty[field]++
+		if len(t.Samples[field]) < maxSamples {
+			t.Samples[field] = append(t.Samples[field], url)
+		}
+	}
+}
+
+// Merge adds the counts of another tally, like the one of a queue worker
+func (t *Tally) Merge(other Tally) {
+	t.Total += other.Total
+	for field, count := range other.Empty {
+		if t.Empty == nil {
+			t.Empty = make(map[string]int)
+			t.Samples = make(map[string][]string)
+		}
+		t.Empty[field] += count
+		for _, url := range other.Samples[field] {
+			if len(t.Samples[field]) < maxSamples {
+				t.Samples[field] = append(t.Samples[field], url)
+			}
+		}
+	}
+}
+
+// Rates returns the fill rate of every monitored field for a run
+func (t Tally) Rates(runID string) []models.FieldFillRate {
+	var rates []models.FieldFillRate
+	for _, field := range Fields() {
+		rates = append(rates, models.FieldFillRate{CrawlRunID: runID, Field: field, Filled: t.Total - t.Empty[field], Total: t.Total})
+	}
+	return rates
+}
+
+// Config sets when a drop of a fill rate is alerted
+type Config struct {
+	BaselineRuns int     // Previous runs averaged into the baseline
+	MinAds       int     // Runs that saved fewer ads are too small to compare
+	MaxDrop      float64 // Largest drop below the baseline, as a share, that is not alerted
+}
+
+// ConfigFromEnv reads FILL_RATE_BASELINE_RUNS, FILL_RATE_MIN_ADS and FILL_RATE_MAX_DROP (percentage points)
+func ConfigFromEnv() Config {
+	config := Config{BaselineRuns: defaultBaselineRuns, MinAds: defaultMinAds, MaxDrop: defaultMaxDrop / 100.0}
+	if runs, err := strconv.Atoi(os.Getenv("FILL_RATE_BASELINE_RUNS")); err == nil && runs > 0 {
+		config.BaselineRuns = runs
+	}
+	if minAds, err := strconv.Atoi(os.Getenv("FILL_RATE_MIN_ADS")); err == nil && minAds > 0 {
+		config.MinAds = minAds
+	}
+	if drop, err := strconv.Atoi(os.Getenv("FILL_RATE_MAX_DROP")); err == nil && drop > 0 && drop <= 100 {
+		config.MaxDrop = float64(drop) / 100
+	}
+	return config
+}
+
+// Drop is a field whose fill rate fell below the baseline of its source
+type Drop struct {
+	Field    string
+	Rate     float64
+	Baseline float64
+	Samples  []string // URLs of ads of the run missing the field
+}
+
+// Check stores the fill rates of a run and returns the fields whose rate fell more than MaxDrop
+// below their average over the previous runs of the same source and target, worst drop first
+func Check(db *gorm.DB, config Config, run models.CrawlRun, tally Tally) ([]Drop, error) {
+	if tally.Total == 0 {
+		return nil, nil
+	}
+	if err := repositories.SaveFieldFillRates(db, tally.Rates(run.ID)); err != nil {
+		return nil, err
+	}
+	if tally.Total < config.MinAds {
+		return nil, nil
+	}
+
+	previous, err := repositories.GetPreviousFillRates(db, run, config.BaselineRuns)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, rate := range previous {
+		// Small runs are too noisy for the baseline
+		if rate.Total < config.MinAds {
+			continue
+		}
+		sums[rate.Field] += rate.Rate()
+		counts[rate.Field]++
+	}
+
+	var drops []Drop
+	for _, rate := range tally.Rates(run.ID) {
+		if counts[rate.Field] == 0 {
+			continue
+		}
+		baseline := sums[rate.Field] / float64(counts[rate.Field])
+		if baseline-rate.Rate() > config.MaxDrop {
+			drops = append(drops, Drop{Field: rate.Field, Rate: rate.Rate(), Baseline: baseline, Samples: tally.Samples[rate.Field]})
+		}
+	}
+	sort.SliceStable(drops, func(i, j int) bool {
+		return drops[i].Baseline-drops[i].Rate > drops[j].Baseline-drops[j].Rate
+	})
+	return drops, nil
+}
+
+// FormatAlert describes the fill rate drops of a run for the super admin
+func FormatAlert(run models.CrawlRun, drops []Drop) string {
+	text := fmt.Sprintf("⚠️ Possible scraper breakage\nSource: %v\n", run.Reference)
+	if run.Target != "" {
+		text += fmt.Sprintf("Target: %v\n", run.Target)
+	}
+	text += fmt.Sprintf("Run: %v\nFields filled much less often than in previous runs:\n", run.ID)
+	for _, drop := range drops {
+		text += fmt.Sprintf("%v: %.0f%% (usually %.0f%%)\n", drop.Field, drop.Rate*100, drop.Baseline*100)
+		for _, url := range drop.Samples {
+			text += "  " + url + "\n"
+		}
+	}
+	return text
+}
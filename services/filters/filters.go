@@ -91,6 +91,16 @@ func GetAllFilters(db *gorm.DB, userID string, pageIndex, pageSize int) (Paginat
 	}, nil
 }
 
+// PropertyTypes maps the Persian property type of a filter to the property type of the ads
+var PropertyTypes = map[string]string{
+	"آپارتمانی": models.PropertyApartment,
+	"ویلایی":    models.PropertyVila,
+	"اداری":     models.PropertyOffice,
+	"مغازه":     models.PropertyShop,
+	"زمین":      models.PropertyLand,
+	"پیش‌فروش":  models.PropertyPresale,
+}
+
 func CreateOrUpdateFilter(db *gorm.DB, filter models.Filters) (string, error) {
 	// Step 1: Validate all fields
 	if err := validateFilterFields(filter); err != nil {
@@ -104,13 +114,8 @@ func CreateOrUpdateFilter(db *gorm.DB, filter models.Filters) (string, error) {
 		filter.CategoryType = ""
 	}
 
-	if filter.PropertyType == "آپارتمانی" {
-		filter.PropertyType = "apartment"
-	} else if filter.PropertyType == "ویلایی" {
-		filter.PropertyType = "vila"
-	} else {
-		filter.PropertyType = ""
-	}
+	// Unknown property types match every ad
+	filter.PropertyType = PropertyTypes[filter.PropertyType]
 
 	if filter.Reference == "دیوار" {
 		filter.Reference = "divar"
@@ -187,6 +192,9 @@ func validateFilterFields(filter models.Filters) error {
 	if err := validatePrice(filter.MinPrice, filter.MaxPrice); err != nil {
 		return err
 	}
+	if err := validateDeposit(filter.MinDeposit, filter.MaxDeposit); err != nil {
+		return err
+	}
 	if err := validateRent(filter.MinRent, filter.MaxRent); err != nil {
 		return err
 	}
@@ -196,6 +204,12 @@ func validateFilterFields(filter models.Filters) error {
 	if err := validateFloorNumber(filter.MinFloorNumber, filter.MaxFloorNumber); err != nil {
 		return err
 	}
+	if err := validateYearBuilt(filter.MinYearBuilt, filter.MaxYearBuilt); err != nil {
+		return err
+	}
+	if filter.MinParking < 0 {
+		return errors.New("parking count cannot be negative")
+	}
 	// Validate optional string fields only if they are provided
 	if filter.City != "" {
 		if err := validateCity(filter.City); err != nil {
@@ -307,6 +321,18 @@ func validatePrice(minPrice, maxPrice int) error {
 	return nil
 }
 
+func validateDeposit(minDeposit, maxDeposit int) error {
+	if minDeposit != 0 && maxDeposit != 0 {
+		if minDeposit < 0 || maxDeposit < 0 {
+			return errors.New("deposit values cannot be negative")
+		}
+		if minDeposit > maxDeposit {
+			return errors.New("minDeposit cannot be greater than maxDeposit")
+		}
+	}
+	return nil
+}
+
 func validateRent(minRent, maxRent int) error {
 	if minRent != 0 && maxRent != 0 {
 		if minRent < 0 || maxRent < 0 {
@@ -342,3 +368,15 @@ func validateFloorNumber(minFloor, maxFloor int) error {
 	}
 	return nil
 }
+
+func validateYearBuilt(minYear, maxYear int) error {
+	if minYear != 0 && maxYear != 0 {
+		if minYear < 0 || maxYear < 0 {
+			return errors.New("year built values cannot be negative")
+		}
+		if minYear > maxYear {
+			return errors.New("minYearBuilt cannot be greater than maxYearBuilt")
+		}
+	}
+	return nil
+}
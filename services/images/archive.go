@@ -0,0 +1,186 @@
+package images
+
+import (
+	"Crawlzilla/services/crawler/politeness"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config holds the settings of the image archive, an empty Dir disables it
+type Config struct {
+	Dir      string
+	MaxBytes int64
+	Timeout  time.Duration
+}
+
+// ConfigFromEnv reads IMAGE_ARCHIVE_DIR, IMAGE_MAX_SIZE_MB and IMAGE_DOWNLOAD_TIMEOUT (seconds)
+func ConfigFromEnv() Config {
+	config := Config{
+		Dir:      os.Getenv("IMAGE_ARCHIVE_DIR"),
+		MaxBytes: 10 << 20,
+		Timeout:  30 * time.Second,
+	}
+	if maxSize, err := strconv.Atoi(os.Getenv("IMAGE_MAX_SIZE_MB")); err == nil && maxSize > 0 {
+		config.MaxBytes = int64(maxSize) << 20
+	}
+	if timeout, err := strconv.Atoi(os.Getenv("IMAGE_DOWNLOAD_TIMEOUT")); err == nil && timeout > 0 {
+		config.Timeout = time.Duration(timeout) * time.Second
+	}
+	return config
+}
+
+// Archive keeps local copies of listing photos, addressed by the SHA-256 of their content,
+// so they can still be shown after the site removed them from its CDN
+type Archive struct {
+	dir      string
+	maxBytes int64
+	client   *http.Client
+}
+
+// Stored is an archived image
+type Stored struct {
+	SHA256 string
+	// PerceptualHash is the hex dHash of the picture, empty when the format can't be decoded
+	PerceptualHash string
+}
+
+// New creates an archive storing images under config.Dir
+func New(config Config) *Archive {
+	return &Archive{
+		dir:      config.Dir,
+		maxBytes: config.MaxBytes,
+		client:   &http.Client{Timeout: config.Timeout},
+	}
+}
+
+var (
+	defaultArchive *Archive
+	defaultOnce    sync.Once
+)
+
+// Default returns the archive configured from the environment, shared by the whole process
+func Default() *Archive {
+	defaultOnce.Do(func() {
+		defaultArchive = New(ConfigFromEnv())
+	})
+	return defaultArchive
+}
+
+// FromContext returns the archive stored in ctx as "image_archive", or the default one
+func FromContext(ctx context.Context) *Archive {
+	if archive, ok := ctx.Value("image_archive").(*Archive); ok && archive != nil {
+		return archive
+	}
+	return Default()
+}
+
+// Enabled reports whether images are archived
+func (a *Archive) Enabled() bool {
+	return a.dir != ""
+}
+
+// Path returns the file of an archived image
+func (a *Archive) Path(sha string) string {
+	return filepath.Join(a.dir, sha[:2], sha)
+}
+
+// Store downloads an image into the archive. An image that is already archived is not written again.
+func (a *Archive) Store(ctx context.Context, url string) (Stored, error) {
+	data, err := a.download(ctx, url)
+	if err != nil {
+		return Stored{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	stored := Stored{SHA256: hex.EncodeToString(sum[:])}
+	if err := a.write(stored.SHA256, data); err != nil {
+		return Stored{}, err
+	}
+
+	// Formats without a decoder, like webp, are archived without a perceptual hash
+	if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+		stored.PerceptualHash = FormatHash(DHash(img))
+	}
+	return stored, nil
+}
+
+// Read returns the content of an archived image
+func (a *Archive) Read(sha string) ([]byte, error) {
+	if !a.Enabled() || len(sha) < 2 {
+		return nil, fmt.Errorf("image %s is not archived", sha)
+	}
+	return os.ReadFile(a.Path(sha))
+}
+
+func (a *Archive) download(ctx context.Context, url string) ([]byte, error) {
+	// CDNs get the same politeness as the sites
+	polite := politeness.FromContext(ctx)
+	if err := polite.Wait(ctx, url); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := polite.Report(ctx, url, resp.StatusCode); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download of image %s failed with status %d", url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, a.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > a.maxBytes {
+		return nil, fmt.Errorf("image %s is larger than %d bytes", url, a.maxBytes)
+	}
+	return data, nil
+}
+
+// write stores data under its hash, through a temporary file so readers never see a partial image
+func (a *Archive) write(sha string, data []byte) error {
+	path := a.Path(sha)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), sha+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
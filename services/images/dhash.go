@@ -0,0 +1,75 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+// dHash compares the brightness of neighbouring cells on a 9x8 grid
+const (
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+// DHash returns the difference hash of an image. Resized or recompressed copies of
+// the same photo get the same or a close hash, compare hashes with Distance.
+func DHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+	var gray [hashHeight][hashWidth]float64
+	for y := 0; y < hashHeight; y++ {
+		y0, y1 := cellRange(bounds.Min.Y, bounds.Dy(), y, hashHeight)
+		for x := 0; x < hashWidth; x++ {
+			x0, x1 := cellRange(bounds.Min.X, bounds.Dx(), x, hashWidth)
+			gray[y][x] = averageLuminance(img, x0, x1, y0, y1)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance returns the number of differing bits of two hashes, 0 means the same picture
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// FormatHash returns the hex form of a hash stored on the image records
+func FormatHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// ParseHash reads a hash stored by FormatHash
+func ParseHash(hash string) (uint64, error) {
+	return strconv.ParseUint(hash, 16, 64)
+}
+
+// cellRange returns the pixel range of a grid cell, every cell covers at least one pixel
+func cellRange(min int, size int, cell int, cells int) (int, int) {
+	start := min + cell*size/cells
+	end := min + (cell+1)*size/cells
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+func averageLuminance(img image.Image, x0, x1, y0, y1 int) float64 {
+	var sum float64
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+		}
+	}
+	return sum / float64((x1-x0)*(y1-y0))
+}
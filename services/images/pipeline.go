@@ -0,0 +1,42 @@
+package images
+
+import (
+	"Crawlzilla/database/repositories"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ArchiveAdImages downloads the images of an ad that are not archived yet and records
+// their hashes. It returns how many images were archived, an image that fails is
+// left for the next crawl of the ad and its error is returned with the others.
+func ArchiveAdImages(ctx context.Context, db *gorm.DB, archive *Archive, adID string) (int, error) {
+	if !archive.Enabled() {
+		return 0, nil
+	}
+
+	images, err := repositories.GetUnarchivedAdImages(db, adID)
+	if err != nil {
+		return 0, err
+	}
+
+	archived := 0
+	var errs []error
+	for _, image := range images {
+		stored, err := archive.Store(ctx, image.URL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return archived, ctx.Err()
+			}
+			errs = append(errs, err)
+			continue
+		}
+		if err := repositories.SetAdImageArchive(db, image.ID, stored.SHA256, stored.PerceptualHash); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		archived++
+	}
+	return archived, errors.Join(errs...)
+}
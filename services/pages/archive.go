@@ -0,0 +1,157 @@
+package pages
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Config holds the settings of the page archive, an empty Dir disables it
+type Config struct {
+	Dir         string
+	Screenshots bool
+}
+
+// ConfigFromEnv reads PAGE_ARCHIVE_DIR and PAGE_ARCHIVE_SCREENSHOTS
+func ConfigFromEnv() Config {
+	return Config{
+		Dir:         os.Getenv("PAGE_ARCHIVE_DIR"),
+		Screenshots: strings.EqualFold(os.Getenv("PAGE_ARCHIVE_SCREENSHOTS"), "true"),
+	}
+}
+
+// Archive keeps the raw HTML of every scraped listing, gzipped and keyed by source,
+// crawl run and listing ID, so a wrong field can be traced to the page or to the parser
+// and the pages can be parsed again without loading them
+type Archive struct {
+	dir         string
+	screenshots bool
+}
+
+// New creates an archive storing pages under config.Dir
+func New(config Config) *Archive {
+	return &Archive{dir: config.Dir, screenshots: config.Screenshots}
+}
+
+var (
+	defaultArchive *Archive
+	defaultOnce    sync.Once
+)
+
+// Default returns the archive configured from the environment, shared by the whole process
+func Default() *Archive {
+	defaultOnce.Do(func() {
+		defaultArchive = New(ConfigFromEnv())
+	})
+	return defaultArchive
+}
+
+// FromContext returns the archive stored in ctx as "page_archive", or the default one
+func FromContext(ctx context.Context) *Archive {
+	if archive, ok := ctx.Value("page_archive").(*Archive); ok && archive != nil {
+		return archive
+	}
+	return Default()
+}
+
+// Enabled reports whether pages are archived
+func (a *Archive) Enabled() bool {
+	return a.dir != ""
+}
+
+// Screenshots reports whether a screenshot is archived with every page
+func (a *Archive) Screenshots() bool {
+	return a.Enabled() && a.screenshots
+}
+
+// Store writes the HTML, and the screenshot when there is one, of a listing scraped by a crawl run
+// and records it. page must have its run, reference and listing ID set.
+func (a *Archive) Store(db *gorm.DB, page *models.RawPage, html string, screenshot []byte) error {
+	if !a.Enabled() {
+		return nil
+	}
+	if page.CrawlRunID == "" || page.SourceListingID == "" {
+		return fmt.Errorf("page %s has no crawl run or listing ID", page.URL)
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write([]byte(html)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	base := filepath.Join(safeName(page.Reference), safeName(page.CrawlRunID), safeName(page.SourceListingID))
+	page.Path = base + ".html.gz"
+	page.Size = len(html)
+	if err := a.write(page.Path, compressed.Bytes()); err != nil {
+		return err
+	}
+	page.ScreenshotPath = ""
+	if len(screenshot) > 0 {
+		page.ScreenshotPath = base + ".jpg"
+		if err := a.write(page.ScreenshotPath, screenshot); err != nil {
+			return err
+		}
+	}
+	return repositories.SaveRawPage(db, page)
+}
+
+// Read returns the HTML of an archived page
+func (a *Archive) Read(page models.RawPage) (string, error) {
+	if !a.Enabled() || page.Path == "" {
+		return "", fmt.Errorf("page %s is not archived", page.URL)
+	}
+	file, err := os.Open(filepath.Join(a.dir, page.Path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	html, err := io.ReadAll(reader)
+	return string(html), err
+}
+
+// write stores data at path, through a temporary file so readers never see a partial page
+func (a *Archive) write(path string, data []byte) error {
+	path = filepath.Join(a.dir, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// safeName keeps a listing ID from escaping its directory
+func safeName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(name)
+}
@@ -0,0 +1,37 @@
+package search
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+
+	"gorm.io/gorm"
+)
+
+// getDuplicates returns the other ads of the cluster of every ad of a result page that has any
+func getDuplicates(db *gorm.DB, ads []models.Ads) (map[string][]models.Ads, error) {
+	var clusterIDs []string
+	for _, ad := range ads {
+		if ad.ClusterID != "" {
+			clusterIDs = append(clusterIDs, ad.ClusterID)
+		}
+	}
+
+	members, err := repositories.GetClusterMembers(db, clusterIDs)
+	if err != nil {
+		return nil, err
+	}
+	byCluster := make(map[string][]models.Ads)
+	for _, member := range members {
+		byCluster[member.ClusterID] = append(byCluster[member.ClusterID], member)
+	}
+
+	duplicates := make(map[string][]models.Ads)
+	for _, ad := range ads {
+		for _, member := range byCluster[ad.ClusterID] {
+			if ad.ClusterID != "" && member.ID != ad.ID {
+				duplicates[ad.ID] = append(duplicates[ad.ID], member)
+			}
+		}
+	}
+	return duplicates, nil
+}
@@ -0,0 +1,132 @@
+package search
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"slices"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// PriceChange summarizes how the price, deposit and rent of an ad moved since it was first seen
+type PriceChange struct {
+	FirstPrice     int     `json:"first_price"`
+	Price          int     `json:"price"`
+	PricePercent   float64 `json:"price_percent"` // Negative when the price dropped
+	FirstDeposit   int     `json:"first_deposit"`
+	Deposit        int     `json:"deposit"`
+	DepositPercent float64 `json:"deposit_percent"`
+	FirstRent      int     `json:"first_rent"`
+	Rent           int     `json:"rent"`
+	RentPercent    float64 `json:"rent_percent"`
+	PriceChanges   int     `json:"price_changes"`
+	DepositChanges int     `json:"deposit_changes"`
+	RentChanges    int     `json:"rent_changes"`
+}
+
+// Changed reports whether the price, deposit or rent ever changed
+func (c PriceChange) Changed() bool {
+	return c.PriceChanges > 0 || c.DepositChanges > 0 || c.RentChanges > 0
+}
+
+// AdHistory holds the recorded changes of an ad
+type AdHistory struct {
+	Revisions   []models.AdRevision `json:"revisions"`
+	PriceChange PriceChange         `json:"price_change"`
+}
+
+// GetAdHistory retrieves the changes recorded for an ad each time the crawler saw it again
+func GetAdHistory(db *gorm.DB, ad models.Ads) (AdHistory, error) {
+	revisions, err := repositories.GetAdRevisions(db, ad.ID)
+	if err != nil {
+		return AdHistory{}, err
+	}
+	return AdHistory{
+		Revisions:   revisions,
+		PriceChange: summarizePriceChange(ad, revisions),
+	}, nil
+}
+
+// getPriceChanges returns the price change of every ad of a result page whose price, deposit or rent changed
+func getPriceChanges(db *gorm.DB, ads []models.Ads) (map[string]PriceChange, error) {
+	adIDs := make([]string, 0, len(ads))
+	for _, ad := range ads {
+		adIDs = append(adIDs, ad.ID)
+	}
+	if len(adIDs) == 0 {
+		return nil, nil
+	}
+
+	priceRevisions, err := repositories.GetFieldRevisions(db, adIDs, "Price")
+	if err != nil {
+		return nil, err
+	}
+	// The deposit of rent ads used to be stored in their price, backfilled revisions moved with it
+	depositRevisions, err := repositories.GetFieldRevisions(db, adIDs, "Deposit")
+	if err != nil {
+		return nil, err
+	}
+	rentRevisions, err := repositories.GetFieldRevisions(db, adIDs, "Rent")
+	if err != nil {
+		return nil, err
+	}
+
+	revisionsByAd := make(map[string][]models.AdRevision)
+	for _, revision := range slices.Concat(priceRevisions, depositRevisions, rentRevisions) {
+		revisionsByAd[revision.AdID] = append(revisionsByAd[revision.AdID], revision)
+	}
+
+	changes := make(map[string]PriceChange)
+	for _, ad := range ads {
+		if revisions, ok := revisionsByAd[ad.ID]; ok {
+			changes[ad.ID] = summarizePriceChange(ad, revisions)
+		}
+	}
+	return changes, nil
+}
+
+// summarizePriceChange compares the current price, deposit and rent with the values of the first revision
+func summarizePriceChange(ad models.Ads, revisions []models.AdRevision) PriceChange {
+	change := PriceChange{
+		FirstPrice:   ad.Price,
+		Price:        ad.Price,
+		FirstDeposit: ad.Deposit,
+		Deposit:      ad.Deposit,
+		FirstRent:    ad.Rent,
+		Rent:         ad.Rent,
+	}
+
+	// Revisions are oldest first, so the first one holds the value the ad was first seen with
+	for _, revision := range revisions {
+		switch revision.Field {
+		case "Price":
+			if change.PriceChanges == 0 {
+				change.FirstPrice, _ = strconv.Atoi(revision.OldValue)
+			}
+			change.PriceChanges++
+		case "Deposit":
+			if change.DepositChanges == 0 {
+				change.FirstDeposit, _ = strconv.Atoi(revision.OldValue)
+			}
+			change.DepositChanges++
+		case "Rent":
+			if change.RentChanges == 0 {
+				change.FirstRent, _ = strconv.Atoi(revision.OldValue)
+			}
+			change.RentChanges++
+		}
+	}
+
+	change.PricePercent = percentChange(change.FirstPrice, change.Price)
+	change.DepositPercent = percentChange(change.FirstDeposit, change.Deposit)
+	change.RentPercent = percentChange(change.FirstRent, change.Rent)
+	return change
+}
+
+func percentChange(first int, current int) float64 {
+	if first == 0 {
+		return 0
+	}
+	return float64(current-first) * 100 / float64(first)
+}
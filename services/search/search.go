@@ -9,9 +9,11 @@ import (
 )
 
 type PaginatedAds struct {
-	Data  []models.Ads `json:"data"`  // Array of filtered ads
-	Pages int          `json:"pages"` // Total number of pages
-	Page  int          `json:"page"`  // Current page number
+	Data         []models.Ads            `json:"data"`          // Array of filtered ads
+	Pages        int                     `json:"pages"`         // Total number of pages
+	Page         int                     `json:"page"`          // Current page number
+	PriceChanges map[string]PriceChange  `json:"price_changes"` // Price movement of the ads whose price changed, by ad ID
+	Duplicates   map[string][]models.Ads `json:"duplicates"`    // Other listings of the same property by ad ID, when duplicates are collapsed
 }
 
 // GetFilteredAdsPaginatedService retrieves filtered ads with pagination, sorting, and filtering.
@@ -24,6 +26,9 @@ func GetFilteredAds(db *gorm.DB, filterID string, page, pageSize int) (Paginated
 
 	// Start building the query for ads
 	query := db.Model(&models.Ads{})
+	if !filter.IncludeInactive {
+		query = query.Where("status = ?", models.AdActive)
+	}
 	if filter.City != "" {
 		query = query.Where("city = ?", filter.City)
 	}
@@ -51,6 +56,12 @@ func GetFilteredAds(db *gorm.DB, filterID string, page, pageSize int) (Paginated
 	if filter.MaxPrice > 0 {
 		query = query.Where("price <= ?", filter.MaxPrice)
 	}
+	if filter.MinDeposit > 0 {
+		query = query.Where("deposit >= ?", filter.MinDeposit)
+	}
+	if filter.MaxDeposit > 0 {
+		query = query.Where("deposit <= ?", filter.MaxDeposit)
+	}
 	if filter.MinRent > 0 {
 		query = query.Where("rent >= ?", filter.MinRent)
 	}
@@ -69,6 +80,16 @@ func GetFilteredAds(db *gorm.DB, filterID string, page, pageSize int) (Paginated
 	if filter.MaxFloorNumber > 0 {
 		query = query.Where("floor_number <= ?", filter.MaxFloorNumber)
 	}
+	if filter.MinYearBuilt > 0 {
+		query = query.Where("year_built >= ?", filter.MinYearBuilt)
+	}
+	if filter.MaxYearBuilt > 0 {
+		// Ads with an unknown year built are left out
+		query = query.Where("year_built > 0 AND year_built <= ?", filter.MaxYearBuilt)
+	}
+	if filter.MinParking > 0 {
+		query = query.Where("parking_count >= ?", filter.MinParking)
+	}
 	if filter.HasElevator {
 		query = query.Where("has_elevator = ?", true)
 	}
@@ -81,15 +102,20 @@ func GetFilteredAds(db *gorm.DB, filterID string, page, pageSize int) (Paginated
 	if filter.HasBalcony {
 		query = query.Where("has_balcony = ?", true)
 	}
+	if filter.CollapseDuplicates {
+		query = repositories.CollapseClusters(query)
+	}
 
 	// Add sorting if specified in the filter
 	if filter.Sort != "" && filter.Order != "" {
 		validSortColumns := map[string]bool{
 			"price":        true,
+			"deposit":      true,
 			"rent":         true,
 			"area":         true,
 			"room":         true,
 			"floor_number": true,
+			"year_built":   true,
 			"visit_count":  true,
 			"created_at":   true,
 		}
@@ -120,14 +146,30 @@ func GetFilteredAds(db *gorm.DB, filterID string, page, pageSize int) (Paginated
 		return PaginatedAds{}, err
 	}
 
+	// Attach the price movement of the ads
+	priceChanges, err := getPriceChanges(db, ads)
+	if err != nil {
+		return PaginatedAds{}, err
+	}
+
+	// List the other sources of the collapsed ads
+	var duplicates map[string][]models.Ads
+	if filter.CollapseDuplicates {
+		if duplicates, err = getDuplicates(db, ads); err != nil {
+			return PaginatedAds{}, err
+		}
+	}
+
 	// Calculate total pages
 	totalPages := int((totalRecords + int64(pageSize) - 1) / int64(pageSize))
 
 	// Prepare the paginated response
 	result := PaginatedAds{
-		Data:  ads,
-		Pages: totalPages,
-		Page:  page,
+		Data:         ads,
+		Pages:        totalPages,
+		Page:         page,
+		PriceChanges: priceChanges,
+		Duplicates:   duplicates,
 	}
 
 	return result, nil
@@ -148,6 +190,9 @@ func GetMostFilteredAds(db *gorm.DB, page, pageSize int) (PaginatedAds, error) {
 
 	// Step 2: Build the ads query using the most-used filter
 	query := db.Model(&models.Ads{})
+	if !mostUsedFilter.IncludeInactive {
+		query = query.Where("status = ?", models.AdActive)
+	}
 	if mostUsedFilter.City != "" {
 		query = query.Where("city = ?", mostUsedFilter.City)
 	}
@@ -175,6 +220,12 @@ func GetMostFilteredAds(db *gorm.DB, page, pageSize int) (PaginatedAds, error) {
 	if mostUsedFilter.MaxPrice > 0 {
 		query = query.Where("price <= ?", mostUsedFilter.MaxPrice)
 	}
+	if mostUsedFilter.MinDeposit > 0 {
+		query = query.Where("deposit >= ?", mostUsedFilter.MinDeposit)
+	}
+	if mostUsedFilter.MaxDeposit > 0 {
+		query = query.Where("deposit <= ?", mostUsedFilter.MaxDeposit)
+	}
 	if mostUsedFilter.MinRent > 0 {
 		query = query.Where("rent >= ?", mostUsedFilter.MinRent)
 	}
@@ -193,6 +244,16 @@ func GetMostFilteredAds(db *gorm.DB, page, pageSize int) (PaginatedAds, error) {
 	if mostUsedFilter.MaxFloorNumber > 0 {
 		query = query.Where("floor_number <= ?", mostUsedFilter.MaxFloorNumber)
 	}
+	if mostUsedFilter.MinYearBuilt > 0 {
+		query = query.Where("year_built >= ?", mostUsedFilter.MinYearBuilt)
+	}
+	if mostUsedFilter.MaxYearBuilt > 0 {
+		// Ads with an unknown year built are left out
+		query = query.Where("year_built > 0 AND year_built <= ?", mostUsedFilter.MaxYearBuilt)
+	}
+	if mostUsedFilter.MinParking > 0 {
+		query = query.Where("parking_count >= ?", mostUsedFilter.MinParking)
+	}
 	if mostUsedFilter.HasElevator {
 		query = query.Where("has_elevator = ?", true)
 	}
@@ -205,6 +266,9 @@ func GetMostFilteredAds(db *gorm.DB, page, pageSize int) (PaginatedAds, error) {
 	if mostUsedFilter.HasBalcony {
 		query = query.Where("has_balcony = ?", true)
 	}
+	if mostUsedFilter.CollapseDuplicates {
+		query = repositories.CollapseClusters(query)
+	}
 
 	// Step 3: Count total records matching the most-used filter
 	totalRecords, err := repositories.CountFilteredAds(db, query)
@@ -218,14 +282,30 @@ func GetMostFilteredAds(db *gorm.DB, page, pageSize int) (PaginatedAds, error) {
 		return PaginatedAds{}, err
 	}
 
-	// Step 5: Calculate total pages
+	// Step 5: Attach the price movement of the ads
+	priceChanges, err := getPriceChanges(db, ads)
+	if err != nil {
+		return PaginatedAds{}, err
+	}
+
+	// Step 6: List the other sources of the collapsed ads
+	var duplicates map[string][]models.Ads
+	if mostUsedFilter.CollapseDuplicates {
+		if duplicates, err = getDuplicates(db, ads); err != nil {
+			return PaginatedAds{}, err
+		}
+	}
+
+	// Step 7: Calculate total pages
 	totalPages := int((totalRecords + int64(pageSize) - 1) / int64(pageSize))
 
-	// Step 6: Prepare the paginated response
+	// Step 8: Prepare the paginated response
 	result := PaginatedAds{
-		Data:  ads,
-		Pages: totalPages,
-		Page:  page,
+		Data:         ads,
+		Pages:        totalPages,
+		Page:         page,
+		PriceChanges: priceChanges,
+		Duplicates:   duplicates,
 	}
 
 	return result, nil
@@ -3,6 +3,7 @@ package super_admin
 import (
 	"Crawlzilla/database/repositories"
 	"Crawlzilla/models"
+	"Crawlzilla/services/filters"
 	"Crawlzilla/utils"
 	"errors"
 	"fmt"
@@ -98,7 +99,7 @@ func validateCategory(categoryType string) error {
 
 // validateCategory checks if the category is valid
 func validateProperty(propertyType string) error {
-	if propertyType != "آپارتمانی" && propertyType != "ویلایی" {
+	if _, ok := filters.PropertyTypes[propertyType]; !ok {
 		return errors.New("property type is wrong")
 	}
 	return nil
@@ -152,12 +153,12 @@ func CreateAd(database *gorm.DB, result *models.Ads) error {
 		result.CategoryType = "sell"
 	} else {
 		result.CategoryType = "rent"
+		// The price of a rent ad is its deposit
+		if result.Deposit == 0 {
+			result.Deposit, result.Price = result.Price, 0
+		}
 	}
-	if result.PropertyType == "آپارتمانی" {
-		result.PropertyType = "house"
-	} else {
-		result.PropertyType = "vila"
-	}
+	result.PropertyType = filters.PropertyTypes[result.PropertyType]
 
 	if _, err := repositories.CreateAd(database, result); err != nil {
 		log.Printf("Failed to add data: %v", err)
@@ -3,6 +3,7 @@ package tests
 import (
 	"Crawlzilla/models"
 	"testing"
+	"time"
 
 	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
@@ -27,16 +28,18 @@ func SetupTestDB() *gorm.DB {
 	return db
 }
 
-// TestCreateAdWithHash tests adding unique and duplicate Ads records and the Hash field
+// TestCreateAdWithHash tests the listing key and the content Hash of Ads records
 func TestCreateAdWithHash(t *testing.T) {
 	// Initialize test database
 	database := SetupTestDB()
 
 	// First Ads entry
 	entry1 := &models.Ads{
-		Title:       "Sample Name",
-		URL:         "http://example.com/item1",
-		Description: "Sample Description",
+		Title:           "Sample Name",
+		URL:             "http://example.com/item1",
+		Description:     "Sample Description",
+		Reference:       "divar",
+		SourceListingID: "item1",
 	}
 	err := database.Create(entry1).Error
 	assert.NoError(t, err)
@@ -50,24 +53,37 @@ func TestCreateAdWithHash(t *testing.T) {
 	var firstRecord models.Ads
 	database.First(&firstRecord)
 	assert.NotEmpty(t, firstRecord.Hash, "Hash should be set for the first record")
+	assert.False(t, firstRecord.LastSeenAt.IsZero(), "LastSeenAt should be set for the first record")
 
-	// Second Ads entry with the same URL, Title, and Description (should trigger duplicate hash)
+	// Second Ads entry of the same listing (should violate the listing key)
 	entry2 := &models.Ads{
-		Title:       "Sample Name",              // Same as entry1
-		URL:         "http://example.com/item1", // Same URL as entry1
-		Description: "Sample Description",       // Same Description as entry1
+		Title:           "Sample Name",
+		URL:             "http://example.com/item1",
+		Description:     "Changed Description",
+		Reference:       "divar",
+		SourceListingID: "item1",
 	}
 	err = database.Create(entry2).Error
-	assert.Error(t, err, "Duplicate record should not be inserted due to unique constraint on Hash")
+	assert.Error(t, err, "Duplicate record should not be inserted due to unique constraint on the listing key")
 
-	// Verify that the duplicate was not inserted based on the hash
+	// Verify that the duplicate was not inserted
 	database.Model(&models.Ads{}).Count(&count)
-	assert.Equal(t, int64(1), count, "Duplicate record should not be inserted based on hash")
+	assert.Equal(t, int64(1), count, "Duplicate listing should not be inserted")
 
-	// Verify that the hash of the second entry is the same as the first entry
-	var secondRecord models.Ads
-	database.Last(&secondRecord)
-	assert.Equal(t, firstRecord.Hash, secondRecord.Hash, "Hashes of the two records should be the same")
+	// The hash follows the content, not the database fields
+	same := *entry1
+	same.VisitCount = 10
+	same.LastSeenAt = time.Now().Add(time.Hour)
+	assert.Equal(t, firstRecord.Hash, same.ContentHash(), "Visits should not change the hash")
+	same.Price = 100
+	assert.NotEqual(t, firstRecord.Hash, same.ContentHash(), "A price change should change the hash")
+
+	// Ads without a listing ID, like admin ads, are their own listing
+	admin1 := &models.Ads{Title: "Admin Ad", Reference: "admin"}
+	admin2 := &models.Ads{Title: "Admin Ad", Reference: "admin"}
+	assert.NoError(t, database.Create(admin1).Error)
+	assert.NoError(t, database.Create(admin2).Error)
+	assert.Equal(t, admin1.ID, admin1.SourceListingID)
 
 	// Clean up test database
 	database.Exec("DROP TABLE ads")
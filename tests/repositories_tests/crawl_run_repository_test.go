@@ -0,0 +1,59 @@
+package repositories_tests
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestGetLastCrawlRuns(t *testing.T) {
+	db := SetupTestDB()
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, reference := range []string{"divar", "sheypoor", "divar", "divar"} {
+		run := models.CrawlRun{Reference: reference, Status: models.CheckpointFinished, StartedAt: start.Add(time.Duration(i) * time.Hour), InsertedCount: i}
+		assert.NoError(t, repositories.CreateCrawlRun(db, &run))
+	}
+
+	runs, err := repositories.GetLastCrawlRuns(db, "", 3)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 3)
+	assert.Equal(t, 3, runs[0].InsertedCount)
+	assert.Equal(t, "sheypoor", runs[2].Reference)
+
+	runs, err = repositories.GetLastCrawlRuns(db, "divar", 10)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 3)
+
+	// The previous run is the latest earlier run of the same source
+	previous, err := repositories.GetPreviousCrawlRun(db, runs[1])
+	assert.NoError(t, err)
+	assert.Equal(t, 0, previous.InsertedCount)
+
+	_, err = repositories.GetPreviousCrawlRun(db, runs[2])
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestSaveCrawlRun(t *testing.T) {
+	db := SetupTestDB()
+
+	run := models.CrawlRun{Reference: "divar", Status: models.CheckpointRunning, StartedAt: time.Now()}
+	assert.NoError(t, repositories.CreateCrawlRun(db, &run))
+
+	run.Status = models.CheckpointFinished
+	run.FinishedAt = run.StartedAt.Add(2 * time.Minute)
+	run.SetFailures(map[models.FailureKind]int{models.FailureTimeout: 2, models.FailureParse: 1})
+	assert.NoError(t, repositories.SaveCrawlRun(db, &run))
+
+	var stored models.CrawlRun
+	assert.NoError(t, db.First(&stored, "id = ?", run.ID).Error)
+	assert.Equal(t, models.CheckpointFinished, stored.Status)
+	assert.Equal(t, 3, stored.FailedCount)
+	assert.Equal(t, 2, stored.Failures()[models.FailureTimeout])
+	assert.Equal(t, 1, stored.Failures()[models.FailureParse])
+	assert.Equal(t, 0, stored.Failures()[models.FailureDatabase])
+}
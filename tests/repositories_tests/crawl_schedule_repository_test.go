@@ -0,0 +1,43 @@
+package repositories_tests
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestCrawlScheduleRepository(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE crawl_schedules;")
+
+	schedules := []models.CrawlSchedule{
+		{Reference: "sheypoor", Spec: "@daily", Enabled: true},
+		{Reference: "divar", Spec: "0 3 * * *", Enabled: true},
+		{Reference: "divar", TargetID: "target", Spec: "@every 6h", Enabled: false},
+	}
+	for i := range schedules {
+		assert.NoError(t, repositories.CreateCrawlSchedule(db, &schedules[i]))
+	}
+
+	enabled, err := repositories.GetEnabledCrawlSchedules(db)
+	assert.NoError(t, err)
+	assert.Len(t, enabled, 2)
+	assert.Equal(t, "divar", enabled[0].Reference)
+
+	assert.NoError(t, repositories.UpdateCrawlSchedule(db, schedules[2].ID, "@every 12h", true))
+	stored, err := repositories.GetCrawlScheduleByID(db, schedules[2].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "@every 12h", stored.Spec)
+	assert.True(t, stored.Enabled)
+
+	assert.NoError(t, repositories.DeleteCrawlSchedulesOfTarget(db, "target"))
+	assert.ErrorIs(t, repositories.DeleteCrawlSchedule(db, schedules[2].ID), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repositories.UpdateCrawlSchedule(db, schedules[2].ID, "@daily", true), gorm.ErrRecordNotFound)
+
+	all, err := repositories.GetCrawlSchedules(db)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+}
@@ -0,0 +1,52 @@
+package repositories_tests
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestGetDueCrawlTargets(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE crawl_targets;")
+
+	lastRun := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	targets := []models.CrawlTarget{
+		{Reference: "divar", City: "tehran", Category: "buy-apartment", Enabled: true, LastRunAt: lastRun.Add(time.Hour)},
+		{Reference: "divar", City: "shiraz", Category: "buy-apartment", Enabled: true, LastRunAt: lastRun},
+		{Reference: "divar", City: "tabriz", Category: "buy-apartment", Enabled: true},
+		{Reference: "divar", City: "mashhad", Category: "buy-apartment", Enabled: false},
+		{Reference: "sheypoor", City: "tehran", Category: "villa-for-sale", Enabled: true},
+	}
+	for i := range targets {
+		assert.NoError(t, repositories.CreateCrawlTarget(db, &targets[i]))
+	}
+
+	// Never crawled targets go first, then the one crawled longest ago
+	due, err := repositories.GetDueCrawlTargets(db, "divar")
+	assert.NoError(t, err)
+	assert.Len(t, due, 3)
+	assert.Equal(t, "tabriz", due[0].City)
+	assert.Equal(t, "shiraz", due[1].City)
+	assert.Equal(t, "tehran", due[2].City)
+
+	count, err := repositories.CountCrawlTargets(db, "divar")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+
+	assert.NoError(t, repositories.MarkCrawlTargetRun(db, due[0].ID, lastRun.Add(2*time.Hour)))
+	assert.NoError(t, repositories.SetCrawlTargetEnabled(db, targets[3].ID, true))
+	due, err = repositories.GetDueCrawlTargets(db, "divar")
+	assert.NoError(t, err)
+	assert.Len(t, due, 4)
+	assert.Equal(t, "mashhad", due[0].City)
+	assert.Equal(t, "tabriz", due[3].City)
+
+	assert.NoError(t, repositories.DeleteCrawlTarget(db, targets[4].ID))
+	assert.ErrorIs(t, repositories.DeleteCrawlTarget(db, targets[4].ID), gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, repositories.SetCrawlTargetEnabled(db, targets[4].ID, false), gorm.ErrRecordNotFound)
+}
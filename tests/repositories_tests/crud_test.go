@@ -3,8 +3,10 @@ package repositories_tests
 import (
 	"Crawlzilla/database/repositories"
 	"Crawlzilla/models"
+	"Crawlzilla/utils"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
@@ -22,7 +24,7 @@ func SetupTestDB() *gorm.DB {
 	}
 
 	// Run AutoMigrate to create the Ads table
-	if err := db.AutoMigrate(&models.Ads{}, &models.Users{}, &models.Filters{}); err != nil {
+	if err := db.AutoMigrate(&models.Ads{}, &models.Users{}, &models.Filters{}, &models.AdRevision{}, &models.Frontier{}, &models.Checkpoint{}, &models.DeadLetter{}, &models.CrawlRun{}, &models.AdImage{}, &models.CrawlTarget{}, &models.CrawlSchedule{}, &models.RawPage{}, &models.FieldFillRate{}); err != nil {
 		panic("failed to migrate database schema")
 	}
 
@@ -43,14 +45,290 @@ func TestCreateAd(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, id)
 
-	// Test case 2: Attempt to add a duplicate ad
+	// Test case 2: Ads without a listing ID are never matched, so an identical one is a new ad
 	adDuplicate := models.Ads{
 		Title: ad.Title,
-		// Hash:  ad.Hash, // Manually set to the same hash to simulate duplication
 	}
-	_, err = repositories.CreateAd(db, &adDuplicate)
-	assert.Error(t, err)
-	assert.Equal(t, "cant't add to database", err.Error())
+	duplicateID, err := repositories.CreateAd(db, &adDuplicate)
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, duplicateID)
+}
+
+func TestUpsertAd(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE ads;")
+
+	ad := models.Ads{Title: "Sample Ad", Reference: "divar", SourceListingID: "wZ10kKqk", Price: 1000}
+	id, saved, err := repositories.UpsertAd(db, &ad)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdInserted, saved)
+
+	var stored models.Ads
+	assert.NoError(t, db.First(&stored, "id = ?", id).Error)
+	firstSeen := stored.LastSeenAt
+
+	// Visits don't change the listing
+	_, err = repositories.GetAdByID(db, id)
+	assert.NoError(t, err)
+
+	// Scraping the same listing again only bumps LastSeenAt
+	time.Sleep(10 * time.Millisecond)
+	again := models.Ads{Title: "Sample Ad", Reference: "divar", SourceListingID: "wZ10kKqk", Price: 1000}
+	againID, saved, err := repositories.UpsertAd(db, &again)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUnchanged, saved)
+	assert.Equal(t, id, againID)
+
+	assert.NoError(t, db.First(&stored, "id = ?", id).Error)
+	assert.True(t, stored.LastSeenAt.After(firstSeen))
+
+	// A changed price updates the stored ad instead of adding a new one
+	changed := models.Ads{Title: "Sample Ad", Reference: "divar", SourceListingID: "wZ10kKqk", Price: 900}
+	changedID, saved, err := repositories.UpsertAd(db, &changed)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUpdated, saved)
+	assert.Equal(t, id, changedID)
+
+	assert.NoError(t, db.First(&stored, "id = ?", id).Error)
+	assert.Equal(t, 900, stored.Price)
+	assert.Equal(t, 1, stored.VisitCount, "visits are kept on update")
+
+	// The same listing ID on another site is another listing
+	other := models.Ads{Title: "Sample Ad", Reference: "sheypoor", SourceListingID: "wZ10kKqk", Price: 900}
+	otherID, saved, err := repositories.UpsertAd(db, &other)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdInserted, saved)
+	assert.NotEqual(t, id, otherID)
+
+	var count int64
+	db.Model(&models.Ads{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestUpsertAdRace(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE ads;")
+
+	// Another worker stores the listing right before this one inserts it
+	raced := false
+	db.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.(*models.Ads); !ok || raced {
+			return
+		}
+		raced = true
+		other := models.Ads{Title: "Sample Ad", Price: 1000, Reference: "divar", SourceListingID: "wZ10kKqk"}
+		assert.NoError(t, tx.Session(&gorm.Session{NewDB: true}).Create(&other).Error)
+	})
+
+	ad := models.Ads{Title: "Sample Ad", Price: 900, Reference: "divar", SourceListingID: "wZ10kKqk"}
+	_, saved, err := repositories.UpsertAd(db, &ad)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUpdated, saved)
+	var stored []models.Ads
+	db.Where("source_listing_id = ?", "wZ10kKqk").Find(&stored)
+	if assert.Len(t, stored, 1) {
+		assert.Equal(t, 900, stored[0].Price)
+	}
+
+	// A failed insert returns the database error
+	db.Exec("DROP TABLE ads;")
+	_, _, err = repositories.UpsertAd(db, &models.Ads{Title: "Sample Ad", Reference: "divar", SourceListingID: "hQ3mTx8r"})
+	assert.ErrorContains(t, err, "no such table")
+}
+
+func TestUpsertAdKeepsYearBuiltFromAge(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE ads;")
+
+	now := time.Now()
+	ad := models.Ads{Title: "Sample Ad", Reference: "sheypoor", SourceListingID: "438412345", YearBuilt: utils.YearBuiltFromAge(5, now), AgeBasedYear: true}
+	id, _, err := repositories.UpsertAdSeenAt(db, &ad, now)
+	assert.NoError(t, err)
+
+	// A year later the listing still says 5 years old, it is the same building
+	nextYear := now.AddDate(1, 0, 0)
+	again := models.Ads{Title: "Sample Ad", Reference: "sheypoor", SourceListingID: "438412345", YearBuilt: utils.YearBuiltFromAge(5, nextYear), AgeBasedYear: true}
+	_, saved, err := repositories.UpsertAdSeenAt(db, &again, nextYear)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUnchanged, saved)
+
+	var stored models.Ads
+	assert.NoError(t, db.First(&stored, "id = ?", id).Error)
+	assert.Equal(t, utils.YearBuiltFromAge(5, now), stored.YearBuilt)
+	var revisions int64
+	db.Model(&models.AdRevision{}).Where("ad_id = ?", id).Count(&revisions)
+	assert.Zero(t, revisions)
+
+	// A changed age is a changed listing
+	older := models.Ads{Title: "Sample Ad", Reference: "sheypoor", SourceListingID: "438412345", YearBuilt: utils.YearBuiltFromAge(6, nextYear), AgeBasedYear: true}
+	_, saved, err = repositories.UpsertAdSeenAt(db, &older, nextYear)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUpdated, saved)
+	assert.NoError(t, db.First(&stored, "id = ?", id).Error)
+	assert.Equal(t, utils.YearBuiltFromAge(6, now), stored.YearBuilt)
+}
+
+func TestUpsertAdImages(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE ads;")
+
+	ad := models.Ads{Title: "Sample Ad", Reference: "divar", SourceListingID: "gallery1"}
+	ad.SetImages([]string{"https://example.com/a.jpg", "https://example.com/b.jpg", "https://example.com/a.jpg"})
+	assert.Equal(t, "https://example.com/a.jpg", ad.ImageURL)
+	id, saved, err := repositories.UpsertAd(db, &ad)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdInserted, saved)
+
+	stored, err := repositories.GetAdByID(db, id)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/a.jpg", "https://example.com/b.jpg"}, stored.ImageURLs())
+
+	// The same gallery leaves the ad unchanged
+	again := models.Ads{Title: "Sample Ad", Reference: "divar", SourceListingID: "gallery1"}
+	again.SetImages([]string{"https://example.com/a.jpg", "https://example.com/b.jpg"})
+	_, saved, err = repositories.UpsertAd(db, &again)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUnchanged, saved)
+
+	// A new gallery replaces the stored one in its new order
+	changed := models.Ads{Title: "Sample Ad", Reference: "divar", SourceListingID: "gallery1"}
+	changed.SetImages([]string{"https://example.com/c.jpg", "https://example.com/a.jpg"})
+	_, saved, err = repositories.UpsertAd(db, &changed)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUpdated, saved)
+
+	stored, err = repositories.GetAdByID(db, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/c.jpg", stored.ImageURL)
+	assert.Equal(t, []string{"https://example.com/c.jpg", "https://example.com/a.jpg"}, stored.ImageURLs())
+
+	var count int64
+	db.Model(&models.AdImage{}).Where("ad_id = ?", id).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestBackfillSourceListingIDs(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE ads;")
+
+	// Two copies of the same listing stored by the old hash dedup, without listing IDs
+	old := models.Ads{Title: "Old copy", Reference: "divar", URL: "https://divar.ir/v/apartment/wZ10kKqk"}
+	assert.NoError(t, db.Create(&old).Error)
+	newer := models.Ads{Title: "New copy", Reference: "divar", URL: "https://divar.ir/v/apartment/wZ10kKqk", CreatedAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, db.Create(&newer).Error)
+	db.Model(&models.Ads{}).Where("1 = 1").UpdateColumn("source_listing_id", nil)
+
+	filled, err := repositories.BackfillSourceListingIDs(db, utils.ExtractSourceListingID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, filled)
+
+	var stored models.Ads
+	assert.NoError(t, db.First(&stored, "source_listing_id = ?", "wZ10kKqk").Error)
+	assert.Equal(t, "New copy", stored.Title)
+}
+
+func TestBackfillDeposits(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE ads;")
+	defer db.Exec("DELETE FROM filters;")
+	defer db.Exec("DELETE FROM ad_revisions;")
+
+	// Rent ads stored their deposit in the price and sheypoor apartments were "house"
+	rent := models.Ads{Title: "Rent", Reference: "sheypoor", CategoryType: "rent", PropertyType: "house", Price: 50000000, Rent: 6000000}
+	assert.NoError(t, db.Create(&rent).Error)
+	sell := models.Ads{Title: "Sell", Reference: "divar", CategoryType: "sell", PropertyType: models.PropertyApartment, Price: 8500000000}
+	assert.NoError(t, db.Create(&sell).Error)
+	revision := models.AdRevision{AdID: rent.ID, Field: "Price", OldValue: "40000000", NewValue: "50000000"}
+	assert.NoError(t, db.Create(&revision).Error)
+	filter := models.Filters{Title: "Rent", CategoryType: "rent", MinPrice: 10000000, MaxPrice: 90000000}
+	assert.NoError(t, db.Create(&filter).Error)
+
+	moved, err := repositories.BackfillDeposits(db)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), moved)
+
+	var stored models.Ads
+	assert.NoError(t, db.First(&stored, "id = ?", rent.ID).Error)
+	assert.Equal(t, 0, stored.Price)
+	assert.Equal(t, 50000000, stored.Deposit)
+	assert.Equal(t, models.PropertyApartment, stored.PropertyType)
+	var storedSell models.Ads
+	assert.NoError(t, db.First(&storedSell, "id = ?", sell.ID).Error)
+	assert.Equal(t, 8500000000, storedSell.Price)
+	assert.Equal(t, 0, storedSell.Deposit)
+
+	var storedRevision models.AdRevision
+	assert.NoError(t, db.First(&storedRevision, "id = ?", revision.ID).Error)
+	assert.Equal(t, "Deposit", storedRevision.Field)
+
+	var storedFilter models.Filters
+	assert.NoError(t, db.First(&storedFilter, "id = ?", filter.ID).Error)
+	assert.Equal(t, 0, storedFilter.MinPrice)
+	assert.Equal(t, 10000000, storedFilter.MinDeposit)
+	assert.Equal(t, 90000000, storedFilter.MaxDeposit)
+
+	// Running it again moves nothing
+	moved, err = repositories.BackfillDeposits(db)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), moved)
+}
+
+func TestTouchListing(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE ads;")
+
+	lastSeen := time.Now().Add(-24 * time.Hour)
+	ad := models.Ads{Title: "Known", Reference: "divar", URL: "https://divar.ir/v/apartment/wZ10kKqk", SourceListingID: "wZ10kKqk", LastSeenAt: lastSeen}
+	assert.NoError(t, db.Create(&ad).Error)
+
+	known, err := repositories.TouchListing(db, "divar", "wZ10kKqk")
+	assert.NoError(t, err)
+	assert.True(t, known)
+
+	var stored models.Ads
+	assert.NoError(t, db.First(&stored, "id = ?", ad.ID).Error)
+	assert.True(t, stored.LastSeenAt.After(lastSeen))
+
+	// The same listing ID on another site is a different listing
+	known, err = repositories.TouchListing(db, "sheypoor", "wZ10kKqk")
+	assert.NoError(t, err)
+	assert.False(t, known)
+}
+
+func TestUpdateAdStatus(t *testing.T) {
+	db := SetupTestDB()
+	defer db.Exec("DROP TABLE ads;")
+
+	ad := models.Ads{Title: "Listing", Reference: "divar", SourceListingID: "wZ10kKqk"}
+	id, err := repositories.CreateAd(db, &ad)
+	assert.NoError(t, err)
+
+	due, err := repositories.GetAdsToRevalidate(db, "divar", time.Now(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+
+	// Still active, only the visit is recorded
+	checkedAt := time.Now()
+	assert.NoError(t, repositories.UpdateAdStatus(db, id, models.AdActive, checkedAt))
+	stored, err := repositories.GetAdByID(db, id)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AdActive, stored.Status)
+	assert.True(t, stored.StatusChangedAt.Before(checkedAt))
+
+	due, err = repositories.GetAdsToRevalidate(db, "divar", checkedAt.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, due)
+
+	// Expired ads are not checked again
+	assert.NoError(t, repositories.UpdateAdStatus(db, id, models.AdExpired, checkedAt.Add(time.Minute)))
+	stored, err = repositories.GetAdByID(db, id)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AdExpired, stored.Status)
+	assert.True(t, stored.StatusChangedAt.Equal(checkedAt.Add(time.Minute)))
+
+	due, err = repositories.GetAdsToRevalidate(db, "divar", time.Now().Add(time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, due)
 }
 
 func TestGetAllAds(t *testing.T) {
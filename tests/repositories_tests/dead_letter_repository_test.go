@@ -0,0 +1,82 @@
+package repositories_tests
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddDeadLetter(t *testing.T) {
+	db := SetupTestDB()
+
+	letter := models.DeadLetter{Reference: "divar", URL: "https://divar.ir/v/a", Kind: models.FailureTimeout, Error: "deadline", Attempts: 3}
+	assert.NoError(t, repositories.AddDeadLetter(db, &letter))
+
+	// Failing again updates the letter and adds up the attempts
+	again := models.DeadLetter{Reference: "divar", URL: "https://divar.ir/v/a", Kind: models.FailureParse, Error: "city not found", Attempts: 1}
+	assert.NoError(t, repositories.AddDeadLetter(db, &again))
+	assert.Equal(t, letter.ID, again.ID)
+
+	other := models.DeadLetter{Reference: "sheypoor", URL: "https://www.sheypoor.com/v/b.html", Kind: models.FailureParse, Attempts: 1}
+	assert.NoError(t, repositories.AddDeadLetter(db, &other))
+
+	letters, total, err := repositories.GetDeadLetters(db, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, letters, 2)
+
+	var stored models.DeadLetter
+	assert.NoError(t, db.First(&stored, "id = ?", letter.ID).Error)
+	assert.Equal(t, models.FailureParse, stored.Kind)
+	assert.Equal(t, 4, stored.Attempts)
+
+	counts, err := repositories.CountDeadLettersByKind(db)
+	assert.NoError(t, err)
+	assert.Equal(t, map[models.FailureKind]int64{models.FailureParse: 2}, counts)
+
+	assert.NoError(t, repositories.RemoveDeadLetter(db, "sheypoor", "https://www.sheypoor.com/v/b.html"))
+	_, total, err = repositories.GetDeadLetters(db, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+}
+
+func TestRequeueDeadLetter(t *testing.T) {
+	db := SetupTestDB()
+
+	// A failed frontier entry and a letter that has none
+	failed := models.Frontier{Reference: "divar", URL: "https://divar.ir/v/a", Status: models.FrontierFailed, Attempts: 3, LastError: "deadline"}
+	assert.NoError(t, db.Create(&failed).Error)
+	letter := models.DeadLetter{Reference: "divar", URL: "https://divar.ir/v/a", Kind: models.FailureTimeout, Attempts: 3}
+	assert.NoError(t, repositories.AddDeadLetter(db, &letter))
+	orphan := models.DeadLetter{Reference: "sheypoor", URL: "https://www.sheypoor.com/v/b.html", Category: "villa-for-sale", Kind: models.FailureParse, Attempts: 1}
+	assert.NoError(t, repositories.AddDeadLetter(db, &orphan))
+
+	requeued, err := repositories.RequeueDeadLetter(db, letter.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://divar.ir/v/a", requeued.URL)
+
+	pending, err := repositories.GetFrontierByStatus(db, "divar", models.FrontierPending)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 0, pending[0].Attempts)
+	assert.Empty(t, pending[0].LastError)
+
+	// A letter can only be re-queued once
+	_, err = repositories.RequeueDeadLetter(db, letter.ID)
+	assert.Error(t, err)
+
+	count, err := repositories.RequeueAllDeadLetters(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	pending, err = repositories.GetFrontierByStatus(db, "sheypoor", models.FrontierPending)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "villa-for-sale", pending[0].Category)
+
+	_, total, err := repositories.GetDeadLetters(db, 0, 10)
+	assert.NoError(t, err)
+	assert.Zero(t, total)
+}
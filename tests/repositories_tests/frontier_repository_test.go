@@ -0,0 +1,84 @@
+package repositories_tests
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddToFrontier(t *testing.T) {
+	db := SetupTestDB()
+	runStart := time.Now().Add(-time.Minute)
+
+	// A new URL is queued as pending
+	added, err := repositories.AddToFrontier(db, &models.Frontier{Reference: "divar", URL: "https://divar.ir/v/a"}, runStart)
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	// Discovering it again while it is pending does not queue it twice
+	added, err = repositories.AddToFrontier(db, &models.Frontier{Reference: "divar", URL: "https://divar.ir/v/a"}, runStart)
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	// The same URL of another source is a different entry
+	added, err = repositories.AddToFrontier(db, &models.Frontier{Reference: "sheypoor", URL: "https://divar.ir/v/a"}, runStart)
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	// Scraped in this run, so it is skipped
+	assert.NoError(t, repositories.UpdateFrontierStatus(db, "divar", "https://divar.ir/v/a", models.FrontierDone, ""))
+	added, err = repositories.AddToFrontier(db, &models.Frontier{Reference: "divar", URL: "https://divar.ir/v/a"}, runStart)
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	// A later run queues it again
+	added, err = repositories.AddToFrontier(db, &models.Frontier{Reference: "divar", URL: "https://divar.ir/v/a"}, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	pending, err := repositories.GetFrontierByStatus(db, "divar", models.FrontierPending)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
+
+func TestResetInProgressFrontier(t *testing.T) {
+	db := SetupTestDB()
+
+	_, err := repositories.AddToFrontier(db, &models.Frontier{Reference: "divar", URL: "https://divar.ir/v/a"}, time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, repositories.UpdateFrontierStatus(db, "divar", "https://divar.ir/v/a", models.FrontierInProgress, ""))
+
+	inProgress, err := repositories.GetFrontierByStatus(db, "divar", models.FrontierInProgress)
+	assert.NoError(t, err)
+	assert.Len(t, inProgress, 1)
+	assert.Equal(t, 1, inProgress[0].Attempts)
+
+	// A restarted crawler puts interrupted scrapes back to pending
+	assert.NoError(t, repositories.ResetInProgressFrontier(db, "divar", ""))
+	pending, err := repositories.GetFrontierByStatus(db, "divar", models.FrontierPending)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
+
+func TestSaveCheckpoint(t *testing.T) {
+	db := SetupTestDB()
+
+	_, err := repositories.GetCheckpoint(db, "divar", "")
+	assert.Error(t, err)
+
+	checkpoint := models.Checkpoint{Reference: "divar", Status: models.CheckpointRunning, StartedAt: time.Now(), DiscoveredCount: 3}
+	assert.NoError(t, repositories.SaveCheckpoint(db, &checkpoint))
+
+	checkpoint.Status = models.CheckpointFinished
+	checkpoint.SuccessCount = 2
+	assert.NoError(t, repositories.SaveCheckpoint(db, &checkpoint))
+
+	saved, err := repositories.GetCheckpoint(db, "divar", "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.CheckpointFinished, saved.Status)
+	assert.Equal(t, 3, saved.DiscoveredCount)
+	assert.Equal(t, 2, saved.SuccessCount)
+}
@@ -0,0 +1,64 @@
+package repositories_tests
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveRawPage(t *testing.T) {
+	db := SetupTestDB()
+
+	page := models.RawPage{CrawlRunID: "run-1", Reference: "divar", SourceListingID: "a", URL: "https://divar.ir/v/a", Path: "divar/run-1/a.html.gz", ScrapeError: "timeout"}
+	assert.NoError(t, repositories.SaveRawPage(db, &page))
+
+	// A retried listing of the same run replaces its page
+	again := models.RawPage{CrawlRunID: "run-1", Reference: "divar", SourceListingID: "a", URL: "https://divar.ir/v/a", Path: "divar/run-1/a.html.gz", Size: 120}
+	assert.NoError(t, repositories.SaveRawPage(db, &again))
+	assert.Equal(t, page.ID, again.ID)
+
+	other := models.RawPage{CrawlRunID: "run-1", Reference: "sheypoor", SourceListingID: "a", URL: "https://www.sheypoor.com/v/a.html"}
+	assert.NoError(t, repositories.SaveRawPage(db, &other))
+
+	pages, err := repositories.GetRawPagesOfRun(db, "run-1")
+	assert.NoError(t, err)
+	assert.Len(t, pages, 2)
+	assert.Equal(t, "", pages[0].ScrapeError)
+	assert.Equal(t, 120, pages[0].Size)
+}
+
+func TestGetLatestRawPages(t *testing.T) {
+	db := SetupTestDB()
+
+	now := time.Now()
+	pages := []models.RawPage{
+		{CrawlRunID: "run-1", Reference: "divar", SourceListingID: "a", CreatedAt: now.Add(-2 * time.Hour)},
+		{CrawlRunID: "run-2", Reference: "divar", SourceListingID: "a", CreatedAt: now.Add(-time.Hour)},
+		{CrawlRunID: "run-1", Reference: "divar", SourceListingID: "b", CreatedAt: now.Add(-2 * time.Hour)},
+		{CrawlRunID: "run-1", Reference: "sheypoor", SourceListingID: "a", CreatedAt: now.Add(-2 * time.Hour)},
+	}
+	for i := range pages {
+		assert.NoError(t, db.Create(&pages[i]).Error)
+	}
+
+	latest, err := repositories.GetLatestRawPages(db, "divar", "")
+	assert.NoError(t, err)
+	assert.Len(t, latest, 2)
+	runs := map[string]string{}
+	for _, page := range latest {
+		runs[page.SourceListingID] = page.CrawlRunID
+	}
+	assert.Equal(t, map[string]string{"a": "run-2", "b": "run-1"}, runs)
+
+	latest, err = repositories.GetLatestRawPages(db, "divar", "a")
+	assert.NoError(t, err)
+	assert.Len(t, latest, 1)
+	assert.Equal(t, "run-2", latest[0].CrawlRunID)
+
+	latest, err = repositories.GetLatestRawPages(db, "", "")
+	assert.NoError(t, err)
+	assert.Len(t, latest, 3)
+}
@@ -0,0 +1,93 @@
+package services_tests
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/search"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdHistoryRecordsPriceDrop(t *testing.T) {
+	db := SetupSearchTestDB()
+
+	ad := models.Ads{Title: "Flat", City: "City", Reference: "divar", SourceListingID: "wZ10kKqk", Price: 10000, Area: 60}
+	id, _, err := repositories.UpsertAd(db, &ad)
+	assert.NoError(t, err)
+
+	// The crawler sees the listing again with a lower price and a new description
+	seenAgain := models.Ads{Title: "Flat", City: "City", Reference: "divar", SourceListingID: "wZ10kKqk", Price: 9200, Area: 60, Description: "urgent"}
+	_, saved, err := repositories.UpsertAd(db, &seenAgain)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUpdated, saved)
+
+	// Unchanged scrapes add no revision
+	unchanged := seenAgain
+	_, saved, err = repositories.UpsertAd(db, &unchanged)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUnchanged, saved)
+
+	stored, err := repositories.GetAdByID(db, id)
+	assert.NoError(t, err)
+	history, err := search.GetAdHistory(db, stored)
+	assert.NoError(t, err)
+
+	assert.Len(t, history.Revisions, 2)
+	fields := []string{history.Revisions[0].Field, history.Revisions[1].Field}
+	assert.ElementsMatch(t, []string{"Price", "Description"}, fields)
+
+	assert.Equal(t, 10000, history.PriceChange.FirstPrice)
+	assert.Equal(t, 9200, history.PriceChange.Price)
+	assert.InDelta(t, -8.0, history.PriceChange.PricePercent, 0.001)
+	assert.Equal(t, 0, history.PriceChange.RentChanges)
+
+	// Search results carry the price movement of the changed ads
+	filter := models.Filters{City: "City"}
+	assert.NoError(t, repositories.CreateOrUpdateFilter(db, &filter))
+	other := models.Ads{Title: "Other", City: "City", Price: 5000}
+	_, err = repositories.CreateAd(db, &other)
+	assert.NoError(t, err)
+
+	result, err := search.GetFilteredAds(db, filter.ID, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, result.Data, 2)
+	assert.Len(t, result.PriceChanges, 1)
+	assert.InDelta(t, -8.0, result.PriceChanges[id].PricePercent, 0.001)
+}
+
+func TestAdHistoryFollowsBackfilledDeposit(t *testing.T) {
+	db := SetupSearchTestDB()
+
+	// A rent ad stored before ads had a deposit kept it in the price
+	ad := models.Ads{Title: "Flat", City: "City", Reference: "divar", SourceListingID: "gYk2pLm4", CategoryType: "rent", Price: 500000000, Rent: 10000000, Area: 60}
+	id, _, err := repositories.UpsertAd(db, &ad)
+	assert.NoError(t, err)
+	lower := ad
+	lower.Price = 450000000
+	_, saved, err := repositories.UpsertAd(db, &lower)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUpdated, saved)
+
+	moved, err := repositories.BackfillDeposits(db)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), moved)
+
+	// The price revision moved to the deposit, its drop is still reported
+	stored, err := repositories.GetAdByID(db, id)
+	assert.NoError(t, err)
+	history, err := search.GetAdHistory(db, stored)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, history.PriceChange.PriceChanges)
+	assert.Equal(t, 1, history.PriceChange.DepositChanges)
+	assert.Equal(t, 500000000, history.PriceChange.FirstDeposit)
+	assert.Equal(t, 450000000, history.PriceChange.Deposit)
+	assert.InDelta(t, -10.0, history.PriceChange.DepositPercent, 0.001)
+	assert.True(t, history.PriceChange.Changed())
+
+	filter := models.Filters{City: "City"}
+	assert.NoError(t, repositories.CreateOrUpdateFilter(db, &filter))
+	result, err := search.GetFilteredAds(db, filter.ID, 1, 10)
+	assert.NoError(t, err)
+	assert.InDelta(t, -10.0, result.PriceChanges[id].DepositPercent, 0.001)
+}
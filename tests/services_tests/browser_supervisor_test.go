@@ -0,0 +1,142 @@
+package services_tests
+
+import (
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBrowsers launches contexts standing in for Chrome, crash cancels the running one
+type fakeBrowsers struct {
+	launched int
+	crash    context.CancelFunc
+}
+
+func (b *fakeBrowsers) config(maxRecoveries int) browser.SupervisorConfig {
+	return browser.SupervisorConfig{
+		MaxRecoveries: maxRecoveries,
+		StallTimeout:  50 * time.Millisecond,
+		MaxErrors:     3,
+		Launch: func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+			b.launched++
+			browserCtx, cancel := context.WithCancel(ctx)
+			b.crash = cancel
+			return browserCtx, cancel, nil
+		},
+		Probe: func(ctx context.Context) error { return ctx.Err() },
+	}
+}
+
+// recoveryContext counts the recoveries reported to the run
+func recoveryContext(recoveries *int) context.Context {
+	return context.WithValue(context.Background(), "recovery_reporter", source.RecoveryReporter(func() { *recoveries++ }))
+}
+
+func TestSupervisorRestartsStalledBrowser(t *testing.T) {
+	browsers := &fakeBrowsers{}
+	recoveries := 0
+	supervisor := browser.NewSupervisor(recoveryContext(&recoveries), browsers.config(2))
+	assert.NoError(t, supervisor.Start())
+	defer supervisor.Close()
+
+	// A step that hangs is cut off by the stall timeout
+	err := supervisor.Do(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, browser.ErrStalled)
+
+	repositioned := 0
+	assert.NoError(t, supervisor.Check(err, func() error {
+		repositioned++
+		return nil
+	}))
+	assert.Equal(t, 2, browsers.launched)
+	assert.Equal(t, 1, repositioned)
+	assert.Equal(t, 1, supervisor.Recoveries())
+	assert.Equal(t, 1, recoveries)
+}
+
+func TestSupervisorRestartsCrashedBrowser(t *testing.T) {
+	browsers := &fakeBrowsers{}
+	supervisor := browser.NewSupervisor(context.Background(), browsers.config(2))
+	assert.NoError(t, supervisor.Start())
+	defer supervisor.Close()
+
+	// A failed step in a responsive browser is retried without a restart
+	assert.NoError(t, supervisor.Check(errors.New("node not found"), nil))
+	assert.Equal(t, 1, browsers.launched)
+
+	// A step failing because Chrome died restarts it
+	browsers.crash()
+	err := supervisor.Do(func(ctx context.Context) error { return ctx.Err() })
+	assert.Error(t, err)
+	assert.NoError(t, supervisor.Check(err, nil))
+	assert.Equal(t, 2, browsers.launched)
+	assert.NoError(t, supervisor.Do(func(ctx context.Context) error { return ctx.Err() }))
+}
+
+func TestSupervisorRestartsBrowserAfterMaxErrors(t *testing.T) {
+	browsers := &fakeBrowsers{}
+	recoveries := 0
+	config := browsers.config(2)
+	config.MaxErrors = 2
+	supervisor := browser.NewSupervisor(recoveryContext(&recoveries), config)
+	assert.NoError(t, supervisor.Start())
+	defer supervisor.Close()
+
+	// A step failing again and again in a responsive browser is retried, then the browser is restarted
+	repositioned := 0
+	reposition := func() error {
+		repositioned++
+		return nil
+	}
+	for i := 0; i < config.MaxErrors; i++ {
+		assert.NoError(t, supervisor.Check(errors.New("node not found"), reposition))
+	}
+	assert.Equal(t, 2, browsers.launched)
+	assert.Equal(t, 1, repositioned)
+	assert.Equal(t, 1, supervisor.Recoveries())
+	assert.Equal(t, 1, recoveries)
+}
+
+func TestSupervisorGivesUpAfterMaxRecoveries(t *testing.T) {
+	browsers := &fakeBrowsers{}
+	recoveries := 0
+	supervisor := browser.NewSupervisor(recoveryContext(&recoveries), browsers.config(2))
+	assert.NoError(t, supervisor.Start())
+	defer supervisor.Close()
+
+	// Repositioning keeps failing, every restart is used up
+	err := supervisor.Recover(errors.New("scroll height stopped changing"), func() error {
+		return errors.New("navigation failed")
+	})
+	assert.ErrorIs(t, err, browser.ErrGaveUp)
+	assert.Equal(t, 2, supervisor.Recoveries())
+	assert.Equal(t, 2, recoveries)
+	assert.Equal(t, 3, browsers.launched)
+}
+
+func TestScrollTracker(t *testing.T) {
+	tracker := browser.ScrollTracker{Limit: 2}
+
+	grew, stuck := tracker.Measure(1000)
+	assert.True(t, grew)
+	assert.False(t, stuck)
+	grew, stuck = tracker.Measure(1000)
+	assert.False(t, grew)
+	assert.False(t, stuck)
+	_, stuck = tracker.Measure(1000)
+	assert.True(t, stuck)
+
+	grew, _ = tracker.Measure(1500)
+	assert.True(t, grew)
+	tracker.Reset()
+	grew, _ = tracker.Measure(1500)
+	assert.True(t, grew)
+}
@@ -0,0 +1,82 @@
+package services_tests
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawl_runs"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareCrawlRuns(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	previous := models.CrawlRun{StartedAt: start, FinishedAt: start.Add(10 * time.Minute), InsertedCount: 10, UpdatedCount: 10, FailedCount: 5}
+	run := models.CrawlRun{StartedAt: start.Add(time.Hour), FinishedAt: start.Add(time.Hour + 5*time.Minute), InsertedCount: 20, DuplicateCount: 10, FailedCount: 2}
+
+	comparison := crawl_runs.Compare(run, previous)
+	assert.Equal(t, -5*time.Minute, comparison.Duration)
+	assert.Equal(t, 10, comparison.Scraped)
+	assert.Equal(t, 10, comparison.Inserted)
+	assert.Equal(t, -10, comparison.Updated)
+	assert.Equal(t, -3, comparison.Failed)
+	assert.InDelta(t, 4.0, comparison.AdsPerMinute, 0.001)
+}
+
+func TestGetLastRuns(t *testing.T) {
+	setupCrawlerTestDB(t)
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		run := models.CrawlRun{Reference: "fake", Status: models.CheckpointFinished, StartedAt: start.Add(time.Duration(i) * time.Hour), InsertedCount: i * 10}
+		assert.NoError(t, repositories.CreateCrawlRun(database.DB, &run))
+	}
+
+	reports, err := crawl_runs.GetLastRuns(database.DB, "fake", 2)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, 20, reports[0].Run.InsertedCount)
+	assert.Equal(t, 10, reports[0].Comparison.Inserted)
+	assert.Equal(t, 10, reports[1].Comparison.Inserted)
+
+	// The first run of a source has nothing to compare with
+	reports, err = crawl_runs.GetLastRuns(database.DB, "fake", 3)
+	assert.NoError(t, err)
+	assert.Nil(t, reports[2].Comparison)
+
+	_, err = crawl_runs.GetLastRuns(database.DB, "fake", 0)
+	assert.Error(t, err)
+}
+
+// listingSource is a fakeSource whose ads carry a listing ID, so they are matched across runs
+type listingSource struct {
+	*fakeSource
+}
+
+func (s listingSource) Scrap(ctx context.Context, job source.Job) (models.Ads, error) {
+	ad, err := s.fakeSource.Scrap(ctx, job)
+	ad.SourceListingID = job.URL
+	return ad, err
+}
+
+func TestCrawlerCountsSavedResults(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+
+	urls := []string{"https://example.com/ad/1", "https://example.com/ad/2"}
+	first := &crawler.CrawlerState{}
+	crawler.StartCrawler(crawlerTestContext(), listingSource{&fakeSource{urls: urls}}, first)
+	assert.Equal(t, 2, first.InsertedCount)
+	assert.Equal(t, 0, first.DuplicateCount)
+
+	// Scraping the same ads again finds nothing new
+	second := &crawler.CrawlerState{}
+	crawler.StartCrawler(crawlerTestContext(), listingSource{&fakeSource{urls: urls}}, second)
+	assert.Equal(t, 0, second.InsertedCount)
+	assert.Equal(t, 2, second.DuplicateCount)
+}
@@ -0,0 +1,164 @@
+package services_tests
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawl_targets"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"fmt"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCrawlTarget(t *testing.T) {
+	target, err := crawl_targets.NewTarget(" Divar ", "Tehran", "buy-apartment", 5, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "divar", target.Reference)
+	assert.Equal(t, "tehran/buy-apartment", target.Name())
+	assert.True(t, target.Enabled)
+
+	_, err = crawl_targets.NewTarget("bama", "tehran", "buy-apartment", 0, 0)
+	assert.ErrorIs(t, err, crawl_targets.ErrUnknownSource)
+	_, err = crawl_targets.NewTarget("divar", "تهران", "buy-apartment", 0, 0)
+	assert.ErrorIs(t, err, crawl_targets.ErrInvalidSlug)
+	_, err = crawl_targets.NewTarget("divar", "tehran", "../buy", 0, 0)
+	assert.ErrorIs(t, err, crawl_targets.ErrInvalidSlug)
+	_, err = crawl_targets.NewTarget("divar", "tehran", "buy-apartment", -1, 0)
+	assert.ErrorIs(t, err, crawl_targets.ErrInvalidBudget)
+
+	// Sheypoor ads are parsed by category, so only the supported ones are allowed
+	_, err = crawl_targets.NewTarget("sheypoor", "tehran", "villa-for-sale", 0, 0)
+	assert.NoError(t, err)
+	_, err = crawl_targets.NewTarget("sheypoor", "tehran", "cars", 0, 0)
+	assert.ErrorIs(t, err, crawl_targets.ErrUnsupportedCategory)
+}
+
+func TestAddCrawlTargetRejectsDuplicates(t *testing.T) {
+	setupCrawlerTestDB(t)
+
+	_, err := crawl_targets.AddTarget(database.DB, "divar", "tehran", "buy-apartment", 0, 0)
+	assert.NoError(t, err)
+	_, err = crawl_targets.AddTarget(database.DB, "divar", "TEHRAN", "buy-apartment", 0, 0)
+	assert.ErrorIs(t, err, crawl_targets.ErrDuplicateTarget)
+
+	targets, err := crawl_targets.GetTargets(database.DB)
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+
+	toggled, err := crawl_targets.ToggleTarget(database.DB, targets[0].ID)
+	assert.NoError(t, err)
+	assert.False(t, toggled.Enabled)
+}
+
+// runTargetsContext is a crawler context with the bot RunCrawler reports to, no super admin is set
+func runTargetsContext(t *testing.T) context.Context {
+	t.Setenv("SUPER_ADMIN_ID", "")
+	return context.WithValue(crawlerTestContext(), "bot", (*tgbotapi.BotAPI)(nil))
+}
+
+func TestRunTargetsCyclesThroughTargets(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+
+	for _, target := range []models.CrawlTarget{
+		{Reference: "fake", City: "tehran", Category: "buy", MaxAds: 1, Enabled: true},
+		{Reference: "fake", City: "shiraz", Category: "buy", Enabled: true},
+		{Reference: "fake", City: "tabriz", Category: "buy", Enabled: false},
+	} {
+		assert.NoError(t, repositories.CreateCrawlTarget(database.DB, &target))
+	}
+
+	var order []string
+	sources := make(map[string]*fakeSource)
+	newSource := func(city, category string) source.Source {
+		name := city + "/" + category
+		order = append(order, name)
+		sources[name] = &fakeSource{urls: []string{
+			fmt.Sprintf("https://example.com/%s/1", city),
+			fmt.Sprintf("https://example.com/%s/2", city),
+			fmt.Sprintf("https://example.com/%s/3", city),
+		}}
+		return sources[name]
+	}
+
+	ctx := runTargetsContext(t)
+	crawler.RunTargets(ctx, "fake", &fakeSource{}, newSource)
+	assert.Equal(t, []string{"tehran/buy", "shiraz/buy"}, order)
+	// Each target has its own ad budget
+	assert.Len(t, sources["tehran/buy"].scraped, 1)
+
+	runs, err := repositories.GetLastCrawlRuns(database.DB, "fake", 10)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+	assert.ElementsMatch(t, []string{"tehran/buy", "shiraz/buy"}, []string{runs[0].Target, runs[1].Target})
+
+	// A new target has never been crawled and gets the first turn
+	assert.NoError(t, repositories.CreateCrawlTarget(database.DB, &models.CrawlTarget{Reference: "fake", City: "qom", Category: "buy", Enabled: true}))
+	order = nil
+	crawler.RunTargets(ctx, "fake", &fakeSource{}, newSource)
+	assert.Equal(t, []string{"qom/buy", "tehran/buy", "shiraz/buy"}, order)
+}
+
+func TestRunTargetsWithoutTargetsCrawlsWholeSite(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+
+	whole := &fakeSource{urls: []string{"https://example.com/ad/1", "https://example.com/ad/2"}}
+	crawler.RunTargets(runTargetsContext(t), "fake", whole, func(city, category string) source.Source {
+		t.Fatalf("no target should be crawled, got %s/%s", city, category)
+		return nil
+	})
+	assert.Len(t, whole.scraped, 2)
+
+	runs, err := repositories.GetLastCrawlRuns(database.DB, "fake", 10)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+	assert.Empty(t, runs[0].Target)
+}
+
+func TestInterruptedTargetIsOnlyResumedByItself(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+
+	tehran := models.CrawlTarget{Reference: "fake", City: "tehran", Category: "buy", Enabled: true}
+	shiraz := models.CrawlTarget{Reference: "fake", City: "shiraz", Category: "buy", Enabled: true}
+	assert.NoError(t, repositories.CreateCrawlTarget(database.DB, &tehran))
+	assert.NoError(t, repositories.CreateCrawlTarget(database.DB, &shiraz))
+	urls := func(city string) []string {
+		return []string{
+			fmt.Sprintf("https://example.com/%s/1", city),
+			fmt.Sprintf("https://example.com/%s/2", city),
+			fmt.Sprintf("https://example.com/%s/3", city),
+		}
+	}
+
+	// The tehran run is cut off after one ad
+	ctx, cancel := context.WithCancel(runTargetsContext(t))
+	first := &fakeSource{urls: urls("tehran"), stopAfter: 1, stop: cancel}
+	run := crawler.RunTarget(ctx, tehran, func(city, category string) source.Source { return first })
+	cancel()
+	assert.Equal(t, models.CheckpointInterrupted, run.Status)
+
+	// Shiraz discovers and scrapes its own listings, tehran's stay pending
+	second := &fakeSource{urls: urls("shiraz")}
+	run = crawler.RunTarget(runTargetsContext(t), shiraz, func(city, category string) source.Source { return second })
+	assert.Equal(t, models.CheckpointFinished, run.Status)
+	assert.Equal(t, 1, second.discovers)
+	assert.ElementsMatch(t, urls("shiraz"), second.scraped)
+
+	// The next tehran run resumes where it was cut off
+	third := &fakeSource{urls: urls("tehran")}
+	run = crawler.RunTarget(runTargetsContext(t), tehran, func(city, category string) source.Source { return third })
+	assert.Equal(t, models.CheckpointFinished, run.Status)
+	assert.Equal(t, 0, third.discovers)
+	assert.NotEmpty(t, third.scraped)
+	for _, url := range third.scraped {
+		assert.Contains(t, urls("tehran"), url)
+		assert.NotContains(t, first.scraped, url)
+	}
+}
@@ -0,0 +1,172 @@
+package services_tests
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	cfg "Crawlzilla/logger"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeSource discovers a fixed list of URLs and scrapes them without a browser
+type fakeSource struct {
+	urls []string
+
+	mu        sync.Mutex
+	scraped   []string
+	discovers int
+	// stopAfter cancels the run after that many ads were scraped, to simulate a restart
+	stopAfter int
+	stop      context.CancelFunc
+	// delay keeps a scrape busy so concurrent scrapes can be counted
+	delay     time.Duration
+	active    int
+	maxActive int
+}
+
+func (s *fakeSource) Name() string { return "fake" }
+
+func (s *fakeSource) Discover(ctx context.Context, jobs chan<- source.Job) {
+	s.mu.Lock()
+	s.discovers++
+	s.mu.Unlock()
+	for _, url := range s.urls {
+		select {
+		case jobs <- source.Job{URL: url}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *fakeSource) Scrap(ctx context.Context, job source.Job) (models.Ads, error) {
+	if s.delay > 0 {
+		s.mu.Lock()
+		s.active++
+		s.maxActive = max(s.maxActive, s.active)
+		s.mu.Unlock()
+		time.Sleep(s.delay)
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil && len(s.scraped) >= s.stopAfter {
+		s.stop()
+		return models.Ads{}, errors.New("shutting down")
+	}
+	s.scraped = append(s.scraped, job.URL)
+	return models.Ads{Title: job.URL, URL: job.URL, Reference: s.Name()}, nil
+}
+
+func setupCrawlerTestDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic("failed to connect to database")
+	}
+	// Every connection of an in-memory sqlite is a new database, so keep a single one
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Ads{}, &models.AdRevision{}, &models.Frontier{}, &models.Checkpoint{}, &models.DeadLetter{}, &models.CrawlRun{}, &models.AdImage{}, &models.CrawlTarget{}, &models.CrawlSchedule{}, &models.RawPage{}, &models.FieldFillRate{}); err != nil {
+		panic("failed to migrate database schema")
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+}
+
+func crawlerTestContext() context.Context {
+	var configLogger cfg.ConfigLoggerType = func(scope string) (*zap.Logger, error) { return zap.NewNop(), nil }
+	return context.WithValue(context.Background(), "configLogger", configLogger)
+}
+
+func TestCrawlerResumesPendingFrontier(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+
+	var urls []string
+	for i := 0; i < 5; i++ {
+		urls = append(urls, fmt.Sprintf("https://example.com/ad/%d", i))
+	}
+
+	// First run is stopped after two ads
+	ctx, cancel := context.WithCancel(crawlerTestContext())
+	first := &fakeSource{urls: urls, stopAfter: 2, stop: cancel}
+	crawler.StartCrawler(ctx, first, &crawler.CrawlerState{})
+	cancel()
+
+	checkpoint, err := repositories.GetCheckpoint(database.DB, "fake", "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.CheckpointInterrupted, checkpoint.Status)
+	assert.Equal(t, 2, checkpoint.SuccessCount)
+
+	done, err := repositories.GetFrontierByStatus(database.DB, "fake", models.FrontierDone)
+	assert.NoError(t, err)
+	assert.Len(t, done, 2)
+
+	// The restarted run scrapes what is left without discovering again
+	second := &fakeSource{urls: urls}
+	state := &crawler.CrawlerState{}
+	crawler.StartCrawler(crawlerTestContext(), second, state)
+
+	assert.Equal(t, 0, second.discovers)
+	assert.NotEmpty(t, second.scraped)
+	for _, url := range second.scraped {
+		assert.NotContains(t, first.scraped, url, "already scraped URL was scraped again")
+	}
+	assert.Equal(t, 2+len(second.scraped), state.SuccessAdCount)
+
+	checkpoint, err = repositories.GetCheckpoint(database.DB, "fake", "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.CheckpointFinished, checkpoint.Status)
+
+	pending, err := repositories.GetFrontierByStatus(database.DB, "fake", models.FrontierPending)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestCrawlerSkipsURLsSeenTwiceInOneRun(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+
+	// Listing pages repeat the cards of earlier pages
+	src := &fakeSource{urls: []string{"https://example.com/ad/1", "https://example.com/ad/2", "https://example.com/ad/1"}}
+	state := &crawler.CrawlerState{}
+	crawler.StartCrawler(crawlerTestContext(), src, state)
+
+	assert.ElementsMatch(t, []string{"https://example.com/ad/1", "https://example.com/ad/2"}, src.scraped)
+	assert.Equal(t, 2, state.DiscoveredCount)
+}
+
+func TestCrawlerUsesConfiguredWorkers(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+	t.Setenv("MAX_WORKERS", "3")
+
+	var urls []string
+	for i := 0; i < 9; i++ {
+		urls = append(urls, fmt.Sprintf("https://example.com/ad/%d", i))
+	}
+	src := &fakeSource{urls: urls, delay: 50 * time.Millisecond}
+	state := &crawler.CrawlerState{}
+	crawler.StartCrawler(crawlerTestContext(), src, state)
+
+	assert.Equal(t, 9, state.SuccessAdCount)
+	assert.Equal(t, 3, src.maxActive)
+}
@@ -0,0 +1,254 @@
+package services_tests
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/queue"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQueue is an in-memory queue shared by the discovery and the workers of a test
+type fakeQueue struct {
+	mu          sync.Mutex
+	next        int
+	tasks       []queue.Delivery
+	outstanding map[string]int64
+	stats       map[string]map[string]queue.WorkerStats
+	finished    map[string]bool
+	held        map[string]string // Worker holding each pulled task
+	takenOver   map[string]bool   // URLs another worker claims right after they are pulled
+}
+
+func newFakeQueue() *fakeQueue {
+	return &fakeQueue{outstanding: make(map[string]int64), stats: make(map[string]map[string]queue.WorkerStats), finished: make(map[string]bool), held: make(map[string]string), takenOver: make(map[string]bool)}
+}
+
+func (q *fakeQueue) Push(ctx context.Context, task queue.Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.next++
+	q.tasks = append(q.tasks, queue.Delivery{ID: strconv.Itoa(q.next), Task: task, Attempts: 1})
+	q.outstanding[task.RunID]++
+	return nil
+}
+
+func (q *fakeQueue) Pull(ctx context.Context, worker string) (queue.Delivery, bool, error) {
+	q.mu.Lock()
+	if len(q.tasks) == 0 {
+		q.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return queue.Delivery{}, false, nil
+	}
+	defer q.mu.Unlock()
+	delivery := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	delivery.Worker = worker
+	q.held[delivery.ID] = worker
+	if q.takenOver[delivery.Task.URL] {
+		q.held[delivery.ID] = "other-worker"
+	}
+	return delivery, true, nil
+}
+
+func (q *fakeQueue) Ack(ctx context.Context, delivery queue.Delivery) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.held[delivery.ID] != delivery.Worker {
+		return false, nil
+	}
+	delete(q.held, delivery.ID)
+	q.outstanding[delivery.Task.RunID]--
+	return true, nil
+}
+
+func (q *fakeQueue) Outstanding(ctx context.Context, runID string) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.outstanding[runID], nil
+}
+
+func (q *fakeQueue) Complete(ctx context.Context, delivery queue.Delivery, result queue.Result) (bool, error) {
+	if acked, err := q.Ack(ctx, delivery); !acked {
+		return false, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stats[result.RunID] == nil {
+		q.stats[result.RunID] = make(map[string]queue.WorkerStats)
+	}
+	stats := q.stats[result.RunID][result.Worker]
+	stats.Add(result)
+	q.stats[result.RunID][result.Worker] = stats
+	return true, nil
+}
+
+func (q *fakeQueue) Stats(ctx context.Context, runID string) (map[string]queue.WorkerStats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := make(map[string]queue.WorkerStats)
+	for worker, workerStats := range q.stats[runID] {
+		stats[worker] = workerStats
+	}
+	return stats, nil
+}
+
+func (q *fakeQueue) Finish(ctx context.Context, runID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.finished[runID] = true
+	return nil
+}
+
+func (q *fakeQueue) Finished(ctx context.Context, runID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.finished[runID], nil
+}
+
+// startQueueWorker runs a queue worker until the test ends
+func startQueueWorker(t *testing.T, q queue.Queue, name string, src source.Source) {
+	ctx, cancel := context.WithCancel(crawlerTestContext())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		crawler.RunWorker(ctx, q, name, map[string]source.Source{src.Name(): src})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestDistributedCrawlIsScrapedByQueueWorkers(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+	t.Setenv("MAX_WORKERS", "2")
+
+	var urls []string
+	for i := 0; i < 4; i++ {
+		urls = append(urls, fmt.Sprintf("https://example.com/ad/%d", i))
+	}
+	q := newFakeQueue()
+	scraper := &fakeSource{}
+	startQueueWorker(t, q, "worker-1", scraper)
+
+	// The discovery process scrapes nothing itself
+	discovery := &fakeSource{urls: urls}
+	state := &crawler.CrawlerState{}
+	ctx := context.WithValue(crawlerTestContext(), "crawl_queue", queue.Queue(q))
+	crawler.StartCrawler(ctx, discovery, state)
+
+	assert.Empty(t, discovery.scraped)
+	assert.ElementsMatch(t, urls, scraper.scraped)
+	assert.Equal(t, 4, state.DiscoveredCount)
+	assert.Equal(t, 4, state.SuccessAdCount)
+	assert.Equal(t, 4, state.InsertedCount)
+	assert.Equal(t, 4, state.Workers["worker-1"].Success)
+	assert.Len(t, q.finished, 1)
+
+	done, err := repositories.GetFrontierByStatus(database.DB, "fake", models.FrontierDone)
+	assert.NoError(t, err)
+	assert.Len(t, done, 4)
+	checkpoint, err := repositories.GetCheckpoint(database.DB, "fake", "")
+	assert.NoError(t, err)
+	assert.Equal(t, models.CheckpointFinished, checkpoint.Status)
+	assert.Equal(t, 4, checkpoint.SuccessCount)
+}
+
+func TestQueueWorkerGivesUpOnRedeliveredTask(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_WORKERS", "1")
+
+	// The task was pulled three times by workers that died before acking it
+	q := newFakeQueue()
+	assert.NoError(t, q.Push(context.Background(), queue.Task{RunID: "run-1", Reference: "fake", URL: "https://example.com/ad/1"}))
+	q.tasks[0].Attempts = 4
+
+	scraper := &fakeSource{}
+	startQueueWorker(t, q, "worker-1", scraper)
+	assert.Eventually(t, func() bool {
+		outstanding, _ := q.Outstanding(context.Background(), "run-1")
+		return outstanding == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Empty(t, scraper.scraped)
+	letters, total, err := repositories.GetDeadLetters(database.DB, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "https://example.com/ad/1", letters[0].URL)
+	stats, _ := q.Stats(context.Background(), "run-1")
+	assert.Equal(t, 1, stats["worker-1"].Failed)
+}
+
+func TestQueueWorkerDropsTasksOfFinishedRun(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_WORKERS", "1")
+
+	// The run stopped at MAX_AD_COUNT before the workers got to its last tasks
+	q := newFakeQueue()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, q.Push(context.Background(), queue.Task{RunID: "run-1", Reference: "fake", URL: fmt.Sprintf("https://example.com/ad/%d", i)}))
+	}
+	assert.NoError(t, q.Finish(context.Background(), "run-1"))
+	assert.NoError(t, q.Push(context.Background(), queue.Task{RunID: "run-2", Reference: "fake", URL: "https://example.com/ad/3"}))
+
+	scraper := &fakeSource{}
+	startQueueWorker(t, q, "worker-1", scraper)
+	assert.Eventually(t, func() bool {
+		first, _ := q.Outstanding(context.Background(), "run-1")
+		second, _ := q.Outstanding(context.Background(), "run-2")
+		return first == 0 && second == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	scraper.mu.Lock()
+	assert.Equal(t, []string{"https://example.com/ad/3"}, scraper.scraped)
+	scraper.mu.Unlock()
+	stats, _ := q.Stats(context.Background(), "run-1")
+	assert.Empty(t, stats)
+}
+
+func TestQueueWorkerDropsResultOfTaskTakenOver(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_WORKERS", "1")
+
+	// The worker is too slow, another worker claims the task before it finishes
+	q := newFakeQueue()
+	q.takenOver["https://example.com/ad/1"] = true
+	assert.NoError(t, q.Push(context.Background(), queue.Task{RunID: "run-1", Reference: "fake", URL: "https://example.com/ad/1"}))
+
+	scraper := &fakeSource{}
+	startQueueWorker(t, q, "worker-1", scraper)
+	assert.Eventually(t, func() bool {
+		scraper.mu.Lock()
+		defer scraper.mu.Unlock()
+		return len(scraper.scraped) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Only the worker holding the task counts it and finishes it
+	assert.Never(t, func() bool {
+		stats, _ := q.Stats(context.Background(), "run-1")
+		return len(stats) > 0
+	}, 100*time.Millisecond, 10*time.Millisecond)
+	outstanding, _ := q.Outstanding(context.Background(), "run-1")
+	assert.Equal(t, int64(1), outstanding)
+
+	delivery := queue.Delivery{ID: "1", Worker: "other-worker", Task: queue.Task{RunID: "run-1", Reference: "fake", URL: "https://example.com/ad/1"}}
+	completed, err := q.Complete(context.Background(), delivery, queue.Result{RunID: "run-1", Worker: "other-worker", URL: delivery.Task.URL})
+	assert.NoError(t, err)
+	assert.True(t, completed)
+	stats, _ := q.Stats(context.Background(), "run-1")
+	assert.Equal(t, 1, stats["other-worker"].Success)
+	assert.NotContains(t, stats, "worker-1")
+	outstanding, _ = q.Outstanding(context.Background(), "run-1")
+	assert.Zero(t, outstanding)
+}
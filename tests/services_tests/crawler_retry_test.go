@@ -0,0 +1,160 @@
+package services_tests
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakySource fails the scrapes of a URL with the queued errors before it succeeds
+type flakySource struct {
+	fakeSource
+	failures map[string][]error
+	attempts map[string]int
+}
+
+func (s *flakySource) Scrap(ctx context.Context, job source.Job) (models.Ads, error) {
+	s.mu.Lock()
+	s.attempts[job.URL]++
+	if errs := s.failures[job.URL]; len(errs) > 0 {
+		s.failures[job.URL] = errs[1:]
+		s.mu.Unlock()
+		return models.Ads{}, errs[0]
+	}
+	s.mu.Unlock()
+	return s.fakeSource.Scrap(ctx, job)
+}
+
+func TestClassifyScrapeFailures(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind models.FailureKind
+	}{
+		{source.Fail(models.FailureNavigation, fmt.Errorf("failed to load URL: %w", context.DeadlineExceeded)), models.FailureTimeout},
+		{source.Fail(models.FailureNavigation, errors.New("net::ERR_CONNECTION_RESET")), models.FailureNavigation},
+		{source.Fail(models.FailureParse, source.Fail(models.FailureUnsupported, errors.New("property type not found"))), models.FailureUnsupported},
+		{source.Fail(models.FailureParse, errors.New("city not found")), models.FailureParse},
+		{source.Fail(models.FailureDatabase, errors.New("connection refused")), models.FailureDatabase},
+		{source.Fail(models.FailureNavigation, source.Fail(models.FailureDisallowed, politeness.ErrDisallowed)), models.FailureDisallowed},
+		{errors.New("untagged"), models.FailureNavigation},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.kind, source.Classify(test.err), test.err.Error())
+	}
+
+	// Tagging keeps the message of the error
+	assert.EqualError(t, source.Fail(models.FailureParse, errors.New("city not found")), "city not found")
+	assert.NoError(t, source.Fail(models.FailureParse, nil))
+}
+
+func TestCrawlerRetriesTransientFailuresAndDeadLettersTheRest(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+	t.Setenv("MAX_RETRIES", "2")
+	t.Setenv("RETRY_BACKOFF", "0")
+
+	timeout := source.Fail(models.FailureNavigation, fmt.Errorf("failed to load URL: %w", context.DeadlineExceeded))
+	unsupported := source.Fail(models.FailureUnsupported, errors.New("property type not found"))
+	src := &flakySource{
+		fakeSource: fakeSource{urls: []string{"https://example.com/flaky", "https://example.com/office", "https://example.com/down", "https://example.com/ok"}},
+		failures: map[string][]error{
+			"https://example.com/flaky":  {timeout},
+			"https://example.com/office": {unsupported},
+			"https://example.com/down":   {timeout, timeout, timeout},
+		},
+		attempts: map[string]int{},
+	}
+	state := &crawler.CrawlerState{}
+	crawler.StartCrawler(crawlerTestContext(), src, state)
+
+	// A transient failure is retried, a permanent one is not
+	assert.Equal(t, 2, src.attempts["https://example.com/flaky"])
+	assert.Equal(t, 1, src.attempts["https://example.com/office"])
+	assert.Equal(t, 3, src.attempts["https://example.com/down"])
+	assert.Equal(t, 2, state.SuccessAdCount)
+	assert.Equal(t, 2, state.FailAdCount)
+
+	letters, total, err := repositories.GetDeadLetters(database.DB, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	kinds := map[string]models.FailureKind{}
+	attempts := map[string]int{}
+	for _, letter := range letters {
+		kinds[letter.URL] = letter.Kind
+		attempts[letter.URL] = letter.Attempts
+	}
+	assert.Equal(t, models.FailureUnsupported, kinds["https://example.com/office"])
+	assert.Equal(t, 1, attempts["https://example.com/office"])
+	assert.Equal(t, models.FailureTimeout, kinds["https://example.com/down"])
+	assert.Equal(t, 3, attempts["https://example.com/down"])
+
+	// Re-queued letters are scraped by the next run and leave the store once they succeed
+	count, err := repositories.RequeueAllDeadLetters(database.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	src.urls = nil
+	crawler.StartCrawler(crawlerTestContext(), src, &crawler.CrawlerState{})
+	assert.Equal(t, 4, src.attempts["https://example.com/down"])
+	_, total, err = repositories.GetDeadLetters(database.DB, 0, 10)
+	assert.NoError(t, err)
+	assert.Zero(t, total)
+}
+
+// robotsSource lists fake URLs and fetches them over HTTP like a real source
+type robotsSource struct {
+	fakeSource
+	attempts int
+}
+
+func (s *robotsSource) Scrap(ctx context.Context, job source.Job) (models.Ads, error) {
+	s.mu.Lock()
+	s.attempts++
+	s.mu.Unlock()
+	if _, err := fetch.Get(ctx, job.URL, nil); err != nil {
+		return models.Ads{}, source.Fail(models.FailureNavigation, err)
+	}
+	return s.fakeSource.Scrap(ctx, job)
+}
+
+func TestCrawlerDoesNotRetryDisallowedURLs(t *testing.T) {
+	setupCrawlerTestDB(t)
+	t.Setenv("MAX_AD_COUNT", "100")
+	t.Setenv("MAX_RETRIES", "2")
+	t.Setenv("RETRY_BACKOFF", "0")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	src := &robotsSource{fakeSource: fakeSource{urls: []string{server.URL + "/private/ad"}}}
+	polite := politeness.New(politeness.Config{Robots: true, UserAgent: "Crawlzilla"})
+	state := &crawler.CrawlerState{}
+	crawler.StartCrawler(context.WithValue(crawlerTestContext(), "politeness", polite), src, state)
+
+	// robots.txt refuses the URL on every attempt, so it goes straight to the dead letters
+	assert.Equal(t, 1, src.attempts)
+	assert.Equal(t, 1, state.FailAdCount)
+	letters, _, err := repositories.GetDeadLetters(database.DB, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, letters, 1) {
+		assert.Equal(t, models.FailureDisallowed, letters[0].Kind)
+		assert.Equal(t, 1, letters[0].Attempts)
+	}
+}
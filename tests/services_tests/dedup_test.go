@@ -0,0 +1,158 @@
+package services_tests
+
+import (
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/dedup"
+	"Crawlzilla/services/search"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// duplicateAds are one apartment posted on divar and by an agent on sheypoor, and another apartment nearby
+func duplicateAds() (divarAd models.Ads, sheypoorAd models.Ads, otherAd models.Ads) {
+	divarAd = models.Ads{
+		Title: "آپارتمان ۱۲۰ متری ونک", Description: "آپارتمان نوساز، نورگیر و دسترسی عالی به مترو، سه خواب با پارکینگ",
+		City: "تهران", Neighborhood: "ونک", Reference: "divar", SourceListingID: "wZ10kKqk", CategoryType: "sell", PropertyType: "apartment",
+		Area: 120, Room: 3, Price: 12000000000, ContactNumber: "۰۹۱۲۱۲۳۴۵۶۷", Latitude: 35.757321, Longitude: 51.409212,
+	}
+	sheypoorAd = models.Ads{
+		Title: "فروش آپارتمان ۱۲۰ متری در ونک", Description: "آپارتمان نوساز نورگیر و دسترسی عالی به مترو سه خواب با پارکینگ",
+		City: "تهران", Neighborhood: "ونك", Reference: "sheypoor", SourceListingID: "438491234", PropertyType: "apartment",
+		Area: 118, Room: 3, Price: 12300000000, ContactNumber: "+98 912 123 4567",
+	}
+	otherAd = models.Ads{
+		Title: "آپارتمان ۱۲۰ متری ونک", Description: "طبقه پنجم، بازسازی شده",
+		City: "تهران", Neighborhood: "ونک", Reference: "divar", SourceListingID: "aB34cD56", CategoryType: "sell", PropertyType: "apartment",
+		Area: 121, Room: 3, Price: 16000000000, ContactNumber: "09359876543", Latitude: 35.775, Longitude: 51.43,
+	}
+	return divarAd, sheypoorAd, otherAd
+}
+
+func TestDedupNormalize(t *testing.T) {
+	assert.Equal(t, "09121234567", dedup.NormalizePhone("+98 912 123 4567"))
+	assert.Equal(t, "09121234567", dedup.NormalizePhone("۰۹۱۲-۱۲۳-۴۵۶۷"))
+	assert.Equal(t, "09121234567", dedup.NormalizePhone("9121234567"))
+	assert.Equal(t, dedup.NormalizePlace("ونک"), dedup.NormalizePlace("ونك"))
+	assert.Equal(t, "120 متر نوساز", dedup.NormalizeText("۱۲۰ متر، نوساز!"))
+}
+
+func TestMinHashSimilarity(t *testing.T) {
+	a, _ := dedup.MinHash("آپارتمان نوساز نورگیر و دسترسی عالی به مترو")
+	b, _ := dedup.MinHash("آپارتمان نوساز، نورگیر و دسترسی عالی به مترو")
+	c, _ := dedup.MinHash("ویلا با استخر و باغ در شمال")
+	assert.Equal(t, 1.0, a.Similarity(b))
+	assert.Less(t, a.Similarity(c), 0.2)
+
+	_, ok := dedup.MinHash("   ")
+	assert.False(t, ok)
+}
+
+func TestDedupScore(t *testing.T) {
+	divarAd, sheypoorAd, otherAd := duplicateAds()
+
+	assert.True(t, dedup.Match(dedup.NewCandidate(divarAd), dedup.NewCandidate(sheypoorAd)))
+	assert.False(t, dedup.Match(dedup.NewCandidate(divarAd), dedup.NewCandidate(otherAd)))
+
+	// Another room count is another property, whatever else matches
+	otherRooms := sheypoorAd
+	otherRooms.Room = 2
+	assert.Zero(t, dedup.Score(dedup.NewCandidate(divarAd), dedup.NewCandidate(otherRooms)))
+}
+
+func TestAssignClusterAndCollapseSearch(t *testing.T) {
+	db := SetupSearchTestDB()
+
+	divarAd, sheypoorAd, otherAd := duplicateAds()
+	var ids []string
+	for _, ad := range []models.Ads{divarAd, otherAd, sheypoorAd} {
+		id, err := repositories.CreateAd(db, &ad)
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	clustered, err := dedup.ClusterUnassigned(db, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, clustered)
+
+	var stored []models.Ads
+	assert.NoError(t, db.Where("id IN ?", ids).Find(&stored).Error)
+	clusters := make(map[string]string)
+	for _, ad := range stored {
+		clusters[ad.ID] = ad.ClusterID
+	}
+	assert.Equal(t, clusters[ids[0]], clusters[ids[2]], "the copies share a cluster")
+	assert.NotEqual(t, clusters[ids[0]], clusters[ids[1]])
+
+	// An updated ad keeps its cluster
+	update := sheypoorAd
+	update.Price = 12200000000
+	_, saved, err := repositories.UpsertAd(db, &update)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUpdated, saved)
+	var updated models.Ads
+	assert.NoError(t, db.First(&updated, "id = ?", ids[2]).Error)
+	assert.Equal(t, clusters[ids[0]], updated.ClusterID)
+
+	// Collapsed search returns a result per property and lists the other sources
+	filter := models.Filters{City: "تهران", CollapseDuplicates: true}
+	assert.NoError(t, repositories.CreateOrUpdateFilter(db, &filter))
+	result, err := search.GetFilteredAds(db, filter.ID, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, result.Data, 2)
+	assert.Equal(t, 1, result.Pages)
+	for _, ad := range result.Data {
+		if ad.ClusterID == clusters[ids[0]] {
+			assert.Len(t, result.Duplicates[ad.ID], 1)
+		} else {
+			assert.Empty(t, result.Duplicates[ad.ID])
+		}
+	}
+
+	// Without the option every listing is a result
+	all := models.Filters{City: "تهران"}
+	assert.NoError(t, repositories.CreateOrUpdateFilter(db, &all))
+	result, err = search.GetFilteredAds(db, all.ID, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, result.Data, 3)
+	assert.Nil(t, result.Duplicates)
+}
+
+func TestClusterCandidatesPreferTheSameCityAndRecentAds(t *testing.T) {
+	db := SetupSearchTestDB()
+
+	// Older ads of the same size fill the limit: in another city, or across Tehran
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	for i := 0; i < 6; i++ {
+		elsewhere := models.Ads{Title: "آپارتمان ۱۲۰ متری", City: "مشهد", Reference: "divar", SourceListingID: fmt.Sprintf("mashhad-%d", i),
+			CategoryType: "sell", Area: 120, Room: 3, CreatedAt: old}
+		farAway := models.Ads{Title: "آپارتمان ۱۲۰ متری", City: "تهران", Reference: "divar", SourceListingID: fmt.Sprintf("tehran-%d", i),
+			CategoryType: "sell", Area: 120, Room: 3, Latitude: 35.63, Longitude: 51.2, CreatedAt: old}
+		assert.NoError(t, db.Create(&elsewhere).Error)
+		assert.NoError(t, db.Create(&farAway).Error)
+	}
+	divarAd, sheypoorAd, otherAd := duplicateAds()
+	otherAd.CreatedAt = old.Add(-time.Hour)
+	assert.NoError(t, db.Create(&otherAd).Error)
+	assert.NoError(t, db.Create(&sheypoorAd).Error)
+	assert.NoError(t, db.Create(&divarAd).Error)
+
+	candidates, err := repositories.GetClusterCandidates(db, divarAd, 0.1, 5000, 2)
+	assert.NoError(t, err)
+	var ids []string
+	for _, candidate := range candidates {
+		assert.Equal(t, "تهران", candidate.City)
+		ids = append(ids, candidate.ID)
+	}
+	// The copy is newest, the older apartment nearby fills the rest of the limit
+	assert.Equal(t, []string{sheypoorAd.ID, otherAd.ID}, ids)
+
+	clusterID, err := dedup.AssignCluster(db, divarAd.ID)
+	assert.NoError(t, err)
+	var stored models.Ads
+	assert.NoError(t, db.First(&stored, "id = ?", sheypoorAd.ID).Error)
+	assert.Equal(t, clusterID, stored.ClusterID)
+}
@@ -1,25 +1,25 @@
 package services_tests
 
 import (
+	"Crawlzilla/models"
 	"Crawlzilla/services/crawler/divar"
-	"log"
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/source"
+	"context"
 	"testing"
 
-	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestScrapPropertyPage(t *testing.T) {
-	// Load .env file
-	if err := godotenv.Load("../../.env"); err != nil {
-		log.Fatalf("No .env file found: %v", err)
-	}
-
-	// Define a mock page URL (replace with a valid test URL if possible)
-	mockURL := "https://divar.ir/v/%DB%B8%DB%B0%D9%85%D8%AA%D8%B1-%D8%A2%D9%81%D8%AA%D8%A7%D8%A8%DA%AF%DB%8C%D8%B1-%D9%81%D9%88%D9%84-%D8%A7%D9%85%DA%A9%D8%A7%D9%86%D8%A7%D8%AA-%D8%B4%D9%87%D8%B1%D8%B2%DB%8C%D8%A8%D8%A7/wZ10kKqk"
+	// Define a mock page URL, the page itself is replayed from a saved snapshot
+	mockURL := "https://divar.ir/v/apartment-vanak/wZ10kKqk"
 
-	// Call the ScrapPropertyPage function
-	result, err := divar.ScrapPropertyPage(mockURL)
+	// Scrap the page like a crawl run does, with the fixture loader in place of Chrome
+	src := divar.NewSource()
+	src.Fetch = fetch.Config{Mode: fetch.ModeChrome}
+	src.Loader = fixtureLoader(t, "divar/apartment_sell.html")
+	result, err := src.Scrap(context.Background(), source.Job{URL: mockURL})
 
 	// Validate the result and error handling
 	assert.NoError(t, err, "Expected no error during scraping")
@@ -32,3 +32,48 @@ func TestScrapPropertyPage(t *testing.T) {
 	assert.GreaterOrEqual(t, result.Price, 0, "Price should be greater than or equal to 0")
 	assert.GreaterOrEqual(t, result.Area, 0, "Area should be greater than or equal to 0")
 }
+
+func TestDivarScraperGolden(t *testing.T) {
+	tests := []struct {
+		fixture string
+		golden  string
+		url     string
+	}{
+		{"divar/apartment_sell.html", "divar/apartment_sell.golden.json", "https://divar.ir/v/apartment-vanak/wZ10kKqk"},
+		{"divar/apartment_rent.html", "divar/apartment_rent.golden.json", "https://divar.ir/v/apartment-shiraz/gYk2pLm4"},
+		{"divar/office_rent.html", "divar/office_rent.golden.json", "https://divar.ir/v/office-valiasr/hQ3mTx8r"},
+	}
+
+	src := divar.NewSource()
+	src.Fetch = fetch.Config{Mode: fetch.ModeChrome}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			src.Loader = fixtureLoader(t, test.fixture)
+			result, err := src.Scrap(context.Background(), source.Job{URL: test.url})
+			assert.NoError(t, err)
+			assertGoldenAds(t, test.golden, result)
+		})
+	}
+}
+
+func TestDivarScraperRejectsUnsupportedCategory(t *testing.T) {
+	html := `<div id="app"><div class="container--has-footer-d86a9 kt-container"><div><main><article><div><div class="kt-col-5">
+		<div><nav><div><a><button><span>فروش صنعتی، کشاورزی و تجاری</span></button></a></div></nav></div>
+	</div></div></article></main></div></div></div>`
+
+	_, err := divar.ParsePropertyPage("https://divar.ir/v/industrial/abc", html)
+	assert.EqualError(t, err, "property type not found")
+	assert.Equal(t, models.FailureUnsupported, source.Classify(err))
+}
+
+func TestDivarScraperPresale(t *testing.T) {
+	html := `<div id="app"><div class="container--has-footer-d86a9 kt-container"><div><main><article><div><div class="kt-col-5">
+		<section><div class="kt-page-title"><div><h1>پیش‌فروش آپارتمان</h1><div>لحظاتی پیش در تهران، پونک</div></div></div></section>
+		<div><nav><div><a><button><span>پیش‌فروش آپارتمان</span></button></a></div></nav></div>
+	</div></div></article></main></div></div></div>`
+
+	result, err := divar.ParsePropertyPage("https://divar.ir/v/presale/abc", html)
+	assert.NoError(t, err)
+	assert.Equal(t, "sell", result.CategoryType)
+	assert.Equal(t, models.PropertyPresale, result.PropertyType)
+}
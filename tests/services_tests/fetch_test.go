@@ -0,0 +1,230 @@
+package services_tests
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/divar"
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/generic"
+	"Crawlzilla/services/crawler/politeness"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixtureServer serves saved listing pages over HTTP, requests for missing fixtures get a 404
+func fixtureServer(t testing.TB, fixtures map[string]string) *httptest.Server {
+	server := httptest.NewServer(fixtureHandler(t, fixtures))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func fixtureHandler(t testing.TB, fixtures map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		html, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Errorf("failed to read fixture %s: %v", fixture, err)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(html)
+	})
+}
+
+// fetchTestContext returns a crawler test context whose politeness layer does not pace requests
+func fetchTestContext() context.Context {
+	return context.WithValue(crawlerTestContext(), "politeness", politeness.New(politeness.Config{}))
+}
+
+// chromeLoader counts the listings that would have been rendered in Chrome
+func chromeLoader(t *testing.T, fixture string, calls *int) source.PageLoader {
+	load := fixtureLoader(t, fixture)
+	return func(ctx context.Context, pageURL string) (string, error) {
+		*calls++
+		return load(ctx, pageURL)
+	}
+}
+
+func TestFetchHTTPModeDoesNotStartChrome(t *testing.T) {
+	t.Setenv("DIVAR_TOKEN", "secret")
+	var cookie, agent string
+	fixtures := fixtureHandler(t, map[string]string{"/v/apartment-vanak/wZ10kKqk": "divar/apartment_sell.html"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, agent = r.Header.Get("Cookie"), r.Header.Get("User-Agent")
+		fixtures.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	chromeCalls := 0
+	src := divar.NewSource()
+	src.Fetch = fetch.Config{Mode: fetch.ModeHTTP}
+	src.Loader = chromeLoader(t, "divar/apartment_sell.html", &chromeCalls)
+
+	recorder := &source.PageRecorder{}
+	ctx := context.WithValue(fetchTestContext(), "page_recorder", recorder)
+	result, err := src.Scrap(ctx, source.Job{URL: server.URL + "/v/apartment-vanak/wZ10kKqk"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, chromeCalls)
+	assert.Equal(t, "۱۲۰ متر، ۳ خواب، ونک", result.Title)
+	assert.Equal(t, "token=secret", cookie)
+	assert.Equal(t, fetch.UserAgent, agent)
+	html, _, ok := recorder.Page()
+	assert.True(t, ok)
+	assert.Contains(t, html, result.Title)
+
+	// A missing page is a navigation failure, it is not retried with Chrome
+	_, err = src.Scrap(ctx, source.Job{URL: server.URL + "/v/gone/abc"})
+	assert.Equal(t, models.FailureNavigation, source.Classify(err))
+	assert.Equal(t, 0, chromeCalls)
+}
+
+func TestFetchAutoModeFallsBackToChrome(t *testing.T) {
+	server := fixtureServer(t, map[string]string{
+		"/v/apartment-vanak/wZ10kKqk":  "divar/apartment_sell.html",
+		"/v/office-valiasr/hQ3mTx8r":   "divar/office_rent.html",
+		"/v/apartment-shiraz/gYk2pLm4": "divar/apartment_rent.html",
+	})
+	ctx := fetchTestContext()
+
+	chromeCalls := 0
+	src := divar.NewSource()
+	src.Fetch = fetch.Config{Mode: fetch.ModeAuto, BrowserFields: []string{"ContactNumber"}}
+	src.Loader = chromeLoader(t, "divar/apartment_sell.html", &chromeCalls)
+
+	// The server rendered page has every browser field, Chrome is not needed
+	result, err := src.Scrap(ctx, source.Job{URL: server.URL + "/v/apartment-vanak/wZ10kKqk"})
+	assert.NoError(t, err)
+	assert.Equal(t, "۰۹۱۲۱۲۳۴۵۶۷", result.ContactNumber)
+	assert.Equal(t, 0, chromeCalls)
+
+	// The contact number is missing from the fetched page, the rendered one has it
+	result, err = src.Scrap(ctx, source.Job{URL: server.URL + "/v/office-valiasr/hQ3mTx8r"})
+	assert.NoError(t, err)
+	assert.Equal(t, "۰۹۱۲۱۲۳۴۵۶۷", result.ContactNumber)
+	assert.Equal(t, 1, chromeCalls)
+
+	// Without browser fields any parsed page is kept
+	src.Fetch.BrowserFields = nil
+	result, err = src.Scrap(ctx, source.Job{URL: server.URL + "/v/apartment-shiraz/gYk2pLm4"})
+	assert.NoError(t, err)
+	assert.Empty(t, result.ContactNumber)
+	assert.Equal(t, 1, chromeCalls)
+
+	// A page that fails over HTTP is rendered in Chrome
+	_, err = src.Scrap(ctx, source.Job{URL: server.URL + "/v/gone/abc"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, chromeCalls)
+}
+
+func TestFetchAutoModeKeepsUnsupportedCategories(t *testing.T) {
+	chromeCalls := 0
+	strategy := fetch.Strategy{
+		Config: fetch.Config{Mode: fetch.ModeAuto},
+		HTTP:   fixtureLoader(t, "divar/apartment_sell.html"),
+		Chrome: chromeLoader(t, "divar/apartment_sell.html", &chromeCalls),
+		Parse: func(job source.Job, html string) (models.Ads, error) {
+			return models.Ads{}, source.Fail(models.FailureUnsupported, errors.New("category not found"))
+		},
+	}
+	_, err := strategy.Scrap(fetchTestContext(), source.Job{URL: "https://divar.ir/v/industrial/abc"})
+	assert.Equal(t, models.FailureUnsupported, source.Classify(err))
+	assert.Equal(t, 0, chromeCalls)
+}
+
+func TestFetchConfigFromEnv(t *testing.T) {
+	defaults := fetch.Config{Mode: fetch.ModeChrome, BrowserFields: []string{"ContactNumber"}}
+	assert.Equal(t, defaults, fetch.ConfigFromEnv("divar", defaults))
+	// Divar listings are not rendered again for a contact number unless configured to
+	assert.Empty(t, divar.NewSource().Fetch.BrowserFields)
+
+	t.Setenv("FETCH_MODE", "http")
+	t.Setenv("FETCH_MODE_DIVAR", "auto")
+	t.Setenv("FETCH_BROWSER_FIELDS_DIVAR", "ContactNumber, Images")
+	t.Setenv("FETCH_BROWSER_FIELDS_SHEYPOOR", "Phone")
+
+	divarConfig := fetch.ConfigFromEnv("divar", defaults)
+	assert.Equal(t, fetch.ModeAuto, divarConfig.Mode)
+	assert.Equal(t, []string{"ContactNumber", "Images"}, divarConfig.BrowserFields)
+
+	// An unknown field keeps the defaults of the source
+	sheypoorConfig := fetch.ConfigFromEnv("sheypoor", fetch.Config{Mode: fetch.ModeChrome})
+	assert.Equal(t, fetch.ModeHTTP, sheypoorConfig.Mode)
+	assert.Empty(t, sheypoorConfig.BrowserFields)
+
+	t.Setenv("FETCH_MODE_DIVAR", "curl")
+	assert.Equal(t, fetch.ModeHTTP, fetch.ConfigFromEnv("divar", defaults).Mode)
+}
+
+func TestGenericSiteFetchConfig(t *testing.T) {
+	site, err := generic.Load(filepath.Join("testdata", "generic", "melkana", "site.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, fetch.Config{Mode: fetch.ModeChrome}, site.FetchConfig())
+
+	definition := `{
+		"name": "melkana", "list_url": "https://melkana.example/s/{category}?page={page}", "fetch": "auto",
+		"categories": {"apartment-sale": {"fields": {"CategoryType": "sell"}}},
+		"pagination": {"strategy": "page_param"}, "card_links": ["a.card"],
+		"fields": {"Title": {"selectors": ["h1"]}, "ContactNumber": {"selectors": ["a.phone"], "browser": true}}
+	}`
+	site, err = generic.Parse([]byte(definition))
+	assert.NoError(t, err)
+	assert.Equal(t, fetch.Config{Mode: fetch.ModeAuto, BrowserFields: []string{"ContactNumber"}}, site.FetchConfig())
+	assert.Equal(t, fetch.ModeAuto, generic.NewSource(site).Fetch.Mode)
+}
+
+// The benchmarks compare loading and parsing a listing over HTTP with rendering it in Chrome:
+// go test ./tests/services_tests/ -run '^$' -bench Fetch -benchmem
+func BenchmarkFetchHTTP(b *testing.B) {
+	b.Setenv("MAX_SCRAP_TIME", "30")
+	server := fixtureServer(b, map[string]string{"/v/apartment-vanak/wZ10kKqk": "divar/apartment_sell.html"})
+	src := divar.NewSource()
+	src.Fetch = fetch.Config{Mode: fetch.ModeHTTP}
+	benchmarkScrap(b, fetchTestContext(), src, server.URL+"/v/apartment-vanak/wZ10kKqk")
+}
+
+func BenchmarkFetchChrome(b *testing.B) {
+	if !chromeInstalled() {
+		b.Skip("Chrome is not installed")
+	}
+	b.Setenv("MAX_SCRAP_TIME", "30")
+	server := fixtureServer(b, map[string]string{"/v/apartment-vanak/wZ10kKqk": "divar/apartment_sell.html"})
+	src := divar.NewSource()
+	src.Fetch = fetch.Config{Mode: fetch.ModeChrome}
+
+	// Tabs are leased from a pool like in a crawl run, Chrome starts once
+	pool := browser.NewPool(context.Background(), 1, 0)
+	defer pool.Close()
+	ctx := context.WithValue(fetchTestContext(), "browser_pool", pool)
+	benchmarkScrap(b, ctx, src, server.URL+"/v/apartment-vanak/wZ10kKqk")
+}
+
+func benchmarkScrap(b *testing.B, ctx context.Context, src source.Source, url string) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := src.Scrap(ctx, source.Job{URL: url}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// chromeInstalled reports whether chromedp can find a Chrome to start
+func chromeInstalled() bool {
+	for _, name := range []string{"headless_shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package services_tests
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/fill_rates"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fillRateAd is an ad with every monitored field filled in
+func fillRateAd() models.Ads {
+	return models.Ads{
+		SourceListingID: "wZ10kKqk", Title: "آپارتمان ۱۰۰ متری", Description: "نوساز", LocationURL: "https://maps.example/1",
+		ImageURL: "https://img.example/1.jpg", Images: []models.AdImage{{URL: "https://img.example/1.jpg"}},
+		City: "tehran", Neighborhood: "vanak", ContactNumber: "09120000000", CategoryType: "buy", PropertyType: "apartment",
+		Latitude: 35.7, Longitude: 51.4, Area: 100, Price: 5000000000, Deposit: 100000000, Rent: 1000000, Room: 2,
+		FloorNumber: 3, TotalFloors: 5, YearBuilt: 1400, ParkingCount: 1,
+	}
+}
+
+func TestEmptyFields(t *testing.T) {
+	ad := fillRateAd()
+	assert.Empty(t, fill_rates.EmptyFields(ad))
+
+	ad.Area = 0
+	ad.City = ""
+	ad.Images = nil
+	ad.HasElevator = false
+	assert.Equal(t, []string{"Images", "City", "Area"}, fill_rates.EmptyFields(ad))
+}
+
+// createFillRateRun stores a run of divar that saved total ads, with area filled in filled of them
+func createFillRateRun(t *testing.T, startedAt time.Time, filled, total int) models.CrawlRun {
+	run := models.CrawlRun{Reference: "divar", StartedAt: startedAt}
+	assert.NoError(t, repositories.CreateCrawlRun(database.DB, &run))
+	var tally fill_rates.Tally
+	for i := 0; i < total; i++ {
+		var empty []string
+		if i >= filled {
+			empty = []string{"Area"}
+		}
+		tally.Add(fmt.Sprintf("https://divar.ir/v/%d", i), empty)
+	}
+	assert.NoError(t, repositories.SaveFieldFillRates(database.DB, tally.Rates(run.ID)))
+	return run
+}
+
+func TestFillRateDropIsAlerted(t *testing.T) {
+	setupCrawlerTestDB(t)
+	config := fill_rates.Config{BaselineRuns: 2, MinAds: 20, MaxDrop: 0.3}
+	start := time.Now().Add(-time.Hour)
+
+	// Outside of the baseline, only the last two runs count
+	createFillRateRun(t, start, 0, 40)
+	createFillRateRun(t, start.Add(time.Minute), 38, 40)
+	createFillRateRun(t, start.Add(2*time.Minute), 40, 40)
+
+	run := models.CrawlRun{Reference: "divar", StartedAt: start.Add(3 * time.Minute)}
+	assert.NoError(t, repositories.CreateCrawlRun(database.DB, &run))
+	var tally fill_rates.Tally
+	for i := 0; i < 40; i++ {
+		empty := []string{"Area"}
+		if i%4 == 0 {
+			empty = append(empty, "City")
+		}
+		tally.Add(fmt.Sprintf("https://divar.ir/v/%d", i), empty)
+	}
+
+	drops, err := fill_rates.Check(database.DB, config, run, tally)
+	assert.NoError(t, err)
+	// City only fell by a quarter
+	assert.Len(t, drops, 1)
+	assert.Equal(t, "Area", drops[0].Field)
+	assert.InDelta(t, 0, drops[0].Rate, 0.001)
+	assert.InDelta(t, 0.975, drops[0].Baseline, 0.001)
+	assert.Equal(t, []string{"https://divar.ir/v/0", "https://divar.ir/v/1", "https://divar.ir/v/2"}, drops[0].Samples)
+	assert.Contains(t, fill_rates.FormatAlert(run, drops), "Area: 0% (usually 98%)")
+
+	// The rates of the run are stored for the next ones
+	previous, err := repositories.GetPreviousFillRates(database.DB, models.CrawlRun{Reference: "divar", StartedAt: time.Now()}, 1)
+	assert.NoError(t, err)
+	assert.Len(t, previous, len(fill_rates.Fields()))
+	for _, rate := range previous {
+		assert.Equal(t, run.ID, rate.CrawlRunID)
+	}
+}
+
+func TestFillRateSmallRunIsNotAlerted(t *testing.T) {
+	setupCrawlerTestDB(t)
+	config := fill_rates.Config{BaselineRuns: 5, MinAds: 20, MaxDrop: 0.3}
+	start := time.Now().Add(-time.Hour)
+	createFillRateRun(t, start, 40, 40)
+
+	run := models.CrawlRun{Reference: "divar", StartedAt: start.Add(time.Minute)}
+	assert.NoError(t, repositories.CreateCrawlRun(database.DB, &run))
+	var tally fill_rates.Tally
+	for i := 0; i < 5; i++ {
+		tally.Add(fmt.Sprintf("https://divar.ir/v/%d", i), []string{"Area"})
+	}
+
+	drops, err := fill_rates.Check(database.DB, config, run, tally)
+	assert.NoError(t, err)
+	assert.Empty(t, drops)
+
+	// Another source has its own baseline
+	other := models.CrawlRun{Reference: "sheypoor", StartedAt: start.Add(time.Minute)}
+	assert.NoError(t, repositories.CreateCrawlRun(database.DB, &other))
+	tally = fill_rates.Tally{}
+	for i := 0; i < 40; i++ {
+		tally.Add(fmt.Sprintf("https://sheypoor.com/v/%d", i), []string{"Area"})
+	}
+	drops, err = fill_rates.Check(database.DB, config, other, tally)
+	assert.NoError(t, err)
+	assert.Empty(t, drops)
+}
@@ -103,6 +103,28 @@ func TestFilterService_CreateOrUpdateFilter(t *testing.T) {
 			wantID:  "", // Expect no ID since it’s invalid
 			wantErr: true,
 		},
+		{
+			name: "Invalid filter with min deposit greater than max deposit",
+			filter: models.Filters{
+				USER_ID:    "user-id-9",
+				Title:      "Test",
+				MinDeposit: 1000,
+				MaxDeposit: 500,
+			},
+			wantID:  "", // Expect no ID since it’s invalid
+			wantErr: true,
+		},
+		{
+			name: "Invalid filter with min year built greater than max year built",
+			filter: models.Filters{
+				USER_ID:      "user-id-10",
+				Title:        "Test",
+				MinYearBuilt: 1400,
+				MaxYearBuilt: 1390,
+			},
+			wantID:  "", // Expect no ID since it’s invalid
+			wantErr: true,
+		},
 		{
 			name: "Invalid filter with no user id",
 			filter: models.Filters{
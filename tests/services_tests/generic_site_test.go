@@ -0,0 +1,136 @@
+package services_tests
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/generic"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// genericFixture is a listing page of a defined site and the golden file of the ad parsed from it
+type genericFixture struct {
+	Fixture  string `json:"fixture"`
+	Golden   string `json:"golden"`
+	URL      string `json:"url"`
+	Category string `json:"category"`
+}
+
+// TestGenericSitesGolden parses the fixtures of every site in testdata/generic, a new site is
+// covered by adding a directory with its site.json, its listing pages and a fixtures.json
+func TestGenericSitesGolden(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "generic", "*"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		site, err := generic.Load(filepath.Join(dir, "site.json"))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "fixtures.json"))
+		assert.NoError(t, err)
+		var fixtures []genericFixture
+		assert.NoError(t, json.Unmarshal(data, &fixtures))
+
+		src := generic.NewSource(site)
+		for _, fixture := range fixtures {
+			relative, _ := filepath.Rel("testdata", filepath.Join(dir, fixture.Fixture))
+			t.Run(relative, func(t *testing.T) {
+				src.Loader = fixtureLoader(t, relative)
+				result, err := src.Scrap(context.Background(), source.Job{URL: fixture.URL, Category: fixture.Category})
+				assert.NoError(t, err)
+				golden, _ := filepath.Rel("testdata", filepath.Join(dir, fixture.Golden))
+				assertGoldenAds(t, golden, result)
+			})
+		}
+	}
+}
+
+func TestGenericSiteUnknownCategory(t *testing.T) {
+	site, err := generic.Load(filepath.Join("testdata", "generic", "melkana", "site.json"))
+	assert.NoError(t, err)
+
+	_, err = generic.NewSource(site).Parse(source.Job{URL: "https://melkana.example/ad/1/car", Category: "cars"}, "<html></html>")
+	assert.Equal(t, models.FailureUnsupported, source.Classify(err))
+
+	// A page without a title is not an ad
+	_, err = generic.NewSource(site).Parse(source.Job{URL: "https://melkana.example/ad/1/x", Category: "apartment-sale"}, "<html><body></body></html>")
+	assert.Equal(t, models.FailureParse, source.Classify(err))
+}
+
+func TestGenericSitePaginatesListPages(t *testing.T) {
+	t.Setenv("MAX_CRAWL_TIME", "1")
+	t.Setenv("MAX_PAGE", "10")
+	site, err := generic.Load(filepath.Join("testdata", "generic", "melkana", "site.json"))
+	assert.NoError(t, err)
+
+	src := generic.NewTargetSource(site, "tehran", "apartment-sale")
+	var loaded []string
+	src.ListLoader = func(ctx context.Context, pageURL string) (string, error) {
+		loaded = append(loaded, pageURL)
+		page := pageURL[strings.LastIndex(pageURL, "=")+1:]
+		html, err := os.ReadFile(filepath.Join("testdata", "generic", "melkana", fmt.Sprintf("list_%s.html", page)))
+		return string(html), err
+	}
+
+	jobs := make(chan source.Job)
+	go func() {
+		src.Discover(crawlerTestContext(), jobs)
+		close(jobs)
+	}()
+	var urls []string
+	for job := range jobs {
+		assert.Equal(t, "apartment-sale", job.Category)
+		urls = append(urls, job.URL)
+	}
+
+	// Cards repeated on the next page are only sent once, the empty third page ends the list
+	assert.Equal(t, []string{
+		"https://melkana.example/ad/1001/apartment-vanak",
+		"https://melkana.example/ad/1002/apartment-pasdaran",
+		"https://melkana.example/ad/1003/apartment-tajrish",
+		"https://melkana.example/ad/1004/apartment-niavaran",
+	}, urls)
+	assert.Equal(t, []string{
+		"https://melkana.example/tehran/apartment-sale?page=1",
+		"https://melkana.example/tehran/apartment-sale?page=2",
+		"https://melkana.example/tehran/apartment-sale?page=3",
+	}, loaded)
+	assert.Equal(t, "1004", src.ListingID(urls[3]))
+}
+
+func TestGenericSiteValidation(t *testing.T) {
+	valid := `{
+		"name": "melkana", "list_url": "https://melkana.example/s/{category}?page={page}",
+		"categories": {"apartment-sale": {"fields": {"CategoryType": "sell"}}},
+		"pagination": {"strategy": "page_param"}, "card_links": ["a.card"],
+		"fields": {"Title": {"selectors": ["h1"]}}
+	}`
+	_, err := generic.Parse([]byte(valid))
+	assert.NoError(t, err)
+
+	broken := map[string]string{
+		"long name":          strings.Replace(valid, `"melkana"`, `"melkana-tehran"`, 1),
+		"unknown strategy":   strings.Replace(valid, `"page_param"`, `"infinite"`, 1),
+		"no page parameter":  strings.Replace(valid, `?page={page}`, ``, 1),
+		"unknown field":      strings.Replace(valid, `"Title": {"selectors": ["h1"]}`, `"Title": {"selectors": ["h1"]}, "Floors": {"selectors": ["li"]}`, 1),
+		"unknown transform":  strings.Replace(valid, `{"selectors": ["h1"]}`, `{"selectors": ["h1"], "transforms": ["rial"]}`, 1),
+		"reserved field":     strings.Replace(valid, `"CategoryType": "sell"`, `"Reference": "divar"`, 1),
+		"bad constant":       strings.Replace(valid, `"CategoryType": "sell"`, `"Area": "big"`, 1),
+		"no title":           strings.Replace(valid, `"Title"`, `"Description"`, 1),
+		"unknown fetch mode": strings.Replace(valid, `"card_links"`, `"fetch": "curl", "card_links"`, 1),
+		"browser bool field": strings.Replace(valid, `"Title": {"selectors": ["h1"]}`, `"Title": {"selectors": ["h1"]}, "HasParking": {"selectors": [".p"], "exists": true, "browser": true}`, 1),
+	}
+	for name, definition := range broken {
+		_, err := generic.Parse([]byte(definition))
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,116 @@
+package services_tests
+
+import (
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/images"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPhoto draws a picture with a diagonal gradient and a dark block
+func testPhoto(width int, height int, inverted bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := uint8((x*255/width + y*128/height) / 2)
+			if x > width/3 && x < width/2 && y > height/4 && y < height*3/4 {
+				value = 20
+			}
+			if inverted {
+				value = 255 - value
+			}
+			img.Set(x, y, color.RGBA{value, value, value, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDHashMatchesResizedCopy(t *testing.T) {
+	original := images.DHash(testPhoto(180, 120, false))
+	resized := images.DHash(testPhoto(90, 60, false))
+	other := images.DHash(testPhoto(180, 120, true))
+
+	assert.LessOrEqual(t, images.Distance(original, resized), 4)
+	assert.Greater(t, images.Distance(original, other), 20)
+
+	parsed, err := images.ParseHash(images.FormatHash(original))
+	assert.NoError(t, err)
+	assert.Equal(t, original, parsed)
+}
+
+func TestArchiveAdImages(t *testing.T) {
+	setupCrawlerTestDB(t)
+
+	photo := encodePNG(t, testPhoto(60, 40, false))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/photo.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(photo)
+	}))
+	defer server.Close()
+
+	ad := models.Ads{Title: "Gallery", Reference: "fake", SourceListingID: "gallery"}
+	ad.SetImages([]string{server.URL + "/photo.png", server.URL + "/removed.png"})
+	id, _, err := repositories.UpsertAd(database.DB, &ad)
+	assert.NoError(t, err)
+
+	// Archiving is off without a directory
+	archived, err := images.ArchiveAdImages(crawlerTestContext(), database.DB, images.New(images.Config{}), id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, archived)
+
+	archive := images.New(images.Config{Dir: t.TempDir(), MaxBytes: 1 << 20, Timeout: 5 * time.Second})
+	archived, err = images.ArchiveAdImages(crawlerTestContext(), database.DB, archive, id)
+	assert.Error(t, err, "the removed photo can't be archived")
+	assert.Equal(t, 1, archived)
+
+	stored, err := repositories.GetAdByID(database.DB, id)
+	assert.NoError(t, err)
+	sum := sha256.Sum256(photo)
+	assert.Equal(t, hex.EncodeToString(sum[:]), stored.Images[0].SHA256)
+	assert.Len(t, stored.Images[0].PerceptualHash, 16)
+	assert.False(t, stored.Images[1].Archived())
+
+	// The file is addressed by its content
+	data, err := os.ReadFile(archive.Path(stored.Images[0].SHA256))
+	assert.NoError(t, err)
+	assert.Equal(t, photo, data)
+	data, err = archive.Read(stored.Images[0].SHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, photo, data)
+
+	// A photo that stays in a changed gallery keeps its archived copy
+	changed := models.Ads{Title: "Gallery", Reference: "fake", SourceListingID: "gallery"}
+	changed.SetImages([]string{server.URL + "/new.png", server.URL + "/photo.png"})
+	_, saved, err := repositories.UpsertAd(database.DB, &changed)
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.AdUpdated, saved)
+
+	stored, err = repositories.GetAdByID(database.DB, id)
+	assert.NoError(t, err)
+	assert.False(t, stored.Images[0].Archived())
+	assert.Equal(t, hex.EncodeToString(sum[:]), stored.Images[1].SHA256)
+}
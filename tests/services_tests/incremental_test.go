@@ -0,0 +1,37 @@
+package services_tests
+
+import (
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKnownTrackerStopsAfterConsecutiveKnown(t *testing.T) {
+	stored := map[string]bool{"https://divar.ir/v/1": true, "https://divar.ir/v/2": true, "https://divar.ir/v/4": true, "https://divar.ir/v/5": true}
+	ctx := context.WithValue(crawlerTestContext(), "incremental", source.Incremental{
+		Known:     func(url string) bool { return stored[url] },
+		StopAfter: 2,
+	})
+	known := source.NewKnownTracker(ctx)
+
+	// A new listing between known ones resets the run of known listings
+	assert.True(t, known.Known("https://divar.ir/v/1"))
+	assert.False(t, known.Done())
+	assert.False(t, known.Known("https://divar.ir/v/3"))
+	assert.True(t, known.Known("https://divar.ir/v/4"))
+	assert.False(t, known.Done())
+	assert.True(t, known.Known("https://divar.ir/v/5"))
+	assert.True(t, known.Done())
+	assert.Equal(t, 3, known.Skipped())
+}
+
+func TestKnownTrackerFullRun(t *testing.T) {
+	// Without an incremental run nothing is known and the scroller never stops early
+	known := source.NewKnownTracker(crawlerTestContext())
+	assert.Nil(t, known)
+	assert.False(t, known.Known("https://divar.ir/v/1"))
+	assert.False(t, known.Done())
+	assert.Equal(t, 0, known.Skipped())
+}
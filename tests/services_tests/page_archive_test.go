@@ -0,0 +1,80 @@
+package services_tests
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/divar"
+	"Crawlzilla/services/pages"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageArchiveRoundTrip(t *testing.T) {
+	setupCrawlerTestDB(t)
+	dir := t.TempDir()
+	archive := pages.New(pages.Config{Dir: dir, Screenshots: true})
+
+	page := models.RawPage{CrawlRunID: "run-1", Reference: "divar", SourceListingID: "wZ10kKqk", URL: "https://divar.ir/v/apartment-vanak/wZ10kKqk"}
+	assert.NoError(t, archive.Store(database.DB, &page, "<html>listing</html>", []byte("jpeg")))
+	assert.Equal(t, filepath.Join("divar", "run-1", "wZ10kKqk.html.gz"), page.Path)
+	assert.Equal(t, 20, page.Size)
+
+	screenshot, err := os.ReadFile(filepath.Join(dir, page.ScreenshotPath))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("jpeg"), screenshot)
+
+	stored, err := repositories.GetLatestRawPages(database.DB, "divar", "wZ10kKqk")
+	assert.NoError(t, err)
+	assert.Len(t, stored, 1)
+	html, err := archive.Read(stored[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "<html>listing</html>", html)
+
+	// Without a directory nothing is archived
+	disabled := pages.New(pages.Config{})
+	assert.False(t, disabled.Screenshots())
+	assert.NoError(t, disabled.Store(database.DB, &models.RawPage{CrawlRunID: "run-1", Reference: "divar", SourceListingID: "b"}, "<html></html>", nil))
+}
+
+func TestReprocessArchivedPages(t *testing.T) {
+	setupCrawlerTestDB(t)
+	archive := pages.New(pages.Config{Dir: t.TempDir()})
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "divar/apartment_sell.html"))
+	assert.NoError(t, err)
+	pageURL := "https://divar.ir/v/apartment-vanak/wZ10kKqk"
+	page := models.RawPage{CrawlRunID: "run-1", Reference: "divar", SourceListingID: "wZ10kKqk", URL: pageURL}
+	assert.NoError(t, archive.Store(database.DB, &page, string(fixture), nil))
+	broken := models.RawPage{CrawlRunID: "run-1", Reference: "divar", SourceListingID: "broken", URL: "https://divar.ir/v/broken/broken"}
+	assert.NoError(t, archive.Store(database.DB, &broken, "<html></html>", nil))
+
+	// The ad was stored by an older parser, then seen again and removed after the page was archived
+	want, err := divar.ParsePropertyPage(pageURL, string(fixture))
+	assert.NoError(t, err)
+	stale := want
+	stale.Price = want.Price + 1000
+	_, _, err = repositories.UpsertAdSeenAt(database.DB, &stale, page.CreatedAt.Add(time.Hour))
+	assert.NoError(t, err)
+	expiredAt := page.CreatedAt.Add(2 * time.Hour)
+	assert.NoError(t, repositories.UpdateAdStatus(database.DB, stale.ID, models.AdExpired, expiredAt))
+
+	stats, err := crawler.Reprocess(crawlerTestContext(), archive, crawler.Parsers(), "", "run-1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, crawler.ReprocessStats{Pages: 2, Updated: 1, Failed: 1}, stats)
+
+	var stored models.Ads
+	assert.NoError(t, database.DB.First(&stored, "id = ?", stale.ID).Error)
+	assert.Equal(t, want.Price, stored.Price)
+	assert.Equal(t, models.AdExpired, stored.Status)
+	assert.WithinDuration(t, page.CreatedAt.Add(time.Hour), stored.LastSeenAt, time.Second)
+
+	// A disabled archive has nothing to reprocess
+	_, err = crawler.Reprocess(crawlerTestContext(), pages.New(pages.Config{}), crawler.Parsers(), "divar", "", "")
+	assert.Error(t, err)
+}
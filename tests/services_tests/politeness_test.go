@@ -0,0 +1,168 @@
+package services_tests
+
+import (
+	"Crawlzilla/services/crawler/politeness"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolitenessRateLimitsPerHost(t *testing.T) {
+	polite := politeness.New(politeness.Config{Rate: 20, Burst: 2})
+	ctx := crawlerTestContext()
+
+	// The burst goes out at once, the next request waits for a token
+	start := time.Now()
+	assert.NoError(t, polite.Wait(ctx, "https://divar.ir/s/iran"))
+	assert.NoError(t, polite.Wait(ctx, "https://divar.ir/v/1"))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+	assert.NoError(t, polite.Wait(ctx, "https://divar.ir/v/2"))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	// Other hosts have their own bucket
+	start = time.Now()
+	assert.NoError(t, polite.Wait(ctx, "https://www.sheypoor.com/s/iran"))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+
+	// A canceled wait returns the context error
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	polite.Wait(ctx, "https://divar.ir/v/3")
+	assert.ErrorIs(t, polite.Wait(canceled, "https://divar.ir/v/4"), context.Canceled)
+}
+
+// sharedLimiter stands in for the token buckets of Redis shared by crawler processes
+type sharedLimiter struct {
+	mu       sync.Mutex
+	tokens   map[string]float64
+	refilled map[string]time.Time
+	err      error
+}
+
+func (l *sharedLimiter) Reserve(ctx context.Context, host string, rate float64, burst int) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return 0, l.err
+	}
+	tokens, ok := l.tokens[host]
+	if !ok {
+		tokens = float64(burst)
+	} else {
+		tokens = min(float64(burst), tokens+time.Since(l.refilled[host]).Seconds()*rate)
+	}
+	l.refilled[host] = time.Now()
+	if tokens >= 1 {
+		l.tokens[host] = tokens - 1
+		return 0, nil
+	}
+	l.tokens[host] = tokens
+	return time.Duration((1 - tokens) / rate * float64(time.Second)), nil
+}
+
+func TestPolitenessSharesRateLimitBetweenProcesses(t *testing.T) {
+	limiter := &sharedLimiter{tokens: make(map[string]float64), refilled: make(map[string]time.Time)}
+	first := politeness.New(politeness.Config{Rate: 20, Burst: 2, Limiter: limiter})
+	second := politeness.New(politeness.Config{Rate: 20, Burst: 2, Limiter: limiter})
+	ctx := crawlerTestContext()
+
+	// The burst is shared, the request of the second process waits for a token
+	start := time.Now()
+	assert.NoError(t, first.Wait(ctx, "https://divar.ir/v/1"))
+	assert.NoError(t, first.Wait(ctx, "https://divar.ir/v/2"))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+	assert.NoError(t, second.Wait(ctx, "https://divar.ir/v/3"))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	// Without the shared limiter each process falls back to its own bucket
+	limiter.err = errors.New("connection refused")
+	start = time.Now()
+	assert.NoError(t, second.Wait(ctx, "https://divar.ir/v/4"))
+	assert.NoError(t, second.Wait(ctx, "https://divar.ir/v/5"))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestPolitenessBacksOffThrottledHosts(t *testing.T) {
+	polite := politeness.New(politeness.Config{MinBackoff: 20 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	ctx := crawlerTestContext()
+	pageURL := "https://divar.ir/v/1"
+
+	assert.NoError(t, polite.Report(ctx, pageURL, http.StatusOK))
+	assert.ErrorIs(t, polite.Report(ctx, pageURL, http.StatusTooManyRequests), politeness.ErrThrottled)
+	assert.Equal(t, 20*time.Millisecond, polite.State("divar.ir").Backoff)
+	assert.ErrorIs(t, polite.Report(ctx, pageURL, http.StatusBadGateway), politeness.ErrThrottled)
+	assert.Equal(t, 40*time.Millisecond, polite.State("divar.ir").Backoff)
+
+	// Block pages back off too and the backoff is capped
+	err := polite.DetectBlock(ctx, pageURL, "<html><body>Access Denied</body></html>", []string{"Access Denied"})
+	assert.ErrorIs(t, err, politeness.ErrBlocked)
+	state := polite.State("divar.ir")
+	assert.Equal(t, 50*time.Millisecond, state.Backoff)
+	assert.Equal(t, 3, state.Blocks)
+
+	// Requests wait until the backoff is over
+	start := time.Now()
+	assert.NoError(t, polite.Wait(ctx, pageURL))
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+
+	// A good response resets the host
+	assert.NoError(t, polite.DetectBlock(ctx, pageURL, "<html><body>post</body></html>", []string{"Access Denied"}))
+	assert.NoError(t, polite.Report(ctx, pageURL, http.StatusNotFound))
+	assert.Zero(t, polite.State("divar.ir").Backoff)
+	assert.Zero(t, polite.State("divar.ir").Blocks)
+}
+
+func TestPolitenessHonoursRobots(t *testing.T) {
+	robots := strings.Join([]string{
+		"User-agent: *",
+		"Disallow: /private",
+		"Allow: /private/open",
+		"",
+		"User-agent: OtherBot",
+		"User-agent: Crawlzilla",
+		"Disallow: /search$",
+		"Disallow: /*?page=",
+		"Crawl-delay: 0.05",
+	}, "\n")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			requests++
+			fmt.Fprint(w, robots)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	ctx := crawlerTestContext()
+
+	// Our own group applies instead of the * group
+	polite := politeness.New(politeness.Config{Robots: true, UserAgent: "Crawlzilla"})
+	assert.ErrorIs(t, polite.Wait(ctx, server.URL+"/search"), politeness.ErrDisallowed)
+	assert.ErrorIs(t, polite.Wait(ctx, server.URL+"/list?page=2"), politeness.ErrDisallowed)
+	assert.NoError(t, polite.Wait(ctx, server.URL+"/search/tehran"))
+	// Crawl-delay limits the host to a request per delay
+	start := time.Now()
+	assert.NoError(t, polite.Wait(ctx, server.URL+"/private"))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	assert.Equal(t, 1, requests)
+
+	// Other agents fall back to the * group, the longest rule wins
+	other := politeness.New(politeness.Config{Robots: true, UserAgent: "SomeCrawler"})
+	assert.ErrorIs(t, other.Wait(ctx, server.URL+"/private/page"), politeness.ErrDisallowed)
+	assert.NoError(t, other.Wait(ctx, server.URL+"/private/open/page"))
+	assert.NoError(t, other.Wait(ctx, server.URL+"/search"))
+
+	// robots.txt is only read when enabled
+	ignoring := politeness.New(politeness.Config{UserAgent: "Crawlzilla"})
+	assert.NoError(t, ignoring.Wait(ctx, server.URL+"/search"))
+	assert.Equal(t, 2, requests)
+}
@@ -0,0 +1,173 @@
+package services_tests
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/divar"
+	"Crawlzilla/services/crawler/sheypoor"
+	"Crawlzilla/services/search"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeValidator answers status checks from a fixed map, unknown URLs fail
+type fakeValidator struct {
+	fakeSource
+	statuses map[string]models.AdStatus
+}
+
+func (s *fakeValidator) Check(ctx context.Context, ad models.Ads) (models.AdStatus, error) {
+	status, ok := s.statuses[ad.URL]
+	if !ok {
+		return "", errors.New("page not loaded")
+	}
+	return status, nil
+}
+
+func TestRevalidationMarksRemovedListings(t *testing.T) {
+	setupCrawlerTestDB(t)
+	database.DB.AutoMigrate(&models.Filters{})
+	t.Setenv("REVALIDATE_COUNT", "10")
+	t.Setenv("REVALIDATE_AFTER", "24")
+	t.Setenv("MAX_WORKERS", "2")
+
+	urls := []string{"https://example.com/active", "https://example.com/expired", "https://example.com/sold", "https://example.com/broken"}
+	ids := map[string]string{}
+	for _, url := range urls {
+		ad := models.Ads{Title: url, URL: url, City: "City", Reference: "fake", SourceListingID: url}
+		id, _, err := repositories.UpsertAd(database.DB, &ad)
+		assert.NoError(t, err)
+		ids[url] = id
+	}
+	// Checked an hour ago, not due yet
+	recent := models.Ads{Title: "recent", URL: "https://example.com/recent", City: "City", Reference: "fake", SourceListingID: "recent"}
+	recentID, _, err := repositories.UpsertAd(database.DB, &recent)
+	assert.NoError(t, err)
+	assert.NoError(t, repositories.UpdateAdStatus(database.DB, recentID, models.AdActive, time.Now().Add(-time.Hour)))
+
+	validator := &fakeValidator{statuses: map[string]models.AdStatus{
+		"https://example.com/active":  models.AdActive,
+		"https://example.com/expired": models.AdExpired,
+		"https://example.com/sold":    models.AdSold,
+		"https://example.com/recent":  models.AdExpired,
+	}}
+	stats := &crawler.RevalidationStats{}
+	assert.NoError(t, crawler.StartRevalidation(crawlerTestContext(), validator, stats))
+
+	assert.Equal(t, 4, stats.Checked)
+	assert.Equal(t, 1, stats.Active)
+	assert.Equal(t, 1, stats.Expired)
+	assert.Equal(t, 1, stats.Sold)
+	assert.Equal(t, 1, stats.Failed)
+
+	expired, err := repositories.GetAdByID(database.DB, ids["https://example.com/expired"])
+	assert.NoError(t, err)
+	assert.Equal(t, models.AdExpired, expired.Status)
+	assert.False(t, expired.StatusChangedAt.IsZero())
+	assert.False(t, expired.LastCheckedAt.IsZero())
+
+	// A failed check keeps the status but is not retried before it is due again
+	broken, err := repositories.GetAdByID(database.DB, ids["https://example.com/broken"])
+	assert.NoError(t, err)
+	assert.Equal(t, models.AdActive, broken.Status)
+	assert.False(t, broken.LastCheckedAt.IsZero())
+
+	stored, err := repositories.GetAdByID(database.DB, recentID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AdActive, stored.Status)
+
+	// Search hides inactive ads unless the filter asks for them
+	filter := models.Filters{City: "City"}
+	assert.NoError(t, repositories.CreateOrUpdateFilter(database.DB, &filter))
+	result, err := search.GetFilteredAds(database.DB, filter.ID, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, result.Data, 3)
+	for _, ad := range result.Data {
+		assert.Equal(t, models.AdActive, ad.Status)
+	}
+
+	all := models.Filters{City: "City", IncludeInactive: true}
+	assert.NoError(t, repositories.CreateOrUpdateFilter(database.DB, &all))
+	result, err = search.GetFilteredAds(database.DB, all.ID, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, result.Data, 5)
+
+	// A crawl finding the listing again brings it back
+	seenAgain := models.Ads{Title: "https://example.com/sold", URL: "https://example.com/sold", City: "City", Reference: "fake", SourceListingID: "https://example.com/sold"}
+	_, _, err = repositories.UpsertAd(database.DB, &seenAgain)
+	assert.NoError(t, err)
+	sold, err := repositories.GetAdByID(database.DB, ids["https://example.com/sold"])
+	assert.NoError(t, err)
+	assert.Equal(t, models.AdActive, sold.Status)
+}
+
+func TestRevalidationNeedsValidator(t *testing.T) {
+	setupCrawlerTestDB(t)
+
+	err := crawler.StartRevalidation(crawlerTestContext(), &fakeSource{}, &crawler.RevalidationStats{})
+	assert.Error(t, err)
+}
+
+func TestParseListingStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		parse  func(string) (models.AdStatus, error)
+		html   string
+		status models.AdStatus
+	}{
+		{
+			name:   "divar active",
+			parse:  divar.ParseListingStatus,
+			html:   `<article><div class="kt-col-5"><nav><a><button><span>اجاره آپارتمان</span></button></a></nav></div></article>`,
+			status: models.AdActive,
+		},
+		{
+			name:   "divar active with notice text in the description",
+			parse:  divar.ParseListingStatus,
+			html:   `<article><div class="kt-col-5"><nav><a><button><span>فروش آپارتمان</span></button></a></nav><div class="kt-description-row"><p>این آگهی فروخته شده است؟ خیر</p></div></div></article>`,
+			status: models.AdActive,
+		},
+		{
+			name:   "divar expired",
+			parse:  divar.ParseListingStatus,
+			html:   `<div><p>این آگهی حذف شده است</p></div>`,
+			status: models.AdExpired,
+		},
+		{
+			name:   "divar sold",
+			parse:  divar.ParseListingStatus,
+			html:   `<div><p>این آگهی فروخته شده است</p></div>`,
+			status: models.AdSold,
+		},
+		{
+			name:   "sheypoor active",
+			parse:  sheypoor.ParseListingStatus,
+			html:   `<h1 id="listing-title">آپارتمان ۱۰۰ متری</h1>`,
+			status: models.AdActive,
+		},
+		{
+			name:   "sheypoor expired",
+			parse:  sheypoor.ParseListingStatus,
+			html:   `<div><p>این آگهی منقضی شده است</p></div>`,
+			status: models.AdExpired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, err := test.parse(test.html)
+			assert.NoError(t, err)
+			assert.Equal(t, test.status, status)
+		})
+	}
+
+	// A page that is neither a listing nor a notice is not guessed
+	_, err := divar.ParseListingStatus(`<div>captcha</div>`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package services_tests
+
+import (
+	"Crawlzilla/cmd/crawler"
+	"Crawlzilla/database"
+	"Crawlzilla/database/repositories"
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawl_schedules"
+	"Crawlzilla/services/crawl_targets"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingRuns records the runs of a scheduler and keeps them busy until released
+type blockingRuns struct {
+	mu      sync.Mutex
+	started []models.CrawlSchedule
+	release chan struct{}
+}
+
+func (r *blockingRuns) run(ctx context.Context, schedule models.CrawlSchedule) {
+	r.mu.Lock()
+	r.started = append(r.started, schedule)
+	r.mu.Unlock()
+	<-r.release
+}
+
+func (r *blockingRuns) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.started)
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	runs := &blockingRuns{release: make(chan struct{})}
+	scheduler := crawler.NewScheduler(crawlerTestContext(), runs.run, crawler.OverlapSkip)
+
+	divar := models.CrawlSchedule{ID: "1", Reference: "divar"}
+	assert.Equal(t, crawler.RunStarted, scheduler.Trigger(divar))
+	assert.Equal(t, crawler.RunSkipped, scheduler.Trigger(models.CrawlSchedule{ID: "2", Reference: "divar"}))
+	assert.True(t, scheduler.Running("divar"))
+
+	// Other sources crawl at the same time
+	assert.Equal(t, crawler.RunStarted, scheduler.Trigger(models.CrawlSchedule{ID: "3", Reference: "sheypoor"}))
+
+	close(runs.release)
+	scheduler.Stop()
+	assert.Equal(t, 2, runs.count())
+	assert.False(t, scheduler.Running("divar"))
+}
+
+func TestSchedulerQueuesOverlappingRuns(t *testing.T) {
+	runs := &blockingRuns{release: make(chan struct{})}
+	scheduler := crawler.NewScheduler(crawlerTestContext(), runs.run, crawler.OverlapQueue)
+
+	assert.Equal(t, crawler.RunStarted, scheduler.Trigger(models.CrawlSchedule{ID: "1", Reference: "divar"}))
+	assert.Equal(t, crawler.RunQueued, scheduler.Trigger(models.CrawlSchedule{ID: "2", Reference: "divar"}))
+	// A schedule waits in the queue only once
+	assert.Equal(t, crawler.RunQueued, scheduler.Trigger(models.CrawlSchedule{ID: "2", Reference: "divar"}))
+
+	close(runs.release)
+	scheduler.Stop()
+	assert.Equal(t, 2, runs.count())
+	assert.Equal(t, "2", runs.started[1].ID)
+}
+
+func TestSchedulerReloadsSchedules(t *testing.T) {
+	setupCrawlerTestDB(t)
+
+	schedule, err := crawl_schedules.AddSchedule(database.DB, "divar", "", "0 3 * * *")
+	assert.NoError(t, err)
+	paused := models.CrawlSchedule{Reference: "sheypoor", Spec: "@daily", Enabled: false}
+	assert.NoError(t, repositories.CreateCrawlSchedule(database.DB, &paused))
+
+	runs := &blockingRuns{release: make(chan struct{})}
+	scheduler := crawler.NewScheduler(crawlerTestContext(), runs.run, crawler.OverlapSkip)
+	assert.NoError(t, scheduler.Start())
+	defer scheduler.Stop()
+
+	next, ok := scheduler.Next(schedule.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 3, next.Hour())
+	assert.Equal(t, 0, next.Minute())
+	_, ok = scheduler.Next(paused.ID)
+	assert.False(t, ok)
+
+	// Changes are picked up by the next reload
+	_, err = crawl_schedules.UpdateScheduleSpec(database.DB, schedule.ID, "30 5 * * *")
+	assert.NoError(t, err)
+	_, err = crawl_schedules.ToggleSchedule(database.DB, paused.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, scheduler.Reload())
+
+	next, ok = scheduler.Next(schedule.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 5, next.Hour())
+	assert.Equal(t, 30, next.Minute())
+	next, ok = scheduler.Next(paused.ID)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now(), next, 24*time.Hour)
+
+	assert.NoError(t, crawl_schedules.RemoveSchedule(database.DB, schedule.ID))
+	assert.NoError(t, scheduler.Reload())
+	_, ok = scheduler.Next(schedule.ID)
+	assert.False(t, ok)
+}
+
+func TestAddCrawlSchedule(t *testing.T) {
+	setupCrawlerTestDB(t)
+
+	_, err := crawl_schedules.AddSchedule(database.DB, "divar", "", "every day")
+	assert.ErrorIs(t, err, crawl_schedules.ErrInvalidSpec)
+	_, err = crawl_schedules.AddSchedule(database.DB, "bama", "", "@daily")
+	assert.ErrorIs(t, err, crawl_schedules.ErrUnknownSource)
+	_, err = crawl_schedules.AddSchedule(database.DB, "divar", "tehran/buy-apartment", "@daily")
+	assert.ErrorIs(t, err, crawl_schedules.ErrUnknownTarget)
+
+	target, err := crawl_targets.AddTarget(database.DB, "divar", "tehran", "buy-apartment", 0, 0)
+	assert.NoError(t, err)
+	schedule, err := crawl_schedules.AddSchedule(database.DB, "divar", "Tehran/buy-apartment", "@every  6h")
+	assert.NoError(t, err)
+	assert.Equal(t, target.ID, schedule.TargetID)
+	assert.Equal(t, "@every 6h", schedule.Spec)
+
+	// Removing a target removes its schedules
+	assert.NoError(t, crawl_targets.RemoveTarget(database.DB, target.ID))
+	schedules, err := crawl_schedules.GetSchedules(database.DB)
+	assert.NoError(t, err)
+	assert.Empty(t, schedules)
+}
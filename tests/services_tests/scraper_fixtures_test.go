@@ -0,0 +1,75 @@
+package services_tests
+
+import (
+	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/source"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// update rewrites the golden files from the current scraper output:
+// go test ./tests/services_tests/ -run Golden -update
+var update = flag.Bool("update", false, "update scraper golden files")
+
+// goldenIgnoredFields are set by the database, not by the scrapers
+var goldenIgnoredFields = map[string]bool{
+	"ID":         true,
+	"Hash":       true,
+	"CreatedAt":  true,
+	"LastSeenAt": true,
+}
+
+// fixtureLoader replays a saved HTML snapshot instead of loading the page
+func fixtureLoader(t *testing.T, fixture string) source.PageLoader {
+	return func(ctx context.Context, pageURL string) (string, error) {
+		html, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatalf("failed to read fixture %s: %v", fixture, err)
+		}
+		return string(html), nil
+	}
+}
+
+// assertGoldenAds compares every scraped field with the golden file of the fixture
+func assertGoldenAds(t *testing.T, golden string, got models.Ads) {
+	t.Helper()
+	path := filepath.Join("testdata", golden)
+
+	if *update {
+		data, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatalf("failed to marshal golden %s: %v", golden, err)
+		}
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			t.Fatalf("failed to write golden %s: %v", golden, err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden %s: %v", golden, err)
+	}
+	var want models.Ads
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatalf("failed to unmarshal golden %s: %v", golden, err)
+	}
+
+	// Report each broken field separately so a markup change shows exactly what stopped parsing
+	gotValue := reflect.ValueOf(got)
+	wantValue := reflect.ValueOf(want)
+	for i := 0; i < gotValue.NumField(); i++ {
+		field := gotValue.Type().Field(i).Name
+		if goldenIgnoredFields[field] {
+			continue
+		}
+		if !reflect.DeepEqual(gotValue.Field(i).Interface(), wantValue.Field(i).Interface()) {
+			t.Errorf("%s: field %s = %#v, want %#v", golden, field, gotValue.Field(i).Interface(), wantValue.Field(i).Interface())
+		}
+	}
+}
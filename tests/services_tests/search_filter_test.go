@@ -22,7 +22,7 @@ func SetupSearchTestDB() *gorm.DB {
 	}
 
 	// Run AutoMigrate to create the Ads table
-	if err := db.AutoMigrate(&models.Ads{}, &models.Users{}, &models.Filters{}); err != nil {
+	if err := db.AutoMigrate(&models.Ads{}, &models.Users{}, &models.Filters{}, &models.AdRevision{}, &models.AdImage{}); err != nil {
 		panic("failed to migrate database schema")
 	}
 
@@ -121,6 +121,42 @@ func TestGetMostFilteredAdsSuccess(t *testing.T) {
 	assert.Equal(t, 1500, result.Data[0].Price)  // Verify the price of the first ad in the result
 }
 
+// TestGetFilteredAdsAttributes tests the deposit, year built, parking and property type conditions
+func TestGetFilteredAdsAttributes(t *testing.T) {
+	db := SetupSearchTestDB()
+
+	filter := models.Filters{
+		CategoryType: "rent",
+		PropertyType: models.PropertyOffice,
+		MaxDeposit:   500000000,
+		MinYearBuilt: 1390,
+		MinParking:   1,
+		Sort:         "year_built",
+		Order:        "desc",
+	}
+	assert.NoError(t, repositories.CreateOrUpdateFilter(db, &filter))
+
+	ads := []models.Ads{
+		{Title: "Match old", CategoryType: "rent", PropertyType: models.PropertyOffice, Deposit: 300000000, YearBuilt: 1392, ParkingCount: 1},
+		{Title: "Match new", CategoryType: "rent", PropertyType: models.PropertyOffice, Deposit: 500000000, YearBuilt: 1402, ParkingCount: 2},
+		{Title: "Deposit too high", CategoryType: "rent", PropertyType: models.PropertyOffice, Deposit: 900000000, YearBuilt: 1400, ParkingCount: 1},
+		{Title: "Too old", CategoryType: "rent", PropertyType: models.PropertyOffice, Deposit: 100000000, YearBuilt: 1370, ParkingCount: 1},
+		{Title: "No parking", CategoryType: "rent", PropertyType: models.PropertyOffice, Deposit: 100000000, YearBuilt: 1400},
+		{Title: "Shop", CategoryType: "rent", PropertyType: models.PropertyShop, Deposit: 100000000, YearBuilt: 1400, ParkingCount: 1},
+	}
+	for _, ad := range ads {
+		_, err := repositories.CreateAd(db, &ad)
+		assert.NoError(t, err)
+	}
+
+	result, err := search.GetFilteredAds(db, filter.ID, 1, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, result.Data, 2) {
+		assert.Equal(t, "Match new", result.Data[0].Title)
+		assert.Equal(t, "Match old", result.Data[1].Title)
+	}
+}
+
 // TestGetFilteredAdsError tests the error case for GetFilteredAds.
 func TestGetFilteredAdsError(t *testing.T) {
 	// Set up in-memory database
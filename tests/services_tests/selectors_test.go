@@ -0,0 +1,83 @@
+package services_tests
+
+import (
+	"Crawlzilla/services/crawler/selectors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSelectors = `{
+	"version": "test-1",
+	"fields": {"title": [".missing-title", "h1"]},
+	"labels": {"yes": ["دارد"]}
+}`
+
+func TestSelectorsFallback(t *testing.T) {
+	t.Setenv("SELECTORS_DIR", "")
+	registry := selectors.NewRegistry("test", []byte(testSelectors), "title")
+	spec := registry.Get()
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body><h1> title </h1></body></html>`))
+	assert.NoError(t, err)
+
+	// The first selector matches nothing, so the second one is used
+	title, err := spec.Text(doc.Selection, "title")
+	assert.NoError(t, err)
+	assert.Equal(t, "title", title)
+
+	assert.True(t, spec.Is("yes", " دارد "))
+	assert.False(t, spec.Is("yes", "ندارد"))
+}
+
+func TestSelectorsReloadFromDirectory(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SELECTORS_DIR", dir)
+	registry := selectors.NewRegistry("test", []byte(testSelectors), "title")
+
+	// Without a file the embedded defaults are used
+	assert.Equal(t, "test-1", registry.Get().Version)
+
+	path := filepath.Join(dir, "test.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "test-2", "fields": {"title": ["h2"]}}`), 0o644))
+	assert.Equal(t, "test-2", registry.Get().Version)
+	assert.Equal(t, "h2", registry.Get().Selector("title"))
+	// The file has no labels, the embedded ones are kept
+	assert.True(t, registry.Get().Is("yes", "دارد"))
+
+	// A broken file keeps the last valid spec
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "test-3", "fields": {"title": []}}`), 0o644))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	assert.Equal(t, "test-2", registry.Get().Version)
+
+	// So does a label without texts
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "test-4", "labels": {"yes": []}}`), 0o644))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	assert.Equal(t, "test-2", registry.Get().Version)
+}
+
+func TestSelectorsFallBackWhenOverrideIsRemoved(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SELECTORS_DIR", dir)
+	registry := selectors.NewRegistry("test", []byte(testSelectors), "title")
+
+	path := filepath.Join(dir, "test.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "test-2", "fields": {"title": ["h2"]}}`), 0o644))
+	assert.Equal(t, "h2", registry.Get().Selector("title"))
+
+	// Deleting the file brings back the embedded defaults without a restart
+	assert.NoError(t, os.Remove(path))
+	assert.Equal(t, "test-1", registry.Get().Version)
+	assert.Equal(t, ".missing-title", registry.Get().Selector("title"))
+
+	// A new file is picked up again
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "test-3", "fields": {"title": ["h3"]}}`), 0o644))
+	assert.Equal(t, "test-3", registry.Reload().Version)
+	assert.NoError(t, os.Remove(path))
+	assert.Equal(t, "test-1", registry.Reload().Version)
+}
@@ -0,0 +1,63 @@
+package services_tests
+
+import (
+	"Crawlzilla/services/crawler/fetch"
+	"Crawlzilla/services/crawler/sheypoor"
+	"Crawlzilla/services/crawler/source"
+	"Crawlzilla/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSheypoorScraperGolden(t *testing.T) {
+	tests := []struct {
+		fixture string
+		golden  string
+		job     source.Job
+		age     int // Building age shown on the page, -1 when it has none
+	}{
+		{
+			"sheypoor/apartment_sale.html", "sheypoor/apartment_sale.golden.json",
+			source.Job{URL: "https://www.sheypoor.com/v/apartment-saadat-abad-438412345.html", Category: "houses-apartments-for-sale"},
+			5,
+		},
+		{
+			"sheypoor/apartment_rent.html", "sheypoor/apartment_rent.golden.json",
+			source.Job{URL: "https://www.sheypoor.com/v/apartment-isfahan-438498765.html", Category: "house-apartment-for-rent"},
+			-1,
+		},
+		{
+			"sheypoor/shop_rent.html", "sheypoor/shop_rent.golden.json",
+			source.Job{URL: "https://www.sheypoor.com/v/shop-isfahan-438476543.html", Category: "commercial-property-for-rent"},
+			0,
+		},
+	}
+
+	src := sheypoor.NewSource()
+	src.Fetch = fetch.Config{Mode: fetch.ModeChrome}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			src.Loader = fixtureLoader(t, test.fixture)
+			result, err := src.Scrap(context.Background(), test.job)
+			assert.NoError(t, err)
+
+			// Sheypoor shows the building age, the year built depends on today so it is checked here
+			if test.age >= 0 {
+				assert.Equal(t, utils.YearBuiltFromAge(test.age, time.Now()), result.YearBuilt)
+			} else {
+				assert.Zero(t, result.YearBuilt)
+			}
+			assert.Equal(t, test.age >= 0, result.AgeBasedYear)
+			result.YearBuilt, result.AgeBasedYear = 0, false
+			assertGoldenAds(t, test.golden, result)
+		})
+	}
+}
+
+func TestSheypoorScraperUnknownCategory(t *testing.T) {
+	_, err := sheypoor.ParseAdPage(source.Job{URL: "https://www.sheypoor.com/v/car-1.html", Category: "cars"}, "<html></html>")
+	assert.Error(t, err)
+}
@@ -22,7 +22,7 @@ func SetupTestDB() *gorm.DB {
 	}
 
 	// Automatically migrate the schema (create tables)
-	if err := db.AutoMigrate(&models.Ads{}); err != nil {
+	if err := db.AutoMigrate(&models.Ads{}, &models.AdImage{}); err != nil {
 		panic("failed to migrate database schema")
 	}
 
@@ -139,18 +139,38 @@ func TestCreateAd(t *testing.T) {
 				Latitude:      45.0,
 				Longitude:     90.0,
 				CategoryType:  "فروش",      // Persian for "sell"
-				PropertyType:  "آپارتمانی", // Persian for "house"
+				PropertyType:  "آپارتمانی", // Persian for "apartment"
 				ContactNumber: "09123456789",
 			},
 			expectErr: false,
 			validate: func(t *testing.T, ad *models.Ads) {
 				assert.Equal(t, "Valid Title", ad.Title)
 				assert.Equal(t, "sell", ad.CategoryType)
-				assert.Equal(t, "house", ad.PropertyType)
+				assert.Equal(t, models.PropertyApartment, ad.PropertyType)
 				assert.Contains(t, ad.URL, "super-admin-")
 				assert.NotEmpty(t, ad.LocationURL)
 			},
 		},
+		{
+			name: "Valid Rent Ad Data",
+			inputAd: &models.Ads{
+				Title:         "Valid Rent Title",
+				Price:         100,
+				Rent:          10,
+				Latitude:      45.0,
+				Longitude:     90.0,
+				CategoryType:  "رهن اجاره",
+				PropertyType:  "مغازه",
+				ContactNumber: "09123456789",
+			},
+			expectErr: false,
+			validate: func(t *testing.T, ad *models.Ads) {
+				assert.Equal(t, "rent", ad.CategoryType)
+				assert.Equal(t, models.PropertyShop, ad.PropertyType)
+				assert.Equal(t, 0, ad.Price)
+				assert.Equal(t, 100, ad.Deposit)
+			},
+		},
 		{
 			name: "Invalid Ad Data - Empty Title",
 			inputAd: &models.Ads{
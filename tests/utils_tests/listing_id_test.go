@@ -0,0 +1,26 @@
+package tests
+
+import (
+	"Crawlzilla/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractSourceListingID(t *testing.T) {
+	tests := []struct {
+		reference string
+		url       string
+		expected  string
+	}{
+		{"divar", "https://divar.ir/v/apartment-vanak/wZ10kKqk", "wZ10kKqk"},
+		{"divar", "https://divar.ir/v/%D8%A2%D9%BE%D8%A7%D8%B1%D8%AA%D9%85%D8%A7%D9%86/gYk2pLm4?utm=1", "gYk2pLm4"},
+		{"divar", "https://divar.ir/s/tehran/real-estate", ""},
+		{"sheypoor", "https://www.sheypoor.com/v/apartment-isfahan-438498765.html", "438498765"},
+		{"admin", "super-admin-12345", ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, utils.ExtractSourceListingID(test.reference, test.url), test.url)
+	}
+}
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"Crawlzilla/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSolarYear(t *testing.T) {
+	assert.Equal(t, 1402, utils.SolarYear(time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 1403, utils.SolarYear(time.Date(2024, time.March, 21, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 1405, utils.SolarYear(time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestExtractNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+		hasError bool
+	}{
+		{"۱۴۰۰", 1400, false},
+		{"قبل از ۱۳۷۰", 1370, false},
+		{"۵ سال", 5, false},
+		{"بیش از 20 سال", 20, false},
+		{"نوساز", 0, true},
+	}
+
+	for _, test := range tests {
+		result, err := utils.ExtractNumber(test.input)
+		if test.hasError {
+			assert.Error(t, err, test.input)
+			continue
+		}
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.expected, result, test.input)
+	}
+}
+
+func TestYearBuiltFromAge(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 1400, utils.YearBuiltFromAge(5, now))
+	assert.Equal(t, 1405, utils.YearBuiltFromAge(0, now))
+}
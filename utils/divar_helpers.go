@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ExtractDivarToken returns the post token of a divar URL like https://divar.ir/v/<slug>/<token>
+func ExtractDivarToken(adURL string) string {
+	parsedURL, err := url.Parse(adURL)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v" {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+// ExtractSourceListingID returns the ID of a listing on its site, or "" when the URL has none
+func ExtractSourceListingID(reference string, adURL string) string {
+	switch reference {
+	case "divar":
+		return ExtractDivarToken(adURL)
+	case "sheypoor":
+		return ExtractListingID(adURL)
+	}
+	return ""
+}
@@ -9,7 +9,26 @@ import (
 	"github.com/shirou/gopsutil/process"
 )
 
-func MeasureExecutionStats(task func()) string {
+// ExecutionStats holds the time and resources a task used
+type ExecutionStats struct {
+	StartTime   time.Time
+	EndTime     time.Time
+	CPUPercent  float64
+	AllocatedMB uint64 // Memory allocated while the task ran
+	InUseMB     uint64 // Heap in use when the task ended
+}
+
+// Elapsed returns how long the task ran
+func (s ExecutionStats) Elapsed() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+func (s ExecutionStats) String() string {
+	return fmt.Sprintf("Elapsed time: %v\nCPU usage by process: %.2f%%\nMemory allocated during computation: %v MB\nMemory in use at the end: %v MB\n", s.Elapsed(), s.CPUPercent, s.AllocatedMB, s.InUseMB)
+}
+
+// MeasureExecution runs task and measures its time, CPU and memory usage
+func MeasureExecution(task func()) ExecutionStats {
 	// Get process details
 	pid := int32(os.Getpid())
 	proc, _ := process.NewProcess(pid)
@@ -31,9 +50,21 @@ func MeasureExecutionStats(task func()) string {
 	endTime := time.Now()
 
 	// Measure CPU at the end
-	cpuUsage, _ := proc.CPUPercent()
+	var cpuUsage float64
+	if proc != nil {
+		cpuUsage, _ = proc.CPUPercent()
+	}
 
-	// Results
+	return ExecutionStats{
+		StartTime:   startTime,
+		EndTime:     endTime,
+		CPUPercent:  cpuUsage,
+		AllocatedMB: (memEnd.TotalAlloc - memStart.TotalAlloc) / (1024 * 1024),
+		InUseMB:     memEnd.HeapAlloc / (1024 * 1024),
+	}
+}
 
-	return fmt.Sprintf("Elapsed time: %v\nCPU usage by process: %.2f%%\nMemory allocated during computation: %v MB\nMemory in use at the end: %v MB\n", endTime.Sub(startTime), cpuUsage, (memEnd.TotalAlloc-memStart.TotalAlloc)/(1024*1024), memEnd.HeapAlloc/(1024*1024))
+// MeasureExecutionStats runs task and returns its time, CPU and memory usage as text
+func MeasureExecutionStats(task func()) string {
+	return MeasureExecution(task).String()
 }
@@ -2,12 +2,19 @@ package utils
 
 import (
 	"Crawlzilla/models"
+	"Crawlzilla/services/crawler/browser"
+	"Crawlzilla/services/crawler/selectors"
 	"context"
+	"errors"
 	"fmt"
+	"html"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
@@ -18,62 +25,60 @@ type AttributeData struct {
 	Value string
 }
 
-// Helper function to convert Go slice of titles to JavaScript array syntax
-func TitlesToJSArray(titles []string) string {
-	jsArray := "["
-	for i, title := range titles {
-		jsArray += `"` + title + `"`
-		if i < len(titles)-1 {
-			jsArray += ", "
-		}
-	}
-	jsArray += "]"
-	return jsArray
-}
-
-func MapAttributesToCrawlResult(attributes []AttributeData) models.Ads {
+// MapAttributesToCrawlResult fills an ad from the attributes of its page, seenAt is when the page was loaded
+func MapAttributesToCrawlResult(spec *selectors.Spec, attributes []AttributeData, seenAt time.Time) models.Ads {
 	var result models.Ads
 	for _, attr := range attributes {
-		switch attr.Title {
-		case "متراژ":
-			result.Area = parseInt(attr.Value)
-		case "تعداد اتاق":
-			result.Room = parseInt(attr.Value)
-		case "پارکینگ":
-			result.HasParking = parseBool(attr.Value)
-		case "انباری":
-			result.HasStorage = parseBool(attr.Value)
-		case "بالکن":
-			// Assuming a similar bool mapping for balcony (not included in CrawlResult, so consider adding if needed)
-		// case "سن بنا":
-		// 	if age, err := extractAge(attr.Value); err == nil {
-		// 		result.BuildingAgeValue = age
-		// 	} else {
-		// 		result.BuildingAgeType = attr.Value
-		// 	}
-		case "رهن":
-			result.Price = parseInt(attr.Value)
-		case "اجاره":
-			result.Rent = parseInt(attr.Value)
-		case "نوع ملک":
-			if attr.Value == "آپارتمان" {
-				result.PropertyType = "house"
+		switch {
+		case spec.Is("area", attr.Title):
+			result.Area = parseInt(spec, attr.Value)
+		case spec.Is("room", attr.Title):
+			result.Room = parseInt(spec, attr.Value)
+		case spec.Is("parking", attr.Title):
+			// Parking is either "دارد"/"ندارد" or the number of spots
+			if count, err := ExtractNumber(attr.Value); err == nil {
+				result.ParkingCount = count
+				result.HasParking = count > 0
 			} else {
-
-				result.PropertyType = "vila"
+				result.HasParking = parseBool(spec, attr.Value)
+			}
+		case spec.Is("parking_count", attr.Title):
+			result.ParkingCount = parseInt(spec, attr.Value)
+			result.HasParking = result.ParkingCount > 0
+		case spec.Is("storage", attr.Title):
+			result.HasStorage = parseBool(spec, attr.Value)
+		case spec.Is("balcony", attr.Title):
+			result.HasBalcony = parseBool(spec, attr.Value)
+		case spec.Is("building_age", attr.Title):
+			result.YearBuilt = parseYearBuilt(spec, attr.Value, seenAt)
+			result.AgeBasedYear = result.YearBuilt != 0
+		case spec.Is("deposit", attr.Title):
+			result.Deposit = parseInt(spec, attr.Value)
+		case spec.Is("rent", attr.Title):
+			result.Rent = parseInt(spec, attr.Value)
+		case spec.Is("property_type", attr.Title):
+			for _, propertyType := range models.PropertyTypes {
+				if spec.Is(propertyType, attr.Value) {
+					result.PropertyType = propertyType
+					break
+				}
 			}
-		case "آسانسور":
-			result.HasElevator = parseBool(attr.Value)
+		case spec.Is("elevator", attr.Title):
+			result.HasElevator = parseBool(spec, attr.Value)
 		}
 	}
+	// A listing with parking has at least one spot when the count is not shown
+	if result.HasParking && result.ParkingCount == 0 {
+		result.ParkingCount = 1
+	}
 
 	return result
 }
 
 // Updated parseInt using ConvertPersianNumber
-func parseInt(value string) int {
+func parseInt(spec *selectors.Spec, value string) int {
 	// Remove "تومان" if present
-	cleanedValue := strings.ReplaceAll(value, "تومان", "")
+	cleanedValue := strings.ReplaceAll(value, spec.Label("currency"), "")
 	cleanedValue = strings.TrimSpace(cleanedValue)
 
 	// Convert Persian number to an integer
@@ -85,84 +90,61 @@ func parseInt(value string) int {
 }
 
 // Helper function to parse boolean values based on Persian terms
-func parseBool(value string) bool {
+func parseBool(spec *selectors.Spec, value string) bool {
 	// "دارد" means true, "ندارد" means false
-	return strings.TrimSpace(value) == "دارد"
+	return spec.Is("yes", value)
 }
 
-// func extractAge(persianNum string) (int, error) {
-// 	// Define a map for Persian to English digit conversion
-// 	persianToEnglish := map[rune]rune{
-// 		'۰': '0', '۱': '1', '۲': '2', '۳': '3', '۴': '4',
-// 		'۵': '5', '۶': '6', '۷': '7', '۸': '8', '۹': '9',
-// 	}
-
-// 	// Convert Persian digits to English digits, ignoring any non-numeric characters
-// 	var englishNum strings.Builder
-// 	for _, r := range persianNum {
-// 		// Skip non-Persian and non-numeric characters
-// 		if englishDigit, exists := persianToEnglish[r]; exists {
-// 			englishNum.WriteRune(englishDigit)
-// 		}
-// 	}
-
-// 	// Convert the result to an integer
-// 	return strconv.Atoi(englishNum.String())
-// }
+// parseYearBuilt converts a building age like "۵ سال" or "نوساز" on a page loaded at seenAt to the Solar Hijri year it was built in
+func parseYearBuilt(spec *selectors.Spec, value string, seenAt time.Time) int {
+	if spec.Contains("new_building", value) {
+		return YearBuiltFromAge(0, seenAt)
+	}
+	age, err := ExtractNumber(value)
+	if err != nil {
+		return 0
+	}
+	return YearBuiltFromAge(age, seenAt)
+}
 
-// ExtractVillaForSale extracts specific attributes for the "villa-for-sale" category
-func ExtractVillaForSale(ctx context.Context) (models.Ads, error) {
-	attrs := []string{"متراژ", "تعداد اتاق", "پارکینگ", "انباری", "بالکن", "سن بنا", "رهن", "اجاره", "نوع ملک", "آسانسور"}
+// ExtractAttributes extracts the attributes listed on an ad page loaded at seenAt
+func ExtractAttributes(spec *selectors.Spec, doc *goquery.Document, seenAt time.Time) (models.Ads, error) {
+	attrs := []string{"area", "room", "parking", "parking_count", "storage", "balcony", "building_age", "deposit", "rent", "property_type", "elevator"}
 	var attributes []AttributeData
 
-	err := chromedp.Run(ctx,
-		chromedp.EvaluateAsDevTools(`
-			((titles) => {
-				let results = [];
-				let elements = document.querySelectorAll('div');
-				for (let elem of elements) {
-					let siblingElems = Array.from(elem.querySelectorAll('p'));
-					if (siblingElems.length === 2) {
-						let [titleElem, valueElem] = siblingElems;
-						if (titles.includes(titleElem.innerText.trim())) {
-							results.push({
-								title: titleElem.innerText.trim(),
-								value: valueElem.innerText.trim()
-							});
-						}
-					}
-				}
-				return results;
-			})(`+TitlesToJSArray(attrs)+`)`, &attributes),
-	)
-	return MapAttributesToCrawlResult(attributes), err
+	// Attributes are rendered as a div holding a title and a value paragraph
+	spec.Find(doc.Selection, "attribute").Each(func(i int, elem *goquery.Selection) {
+		siblingElems := spec.Find(elem, "attribute_text")
+		if siblingElems.Length() != 2 {
+			return
+		}
+		title := strings.TrimSpace(siblingElems.Eq(0).Text())
+		if slices.ContainsFunc(attrs, func(attr string) bool { return spec.Is(attr, title) }) {
+			attributes = append(attributes, AttributeData{
+				Title: title,
+				Value: strings.TrimSpace(siblingElems.Eq(1).Text()),
+			})
+		}
+	})
+	return MapAttributesToCrawlResult(spec, attributes, seenAt), nil
 }
-func ExtractPrice(ctx context.Context) (int, error) {
+
+func ExtractPrice(spec *selectors.Spec, doc *goquery.Document) (int, error) {
 	var priceText string
-	err := chromedp.Run(ctx,
-		chromedp.EvaluateAsDevTools(`
-			(() => {
-				// Find the svg element with the specific path
-				const svg = document.querySelector('svg path[d="M5.422 18.114c-.528 0-.977-.11-1.347-.33a2.127 2.127 0 0 1-.814-.92A3.185 3.185 0 0 1 3 15.545v-4.893h1.727v4.893c0 .198.01.337.033.418.029.073.087.12.173.142.095.022.257.033.49.033h.542l.065 1.02-.065.955h-.543Z"]');
-				
-				if (!svg) return ""; // If SVG not found, return empty string
-				
-				// Traverse up the DOM tree until a strong tag is found
-				let parent = svg.closest("span"); // start from closest span parent
-				while (parent) {
-					const strongTag = parent.querySelector("strong");
-					if (strongTag && strongTag.innerText) {
-						return strongTag.innerText.trim(); // Return the price text
-					}
-					parent = parent.parentElement; // Go to the next parent element
-				}
-				return ""; // Return empty if no strong tag with price is found
-			})()
-		`, &priceText),
-	)
-	if err != nil {
-		return 0, err
+
+	// Find the svg element of the toman icon rendered next to the price
+	svg := spec.Find(doc.Selection, "price_icon").First()
+	if svg.Length() > 0 {
+		// Traverse up the DOM tree until a strong tag is found
+		for parent := svg.Closest("span"); parent.Length() > 0; parent = parent.Parent() {
+			strongTag := spec.Find(parent, "price_value").First()
+			if text := strings.TrimSpace(strongTag.Text()); text != "" {
+				priceText = text
+				break
+			}
+		}
 	}
+
 	// Convert the extracted Persian price text to an integer
 	price, err := ConvertPersianNumber(priceText)
 	if err != nil {
@@ -170,29 +152,17 @@ func ExtractPrice(ctx context.Context) (int, error) {
 	}
 	return price, nil
 }
-func ExtractCityAndDistrict(ctx context.Context) (city, district string, err error) {
-	var result []string
-	err = chromedp.Run(ctx,
-		chromedp.EvaluateAsDevTools(`
-			(() => {
-				const container = document.querySelector("#imooo");
-				if (!container) return [];
-				const links = container.querySelectorAll("li > a");
-				const names = Array.from(links).map(link => link.innerText.trim());
-				return [names[1], names.length > 4 ? names[names.length - 1] : ""];
-			})()
-		`, &result),
-	)
+func ExtractCityAndDistrict(spec *selectors.Spec, doc *goquery.Document) (city, district string, err error) {
+	var names []string
+	spec.Find(doc.Selection, "breadcrumbs").Each(func(i int, link *goquery.Selection) {
+		names = append(names, strings.TrimSpace(link.Text()))
+	})
 
-	if err != nil {
-		return "", "", err
+	if len(names) > 1 {
+		city = names[1]
 	}
-
-	if len(result) > 0 {
-		city = result[0]
-	}
-	if len(result) > 1 {
-		district = result[1]
+	if len(names) > 4 {
+		district = names[len(names)-1]
 	}
 	return city, district, nil
 }
@@ -229,68 +199,58 @@ func ExtractPhoneNumber(ctx context.Context, adURL string) (string, error) {
 	err := chromedp.Run(ctx,
 		network.Enable(),
 		setCookie("refresh_token", refreshToken),
-		chromedp.Navigate(apiURL),
-		chromedp.Text("body", &responseText, chromedp.ByQuery),
 	)
 	if err != nil {
 		return "", fmt.Errorf("failed to set cookies and navigate to API: %v", err)
 	}
+	if err := browser.Navigate(ctx, apiURL); err != nil {
+		return "", fmt.Errorf("failed to set cookies and navigate to API: %v", err)
+	}
+	if err := chromedp.Run(ctx, chromedp.Text("body", &responseText, chromedp.ByQuery)); err != nil {
+		return "", fmt.Errorf("failed to set cookies and navigate to API: %v", err)
+	}
 
 	return responseText, nil
 }
 
 // ExtractTitle extracts the listing title from the page
-func ExtractTitle(ctx context.Context) (string, error) {
-	var title string
-	err := chromedp.Run(ctx,
-		chromedp.WaitVisible(`#listing-title`, chromedp.ByID),
-		chromedp.Evaluate(`document.querySelector('#listing-title')?.innerText`, &title),
-	)
-	return title, err
-}
-
-// ExtractImageURL extracts a single image URL from the ad page
-func ExtractImageURL(ctx context.Context) (string, error) {
-	var url string
-	err := chromedp.Run(ctx,
-		chromedp.EvaluateAsDevTools(`
-            (() => {
-                const img = document.querySelector('.swiper .swiper-slide img');
-                return img && img.src ? img.src : "";
-            })()
-        `, &url),
-	)
+func ExtractTitle(spec *selectors.Spec, doc *goquery.Document) (string, error) {
+	title, err := spec.Text(doc.Selection, "title")
 	if err != nil {
-		return "", err
+		return "", errors.New("listing title not found")
 	}
-	return url, nil
+	return title, nil
 }
-func ExtractDescription(ctx context.Context) (string, error) {
+
+// ExtractImageURLs extracts the URLs of every gallery image of the ad page in order
+func ExtractImageURLs(spec *selectors.Spec, doc *goquery.Document) []string {
+	var urls []string
+	spec.Find(doc.Selection, "image").Each(func(i int, img *goquery.Selection) {
+		if src, exists := img.Attr("src"); exists && src != "" {
+			urls = append(urls, src)
+		}
+	})
+	return urls
+}
+
+func ExtractDescription(spec *selectors.Spec, doc *goquery.Document) (string, error) {
 	var descriptionHTML string
 
-	// Run JavaScript in the browser context to find and retrieve the description HTML
-	err := chromedp.Run(ctx,
-		chromedp.EvaluateAsDevTools(`
-			(() => {
-				const descriptionDivs = document.querySelectorAll("div");
-				for (let i = 0; i < descriptionDivs.length; i++) {
-					if (descriptionDivs[i].innerText.trim() === "توضیحات:") {
-						const nextDiv = descriptionDivs[i].nextElementSibling;
-						if (nextDiv) {
-							return nextDiv.innerHTML; // Return the HTML of the following div
-						}
-					}
-				}
-				return ""; // Return an empty string if no match is found
-			})()
-		`, &descriptionHTML),
-	)
-	if err != nil {
-		return "", err
-	}
+	// Find the div titled "توضیحات:" and retrieve the HTML of the following div
+	spec.Find(doc.Selection, "description_block").EachWithBreak(func(i int, div *goquery.Selection) bool {
+		if !spec.Is("description_title", div.Text()) {
+			return true
+		}
+		if nextDiv := div.Next(); nextDiv.Length() > 0 {
+			descriptionHTML, _ = nextDiv.Html()
+			return false
+		}
+		return true
+	})
 
 	// Replace <br> tags with newline characters
 	description := strings.ReplaceAll(descriptionHTML, "<br>", "\n")
+	description = strings.ReplaceAll(description, "<br/>", "\n")
 
 	// Use a regular expression to remove <span> tags and their content
 	re := regexp.MustCompile(`<span[^>]*>.*?</span>`)
@@ -299,7 +259,7 @@ func ExtractDescription(ctx context.Context) (string, error) {
 	// Remove any remaining HTML tags (if needed)
 	description = removeAllHTMLTags(description)
 
-	return strings.TrimSpace(description), nil
+	return strings.TrimSpace(html.UnescapeString(description)), nil
 }
 
 // Helper function to remove all HTML tags, except for <br> tags which have already been replaced
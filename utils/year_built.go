@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SolarYear returns the Solar Hijri year of t, the calendar the listing sites use
+func SolarYear(t time.Time) int {
+	// The Solar Hijri year starts at Nowruz, around March 21
+	if t.Month() > time.March || (t.Month() == time.March && t.Day() >= 21) {
+		return t.Year() - 621
+	}
+	return t.Year() - 622
+}
+
+// ExtractNumber converts the digits of a text like "قبل از ۱۳۷۰" or "۵ سال" to an integer, ignoring the words around them
+func ExtractNumber(text string) (int, error) {
+	// Define a map for Persian to English digit conversion
+	persianToEnglish := map[rune]rune{
+		'۰': '0', '۱': '1', '۲': '2', '۳': '3', '۴': '4',
+		'۵': '5', '۶': '6', '۷': '7', '۸': '8', '۹': '9',
+	}
+
+	var englishNum strings.Builder
+	for _, r := range text {
+		if englishDigit, exists := persianToEnglish[r]; exists {
+			englishNum.WriteRune(englishDigit)
+		} else if r >= '0' && r <= '9' {
+			englishNum.WriteRune(r)
+		}
+	}
+	if englishNum.Len() == 0 {
+		return 0, errors.New("no number found in " + text)
+	}
+	return strconv.Atoi(englishNum.String())
+}
+
+// YearBuiltFromAge converts a building age in years to the Solar Hijri year it was built in
+func YearBuiltFromAge(age int, now time.Time) int {
+	return SolarYear(now) - age
+}